@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionSummary describes a stored session without its messages
+type SessionSummary struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ForkedFrom string    `json:"forkedFrom,omitempty"`
+	Messages   int       `json:"messages"`
+	ToolCalls  int       `json:"toolCalls"`
+	Usage      Usage     `json:"usage"`
+}
+
+// sessionLister is implemented by session stores that can enumerate their sessions
+type sessionLister interface {
+	List() []*Session
+}
+
+// Sessions summarizes the agent's sessions, newest first. ok is false when the session
+// store can't list them.
+func (a *InlineAgent) Sessions() (summaries []SessionSummary, ok bool) {
+	lister, ok := a.store.(sessionLister)
+	if !ok {
+		return nil, false
+	}
+	for _, session := range lister.List() {
+		session.mu.Lock()
+		summaries = append(summaries, SessionSummary{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			ForkedFrom: session.ForkedFrom,
+			Messages:   len(session.messages),
+			ToolCalls:  len(session.toolCalls),
+			Usage:      session.usage,
+		})
+		session.mu.Unlock()
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].CreatedAt.After(summaries[j].CreatedAt) })
+	return summaries, true
+}
+
+// gatewayDrain counts the requests in flight and, once draining, turns new ones away so
+// the instance can be taken out of service without cutting requests off. Health, metrics
+// and admin requests are always served.
+type gatewayDrain struct {
+	draining atomic.Bool
+	inFlight atomic.Int64
+	since    atomic.Int64
+
+	mu      sync.Mutex
+	onDrain []func()
+}
+
+// OnDrain registers fn to run, in the background, when draining starts, e.g. to stop
+// another listener
+func (d *gatewayDrain) OnDrain(fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onDrain = append(d.onDrain, fn)
+}
+
+// start begins draining; it returns false when the instance is already draining
+func (d *gatewayDrain) start() bool {
+	if !d.draining.CompareAndSwap(false, true) {
+		return false
+	}
+	d.since.Store(time.Now().UnixNano())
+	log.Printf("Draining with %d requests in flight", d.inFlight.Load())
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, fn := range d.onDrain {
+		go fn()
+	}
+	return true
+}
+
+// Draining reports whether the instance is turning new requests away
+func (d *gatewayDrain) Draining() bool {
+	return d.draining.Load()
+}
+
+func (d *gatewayDrain) status() map[string]interface{} {
+	status := map[string]interface{}{
+		"draining": d.Draining(),
+		"inFlight": d.inFlight.Load(),
+	}
+	if d.Draining() {
+		status["since"] = time.Unix(0, d.since.Load())
+		status["drained"] = d.inFlight.Load() == 0
+	}
+	return status
+}
+
+// wrap serves next, rejecting requests with 503 while draining. WebSocket connections count
+// as in flight until they close.
+func (d *gatewayDrain) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/healthz", r.URL.Path == "/readyz", r.URL.Path == "/metrics", strings.HasPrefix(r.URL.Path, "/admin/"):
+			next.ServeHTTP(w, r)
+			return
+		case d.Draining():
+			w.Header().Set("Connection", "close")
+			http.Error(w, "instance is draining", http.StatusServiceUnavailable)
+			return
+		}
+
+		d.inFlight.Add(1)
+		defer func() {
+			if d.inFlight.Add(-1) == 0 && d.Draining() {
+				log.Printf("Drained: no requests in flight")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminAPI serves the /admin/ endpoints for inspecting and controlling a running gateway.
+// Every request must carry the admin token as a bearer token.
+type adminAPI struct {
+	token   string
+	handler *BedrockToolHandler
+	// agent is the gateway agent, or nil when it isn't enabled
+	agent *InlineAgent
+	drain *gatewayDrain
+}
+
+// newAdminHandler returns the handler for /admin/
+func newAdminHandler(token string, handler *BedrockToolHandler, agent *InlineAgent, drain *gatewayDrain) http.Handler {
+	api := &adminAPI{token: token, handler: handler, agent: agent, drain: drain}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/servers", api.servers)
+	mux.HandleFunc("GET /admin/sessions", api.sessions)
+	mux.HandleFunc("POST /admin/tools/refresh", api.refreshTools)
+	mux.HandleFunc("POST /admin/servers/trip", api.trip)
+	mux.HandleFunc("POST /admin/servers/reset", api.reset)
+	mux.HandleFunc("GET /admin/drain", api.drainStatus)
+	mux.HandleFunc("POST /admin/drain", api.startDrain)
+	mux.HandleFunc("GET /admin/analytics/tools", api.toolAnalytics)
+	return api.authorize(mux)
+}
+
+func (api *adminAPI) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// servers lists the MCP server with its handshake, capabilities, tools, stats and SLO state
+func (api *adminAPI) servers(w http.ResponseWriter, r *http.Request) {
+	client := api.handler.mcpClient
+	server := map[string]interface{}{
+		"server":    client.BaseURL(),
+		"ready":     api.handler.Ready(),
+		"startup":   api.handler.startup.Servers(),
+		"stream":    client.SSEStats(),
+		"violating": api.handler.Stats.Violating(client.BaseURL()),
+	}
+	if capabilities, ok := client.Capabilities(); ok {
+		server["capabilities"] = capabilities
+	}
+	if info, ok := client.InitializeResult()["serverInfo"]; ok {
+		server["serverInfo"] = info
+	}
+	api.handler.toolsMu.RLock()
+	server["tools"] = len(api.handler.tools)
+	api.handler.toolsMu.RUnlock()
+	if stats, ok := api.handler.Stats.Stats(client.BaseURL()); ok {
+		server["stats"] = stats
+	}
+	writeAdminJSON(w, map[string]interface{}{"servers": []interface{}{server}})
+}
+
+// sessions lists the gateway agent's sessions
+func (api *adminAPI) sessions(w http.ResponseWriter, r *http.Request) {
+	if api.agent == nil {
+		http.Error(w, "the gateway agent is not enabled", http.StatusNotFound)
+		return
+	}
+	sessions, ok := api.agent.Sessions()
+	if !ok {
+		http.Error(w, "the session store can't list sessions", http.StatusNotImplemented)
+		return
+	}
+	writeAdminJSON(w, map[string]interface{}{"sessions": sessions})
+}
+
+// refreshTools re-lists the server's tools now
+func (api *adminAPI) refreshTools(w http.ResponseWriter, r *http.Request) {
+	tools, err := api.handler.RefreshTools(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	log.Printf("Tools refreshed by admin request: %d tools", len(tools))
+	writeAdminJSON(w, map[string]interface{}{"tools": len(tools)})
+}
+
+// adminServerRequest is the body of trip and reset requests; server defaults to the
+// gateway's MCP server
+type adminServerRequest struct {
+	Server string `json:"server"`
+	Reason string `json:"reason"`
+}
+
+func (api *adminAPI) serverRequest(w http.ResponseWriter, r *http.Request) (adminServerRequest, bool) {
+	var req adminServerRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return req, false
+		}
+	}
+	if req.Server == "" {
+		req.Server = api.handler.mcpClient.BaseURL()
+	}
+	if api.handler.Stats == nil {
+		http.Error(w, "server stats are not tracked", http.StatusNotImplemented)
+		return req, false
+	}
+	return req, true
+}
+
+// trip marks a server as missing its SLO until reset
+func (api *adminAPI) trip(w http.ResponseWriter, r *http.Request) {
+	req, ok := api.serverRequest(w, r)
+	if !ok {
+		return
+	}
+	log.Printf("MCP server %s tripped by admin request: %s", req.Server, req.Reason)
+	writeAdminJSON(w, api.handler.Stats.Trip(req.Server, req.Reason))
+}
+
+// reset clears a trip
+func (api *adminAPI) reset(w http.ResponseWriter, r *http.Request) {
+	req, ok := api.serverRequest(w, r)
+	if !ok {
+		return
+	}
+	log.Printf("MCP server %s reset by admin request", req.Server)
+	writeAdminJSON(w, api.handler.Stats.Reset(req.Server))
+}
+
+// toolAnalytics exports the gateway agent's tool usage as JSON, or as CSV with ?format=csv
+func (api *adminAPI) toolAnalytics(w http.ResponseWriter, r *http.Request) {
+	if api.agent == nil || api.agent.Analytics == nil {
+		http.Error(w, "tool analytics are not enabled", http.StatusNotFound)
+		return
+	}
+	analytics := api.agent.Analytics
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		if err := analytics.WriteCSV(w); err != nil {
+			log.Printf("Failed to export tool analytics: %v", err)
+		}
+		return
+	}
+
+	if err := api.agent.ensureActionGroups(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	var offered []string
+	for _, tool := range api.agent.selectedTools(nil) {
+		offered = append(offered, tool.Name)
+	}
+	writeAdminJSON(w, map[string]interface{}{
+		"days":   analytics.Report(),
+		"unused": analytics.Unused(offered),
+	})
+}
+
+func (api *adminAPI) drainStatus(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, api.drain.status())
+}
+
+// startDrain turns new requests away; poll GET /admin/drain until drained is true
+func (api *adminAPI) startDrain(w http.ResponseWriter, r *http.Request) {
+	api.drain.start()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(api.drain.status())
+}
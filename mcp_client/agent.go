@@ -1,395 +1,398 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 	"github.com/aws/smithy-go/document"
-)
-
-// MCP Protocol Types
-type MCPRequest struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      int         `json:"id"`
-	Method  string      `json:"method"`
-	Params  interface{} `json:"params,omitempty"`
-}
 
-type MCPResponse struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      int         `json:"id"`
-	Result  interface{} `json:"result,omitempty"`
-	Error   *MCPError   `json:"error,omitempty"`
-}
-
-type MCPError struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-}
-
-// Tool definitions
-type Tool struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	InputSchema map[string]interface{} `json:"inputSchema"`
-}
+	"mcp-client/pkg/mcpclient"
+)
 
-type ToolCall struct {
-	Name      string                 `json:"name"`
-	Arguments map[string]interface{} `json:"arguments"`
+// ActionGroup represents a group of actions (MCP clients)
+type ActionGroup struct {
+	Name       string
+	MCPClients []MCPCaller
+	Tools      []Tool
+	InitMode   InitMode
+
+	// ToolOverrides adjust discovered tools by name; ToolHooks then run on every discovered tool
+	ToolOverrides map[string]ToolOverride
+	ToolHooks     []ToolHook
+	// ResultProcessors names the registered processor for a tool's output, overriding its postProcess annotation
+	ResultProcessors map[string]string
+	// Instruction is usage guidance for the group's tools, appended to the agent instruction
+	// whenever any of them is offered to the model
+	Instruction string
+
+	// lazy tracks deferred initialization until the group's tools have been collected
+	lazy *lazyActionGroup
 }
 
-type ToolResult struct {
-	Content []ContentBlock `json:"content"`
-	IsError bool           `json:"isError,omitempty"`
+type lazyActionGroup struct {
+	init  *lazyInit
+	tools []Tool
 }
 
-type ContentBlock struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+// ConverseAPI is the part of the Bedrock runtime client the agent uses
+type ConverseAPI interface {
+	Converse(ctx context.Context, params *bedrockruntime.ConverseInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ConverseOutput, error)
 }
 
-// MCP Client
-type MCPClient struct {
-	baseURL    string
-	httpClient *http.Client
-	requestID  int
+// InlineAgent represents a Bedrock inline agent
+type InlineAgent struct {
+	FoundationModel string
+	Instruction     string
+	AgentName       string
+	ActionGroups    []ActionGroup
+	TraceSink       TraceSink
+	Hooks           Hooks
+	// InferenceConfig is the default inference configuration; a model preset replaces it
+	InferenceConfig *types.InferenceConfiguration
+	// OutputGuardrails filter the final answer before it is returned; nil disables them
+	OutputGuardrails *OutputGuardrails
+	// ToolQuotas limit tool calls per tool, invocation and session; nil disables them
+	ToolQuotas *ToolQuotas
+	// PromptRef is the prompt library version the instruction came from, e.g. "cluster-ops/v3"
+	PromptRef string
+	// KnowledgeBases are queried with the user's input; the passages are offered to the model as citable sources
+	KnowledgeBases []KnowledgeBaseConfig
+	// Workspace keeps large tool outputs out of the conversation; nil returns them inline
+	Workspace *Workspace
+	// ToolConfigLimit warns about, or refuses, tool configurations too large for good answers; nil disables it
+	ToolConfigLimit *ToolConfigLimit
+	// MaxContinuations is how many times an answer cut off at max_tokens is continued with a
+	// "continue" turn and stitched together; 0 returns it truncated
+	MaxContinuations int
+	// ToolPolicy decides whether each tool call may run, and may rewrite its arguments; nil allows all calls
+	ToolPolicy ToolPolicy
+	// Scheduler limits concurrent model calls, serving interactive invocations first; nil doesn't limit them
+	Scheduler *Scheduler
+	// ContextLimit compacts conversations estimated to overflow the model's context window
+	// before they are sent; nil sends them as they are
+	ContextLimit *ContextLimit
+	// TimeBudget gives invocations a deadline shared out between model and tool calls; nil sets none
+	TimeBudget *TimeBudget
+	// ToolFailureLimit is how many turns in a row may have all their tool calls fail before
+	// the model is told to answer without tools and the result is marked degraded; 0 never does
+	ToolFailureLimit int
+	// ServerStats tracks latency and result size per MCP server against an SLO; servers
+	// missing it are tried last for tools several servers offer. nil doesn't track them.
+	ServerStats *ServerStatsTracker
+	// InjectionScreen checks tool outputs for likely prompt injection before the model sees
+	// them; nil passes them through
+	InjectionScreen *InjectionScreen
+	// Composition lets tool results request follow-up tool calls that run without a model
+	// round trip; nil ignores such requests
+	Composition *ToolComposition
+	// Hedging sends a second model request when one is slower than usual, for interactive
+	// invocations only; nil never does
+	Hedging *ConverseHedging
+	// Prefetch runs read-only tools the user's message suggests the model will call alongside
+	// the first model call; nil waits for the model to ask
+	Prefetch *ToolPrefetch
+	// Variables keeps key-value state per session that tools read and write through _meta
+	// and the instruction can reference; nil keeps none
+	Variables *SessionVariables
+	// ResponsePolicy sets the language, tone, length and format of answers; nil leaves them
+	// to the instruction
+	ResponsePolicy *ResponsePolicy
+	// Transcriber turns audio sent with an invocation into text for the model; nil rejects
+	// audio input with ErrAudioUnsupported
+	Transcriber AudioTranscriber
+	// Translation translates tool outputs in another script into the conversation language
+	// before the model sees them; nil passes them through
+	Translation *ToolTranslation
+	// ArgumentRepair checks tool arguments against the tool's schema and fixes simple
+	// mistakes before calling it; nil sends them as the model wrote them
+	ArgumentRepair *ArgumentRepair
+	// SessionTTL expires sessions after a period of inactivity or a maximum age; nil keeps
+	// them until they are deleted
+	SessionTTL *SessionTTL
+	// Analytics aggregates tool usage per day; nil doesn't
+	Analytics *ToolAnalytics
+	// LargeResults cuts the arrays in large JSON tool outputs short as they are read,
+	// before result processors run; nil passes them through whole
+	LargeResults *LargeResultTruncation
+
+	bedrockClient  ConverseAPI
+	retrieveClient RetrieveAPI
+
+	// pendingGroups are the WithActionGroup groups NewInlineAgent adds after the other options
+	pendingGroups []ActionGroup
+
+	// toolHandler overrides live MCP tool execution, e.g. to serve recorded results during replay
+	toolHandler func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error)
+
+	// mu makes get-or-create on the session store atomic
+	mu    sync.Mutex
+	store SessionStore
+	// stopReaper stops the background deletion of expired sessions; nil when none runs
+	stopReaper context.CancelFunc
+
+	// initMu guards ActionGroups while lazily registered groups are initialized, and closed
+	initMu sync.Mutex
+	closed bool
+
+	// startup records the handshake outcome of every MCP server
+	startup StartupReport
+
+	// events fans lifecycle events out to Events subscribers
+	events EventBus
+
+	// warmUp records the outcome of WarmUp for readiness checks
+	warmUp warmUpTracker
+
+	// toolConfigWarned is the tool configuration size last warned about
+	toolConfigWarned atomic.Int64
 }
 
-// NewMCPClient creates a new MCP client
-func NewMCPClient(baseURL string) *MCPClient {
-	return &MCPClient{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		requestID: 0,
-	}
-}
+// withToolHandler returns a copy of the agent that executes tools with handler instead of
+// the MCP servers, with its own empty session store
+func (a *InlineAgent) withToolHandler(handler func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error)) *InlineAgent {
+	a.initMu.Lock()
+	defer a.initMu.Unlock()
 
-// extractSSEData extracts JSON data from Server-Sent Events format
-func extractSSEData(sseResponse string) string {
-	scanner := bufio.NewScanner(strings.NewReader(sseResponse))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "data:") {
-			return strings.TrimSpace(line[5:])
-		}
+	return &InlineAgent{
+		FoundationModel:  a.FoundationModel,
+		Instruction:      a.Instruction,
+		PromptRef:        a.PromptRef,
+		KnowledgeBases:   a.KnowledgeBases,
+		AgentName:        a.AgentName,
+		ActionGroups:     append([]ActionGroup{}, a.ActionGroups...),
+		TraceSink:        a.TraceSink,
+		Hooks:            a.Hooks,
+		InferenceConfig:  a.InferenceConfig,
+		OutputGuardrails: a.OutputGuardrails,
+		ToolQuotas:       a.ToolQuotas,
+		ToolPolicy:       a.ToolPolicy,
+		Workspace:        a.Workspace,
+		ToolConfigLimit:  a.ToolConfigLimit,
+		MaxContinuations: a.MaxContinuations,
+		ContextLimit:     a.ContextLimit,
+		TimeBudget:       a.TimeBudget,
+		ToolFailureLimit: a.ToolFailureLimit,
+		ServerStats:      a.ServerStats,
+		InjectionScreen:  a.InjectionScreen,
+		Composition:      a.Composition,
+		Hedging:          a.Hedging,
+		Prefetch:         a.Prefetch,
+		Variables:        a.Variables,
+		ResponsePolicy:   a.ResponsePolicy,
+		Transcriber:      a.Transcriber,
+		Translation:      a.Translation,
+		ArgumentRepair:   a.ArgumentRepair,
+		SessionTTL:       a.SessionTTL,
+		Analytics:        a.Analytics,
+		LargeResults:     a.LargeResults,
+		bedrockClient:    a.bedrockClient,
+		retrieveClient:   a.retrieveClient,
+		toolHandler:      handler,
+		store:            NewMemorySessionStore(),
 	}
-	return ""
 }
 
-// sendRequest sends an MCP request and returns the response
-func (c *MCPClient) sendRequest(ctx context.Context, method string, params interface{}) (*MCPResponse, error) {
-	c.requestID++
-	
-	req := MCPRequest{
-		JSONRPC: "2.0",
-		ID:      c.requestID,
-		Method:  method,
-		Params:  params,
-	}
-
-	reqBody, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "application/json, text/event-stream")
-
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+// AddActionGroup adds an action group to the agent, initializing its MCP clients.
+// With InitLazy or InitBackground the MCP clients are initialized on first use instead.
+func (a *InlineAgent) AddActionGroup(actionGroup ActionGroup) error {
+	a.initMu.Lock()
+	defer a.initMu.Unlock()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
+	if a.closed {
+		return ErrAgentClosed
 	}
 
-	// Handle empty responses
-	if len(body) == 0 {
-		return &MCPResponse{
-			JSONRPC: "2.0",
-			ID:      c.requestID,
-			Result:  nil,
-		}, nil
-	}
-
-	// Check if response is Server-Sent Events format
-	bodyStr := string(body)
-	if strings.HasPrefix(bodyStr, "event:") {
-		jsonData := extractSSEData(bodyStr)
-		if jsonData == "" {
-			return &MCPResponse{
-				JSONRPC: "2.0",
-				ID:      c.requestID,
-				Result:  nil,
-			}, nil
-		}
-		
-		var mcpResp MCPResponse
-		if err := json.Unmarshal([]byte(jsonData), &mcpResp); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal SSE JSON data: %w", err)
-		}
-		
-		if mcpResp.Error != nil {
-			return nil, fmt.Errorf("MCP error %d: %s", mcpResp.Error.Code, mcpResp.Error.Message)
+	if actionGroup.InitMode == InitEager {
+		tools, err := initializeMCPClients(context.Background(), actionGroup.MCPClients, &a.startup)
+		if err != nil {
+			return err
 		}
-		
-		return &mcpResp, nil
+		actionGroup.Tools = append(actionGroup.Tools, actionGroup.augmentTools(tools)...)
+		a.ActionGroups = append(a.ActionGroups, actionGroup)
+		return nil
 	}
 
-	var mcpResp MCPResponse
-	if err := json.Unmarshal(body, &mcpResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
+	lazy := &lazyActionGroup{}
+	lazy.init = newLazyInit(func(ctx context.Context) error {
+		tools, err := initializeMCPClients(ctx, actionGroup.MCPClients, &a.startup)
+		if err != nil {
+			return err
+		}
+		lazy.tools = tools
+		return nil
+	})
+	actionGroup.lazy = lazy
+	a.ActionGroups = append(a.ActionGroups, actionGroup)
 
-	if mcpResp.Error != nil {
-		return nil, fmt.Errorf("MCP error %d: %s", mcpResp.Error.Code, mcpResp.Error.Message)
+	if actionGroup.InitMode == InitBackground {
+		go func() {
+			if err := lazy.init.Do(context.Background()); err != nil {
+				log.Printf("Background initialization of action group %s failed: %v", actionGroup.Name, err)
+			}
+		}()
 	}
 
-	return &mcpResp, nil
+	return nil
 }
 
-// Initialize initializes the MCP connection
-func (c *MCPClient) Initialize(ctx context.Context) error {
-	params := map[string]interface{}{
-		"protocolVersion": "2024-11-05",
-		"capabilities": map[string]interface{}{
-			"tools": map[string]interface{}{
-				"listChanged": true,
-			},
-		},
-		"clientInfo": map[string]interface{}{
-			"name":    "bedrock-mcp-client",
-			"version": "1.0.0",
-		},
-	}
-
-	resp, err := c.sendRequest(ctx, "initialize", params)
-	if err != nil {
-		return err
-	}
-
-	log.Printf("Initialize response: %+v", resp.Result)
+// initializeMCPClients initializes all MCP clients and collects their tools. Every client is
+// attempted, so the startup report covers all servers even when one fails.
+func initializeMCPClients(ctx context.Context, clients []MCPCaller, report *StartupReport) ([]Tool, error) {
+	var allTools []Tool
+	var errs []error
+	for _, mcpClient := range clients {
+		tools, err := handshake(ctx, mcpClient, nil, report)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
 
-	// Send initialized notification
-	notifyParams := map[string]interface{}{}
-	c.requestID++
-	
-	notifyReq := MCPRequest{
-		JSONRPC: "2.0",
-		Method:  "notifications/initialized",
-		Params:  notifyParams,
+		allTools = append(allTools, tools...)
+		log.Printf("Added %d tools from MCP client %s", len(tools), callerName(mcpClient))
 	}
-
-	reqBody, err := json.Marshal(notifyReq)
-	if err != nil {
-		return fmt.Errorf("failed to marshal notification: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return fmt.Errorf("failed to create notification request: %w", err)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
+	return allTools, nil
+}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+// ensureActionGroups finishes initialization of any lazily registered action groups
+func (a *InlineAgent) ensureActionGroups(ctx context.Context) error {
+	a.initMu.Lock()
+	defer a.initMu.Unlock()
 
-	resp2, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("notification request failed: %w", err)
+	for i := range a.ActionGroups {
+		group := &a.ActionGroups[i]
+		if group.lazy == nil {
+			continue
+		}
+		if err := group.lazy.init.Do(ctx); err != nil {
+			return fmt.Errorf("failed to initialize action group %s: %w", group.Name, err)
+		}
+		group.Tools = append(group.Tools, group.augmentTools(group.lazy.tools)...)
+		group.lazy = nil
 	}
-	defer resp2.Body.Close()
-
-	body, _ := io.ReadAll(resp2.Body)
-	log.Printf("Notification response: %s", string(body))
-
 	return nil
 }
 
-// ListTools retrieves available tools from the MCP server
-func (c *MCPClient) ListTools(ctx context.Context) ([]Tool, error) {
-	resp, err := c.sendRequest(ctx, "tools/list", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resultMap, ok := resp.Result.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("unexpected response format")
-	}
-
-	toolsInterface, ok := resultMap["tools"]
-	if !ok {
-		return nil, fmt.Errorf("no tools found in response")
-	}
-
-	toolsBytes, err := json.Marshal(toolsInterface)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal tools: %w", err)
-	}
-
+// selectedTools returns the tools offered to the model. When allowed is non-empty only the
+// named tools are included.
+func (a *InlineAgent) selectedTools(allowed []string) []Tool {
 	var tools []Tool
-	if err := json.Unmarshal(toolsBytes, &tools); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal tools: %w", err)
-	}
-
-	return tools, nil
-}
 
-// CallTool executes a tool with the given arguments
-func (c *MCPClient) CallTool(ctx context.Context, toolCall ToolCall) (*ToolResult, error) {
-	params := map[string]interface{}{
-		"name":      toolCall.Name,
-		"arguments": toolCall.Arguments,
+	allow := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		allow[name] = true
 	}
 
-	resp, err := c.sendRequest(ctx, "tools/call", params)
-	if err != nil {
-		return nil, err
-	}
-
-	resultBytes, err := json.Marshal(resp.Result)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	for _, actionGroup := range a.ActionGroups {
+		for _, tool := range actionGroup.Tools {
+			if len(allow) > 0 && !allow[tool.Name] {
+				continue
+			}
+			tools = append(tools, tool)
+		}
 	}
 
-	var result ToolResult
-	if err := json.Unmarshal(resultBytes, &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	// The workspace tools are always offered, since results may refer to workspace files
+	if a.Workspace != nil {
+		tools = append(tools, workspaceTools()...)
 	}
-
-	return &result, nil
+	return tools
 }
 
-// ActionGroup represents a group of actions (MCP clients)
-type ActionGroup struct {
-	Name       string
-	MCPClients []*MCPClient
-	Tools      []Tool
-}
-
-// InlineAgent represents a Bedrock inline agent
-type InlineAgent struct {
-	FoundationModel string
-	Instruction     string
-	AgentName       string
-	ActionGroups    []ActionGroup
-	bedrockClient   *bedrockruntime.Client
-}
-
-// NewInlineAgent creates a new inline agent
-func NewInlineAgent(foundationModel, instruction, agentName string) (*InlineAgent, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
-
-	client := bedrockruntime.NewFromConfig(cfg)
+// buildToolConfig converts MCP tools to Bedrock tool configuration.
+func (a *InlineAgent) buildToolConfig(tools []Tool) []types.ToolConfiguration {
+	var toolConfigs []types.ToolConfiguration
 
-	return &InlineAgent{
-		FoundationModel: foundationModel,
-		Instruction:     instruction,
-		AgentName:       agentName,
-		ActionGroups:    []ActionGroup{},
-		bedrockClient:   client,
-	}, nil
-}
+	for _, tool := range tools {
+		// Convert map[string]interface{} to document.Document
+		schemaDoc, err := document.NewEncoder().Encode(documentNumbers(tool.InputSchema))
+		if err != nil {
+			log.Printf("Failed to encode schema for tool %s: %v", tool.Name, err)
+			continue
+		}
 
-// AddActionGroup adds an action group to the agent
-func (a *InlineAgent) AddActionGroup(actionGroup ActionGroup) error {
-	// Initialize all MCP clients and collect tools
-	ctx := context.Background()
-	
-	for _, mcpClient := range actionGroup.MCPClients {
-		if err := mcpClient.Initialize(ctx); err != nil {
-			return fmt.Errorf("failed to initialize MCP client %s: %w", mcpClient.baseURL, err)
+		toolSpec := types.ToolSpecification{
+			Name:        aws.String(tool.Name),
+			Description: aws.String(tool.Description),
+			InputSchema: &types.ToolInputSchema{
+				Json: schemaDoc,
+			},
 		}
 
-		tools, err := mcpClient.ListTools(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to list tools from %s: %w", mcpClient.baseURL, err)
+		toolConfig := types.ToolConfiguration{
+			ToolSpec: &toolSpec,
 		}
 
-		actionGroup.Tools = append(actionGroup.Tools, tools...)
-		log.Printf("Added %d tools from MCP client %s", len(tools), mcpClient.baseURL)
+		toolConfigs = append(toolConfigs, toolConfig)
 	}
 
-	a.ActionGroups = append(a.ActionGroups, actionGroup)
-	return nil
+	return toolConfigs
 }
 
-// buildToolConfig converts MCP tools to Bedrock tool configuration
-func (a *InlineAgent) buildToolConfig() []types.ToolConfiguration {
-	var toolConfigs []types.ToolConfiguration
+// groupInstructions appends the instruction of every action group with a tool in the
+// allowed set (all tools when allowed is empty) to instruction
+func (a *InlineAgent) groupInstructions(instruction string, allowed []string) string {
+	allow := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		allow[name] = true
+	}
 
+	var b strings.Builder
+	b.WriteString(instruction)
 	for _, actionGroup := range a.ActionGroups {
+		guidance := strings.TrimSpace(actionGroup.Instruction)
+		if guidance == "" {
+			continue
+		}
 		for _, tool := range actionGroup.Tools {
-			// Convert map[string]interface{} to document.Document
-			schemaDoc, err := document.NewEncoder().Encode(tool.InputSchema)
-			if err != nil {
-				log.Printf("Failed to encode schema for tool %s: %v", tool.Name, err)
-				continue
+			if len(allow) == 0 || allow[tool.Name] {
+				fmt.Fprintf(&b, "\n\n%s", guidance)
+				break
 			}
-
-			toolSpec := types.ToolSpecification{
-				Name:        aws.String(tool.Name),
-				Description: aws.String(tool.Description),
-				InputSchema: &types.ToolInputSchema{
-					Json: schemaDoc,
-				},
-			}
-
-			toolConfig := types.ToolConfiguration{
-				ToolSpec: &toolSpec,
-			}
-
-			toolConfigs = append(toolConfigs, toolConfig)
 		}
 	}
-
-	return toolConfigs
+	return b.String()
 }
 
-// findMCPClientForTool finds the MCP client that provides a specific tool
-func (a *InlineAgent) findMCPClientForTool(toolName string) *MCPClient {
+// findMCPClientForTool finds the MCP client that provides a specific tool. When several
+// action groups offer it, servers missing their SLO are passed over for ones that aren't.
+func (a *InlineAgent) findMCPClientForTool(toolName string) MCPCaller {
+	var fallback MCPCaller
 	for _, actionGroup := range a.ActionGroups {
 		for _, tool := range actionGroup.Tools {
 			if tool.Name == toolName {
 				// Return the first MCP client (assuming one tool per client for simplicity)
 				if len(actionGroup.MCPClients) > 0 {
-					return actionGroup.MCPClients[0]
+					client := actionGroup.MCPClients[0]
+					if !a.ServerStats.Violating(callerName(client)) {
+						return client
+					}
+					if fallback == nil {
+						fallback = client
+					}
 				}
 			}
 		}
 	}
-	return nil
+	return fallback
+}
+
+// GetServerStats returns the latency and result size stats of every MCP server the agent
+// has called, with any SLO violations; nil when the agent doesn't track them
+func (a *InlineAgent) GetServerStats() []ServerStats {
+	return a.ServerStats.All()
 }
 
 // handleToolUse processes tool use requests from Bedrock
@@ -417,13 +420,42 @@ func (a *InlineAgent) handleToolUse(ctx context.Context, toolUse map[string]inte
 		}, nil
 	}
 
-	// Execute the tool
+	// Check the arguments before the call, so the model can fix what can't be repaired
+	// without a round trip to the server
+	if schema, ok := a.toolSchema(name); ok && a.ArgumentRepair != nil {
+		repaired, fixes, problems := a.ArgumentRepair.repair(schema, input)
+		if len(problems) > 0 {
+			return map[string]interface{}{
+				"toolUseId": toolUseID,
+				"content": []map[string]interface{}{
+					{"text": fmt.Sprintf("Invalid arguments for tool '%s': %s", name, strings.Join(problems, "; "))},
+				},
+				"status": "error",
+			}, nil
+		}
+		if len(fixes) > 0 {
+			logf(ctx, "Repaired arguments of tool %s: %s", name, strings.Join(fixes, "; "))
+			input = repaired
+		}
+	}
+
+	// Execute the tool with any renamed parameters mapped back to the server's names
 	toolCall := ToolCall{
 		Name:      name,
-		Arguments: input,
+		Arguments: a.upstreamArguments(name, input),
+	}
+	session := sessionFromContext(ctx)
+	if a.Variables != nil && session != nil {
+		toolCall.Meta = map[string]interface{}{sessionVariablesMeta: session.Variables()}
 	}
 
-	result, err := mcpClient.CallTool(ctx, toolCall)
+	var result *ToolResult
+	err := a.ServerStats.Admit(callerName(mcpClient))
+	if err == nil {
+		callStart := time.Now()
+		result, err = mcpClient.CallTool(a.LargeResults.context(ctx), toolCall)
+		a.ServerStats.Record(callerName(mcpClient), time.Since(callStart), resultSize(result), err)
+	}
 	if err != nil {
 		return map[string]interface{}{
 			"toolUseId": toolUseID,
@@ -433,57 +465,307 @@ func (a *InlineAgent) handleToolUse(ctx context.Context, toolUse map[string]inte
 			"status": "error",
 		}, nil
 	}
+	a.postProcessResult(name, result)
+	a.translateResult(ctx, name, result)
+	if a.Variables != nil && session != nil {
+		a.Variables.apply(session, name, result.Meta)
+	}
 
 	// Format response for Bedrock
-	content := make([]map[string]interface{}, len(result.Content))
-	for i, block := range result.Content {
-		content[i] = map[string]interface{}{
-			"text": block.Text,
-		}
-	}
+	content := toolResultContent(result.Content)
 
 	status := "success"
 	if result.IsError {
 		status = "error"
 	}
 
-	return map[string]interface{}{
+	response := map[string]interface{}{
 		"toolUseId": toolUseID,
 		"content":   content,
 		"status":    status,
+	}
+	if a.Composition != nil {
+		if followUps := followUpRequests(result.Meta); len(followUps) > 0 {
+			response["followUps"] = followUps
+		}
+	}
+	return response, nil
+}
+
+// rejectToolUse stands in for a tool call the user declined
+func rejectToolUse(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"toolUseId": toolUse["toolUseId"],
+		"content": []map[string]interface{}{
+			{"text": "The user rejected this tool call."},
+		},
+		"status": "error",
 	}, nil
 }
 
-// Invoke processes a user input and returns the agent's response
-func (a *InlineAgent) Invoke(inputText string) (string, error) {
-	ctx := context.Background()
-	
-	// Build the conversation with system prompt and user message
-	messages := []types.Message{
-		{
-			Role: types.ConversationRoleUser,
-			Content: []types.ContentBlock{
-				&types.ContentBlockMemberText{
-					Value: inputText,
-				},
+// Invoke processes a user input and returns the agent's response with usage and timing details
+func (a *InlineAgent) Invoke(inputText string) (*Result, error) {
+	return a.InvokeSession("", inputText)
+}
+
+// InvokeText processes a user input and returns only the agent's text response
+func (a *InlineAgent) InvokeText(inputText string) (string, error) {
+	result, err := a.Invoke(inputText)
+	if err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// InvokeSession processes a user input within a session, continuing its conversation history.
+// An empty sessionID runs a one-off conversation that is not stored.
+func (a *InlineAgent) InvokeSession(sessionID, inputText string) (*Result, error) {
+	return a.InvokeWithOptions(inputText, InvokeOptions{SessionID: sessionID})
+}
+
+// InvokeOptions customizes a single invocation
+type InvokeOptions struct {
+	// SessionID continues a stored conversation; empty runs a one-off conversation
+	SessionID string
+	// Preset selects a named entry from ModelPresets instead of the agent's foundation model
+	Preset string
+	// ModelID overrides the agent's foundation model; a Preset takes precedence
+	ModelID string
+	// Instruction overrides the agent's system prompt
+	Instruction string
+	// Tools limits the tools offered to the model to these names; empty offers all tools
+	Tools []string
+	// Tags are attached to every trace event of the invocation
+	Tags map[string]string
+	// Events receives the invocation's trace events as they happen, e.g. to stream them to a client
+	Events func(event TraceEvent)
+	// ApproveTool is asked before each tool call; a rejected call is reported to the model instead of executed
+	ApproveTool func(ctx context.Context, toolUse map[string]interface{}) (bool, error)
+	// BedrockClient makes the invocation's model calls instead of the agent's client, e.g. one
+	// using a tenant's assumed role
+	BedrockClient ConverseAPI
+	// Priority is the invocation's class for the agent's Scheduler; empty is interactive
+	Priority Priority
+	// AllowedModels fails the invocation before any model call unless its model is listed;
+	// empty allows any model
+	AllowedModels []string
+	// Timeout overrides the deadline of the agent's TimeBudget for this invocation
+	Timeout time.Duration
+	// CorrelationID identifies the invocation in logs, traces and MCP request headers, e.g.
+	// one passed in by the client; empty generates one
+	CorrelationID string
+	// ResponsePolicy overrides the agent's response policy, e.g. for a product surface that
+	// shows plain text
+	ResponsePolicy *ResponsePolicy
+	// Audio is voice input sent with the text, transcribed by the agent's Transcriber
+	Audio []AudioContent
+	// StreamBuffer queues Events for a slow consumer instead of calling it from the agent loop
+	StreamBuffer StreamBuffer
+	// Meta is sent in the _meta of every tool call, e.g. the end user's ID, see WithRequestMeta
+	Meta map[string]interface{}
+}
+
+// ErrModelNotAllowed is returned when an invocation's model is not in InvokeOptions.AllowedModels
+var ErrModelNotAllowed = errors.New("model not allowed")
+
+// InvokeWithOptions processes a user input with per-invocation options
+func (a *InlineAgent) InvokeWithOptions(inputText string, opts InvokeOptions) (*Result, error) {
+	return a.InvokeContext(context.Background(), inputText, opts)
+}
+
+// InvokeContext is InvokeWithOptions bound to ctx, e.g. an HTTP request's context, so the
+// invocation's model and tool calls stop when the caller goes away
+func (a *InlineAgent) InvokeContext(ctx context.Context, inputText string, opts InvokeOptions) (*Result, error) {
+	if opts.CorrelationID == "" {
+		opts.CorrelationID = newCorrelationID()
+	}
+	ctx = mcpclient.WithCorrelationID(ctx, opts.CorrelationID)
+	ctx = mcpclient.WithRequestMeta(ctx, opts.Meta)
+	start := time.Now()
+	attempts := &attemptLog{}
+	ctx = withAttemptLog(ctx, attempts)
+
+	if a.Hooks.BeforeInvoke != nil {
+		a.Hooks.BeforeInvoke(ctx, opts.SessionID, inputText)
+	}
+	events, drain := opts.StreamBuffer.buffered(opts.Events)
+	opts.Events = func(event TraceEvent) {
+		attempts.observe(event)
+		if events != nil {
+			events(event)
+		}
+	}
+	result, err := a.invoke(ctx, inputText, opts)
+	drain()
+	if err != nil {
+		a.trace(TraceEvent{Type: TraceInvocationEnd, SessionID: opts.SessionID, Error: err.Error(), Tags: opts.Tags, CorrelationID: opts.CorrelationID})
+		err = attempts.fail(a, opts, start, err)
+	}
+	a.Analytics.record(time.Now(), result, err)
+	if a.Hooks.AfterInvoke != nil {
+		a.Hooks.AfterInvoke(ctx, opts.SessionID, result, err)
+	}
+	return result, err
+}
+
+// continuePrompt asks the model to resume an answer cut off at max_tokens
+const continuePrompt = "Your previous answer was cut off. Continue exactly where it stopped, without repeating anything or adding any preamble."
+
+// invoke runs the Converse tool loop for one input
+func (a *InlineAgent) invoke(ctx context.Context, inputText string, opts InvokeOptions) (*Result, error) {
+	if a.isClosed() {
+		return nil, ErrAgentClosed
+	}
+	start := time.Now()
+	sessionID := opts.SessionID
+
+	ctx, budget, cancel := a.startTimeBudget(ctx, opts, start)
+	defer cancel()
+
+	invocation := &Result{CorrelationID: opts.CorrelationID}
+	emit := func(event TraceEvent) {
+		invocation.flagEvent(event)
+		event.Tags = opts.Tags
+		event.CorrelationID = opts.CorrelationID
+		if event.Time.IsZero() {
+			event.Time = time.Now()
+		}
+		if event.Type != TraceModelText {
+			a.trace(event)
+		}
+		if opts.Events != nil {
+			opts.Events(event)
+		}
+		if budget, ok := budgetEvent(event); ok {
+			a.events.publish(budget)
+		}
+	}
+
+	if err := a.ensureActionGroups(ctx); err != nil {
+		return nil, err
+	}
+	inputText, err := a.withAudioTranscripts(ctx, inputText, opts.Audio)
+	if err != nil {
+		return nil, err
+	}
+
+	session := a.getOrCreateSession(sessionID)
+	sessionToolCalls := session.toolCallCount()
+	if a.Variables != nil {
+		ctx = withSession(ctx, session)
+	}
+
+	var workspaceID string
+	if a.Workspace != nil {
+		var err error
+		if workspaceID, err = workspaceScope(sessionID); err != nil {
+			return nil, err
+		}
+	}
+	emit(TraceEvent{Type: TraceInvocationStart, SessionID: sessionID})
+
+	// Build the conversation with the session history and the new user message; current is
+	// the index of the new message, before which compaction may drop turns
+	history := session.messagesSnapshot()
+	current := len(history)
+	messages := append(history, types.Message{
+		Role: types.ConversationRoleUser,
+		Content: []types.ContentBlock{
+			&types.ContentBlockMemberText{
+				Value: inputText,
 			},
 		},
-	}
+	})
 
 	// Build tool configuration
-	toolConfig := a.buildToolConfig()
+	tools := a.selectedTools(opts.Tools)
+	if err := a.checkToolConfigSize(tools); err != nil {
+		return nil, err
+	}
+	toolConfig := a.buildToolConfig(tools)
+
+	instruction := a.Instruction
+	if opts.Instruction != "" {
+		instruction = opts.Instruction
+	}
+	instruction = a.groupInstructions(instruction, opts.Tools)
+	if a.Variables != nil {
+		var err error
+		if instruction, err = renderSessionVariables(instruction, session.Variables()); err != nil {
+			return nil, err
+		}
+	}
+	policy := a.responsePolicy(opts)
+	if policy != nil {
+		if fragment := policy.instruction(); fragment != "" {
+			instruction = strings.TrimSpace(instruction + "\n\n" + fragment)
+		}
+	}
+	modelID := a.FoundationModel
+	if opts.ModelID != "" {
+		modelID = opts.ModelID
+	}
 
 	// Create the converse request
 	input := &bedrockruntime.ConverseInput{
-		ModelId:  aws.String(a.FoundationModel),
+		ModelId:  aws.String(modelID),
 		Messages: messages,
 		System: []types.SystemContentBlock{
 			&types.SystemContentBlockMemberText{
-				Value: a.Instruction,
+				Value: instruction,
 			},
 		},
 	}
 
+	// Retrieved passages go in the system prompt for this turn only, so they don't pile up in the session
+	var passages []passage
+	if len(a.KnowledgeBases) > 0 {
+		retrieveStart := time.Now()
+		var err error
+		passages, err = a.retrieve(ctx, inputText)
+		if err != nil {
+			emit(TraceEvent{Type: TraceRetrieval, SessionID: sessionID, Duration: time.Since(retrieveStart), Error: err.Error()})
+			return nil, err
+		}
+		emit(TraceEvent{Type: TraceRetrieval, SessionID: sessionID, Duration: time.Since(retrieveStart), Data: map[string]interface{}{"passages": len(passages)}})
+		if len(passages) > 0 {
+			input.System = append(input.System, &types.SystemContentBlockMemberText{Value: sourcesPrompt(passages)})
+		}
+	}
+
+	if a.InferenceConfig != nil {
+		inference := *a.InferenceConfig
+		input.InferenceConfig = &inference
+	}
+
+	if opts.Preset != "" {
+		preset, err := lookupPreset(opts.Preset)
+		if err != nil {
+			return nil, err
+		}
+		if err := preset.apply(input); err != nil {
+			return nil, err
+		}
+		modelID = preset.ModelID
+	}
+
+	if len(opts.AllowedModels) > 0 && !containsString(opts.AllowedModels, modelID) {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotAllowed, modelID)
+	}
+	converse := a.bedrockClient
+	if opts.BedrockClient != nil {
+		converse = opts.BedrockClient
+	}
+	// Tool outputs are translated through the invocation's client, by a model it may use
+	if a.Translation != nil && (len(opts.AllowedModels) == 0 || containsString(opts.AllowedModels, a.FoundationModel)) {
+		ctx = withTranslationModel(ctx, converse, a.FoundationModel)
+	}
+	// Hedges go to the fallback model only if the invocation may use it
+	var hedgeModel string
+	if a.Hedging != nil && (len(opts.AllowedModels) == 0 || containsString(opts.AllowedModels, a.Hedging.FallbackModel)) {
+		hedgeModel = a.Hedging.FallbackModel
+	}
+
 	// Add tool configuration if we have tools
 	if len(toolConfig) > 0 {
 		input.ToolConfig = &types.ToolConfiguration{
@@ -491,13 +773,75 @@ func (a *InlineAgent) Invoke(inputText string) (string, error) {
 		}
 	}
 
+	// An answer cut off at max_tokens is continued; partial holds the text so far and
+	// continuedFrom the index of its first assistant message
+	var partial strings.Builder
+	continuations, continuedFrom := 0, -1
+	fallback := &toolFallback{limit: a.ToolFailureLimit}
+
+	// Tools the model will likely ask for run alongside the first model call; replays
+	// answer from their recordings instead. Calls that need approval aren't run ahead of it.
+	var prefetched *prefetchedCalls
+	if a.toolHandler == nil && opts.ApproveTool == nil {
+		prefetched = a.Prefetch.start(ctx, inputText, tools, func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+			return a.prefetchToolUse(ctx, toolUse, sessionID, sessionToolCalls, opts.Tags)
+		})
+	}
+
 	// Start the conversation loop
 	for {
-		// Call Bedrock
-		result, err := a.bedrockClient.Converse(ctx, input)
+		if a.ContextLimit != nil {
+			_, toolTokens := toolConfigSize(tools)
+			dropped, err := a.fitContextWindow(input, modelID, toolTokens, current, sessionID, emit)
+			if err != nil {
+				return nil, err
+			}
+			messages = input.Messages
+			current -= dropped
+			if continuedFrom >= 0 {
+				continuedFrom -= dropped
+			}
+		}
+
+		// Call Bedrock once the scheduler has a slot for the invocation's priority
+		release, err := a.Scheduler.Acquire(ctx, opts.Priority)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wait for a model call slot: %w", err)
+		}
+		modelStart := time.Now()
+		var result *bedrockruntime.ConverseOutput
+		var hedge string
+		if a.Hedging != nil && opts.Priority != PriorityBatch {
+			result, hedge, err = a.Hedging.converse(ctx, converse, input, hedgeModel)
+		} else {
+			result, err = converse.Converse(ctx, input)
+		}
+		release()
+		modelDuration := time.Since(modelStart)
+		invocation.ModelLatency += modelDuration
 		if err != nil {
-			return "", fmt.Errorf("bedrock converse failed: %w", err)
+			emit(TraceEvent{Type: TraceModelCall, SessionID: sessionID, Duration: modelDuration, Error: err.Error(), Data: map[string]interface{}{"model": modelID}})
+			return nil, fmt.Errorf("bedrock converse failed: %w", err)
 		}
+		invocation.Usage.add(result.Usage)
+		invocation.StopReason = result.StopReason
+		if result.Metrics != nil {
+			invocation.LatencyMs += aws.ToInt64(result.Metrics.LatencyMs)
+		}
+		modelData := map[string]interface{}{
+			"model":      modelID,
+			"stopReason": string(result.StopReason),
+			"messages":   len(input.Messages),
+		}
+		if hedge != "" {
+			modelData["hedge"] = hedge
+		}
+		emit(TraceEvent{
+			Type:      TraceModelCall,
+			SessionID: sessionID,
+			Duration:  modelDuration,
+			Data:      modelData,
+		})
 
 		// Add assistant's response to conversation
 		messages = append(messages, types.Message{
@@ -517,29 +861,187 @@ func (a *InlineAgent) Invoke(inputText string) (string, error) {
 				toolUse := map[string]interface{}{
 					"toolUseId": *c.Value.ToolUseId,
 					"name":      *c.Value.Name,
-					"input":     c.Value.Input,
+					"input":     decodeDocument(c.Value.Input),
 				}
 				toolUses = append(toolUses, toolUse)
 			}
 		}
 
 		// If no tool use, return the text response
+		if len(toolUses) == 0 && result.StopReason == types.StopReasonMaxTokens && continuations < a.MaxContinuations {
+			continuations++
+			if continuedFrom < 0 {
+				continuedFrom = len(messages) - 1
+			}
+			partial.WriteString(textResponse.String())
+			logf(ctx, "Answer cut off at max_tokens, continuing (%d/%d)", continuations, a.MaxContinuations)
+
+			messages = append(messages, types.Message{
+				Role: types.ConversationRoleUser,
+				Content: []types.ContentBlock{
+					&types.ContentBlockMemberText{Value: continuePrompt},
+				},
+			})
+			input.Messages = messages
+			continue
+		}
 		if len(toolUses) == 0 {
-			return textResponse.String(), nil
+			if continuedFrom >= 0 {
+				// Keep a single assistant turn in the session instead of the pieces and continue prompts
+				partial.WriteString(textResponse.String())
+				textResponse.Reset()
+				textResponse.WriteString(partial.String())
+				messages = append(messages[:continuedFrom], types.Message{
+					Role: types.ConversationRoleAssistant,
+					Content: []types.ContentBlock{
+						&types.ContentBlockMemberText{Value: partial.String()},
+					},
+				})
+			}
+
+			answer := applyResponsePolicy(policy, textResponse.String(), messages, sessionID, emit)
+			answer, err := a.applyOutputGuardrails(answer, messages, sessionID, emit)
+			if err != nil {
+				return nil, err
+			}
+			invocation.Text = answer
+			invocation.Citations = citationsFromAnswer(answer, passages)
+			if answer != "" {
+				emit(TraceEvent{Type: TraceModelText, SessionID: sessionID, Data: map[string]interface{}{"text": answer}})
+			}
+			invocation.TotalLatency = time.Since(start)
+			invocation.EstimatedCost = estimateCost(modelID, invocation.Usage)
+			if invocation.Truncated() {
+				invocation.flag(FlagTruncatedResults)
+			}
+			session.record(messages, invocation.ToolCalls, invocation.Usage)
+			emit(TraceEvent{
+				Type:      TraceInvocationEnd,
+				SessionID: sessionID,
+				Duration:  invocation.TotalLatency,
+				Data: map[string]interface{}{
+					"inputTokens":   invocation.Usage.InputTokens,
+					"outputTokens":  invocation.Usage.OutputTokens,
+					"toolCalls":     len(invocation.ToolCalls),
+					"estimatedCost": invocation.EstimatedCost,
+					"stopReason":    string(invocation.StopReason),
+					"degraded":      invocation.Degraded,
+					"flags":         invocation.Flags,
+				},
+			})
+			return invocation, nil
+		}
+
+		// A tool call ends the continuation; the pieces so far stay in the conversation as they are
+		partial.Reset()
+		continuedFrom = -1
+
+		if textResponse.Len() > 0 {
+			emit(TraceEvent{Type: TraceModelText, SessionID: sessionID, Data: map[string]interface{}{"text": textResponse.String()}})
 		}
 
 		// Process tool uses
 		var toolResults []types.ContentBlock
-		for _, toolUse := range toolUses {
-			result, err := a.handleToolUse(ctx, toolUse)
+		turnCalls := len(invocation.ToolCalls)
+		for i, toolUse := range toolUses {
+			handle := a.handleToolUse
+			if a.Workspace != nil && isWorkspaceTool(toolUse["name"].(string)) {
+				handle = a.Workspace.handler(workspaceID)
+			}
+			if a.toolHandler != nil {
+				handle = a.toolHandler
+			}
+
+			var refusal *quotaRefusal
+			if a.ToolQuotas != nil {
+				refusal = a.ToolQuotas.exceeded(toolUse["name"].(string), invocation.ToolCalls, sessionToolCalls)
+			}
+			var denial *PolicyDecision
+			var prefetch *prefetchedCall
+			if refusal == nil {
+				if denial, err = a.evaluateToolPolicy(ctx, toolUse, sessionID, opts.Tags, emit); err != nil {
+					return nil, err
+				}
+				// Matched after the policy, which may rewrite the arguments
+				if denial == nil {
+					prefetch = prefetched.take(toolUse)
+				}
+			}
+			if refusal != nil {
+				handle = refusal.handler()
+			} else if denial != nil {
+				handle = denial.handler()
+			} else if opts.ApproveTool != nil {
+				approved, err := opts.ApproveTool(ctx, toolUse)
+				if err != nil {
+					return nil, fmt.Errorf("tool approval failed: %w", err)
+				}
+				if !approved {
+					handle = rejectToolUse
+					prefetch = nil
+				}
+			}
+			if prefetch != nil {
+				handle = prefetch.handler(handle)
+			}
+
+			if a.Hooks.BeforeToolCall != nil {
+				a.Hooks.BeforeToolCall(ctx, toolUse)
+			}
+
+			// Each call gets its share of the time left, keeping enough back for the next model call
+			toolCtx, cancelTool, ok := budget.toolContext(ctx, len(toolUses)-i)
+			if !ok {
+				handle = budget.outOfTime
+			}
+
+			toolStart := time.Now()
+			result, err := handle(toolCtx, toolUse)
+			cancelTool()
+			toolDuration := time.Since(toolStart)
 			if err != nil {
-				return "", fmt.Errorf("tool execution failed: %w", err)
+				emit(TraceEvent{
+					Type:      TraceToolCall,
+					SessionID: sessionID,
+					Tool:      toolUse["name"].(string),
+					Duration:  toolDuration,
+					Error:     err.Error(),
+					Data:      map[string]interface{}{"toolUseId": toolUse["toolUseId"], "errorClass": mcpclient.ErrorClass(err)},
+				})
+				return nil, fmt.Errorf("tool execution failed: %w", err)
+			}
+
+			followUpCalls, err := a.runFollowUps(ctx, toolUse, result, invocation, sessionToolCalls, sessionID, opts.Tags, emit)
+			if err != nil {
+				return nil, err
+			}
+
+			if a.Workspace != nil {
+				offloaded, err := a.Workspace.offload(ctx, workspaceID, toolUse["name"].(string), result)
+				if err != nil {
+					logf(ctx, "Failed to save tool output to the workspace, returning it inline: %v", err)
+				}
+				if offloaded {
+					invocation.flag(FlagTruncatedResults)
+				}
+			}
+
+			if findings := a.InjectionScreen.screen(toolUse["name"].(string), result); len(findings) > 0 {
+				emit(TraceEvent{
+					Type:      TraceInjection,
+					SessionID: sessionID,
+					Tool:      toolUse["name"].(string),
+					Data: map[string]interface{}{
+						"toolUseId": result["toolUseId"],
+						"findings":  findings,
+					},
+				})
 			}
 
 			// Convert tool result to Bedrock format
 			toolUseID := result["toolUseId"].(string)
 			content := result["content"].([]map[string]interface{})
-			
+
 			var contentText strings.Builder
 			for _, c := range content {
 				if text, ok := c["text"].(string); ok {
@@ -547,20 +1049,60 @@ func (a *InlineAgent) Invoke(inputText string) (string, error) {
 				}
 			}
 
+			invocation.ToolCalls = append(invocation.ToolCalls, ToolCallRecord{
+				ToolUseID: toolUseID,
+				Name:      toolUse["name"].(string),
+				Input:     toolUse["input"].(map[string]interface{}),
+				Output:    contentText.String(),
+				Status:    result["status"].(string),
+				Duration:  toolDuration,
+			})
+			invocation.Audio = append(invocation.Audio, resultAudio(toolUse["name"].(string), content)...)
+			if a.Hooks.AfterToolCall != nil {
+				a.Hooks.AfterToolCall(ctx, invocation.ToolCalls[len(invocation.ToolCalls)-1])
+			}
+			invocation.ToolCalls = append(invocation.ToolCalls, followUpCalls...)
+			emit(TraceEvent{
+				Type:      TraceToolCall,
+				SessionID: sessionID,
+				Tool:      toolUse["name"].(string),
+				Duration:  toolDuration,
+				Data: map[string]interface{}{
+					"toolUseId":  toolUseID,
+					"status":     result["status"],
+					"prefetched": prefetch != nil,
+				},
+			})
+
+			var resultContent []types.ToolResultContentBlock
+			for _, c := range content {
+				if doc, ok := converseDocument(c); ok {
+					resultContent = append(resultContent, &types.ToolResultContentBlockMemberDocument{Value: doc})
+				}
+			}
+			// Converse rejects empty text blocks, so a result of only documents has none
+			if contentText.Len() > 0 || len(resultContent) == 0 {
+				resultContent = append([]types.ToolResultContentBlock{
+					&types.ToolResultContentBlockMemberText{
+						Value: contentText.String(),
+					},
+				}, resultContent...)
+			}
+
 			toolResult := &types.ContentBlockMemberToolResult{
 				Value: types.ToolResultBlock{
 					ToolUseId: aws.String(toolUseID),
-					Content: []types.ToolResultContentBlock{
-						&types.ToolResultContentBlockMemberText{
-							Value: contentText.String(),
-						},
-					},
+					Content:   resultContent,
 				},
 			}
 
 			toolResults = append(toolResults, toolResult)
 		}
 
+		if fallback.observe(input, invocation.ToolCalls[turnCalls:]) {
+			invocation.Degraded = true
+		}
+
 		// Add tool results to conversation and continue
 		messages = append(messages, types.Message{
 			Role:    types.ConversationRoleUser,
@@ -573,35 +1115,153 @@ func (a *InlineAgent) Invoke(inputText string) (string, error) {
 }
 
 // Example usage
+//
+// Subcommands:
+//
+//	eval <suite.json> [baseline-report.json]   run an eval suite and print the report
+//	loadtest [-gateway URL] [-input file.jsonl] [-concurrency N] [-requests N]
+//	doctor [-json] [-timeout D]                check servers, tool schemas and model access
+//	worker -queue URL -results LOCATION [-events URL] [-concurrency N]
+//	conformance [-url URL] [-tool NAME] [-args JSON] [-json]   check an MCP transport's behavior
 func main() {
-	// Create MCP clients
-	mcpClient1 := NewMCPClient("http://localhost:3001/mcp")
+	if len(os.Args) > 1 && os.Args[1] == "conformance" {
+		runConformanceCommand(os.Args[2:])
+		return
+	}
+
+	// Create MCP clients; MCP_REPLICAS balances calls over a comma-separated list of replica URLs
+	var mcpClient1 MCPCaller = mcpclient.New("http://localhost:3001/mcp")
+	if replicas := os.Getenv("MCP_REPLICAS"); replicas != "" {
+		strategy := BalanceStrategy(os.Getenv("MCP_BALANCE_STRATEGY"))
+		if strategy == "" {
+			strategy = BalanceRoundRobin
+		}
+		mcpClient1 = NewHTTPReplicaSet("time", strategy, strings.Split(replicas, ",")...)
+	}
+
+	clients := []MCPCaller{mcpClient1}
+	if set, ok := mcpClient1.(*ReplicaSet); ok {
+		clients = set.Replicas()
+	}
+
+	// Route servers listed in MCP_PROXY_OVERRIDES through their own proxy, or directly
+	proxies, err := mcpclient.ProxyOverridesFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid proxy overrides: %v", err)
+	}
+	for _, c := range clients {
+		if err := proxies.Apply(c.(*MCPClient)); err != nil {
+			log.Fatalf("Failed to set proxy: %v", err)
+		}
+	}
+
+	// Inject transport faults when any MCP_FAULT_* probability is set
+	faults, err := FaultConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid fault injection config: %v", err)
+	}
+	if faults.Enabled() {
+		log.Printf("Fault injection enabled: %+v", faults)
+		for _, c := range clients {
+			client := c.(*MCPClient)
+			client.SetTransport(NewFaultInjector(client.Transport(), faults))
+		}
+	}
 
 	// Create inline agent
 	agent, err := NewInlineAgent(
-		"us.anthropic.claude-3-5-sonnet-20241022-v2:0",
-		"You are a friendly assistant for resolving user queries using available tools.",
-		"SampleAgent",
+		WithModel("us.anthropic.claude-3-5-sonnet-20241022-v2:0"),
+		WithInstruction("You are a friendly assistant for resolving user queries using available tools."),
+		WithName("SampleAgent"),
 	)
 	if err != nil {
 		log.Fatalf("Failed to create agent: %v", err)
 	}
 
+	// Write structured traces when AGENT_TRACE_FILE is set
+	if path := os.Getenv("AGENT_TRACE_FILE"); path != "" {
+		sink, err := NewJSONLTraceSink(path)
+		if err != nil {
+			log.Fatalf("Failed to open trace file: %v", err)
+		}
+		defer sink.Close()
+
+		filter, err := TraceFilterFromEnv()
+		if err != nil {
+			log.Fatalf("Invalid trace filter: %v", err)
+		}
+		agent.TraceSink = NewFilteredTraceSink(sink, filter)
+	}
+
+	// Filter final answers when OUTPUT_GUARDRAILS_FILE is set
+	if path := os.Getenv("OUTPUT_GUARDRAILS_FILE"); path != "" {
+		guardrails, err := LoadOutputGuardrails(path)
+		if err != nil {
+			log.Fatalf("Failed to load output guardrails: %v", err)
+		}
+		agent.OutputGuardrails = guardrails
+	}
+
+	// Check every tool call against TOOL_POLICY, a JSON rules file or an OPA decision URL
+	if location := os.Getenv("TOOL_POLICY"); location != "" {
+		policy, err := OpenToolPolicy(location)
+		if err != nil {
+			log.Fatalf("Failed to load tool policy: %v", err)
+		}
+		agent.ToolPolicy = policy
+	}
+
+	// Publish lifecycle events to an EventBridge bus when AGENT_EVENT_BUS is set
+	if bus := os.Getenv("AGENT_EVENT_BUS"); bus != "" {
+		events, err := NewEventBridgeSink(context.Background(), bus, os.Getenv("AGENT_EVENT_SOURCE"))
+		if err != nil {
+			log.Fatalf("Failed to set up event publishing: %v", err)
+		}
+		defer events.Close()
+		agent.TraceSink = NewMultiTraceSink(agent.TraceSink, events)
+	}
+
+	// doctor runs before the action group is added so unreachable servers are reported, not fatal
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		runDoctorCommand(agent, clients, os.Args[2:])
+		return
+	}
+
 	// Add action group with MCP clients
 	actionGroup := ActionGroup{
 		Name:       "SampleActionGroup",
-		MCPClients: []*MCPClient{mcpClient1},
+		MCPClients: []MCPCaller{mcpClient1},
 	}
 
 	if err := agent.AddActionGroup(actionGroup); err != nil {
 		log.Fatalf("Failed to add action group: %v", err)
 	}
 
+	defer agent.Close(context.Background())
+
+	if len(os.Args) > 2 && os.Args[1] == "eval" {
+		runEvalCommand(agent, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "loadtest" {
+		runLoadTestCommand(agent, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		runWorkerCommand(agent, os.Args[2:])
+		return
+	}
+
 	// Test the agent
 	response, err := agent.Invoke("Convert 11am from NYC time to London time")
 	if err != nil {
 		log.Fatalf("Agent invocation failed: %v", err)
 	}
 
-	fmt.Printf("Agent Response: %s\n", response)
+	fmt.Printf("Agent Response: %s\n", response.Text)
+	if response.Truncated() {
+		log.Printf("Response was cut off by the token limit")
+	}
+	log.Printf("Usage: %d input / %d output tokens, model latency %s, total latency %s, estimated cost $%.4f",
+		response.Usage.InputTokens, response.Usage.OutputTokens, response.ModelLatency, response.TotalLatency, response.EstimatedCost)
 }
\ No newline at end of file
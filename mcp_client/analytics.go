@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAnalyticsDays is how many days of tool usage are kept when MaxDays isn't set
+const defaultAnalyticsDays = 30
+
+// ToolAnalytics aggregates the agent's tool calls per UTC day: how often each tool is
+// called, the shapes of the arguments it gets, how often it succeeds and which tools are
+// used together in an invocation. Reports help prune unused tools and find the ones whose
+// descriptions the model misreads. It is safe for concurrent use.
+type ToolAnalytics struct {
+	// MaxDays is how many days are kept; 0 keeps 30
+	MaxDays int
+
+	mu   sync.Mutex
+	days map[string]*dayUsage
+}
+
+type dayUsage struct {
+	invocations int
+	tools       map[string]*toolUsage
+	pairs       map[[2]string]int
+}
+
+type toolUsage struct {
+	calls    int
+	errors   int
+	duration time.Duration
+	shapes   map[string]int
+}
+
+// ToolUsageDay is one day of a tool usage report
+type ToolUsageDay struct {
+	Day string `json:"day"`
+	// Invocations counts the invocations that called at least one tool
+	Invocations  int         `json:"invocations"`
+	Tools        []ToolUsage `json:"tools"`
+	CoOccurrence []ToolPair  `json:"coOccurrence,omitempty"`
+}
+
+// ToolUsage is a tool's calls on one day
+type ToolUsage struct {
+	Tool        string  `json:"tool"`
+	Calls       int     `json:"calls"`
+	Errors      int     `json:"errors"`
+	SuccessRate float64 `json:"successRate"`
+	AvgDuration int64   `json:"avgDurationMs"`
+	// Shapes counts the calls by argument shape, most common first
+	Shapes []ArgumentShape `json:"shapes"`
+}
+
+// ArgumentShape is the keys and JSON types of a call's arguments, e.g.
+// {limit:integer,query:string}, and how many calls had it
+type ArgumentShape struct {
+	Shape string `json:"shape"`
+	Calls int    `json:"calls"`
+}
+
+// ToolPair is two tools called in the same invocation, and in how many invocations
+type ToolPair struct {
+	Tools       [2]string `json:"tools"`
+	Invocations int       `json:"invocations"`
+}
+
+// NewToolAnalytics creates an empty aggregation
+func NewToolAnalytics() *ToolAnalytics {
+	return &ToolAnalytics{days: make(map[string]*dayUsage)}
+}
+
+// record adds an invocation's tool calls: those in its result, or on failure those the
+// failure report lists
+func (t *ToolAnalytics) record(now time.Time, result *Result, err error) {
+	if t == nil {
+		return
+	}
+	var calls []ToolCallRecord
+	if result != nil {
+		calls = result.ToolCalls
+	}
+	var invocationErr *InvocationError
+	if errors.As(err, &invocationErr) && invocationErr.Report != nil {
+		for _, failure := range invocationErr.Report.ToolFailures {
+			calls = append(calls, ToolCallRecord{Name: failure.Tool, ToolUseID: failure.ToolUseID, Status: "error"})
+		}
+	}
+	if len(calls) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := now.UTC().Format(time.DateOnly)
+	day, ok := t.days[key]
+	if !ok {
+		day = &dayUsage{tools: make(map[string]*toolUsage), pairs: make(map[[2]string]int)}
+		t.days[key] = day
+		t.prune()
+	}
+	day.invocations++
+
+	called := make(map[string]bool)
+	for _, call := range calls {
+		usage, ok := day.tools[call.Name]
+		if !ok {
+			usage = &toolUsage{shapes: make(map[string]int)}
+			day.tools[call.Name] = usage
+		}
+		usage.calls++
+		if call.Status != "success" {
+			usage.errors++
+		}
+		usage.duration += call.Duration
+		if call.Input != nil {
+			usage.shapes[argumentShape(call.Input)]++
+		}
+		called[call.Name] = true
+	}
+
+	names := make([]string, 0, len(called))
+	for name := range called {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			day.pairs[[2]string{names[i], names[j]}]++
+		}
+	}
+}
+
+// prune drops the oldest days beyond MaxDays; it must be called with mu held
+func (t *ToolAnalytics) prune() {
+	maxDays := t.MaxDays
+	if maxDays <= 0 {
+		maxDays = defaultAnalyticsDays
+	}
+	if len(t.days) <= maxDays {
+		return
+	}
+	keys := make([]string, 0, len(t.days))
+	for key := range t.days {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys[:len(keys)-maxDays] {
+		delete(t.days, key)
+	}
+}
+
+// argumentShape describes the keys and JSON types of args, recursing into objects
+func argumentShape(args map[string]interface{}) string {
+	parts := make([]string, 0, len(args))
+	for _, key := range sortedKeys(args) {
+		shape := jsonTypeName(args[key])
+		if obj, ok := args[key].(map[string]interface{}); ok {
+			shape = argumentShape(obj)
+		}
+		parts = append(parts, key+":"+shape)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Report returns the usage of every day kept, oldest first
+func (t *ToolAnalytics) Report() []ToolUsageDay {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := make([]ToolUsageDay, 0, len(t.days))
+	for key, day := range t.days {
+		usageDay := ToolUsageDay{Day: key, Invocations: day.invocations}
+		for name, usage := range day.tools {
+			tool := ToolUsage{
+				Tool:        name,
+				Calls:       usage.calls,
+				Errors:      usage.errors,
+				SuccessRate: float64(usage.calls-usage.errors) / float64(usage.calls),
+				AvgDuration: (usage.duration / time.Duration(usage.calls)).Milliseconds(),
+			}
+			for shape, calls := range usage.shapes {
+				tool.Shapes = append(tool.Shapes, ArgumentShape{Shape: shape, Calls: calls})
+			}
+			sort.Slice(tool.Shapes, func(i, j int) bool {
+				if tool.Shapes[i].Calls != tool.Shapes[j].Calls {
+					return tool.Shapes[i].Calls > tool.Shapes[j].Calls
+				}
+				return tool.Shapes[i].Shape < tool.Shapes[j].Shape
+			})
+			usageDay.Tools = append(usageDay.Tools, tool)
+		}
+		sort.Slice(usageDay.Tools, func(i, j int) bool { return usageDay.Tools[i].Tool < usageDay.Tools[j].Tool })
+
+		for pair, invocations := range day.pairs {
+			usageDay.CoOccurrence = append(usageDay.CoOccurrence, ToolPair{Tools: pair, Invocations: invocations})
+		}
+		sort.Slice(usageDay.CoOccurrence, func(i, j int) bool {
+			a, b := usageDay.CoOccurrence[i], usageDay.CoOccurrence[j]
+			if a.Invocations != b.Invocations {
+				return a.Invocations > b.Invocations
+			}
+			return a.Tools[0]+"\x00"+a.Tools[1] < b.Tools[0]+"\x00"+b.Tools[1]
+		})
+		report = append(report, usageDay)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Day < report[j].Day })
+	return report
+}
+
+// Unused returns the tools in offered that weren't called on any day kept
+func (t *ToolAnalytics) Unused(offered []string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var unused []string
+	for _, name := range offered {
+		called := false
+		for _, day := range t.days {
+			if _, ok := day.tools[name]; ok {
+				called = true
+				break
+			}
+		}
+		if !called {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// WriteJSON writes the report as JSON
+func (t *ToolAnalytics) WriteJSON(w io.Writer) error {
+	if err := json.NewEncoder(w).Encode(t.Report()); err != nil {
+		return fmt.Errorf("failed to write tool analytics: %w", err)
+	}
+	return nil
+}
+
+// WriteCSV writes the report as CSV with one row per tool and day. Argument shapes and the
+// tools a tool was called with are listed as value=count, separated by semicolons.
+func (t *ToolAnalytics) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"day", "tool", "calls", "errors", "success_rate", "avg_duration_ms", "argument_shapes", "called_with"})
+	for _, day := range t.Report() {
+		for _, tool := range day.Tools {
+			shapes := make([]string, len(tool.Shapes))
+			for i, shape := range tool.Shapes {
+				shapes[i] = shape.Shape + "=" + strconv.Itoa(shape.Calls)
+			}
+			var with []string
+			for _, pair := range day.CoOccurrence {
+				switch tool.Tool {
+				case pair.Tools[0]:
+					with = append(with, pair.Tools[1]+"="+strconv.Itoa(pair.Invocations))
+				case pair.Tools[1]:
+					with = append(with, pair.Tools[0]+"="+strconv.Itoa(pair.Invocations))
+				}
+			}
+			out.Write([]string{
+				day.Day,
+				tool.Tool,
+				strconv.Itoa(tool.Calls),
+				strconv.Itoa(tool.Errors),
+				strconv.FormatFloat(tool.SuccessRate, 'f', 3, 64),
+				strconv.FormatInt(tool.AvgDuration, 10),
+				strings.Join(shapes, ";"),
+				strings.Join(with, ";"),
+			})
+		}
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return fmt.Errorf("failed to write tool analytics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxArgumentFixes bounds how many fixes one tool call may need before it is bounced
+const defaultMaxArgumentFixes = 5
+
+// ArgumentRepair checks the arguments the model produced against the tool's input schema
+// before calling it, and fixes what can be fixed without guessing: numbers and booleans
+// sent as strings are converted, missing required arguments with a schema default get the
+// default, and unknown arguments are dropped when the schema sets additionalProperties to
+// false. Calls with other problems, or needing more fixes than MaxFixes, are returned to
+// the model with the problems listed, without reaching the server.
+type ArgumentRepair struct {
+	// MaxFixes bounds the fixes applied to one call; 0 allows 5
+	MaxFixes int
+}
+
+func (r *ArgumentRepair) maxFixes() int {
+	if r.MaxFixes > 0 {
+		return r.MaxFixes
+	}
+	return defaultMaxArgumentFixes
+}
+
+// repair returns a fixed copy of args, the fixes made and the problems left
+func (r *ArgumentRepair) repair(schema, args map[string]interface{}) (map[string]interface{}, []string, []string) {
+	var fixes, problems []string
+	repaired := repairObject("", schema, args, &fixes, &problems)
+	if len(fixes) > r.maxFixes() {
+		problems = append(problems, fmt.Sprintf("arguments need %d corrections, more than the %d allowed", len(fixes), r.maxFixes()))
+	}
+	return repaired, fixes, problems
+}
+
+// repairObject checks an object's properties against schema, recursing into nested objects
+func repairObject(path string, schema, obj map[string]interface{}, fixes, problems *[]string) map[string]interface{} {
+	properties, _ := schema["properties"].(map[string]interface{})
+	closed := schema["additionalProperties"] == false
+
+	repaired := make(map[string]interface{}, len(obj))
+	for _, key := range sortedKeys(obj) {
+		value := obj[key]
+		propSchema, known := properties[key].(map[string]interface{})
+		if !known {
+			if closed {
+				*fixes = append(*fixes, fmt.Sprintf("dropped unknown argument %s", argumentPath(path, key)))
+				continue
+			}
+			repaired[key] = value
+			continue
+		}
+		repaired[key] = repairValue(argumentPath(path, key), propSchema, value, fixes, problems)
+	}
+
+	required, _ := schema["required"].([]interface{})
+	for _, item := range required {
+		key, _ := item.(string)
+		if _, ok := repaired[key]; ok || key == "" {
+			continue
+		}
+		propSchema, _ := properties[key].(map[string]interface{})
+		if def, ok := propSchema["default"]; ok {
+			repaired[key] = def
+			*fixes = append(*fixes, fmt.Sprintf("filled missing %s with its default", argumentPath(path, key)))
+			continue
+		}
+		*problems = append(*problems, fmt.Sprintf("missing required argument %s", argumentPath(path, key)))
+	}
+	return repaired
+}
+
+// repairValue checks one value against its schema's type and enum
+func repairValue(path string, schema map[string]interface{}, value interface{}, fixes, problems *[]string) interface{} {
+	want, _ := schema["type"].(string)
+	if want != "" && !jsonTypeMatches(want, value) {
+		coerced, ok := coerceJSONValue(want, value)
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s must be %s, got %s", path, want, jsonTypeName(value)))
+			return value
+		}
+		*fixes = append(*fixes, fmt.Sprintf("converted %s to %s", path, want))
+		value = coerced
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if want == "object" {
+			value = repairObject(path, schema, v, fixes, problems)
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			repaired := make([]interface{}, len(v))
+			for i, item := range v {
+				repaired[i] = repairValue(fmt.Sprintf("%s[%d]", path, i), items, item, fixes, problems)
+			}
+			value = repaired
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && !enumContains(enum, value) {
+		*problems = append(*problems, fmt.Sprintf("%s must be one of %s", path, enumList(enum)))
+	}
+	return value
+}
+
+// jsonTypeName returns the JSON Schema type of a decoded JSON value
+func jsonTypeName(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case json.Number:
+		if _, err := n.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	default:
+		if f, ok := jsonFloat(v); ok {
+			if f == float64(int64(f)) {
+				return "integer"
+			}
+			return "number"
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func jsonTypeMatches(want string, v interface{}) bool {
+	got := jsonTypeName(v)
+	return got == want || (want == "number" && got == "integer")
+}
+
+// coerceJSONValue converts a string holding a number or boolean to want
+func coerceJSONValue(want string, v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	s = strings.TrimSpace(s)
+	switch want {
+	case "integer":
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return json.Number(s), true
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(s, 64); err == nil && json.Valid([]byte(s)) {
+			return json.Number(s), true
+		}
+	case "boolean":
+		switch s {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+	}
+	return nil, false
+}
+
+func enumContains(enum []interface{}, v interface{}) bool {
+	for _, allowed := range enum {
+		if policyEqual(allowed, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, v := range enum {
+		data, _ := json.Marshal(v)
+		values[i] = string(data)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ", ")
+}
+
+func argumentPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// toolSchema returns the input schema of a tool offered to the model
+func (a *InlineAgent) toolSchema(toolName string) (map[string]interface{}, bool) {
+	for _, group := range a.ActionGroups {
+		for _, tool := range group.Tools {
+			if tool.Name == toolName {
+				return tool.InputSchema, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxAudioBytes bounds a single audio attachment or tool result
+const maxAudioBytes = 25 * 1024 * 1024
+
+// ErrAudioUnsupported is returned for audio input when the agent has no AudioTranscriber.
+// Converse in the Bedrock SDK this module uses has no audio content block, so audio
+// reaches the model as a transcript.
+var ErrAudioUnsupported = errors.New("audio input requires an audio transcriber")
+
+// AudioContent is audio sent with an invocation or returned by a tool, matching MCP's
+// "audio" content block
+type AudioContent struct {
+	MimeType string `json:"mimeType"`
+	// Data is the base64-encoded audio
+	Data string `json:"data"`
+	// Tool is the tool that returned the audio; empty for input audio
+	Tool string `json:"tool,omitempty"`
+}
+
+// decode validates the audio's MIME type and size and returns its bytes
+func (c AudioContent) decode() ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(c.MimeType)
+	if err != nil || !strings.HasPrefix(mediaType, "audio/") {
+		return nil, fmt.Errorf("invalid audio MIME type %q", c.MimeType)
+	}
+	if base64.StdEncoding.DecodedLen(len(c.Data)) > maxAudioBytes {
+		return nil, fmt.Errorf("audio is over the %d byte limit", maxAudioBytes)
+	}
+	data, err := base64.StdEncoding.DecodeString(c.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audio: %w", err)
+	}
+	return data, nil
+}
+
+// AudioTranscriber turns input audio into text for the model
+type AudioTranscriber func(ctx context.Context, mimeType string, audio []byte) (string, error)
+
+// HTTPTranscriber posts audio to url with its MIME type as Content-Type and uses the
+// response body as the transcript, e.g. for a self-hosted speech-to-text service
+func HTTPTranscriber(url string) AudioTranscriber {
+	client := &http.Client{Timeout: 60 * time.Second}
+	return func(ctx context.Context, mimeType string, audio []byte) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(audio))
+		if err != nil {
+			return "", fmt.Errorf("failed to create transcription request: %w", err)
+		}
+		req.Header.Set("Content-Type", mimeType)
+		req.Header.Set("Accept", "text/plain")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to send transcription request: %w", err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read transcription response: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("transcription failed: HTTP %d - %s", resp.StatusCode, string(body))
+		}
+		return strings.TrimSpace(string(body)), nil
+	}
+}
+
+// withAudioTranscripts prepends transcripts of the invocation's audio to the user's text
+func (a *InlineAgent) withAudioTranscripts(ctx context.Context, inputText string, audio []AudioContent) (string, error) {
+	if len(audio) == 0 {
+		return inputText, nil
+	}
+	if a.Transcriber == nil {
+		return "", ErrAudioUnsupported
+	}
+
+	var b strings.Builder
+	for i, clip := range audio {
+		data, err := clip.decode()
+		if err != nil {
+			return "", fmt.Errorf("audio %d: %w", i+1, err)
+		}
+		transcript, err := a.Transcriber(ctx, clip.MimeType, data)
+		if err != nil {
+			return "", fmt.Errorf("failed to transcribe audio %d: %w", i+1, err)
+		}
+		fmt.Fprintf(&b, "[Voice message transcript]\n%s\n\n", transcript)
+	}
+	b.WriteString(inputText)
+	return strings.TrimSpace(b.String()), nil
+}
+
+// audioResultContent formats an MCP audio content block as a tool result entry: a text
+// placeholder for the model, which can't take audio, and the audio for the caller
+func audioResultContent(block ContentBlock) []map[string]interface{} {
+	clip := AudioContent{MimeType: block.MimeType, Data: block.Data}
+	data, err := clip.decode()
+	if err != nil {
+		return []map[string]interface{}{{"text": fmt.Sprintf("[audio omitted: %v]", err)}}
+	}
+	return []map[string]interface{}{
+		{"text": fmt.Sprintf("[audio result: %s, %d bytes, returned to the user]", block.MimeType, len(data))},
+		{"audio": map[string]interface{}{"mimeType": block.MimeType, "data": block.Data}},
+	}
+}
+
+// resultAudio returns the audio entries made by audioResultContent
+func resultAudio(toolName string, content []map[string]interface{}) []AudioContent {
+	var audio []AudioContent
+	for _, c := range content {
+		entry, ok := c["audio"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		mimeType, _ := entry["mimeType"].(string)
+		data, _ := entry["data"].(string)
+		audio = append(audio, AudioContent{MimeType: mimeType, Data: data, Tool: toolName})
+	}
+	return audio
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// toolsListChanged is the notification an MCP server sends when its tool list changes
+const toolsListChanged = "notifications/tools/list_changed"
+
+// ToolCatalog shares discovered tool lists between gateway replicas, so each MCP server is
+// listed once per change rather than once per replica
+type ToolCatalog interface {
+	// Get returns the cached tools for a server and whether there was an entry
+	Get(ctx context.Context, server string) ([]Tool, bool, error)
+	Put(ctx context.Context, server string, tools []Tool) error
+	// Invalidate drops the entry and tells every replica watching the catalog
+	Invalidate(ctx context.Context, server string) error
+	// TryRefreshLock reports whether this replica should re-list the server; the others wait for its result
+	TryRefreshLock(ctx context.Context, server string) (bool, error)
+	// Watch calls fn with the server of every invalidation until ctx is done
+	Watch(ctx context.Context, fn func(server string)) error
+}
+
+// RedisToolCatalog stores tool lists as JSON under "<prefix>tools:<server>" and publishes
+// invalidations on "<prefix>tools:invalidate"
+type RedisToolCatalog struct {
+	client  *redis.Client
+	prefix  string
+	ttl     time.Duration
+	lockTTL time.Duration
+	owner   string
+}
+
+// NewRedisToolCatalog creates a catalog on the Redis server at addr. Entries expire after ttl
+// even without an invalidation, as a safety net for missed notifications.
+func NewRedisToolCatalog(addr string, ttl time.Duration) *RedisToolCatalog {
+	hostname, _ := os.Hostname()
+	return &RedisToolCatalog{
+		client:  redis.NewClient(&redis.Options{Addr: addr}),
+		prefix:  "mcp:",
+		ttl:     ttl,
+		lockTTL: 30 * time.Second,
+		owner:   fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+}
+
+func (c *RedisToolCatalog) key(server string) string {
+	return c.prefix + "tools:" + server
+}
+
+func (c *RedisToolCatalog) channel() string {
+	return c.prefix + "tools:invalidate"
+}
+
+func (c *RedisToolCatalog) Get(ctx context.Context, server string) ([]Tool, bool, error) {
+	data, err := c.client.Get(ctx, c.key(server)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read tool catalog: %w", err)
+	}
+
+	var tools []Tool
+	if err := json.Unmarshal(data, &tools); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal cached tools: %w", err)
+	}
+	return tools, true, nil
+}
+
+func (c *RedisToolCatalog) Put(ctx context.Context, server string, tools []Tool) error {
+	data, err := json.Marshal(tools)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tools: %w", err)
+	}
+	if err := c.client.Set(ctx, c.key(server), data, c.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to write tool catalog: %w", err)
+	}
+	// The refresh is done, so the next invalidation can be handled straight away
+	c.client.Del(ctx, c.key(server)+":refresh")
+	return nil
+}
+
+func (c *RedisToolCatalog) Invalidate(ctx context.Context, server string) error {
+	if err := c.client.Del(ctx, c.key(server)).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate tool catalog: %w", err)
+	}
+	if err := c.client.Publish(ctx, c.channel(), server).Err(); err != nil {
+		return fmt.Errorf("failed to publish invalidation: %w", err)
+	}
+	return nil
+}
+
+func (c *RedisToolCatalog) TryRefreshLock(ctx context.Context, server string) (bool, error) {
+	ok, err := c.client.SetNX(ctx, c.key(server)+":refresh", c.owner, c.lockTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to take refresh lock: %w", err)
+	}
+	return ok, nil
+}
+
+func (c *RedisToolCatalog) Watch(ctx context.Context, fn func(server string)) error {
+	sub := c.client.Subscribe(ctx, c.channel())
+	defer sub.Close()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("tool catalog subscription closed")
+			}
+			fn(msg.Payload)
+		}
+	}
+}
+
+// Close releases the Redis connection pool
+func (c *RedisToolCatalog) Close() error {
+	return c.client.Close()
+}
+
+// SetToolCatalog shares the handler's tool discovery through catalog. A tools/list_changed
+// notification from the server invalidates the entry for every replica.
+func (h *BedrockToolHandler) SetToolCatalog(catalog ToolCatalog) {
+	h.catalog = catalog
+	h.mcpClient.SetNotificationHandler(func(method string) {
+		if method != toolsListChanged {
+			return
+		}
+		log.Printf("Tool list changed on %s", h.mcpClient.BaseURL())
+		if err := catalog.Invalidate(context.Background(), h.mcpClient.BaseURL()); err != nil {
+			log.Printf("Failed to invalidate tool catalog: %v", err)
+		}
+		h.markToolsStale()
+	})
+}
+
+// WatchToolCatalog marks the handler's tools stale whenever another replica invalidates its
+// server. It blocks until ctx is done, reconnecting after errors.
+func (h *BedrockToolHandler) WatchToolCatalog(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := h.catalog.Watch(ctx, func(server string) {
+			if server == h.mcpClient.BaseURL() {
+				h.markToolsStale()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Tool catalog watch failed, retrying: %v", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// PollTools re-lists tools every interval for servers that don't declare tools.listChanged,
+// since their tool changes are never announced. It blocks until ctx is done.
+func (h *BedrockToolHandler) PollTools(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if capabilities, ok := h.mcpClient.Capabilities(); ok && !capabilities.ToolsListChanged() {
+			h.markToolsStale()
+		}
+	}
+}
+
+// RefreshTools re-lists the server's tools now, rather than on the next notification or poll
+func (h *BedrockToolHandler) RefreshTools(ctx context.Context) ([]Tool, error) {
+	h.markToolsStale()
+	return h.Initialize(ctx)
+}
+
+// markToolsStale makes the next Initialize re-discover tools
+func (h *BedrockToolHandler) markToolsStale() {
+	h.toolsMu.Lock()
+	defer h.toolsMu.Unlock()
+	h.stale = true
+}
+
+// discoverTools returns the server's tools from the catalog when cached, otherwise lists them
+// and publishes the result. While another replica holds the refresh lock, previous is
+// returned and ok is false so the caller tries again later.
+func (h *BedrockToolHandler) discoverTools(ctx context.Context, previous []Tool) ([]Tool, bool, error) {
+	server := h.mcpClient.BaseURL()
+
+	if h.catalog != nil {
+		tools, cached, err := h.catalog.Get(ctx, server)
+		if err != nil {
+			log.Printf("Tool catalog unavailable, listing tools directly: %v", err)
+		} else if cached {
+			return tools, true, nil
+		}
+
+		if err == nil && previous != nil {
+			locked, err := h.catalog.TryRefreshLock(ctx, server)
+			if err == nil && !locked {
+				return previous, false, nil
+			}
+		}
+	}
+
+	tools, err := h.mcpClient.ListTools(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list tools: %w", err)
+	}
+
+	if h.catalog != nil {
+		if err := h.catalog.Put(ctx, server, tools); err != nil {
+			log.Printf("Failed to publish tools to catalog: %v", err)
+		}
+	}
+	return tools, true, nil
+}
+
+// refreshTools re-discovers tools after an invalidation, keeping the old list on failure
+func (h *BedrockToolHandler) refreshTools(ctx context.Context) {
+	h.toolsMu.RLock()
+	previous := h.tools
+	h.toolsMu.RUnlock()
+
+	tools, fresh, err := h.discoverTools(ctx, previous)
+	if err != nil {
+		log.Printf("Failed to refresh tools, keeping the previous list: %v", err)
+		return
+	}
+
+	h.toolsMu.Lock()
+	h.tools = tools
+	h.stale = !fresh
+	h.toolsMu.Unlock()
+
+	if diff := DiffTools(h.mcpClient.BaseURL(), previous, tools); !diff.Empty() {
+		h.toolsChanged(diff)
+	}
+}
+
+// toolsChanged logs a tool schema change and reports it to OnToolsChanged
+func (h *BedrockToolHandler) toolsChanged(diff *ToolSchemaDiff) {
+	if diff.Breaking() {
+		log.Printf("Warning: breaking tool change on %s", diff)
+	} else {
+		log.Printf("Tools changed on %s", diff)
+	}
+	h.events.publish(Event{
+		Type:    EventToolsRefreshed,
+		Server:  diff.Server,
+		Message: diff.String(),
+		Data:    map[string]interface{}{"diff": diff, "breaking": diff.Breaking()},
+	})
+	if h.OnToolsChanged != nil {
+		h.OnToolsChanged(diff)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAgentClosed is returned by InlineAgent calls made after Close
+var ErrAgentClosed = errors.New("agent is closed")
+
+// Close closes every MCP client in the group. It is safe to call more than once.
+func (g *ActionGroup) Close(ctx context.Context) error {
+	var errs []error
+	for _, client := range g.MCPClients {
+		if err := client.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close MCP client %s: %w", callerName(client), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close shuts down the agent's action groups; later invocations fail with ErrAgentClosed.
+// It is safe to call more than once. The trace sink is owned by the caller and left open.
+func (a *InlineAgent) Close(ctx context.Context) error {
+	a.initMu.Lock()
+	defer a.initMu.Unlock()
+
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	defer a.events.Close()
+	if a.stopReaper != nil {
+		a.stopReaper()
+	}
+
+	var errs []error
+	for i := range a.ActionGroups {
+		if err := a.ActionGroups[i].Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("action group %s: %w", a.ActionGroups[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isClosed reports whether Close has been called
+func (a *InlineAgent) isClosed() bool {
+	a.initMu.Lock()
+	defer a.initMu.Unlock()
+	return a.closed
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// Codec serializes the gateway's /invoke payloads. JSON is the default; backend workers
+// proxying large tool results can negotiate protobuf with Content-Type and Accept.
+type Codec interface {
+	ContentType() string
+	Marshal(v map[string]interface{}) ([]byte, error)
+	Unmarshal(data []byte) (map[string]interface{}, error)
+}
+
+const (
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
+// codecs are the serializers the gateway accepts, keyed by media type
+var codecs = map[string]Codec{
+	contentTypeJSON:     jsonCodec{},
+	contentTypeProtobuf: protobufCodec{},
+}
+
+// codecFor returns the codec for a Content-Type or Accept header value; empty or */* selects JSON
+func codecFor(header string) (Codec, error) {
+	if header == "" {
+		return codecs[contentTypeJSON], nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid media type %q: %w", header, err)
+	}
+	if mediaType == "*/*" {
+		return codecs[contentTypeJSON], nil
+	}
+	codec, ok := codecs[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported media type %q", mediaType)
+	}
+	return codec, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return contentTypeJSON }
+
+func (jsonCodec) Marshal(v map[string]interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	var v map[string]interface{}
+	if err := mcpclient.UnmarshalJSONNumbers(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// protobufCodec encodes payloads as google.protobuf.Struct
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return contentTypeProtobuf }
+
+func (protobufCodec) Marshal(v map[string]interface{}) ([]byte, error) {
+	s, err := structpb.NewStruct(toStructValue(v).(map[string]interface{}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert payload to protobuf: %w", err)
+	}
+	return proto.Marshal(s)
+}
+
+func (protobufCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	var s structpb.Struct
+	if err := proto.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return s.AsMap(), nil
+}
+
+// toStructValue converts the typed slices the gateway builds (e.g. []map[string]interface{})
+// into the generic forms structpb accepts
+func toStructValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			out[k] = toStructValue(item)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = toStructValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = toStructValue(item)
+		}
+		return out
+	case []string:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = item
+		}
+		return out
+	case int:
+		return float64(t)
+	case int32:
+		return float64(t)
+	case int64:
+		return float64(t)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// followUpMeta is the _meta key of a tool result requesting follow-up tool calls
+	followUpMeta = "followUp"
+	// defaultMaxFollowUps bounds the follow-up calls one model tool call may lead to
+	defaultMaxFollowUps = 5
+)
+
+// ToolComposition lets tools chain other tools without a model round trip. A tool result
+// whose _meta has a "followUp" entry, {"name": ..., "arguments": {...}} or a list of them,
+// has the agent call those tools next, and their outputs are added to the result the model
+// sees. Follow-up calls go through the same quotas and tool policy as the model's own.
+type ToolComposition struct {
+	// MaxSteps is how many follow-up calls, chained ones included, one model tool call may
+	// lead to; 0 uses 5
+	MaxSteps int
+	// Allowed maps a tool to the tools it may request; nil lets any tool request any other
+	Allowed map[string][]string
+}
+
+// FollowUpRequest is one tool call requested by a tool result
+type FollowUpRequest struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+func (c *ToolComposition) maxSteps() int {
+	if c.MaxSteps > 0 {
+		return c.MaxSteps
+	}
+	return defaultMaxFollowUps
+}
+
+// allows reports whether from may request a call to to
+func (c *ToolComposition) allows(from, to string) bool {
+	if c.Allowed == nil {
+		return true
+	}
+	return containsString(c.Allowed[from], to)
+}
+
+// followUpRequests reads the follow-up requests from a tool result's _meta
+func followUpRequests(meta map[string]interface{}) []FollowUpRequest {
+	var entries []interface{}
+	switch v := meta[followUpMeta].(type) {
+	case map[string]interface{}:
+		entries = []interface{}{v}
+	case []interface{}:
+		entries = v
+	}
+
+	var requests []FollowUpRequest
+	for _, entry := range entries {
+		m, _ := entry.(map[string]interface{})
+		name, _ := m["name"].(string)
+		if name == "" {
+			continue
+		}
+		args, _ := m["arguments"].(map[string]interface{})
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		requests = append(requests, FollowUpRequest{Name: name, Arguments: args})
+	}
+	return requests
+}
+
+// pendingFollowUp is a follow-up request waiting to run, with the tool that made it
+type pendingFollowUp struct {
+	from    string
+	request FollowUpRequest
+}
+
+// runFollowUps runs the follow-up calls requested by a tool result, and any they request in
+// turn, appending each one's output to result. It returns their call records.
+func (a *InlineAgent) runFollowUps(ctx context.Context, toolUse, result map[string]interface{}, invocation *Result, sessionToolCalls int, sessionID string, tags map[string]string, emit func(TraceEvent)) ([]ToolCallRecord, error) {
+	if a.Composition == nil {
+		return nil, nil
+	}
+	requests, _ := result["followUps"].([]FollowUpRequest)
+	delete(result, "followUps")
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	parentID, _ := toolUse["toolUseId"].(string)
+	parent, _ := toolUse["name"].(string)
+	var queue []pendingFollowUp
+	for _, request := range requests {
+		queue = append(queue, pendingFollowUp{from: parent, request: request})
+	}
+
+	var records []ToolCallRecord
+	for step := 0; len(queue) > 0; step++ {
+		next := queue[0]
+		queue = queue[1:]
+		name := next.request.Name
+
+		var note string
+		switch {
+		case step >= a.Composition.maxSteps():
+			note = fmt.Sprintf("Follow-up call to %s was skipped: at most %d follow-up calls are allowed.", name, a.Composition.maxSteps())
+		case !a.Composition.allows(next.from, name):
+			note = fmt.Sprintf("Follow-up call to %s was skipped: %s may not request it.", name, next.from)
+		}
+		if note != "" {
+			appendToolText(result, note)
+			continue
+		}
+
+		followUse := map[string]interface{}{
+			"toolUseId": fmt.Sprintf("%s-followup-%d", parentID, step+1),
+			"name":      name,
+			"input":     next.request.Arguments,
+		}
+		handle := a.handleToolUse
+		if a.toolHandler != nil {
+			handle = a.toolHandler
+		}
+		var refusal *quotaRefusal
+		if a.ToolQuotas != nil {
+			calls := append(append([]ToolCallRecord{}, invocation.ToolCalls...), records...)
+			refusal = a.ToolQuotas.exceeded(name, calls, sessionToolCalls)
+		}
+		if refusal != nil {
+			handle = refusal.handler()
+		} else if denial, err := a.evaluateToolPolicy(ctx, followUse, sessionID, tags, emit); err != nil {
+			return nil, err
+		} else if denial != nil {
+			handle = denial.handler()
+		}
+
+		start := time.Now()
+		followResult, err := handle(ctx, followUse)
+		duration := time.Since(start)
+		if err != nil {
+			emit(TraceEvent{Type: TraceToolCall, SessionID: sessionID, Tool: name, Duration: duration, Error: err.Error()})
+			return nil, fmt.Errorf("follow-up tool execution failed: %w", err)
+		}
+		chained, _ := followResult["followUps"].([]FollowUpRequest)
+		delete(followResult, "followUps")
+		for _, request := range chained {
+			queue = append(queue, pendingFollowUp{from: name, request: request})
+		}
+
+		var text strings.Builder
+		content, _ := followResult["content"].([]map[string]interface{})
+		for _, c := range content {
+			if t, ok := c["text"].(string); ok {
+				text.WriteString(t)
+			}
+		}
+		status, _ := followResult["status"].(string)
+		appendToolText(result, fmt.Sprintf("Result of follow-up call to %s (%s):\n%s", name, status, text.String()))
+
+		records = append(records, ToolCallRecord{
+			ToolUseID: followUse["toolUseId"].(string),
+			Name:      name,
+			Input:     followUse["input"].(map[string]interface{}),
+			Output:    text.String(),
+			Status:    status,
+			Duration:  duration,
+		})
+		emit(TraceEvent{
+			Type:      TraceToolCall,
+			SessionID: sessionID,
+			Tool:      name,
+			Duration:  duration,
+			Data: map[string]interface{}{
+				"toolUseId":   followUse["toolUseId"],
+				"status":      status,
+				"requestedBy": next.from,
+			},
+		})
+	}
+	return records, nil
+}
+
+// appendToolText adds a text block to a tool result in Bedrock format
+func appendToolText(result map[string]interface{}, text string) {
+	content, _ := result["content"].([]map[string]interface{})
+	result["content"] = append(content, map[string]interface{}{"text": "\n\n" + text})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"mcp-client/pkg/mcpclient"
+	"mcp-client/pkg/mcpclient/mcptest"
+)
+
+// runConformanceCommand implements "conformance [-url URL] [-tool NAME] [-args JSON] [-json]"
+// against an HTTP server, and exits non-zero when a check fails
+func runConformanceCommand(args []string) {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	url := fs.String("url", "http://localhost:3001/mcp", "MCP server URL")
+	tool := fs.String("tool", "get_current_time", "side-effect free tool to call")
+	toolArgs := fs.String("args", `{"timezone": "UTC"}`, "tool arguments as JSON")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	timeout := fs.Duration("timeout", 2*time.Minute, "overall time limit")
+	fs.Parse(args)
+
+	var arguments map[string]interface{}
+	if err := json.Unmarshal([]byte(*toolArgs), &arguments); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -args: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	report := mcptest.RunConformance(ctx, mcptest.ConformanceConfig{
+		NewCaller: func() mcpclient.MCPCaller { return mcpclient.New(*url) },
+		Tool:      *tool,
+		Arguments: arguments,
+	})
+	if *asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		mcptest.PrintConformanceReport(os.Stdout, report)
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
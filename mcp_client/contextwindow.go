@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+const (
+	// defaultContextWindow is the context window assumed for models not in modelContextWindows
+	defaultContextWindow = 200000
+	// defaultReserveTokens is left for the answer when no max tokens is configured
+	defaultReserveTokens = 4096
+	// imageTokens is a flat estimate per image, about what a 1000x1000 image costs
+	imageTokens = 1600
+	// elidedToolResult replaces tool output dropped to fit the context window
+	elidedToolResult = "[tool output removed to fit the context window]"
+)
+
+// ErrContextWindowExceeded is returned by Invoke when the conversation can't be compacted to
+// fit the model's context window
+var ErrContextWindowExceeded = errors.New("conversation exceeds the model's context window")
+
+// modelContextWindows lists the context window in tokens of the models we use
+var modelContextWindows = map[string]int{
+	"us.anthropic.claude-3-5-sonnet-20241022-v2:0": 200000,
+	"us.anthropic.claude-3-7-sonnet-20250219-v1:0": 200000,
+	"us.anthropic.claude-3-5-haiku-20241022-v1:0":  200000,
+	"us.anthropic.claude-3-haiku-20240307-v1:0":    200000,
+	"us.amazon.nova-pro-v1:0":                      300000,
+	"us.amazon.nova-lite-v1:0":                     300000,
+	"us.amazon.nova-micro-v1:0":                    128000,
+}
+
+// ContextLimit checks the estimated size of every model call against the model's context
+// window and compacts the conversation before it is sent, rather than letting Bedrock
+// reject it with a ValidationException. Earlier turns of the session are dropped first,
+// oldest first; then old tool outputs are replaced with a placeholder. The estimate is
+// about four bytes per token, so ReserveTokens also serves as a safety margin.
+type ContextLimit struct {
+	// MaxTokens is the context window to fit; 0 uses the model's
+	MaxTokens int
+	// ReserveTokens is left free for the answer; 0 uses the max tokens of the inference
+	// configuration, or 4096
+	ReserveTokens int
+}
+
+// budget returns the tokens the input of a call to modelID may use
+func (l *ContextLimit) budget(modelID string, inference *types.InferenceConfiguration) int {
+	window := l.MaxTokens
+	if window <= 0 {
+		window = defaultContextWindow
+		if w, ok := modelContextWindows[modelID]; ok {
+			window = w
+		}
+	}
+	reserve := l.ReserveTokens
+	if reserve <= 0 {
+		reserve = defaultReserveTokens
+		if inference != nil && inference.MaxTokens != nil {
+			reserve = int(aws.ToInt32(inference.MaxTokens))
+		}
+	}
+	return window - reserve
+}
+
+// estimateTokens returns the text size in tokens at about four bytes per token
+func estimateTokens(n int) int {
+	return (n + 3) / 4
+}
+
+// estimateDocumentTokens estimates a JSON document, such as a tool input
+func estimateDocumentTokens(v interface{}) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return estimateTokens(len(data))
+}
+
+// estimateMessageTokens estimates the tokens of one message
+func estimateMessageTokens(message types.Message) int {
+	tokens := 0
+	for _, content := range message.Content {
+		switch c := content.(type) {
+		case *types.ContentBlockMemberText:
+			tokens += estimateTokens(len(c.Value))
+		case *types.ContentBlockMemberToolUse:
+			tokens += estimateTokens(len(aws.ToString(c.Value.Name)))
+			if c.Value.Input != nil {
+				tokens += estimateDocumentTokens(decodeDocument(c.Value.Input))
+			}
+		case *types.ContentBlockMemberToolResult:
+			tokens += estimateToolResultTokens(c.Value)
+		case *types.ContentBlockMemberDocument:
+			tokens += estimateDocumentBlockTokens(c.Value)
+		case *types.ContentBlockMemberImage:
+			tokens += imageTokens
+		}
+	}
+	return tokens
+}
+
+func estimateToolResultTokens(result types.ToolResultBlock) int {
+	tokens := 0
+	for _, content := range result.Content {
+		switch c := content.(type) {
+		case *types.ToolResultContentBlockMemberText:
+			tokens += estimateTokens(len(c.Value))
+		case *types.ToolResultContentBlockMemberJson:
+			if c.Value != nil {
+				tokens += estimateDocumentTokens(decodeDocument(c.Value))
+			}
+		case *types.ToolResultContentBlockMemberDocument:
+			tokens += estimateDocumentBlockTokens(c.Value)
+		case *types.ToolResultContentBlockMemberImage:
+			tokens += imageTokens
+		}
+	}
+	return tokens
+}
+
+// estimateDocumentBlockTokens counts a document's raw bytes; binary formats such as PDF
+// extract to less text than that, so this errs on the large side
+func estimateDocumentBlockTokens(doc types.DocumentBlock) int {
+	if source, ok := doc.Source.(*types.DocumentSourceMemberBytes); ok {
+		return estimateTokens(len(source.Value))
+	}
+	return 0
+}
+
+// estimateInputTokens estimates the tokens of a Converse request: the system prompt, the
+// tool configuration and the messages
+func estimateInputTokens(input *bedrockruntime.ConverseInput, toolTokens int) int {
+	tokens := toolTokens
+	for _, block := range input.System {
+		if text, ok := block.(*types.SystemContentBlockMemberText); ok {
+			tokens += estimateTokens(len(text.Value))
+		}
+	}
+	for _, message := range input.Messages {
+		tokens += estimateMessageTokens(message)
+	}
+	return tokens
+}
+
+// isTurnStart reports whether a message begins a turn: a user message with text, as opposed
+// to one carrying tool results
+func isTurnStart(message types.Message) bool {
+	if message.Role != types.ConversationRoleUser {
+		return false
+	}
+	for _, content := range message.Content {
+		if _, ok := content.(*types.ContentBlockMemberText); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// elideToolResults returns a copy of message with the output of its tool results replaced
+// by a placeholder, and how many results were elided. The message's content is copied so
+// the session's history is not changed in place.
+func elideToolResults(message types.Message) (types.Message, int) {
+	elided := 0
+	content := make([]types.ContentBlock, len(message.Content))
+	for i, block := range message.Content {
+		content[i] = block
+		result, ok := block.(*types.ContentBlockMemberToolResult)
+		if !ok {
+			continue
+		}
+		if len(result.Value.Content) == 1 {
+			if text, ok := result.Value.Content[0].(*types.ToolResultContentBlockMemberText); ok && text.Value == elidedToolResult {
+				continue
+			}
+		}
+		content[i] = &types.ContentBlockMemberToolResult{
+			Value: types.ToolResultBlock{
+				ToolUseId: result.Value.ToolUseId,
+				Status:    result.Value.Status,
+				Content: []types.ToolResultContentBlock{
+					&types.ToolResultContentBlockMemberText{Value: elidedToolResult},
+				},
+			},
+		}
+		elided++
+	}
+	message.Content = content
+	return message, elided
+}
+
+// fitContextWindow compacts input.Messages until the request is estimated to fit the
+// model's context window. Only turns before current, the index of this invocation's user
+// message, are dropped. It returns how many leading messages were dropped.
+func (a *InlineAgent) fitContextWindow(input *bedrockruntime.ConverseInput, modelID string, toolTokens, current int, sessionID string, emit func(TraceEvent)) (int, error) {
+	budget := a.ContextLimit.budget(modelID, input.InferenceConfig)
+	before := estimateInputTokens(input, toolTokens)
+	if before <= budget {
+		return 0, nil
+	}
+
+	messages := input.Messages
+	tokens := before
+
+	// Drop whole earlier turns, oldest first, so the conversation still starts with a user turn
+	dropped := 0
+	for tokens > budget && dropped < current {
+		next := dropped + 1
+		for next < current && !isTurnStart(messages[next]) {
+			next++
+		}
+		for _, message := range messages[dropped:next] {
+			tokens -= estimateMessageTokens(message)
+		}
+		dropped = next
+	}
+	messages = messages[dropped:]
+
+	// Then replace tool outputs, oldest first, leaving the latest ones the model is about to read
+	elided := 0
+	if tokens > budget {
+		messages = append([]types.Message{}, messages...)
+		for i := 0; i < len(messages)-1 && tokens > budget; i++ {
+			compacted, n := elideToolResults(messages[i])
+			if n == 0 {
+				continue
+			}
+			tokens += estimateMessageTokens(compacted) - estimateMessageTokens(messages[i])
+			messages[i] = compacted
+			elided += n
+		}
+	}
+
+	data := map[string]interface{}{
+		"model":           modelID,
+		"budget":          budget,
+		"tokensBefore":    before,
+		"tokensAfter":     tokens,
+		"droppedMessages": dropped,
+		"elidedResults":   elided,
+	}
+	if tokens > budget {
+		err := fmt.Errorf("%w: about %d tokens after compaction, %d available for %s", ErrContextWindowExceeded, tokens, budget, modelID)
+		emit(TraceEvent{Type: TraceCompaction, SessionID: sessionID, Error: err.Error(), Data: data})
+		return 0, err
+	}
+	emit(TraceEvent{Type: TraceCompaction, SessionID: sessionID, Data: data})
+
+	input.Messages = messages
+	return dropped, nil
+}
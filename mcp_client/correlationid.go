@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// maxCorrelationIDLength bounds correlation IDs accepted from clients
+const maxCorrelationIDLength = 128
+
+// newCorrelationID returns a random 16 byte hex ID
+func newCorrelationID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// acceptCorrelationID returns id if a client may set it, or a new ID. IDs end up in log
+// lines and headers, so only short printable ASCII without spaces is accepted.
+func acceptCorrelationID(id string) string {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return newCorrelationID()
+	}
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return newCorrelationID()
+		}
+	}
+	return id
+}
+
+// logf logs like log.Printf, prefixed with the correlation ID of ctx when there is one, so
+// one grep finds every line of a request
+func logf(ctx context.Context, format string, args ...interface{}) {
+	if id := mcpclient.CorrelationID(ctx); id != "" {
+		log.Printf("[%s] %s", id, fmt.Sprintf(format, args...))
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// bedrockToolNamePattern is the tool name format Converse accepts
+var bedrockToolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ServerDiagnosis is what doctor found out about one MCP server
+type ServerDiagnosis struct {
+	Server string                 `json:"server"`
+	OK     bool                   `json:"ok"`
+	Stage  mcpclient.StartupStage `json:"stage,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+	// ErrorClass is "auth" when the server rejected the credentials rather than failing
+	ErrorClass      string        `json:"errorClass,omitempty"`
+	ProtocolVersion string        `json:"protocolVersion,omitempty"`
+	ServerName      string        `json:"serverName,omitempty"`
+	ServerVersion   string        `json:"serverVersion,omitempty"`
+	Capabilities    []string      `json:"capabilities,omitempty"`
+	Tools           int           `json:"tools"`
+	Warnings        []string      `json:"warnings,omitempty"`
+	Duration        time.Duration `json:"duration"`
+	// Streams is how the server's event stream responses behaved during the checks
+	Streams *mcpclient.SSEStreamStats `json:"streams,omitempty"`
+}
+
+// DoctorReport is the outcome of a doctor run
+type DoctorReport struct {
+	Servers []ServerDiagnosis `json:"servers"`
+	Model   string            `json:"model"`
+	ModelOK bool              `json:"modelOk"`
+	// ModelError is why the model could not be called, e.g. missing model access
+	ModelError string `json:"modelError,omitempty"`
+	// ToolConfigBytes and ToolConfigTokens estimate the size of the tool configuration sent with every model call
+	ToolConfigBytes  int `json:"toolConfigBytes"`
+	ToolConfigTokens int `json:"toolConfigTokens"`
+	// ToolConfigLimit is the agent's limit in tokens, or 0 when it has none
+	ToolConfigLimit int  `json:"toolConfigLimit,omitempty"`
+	OK              bool `json:"ok"`
+}
+
+// RunDoctor connects to every client, checks the discovered tools against what Bedrock
+// accepts and makes a minimal model call, reporting problems rather than stopping at the first
+func (a *InlineAgent) RunDoctor(ctx context.Context, clients []MCPCaller) *DoctorReport {
+	report := &DoctorReport{Model: a.FoundationModel, OK: true}
+
+	var allTools []Tool
+	seen := make(map[string]string)
+	for _, client := range clients {
+		diagnosis := diagnoseServer(ctx, client)
+		for _, tool := range diagnosis.tools {
+			if other, ok := seen[tool.Name]; ok {
+				diagnosis.Warnings = append(diagnosis.Warnings, fmt.Sprintf("tool %s is also provided by %s", tool.Name, other))
+			}
+			seen[tool.Name] = diagnosis.Server
+		}
+		allTools = append(allTools, diagnosis.tools...)
+		report.OK = report.OK && diagnosis.OK
+		report.Servers = append(report.Servers, diagnosis.ServerDiagnosis)
+	}
+
+	report.ToolConfigBytes, report.ToolConfigTokens = toolConfigSize(allTools)
+	if a.ToolConfigLimit != nil {
+		report.ToolConfigLimit = a.ToolConfigLimit.maxTokens()
+		if report.ToolConfigTokens > report.ToolConfigLimit && a.ToolConfigLimit.Fail {
+			report.OK = false
+		}
+	}
+
+	if err := a.pingModel(ctx); err != nil {
+		report.ModelError = err.Error()
+		report.OK = false
+	} else {
+		report.ModelOK = true
+	}
+	return report
+}
+
+// serverDiagnosis carries the discovered tools alongside the diagnosis
+type serverDiagnosis struct {
+	ServerDiagnosis
+	tools []Tool
+}
+
+func diagnoseServer(ctx context.Context, client MCPCaller) serverDiagnosis {
+	start := time.Now()
+	d := serverDiagnosis{ServerDiagnosis: ServerDiagnosis{Server: callerName(client)}}
+
+	tools, err := handshake(ctx, client, nil, nil)
+	d.Duration = time.Since(start)
+	if mcpClient, ok := client.(*MCPClient); ok {
+		if streams := mcpClient.SSEStats(); streams.Streams > 0 {
+			d.Streams = &streams
+			if !streams.Healthy() {
+				d.Warnings = append(d.Warnings, fmt.Sprintf("%d of %d response streams dropped or failed, last: %s", streams.Dropped+streams.ReadErrors+streams.ParseErrors, streams.Streams, streams.LastError))
+			}
+			if streams.Gaps > 0 {
+				d.Warnings = append(d.Warnings, fmt.Sprintf("response streams stalled %d times, longest for %s", streams.Gaps, streams.MaxGap.Round(time.Millisecond)))
+			}
+		}
+	}
+	if err != nil {
+		var stageErr *mcpclient.StageError
+		if errors.As(err, &stageErr) {
+			d.Stage = stageErr.Stage
+			err = stageErr.Err
+		}
+		d.Error = err.Error()
+		d.ErrorClass = mcpclient.ErrorClass(err)
+		if d.ErrorClass == mcpclient.ErrorClassAuth {
+			d.Warnings = append(d.Warnings, "the server rejected the credentials; check the token rather than the server")
+		}
+		return d
+	}
+	d.OK = true
+	d.Tools = len(tools)
+	d.tools = tools
+
+	if mcpClient, ok := client.(*MCPClient); ok {
+		result := mcpClient.InitializeResult()
+		d.ProtocolVersion, _ = result["protocolVersion"].(string)
+		if info, ok := result["serverInfo"].(map[string]interface{}); ok {
+			d.ServerName, _ = info["name"].(string)
+			d.ServerVersion, _ = info["version"].(string)
+		}
+		if caps, ok := result["capabilities"].(map[string]interface{}); ok {
+			for name := range caps {
+				d.Capabilities = append(d.Capabilities, name)
+			}
+			sort.Strings(d.Capabilities)
+		}
+	}
+
+	for _, tool := range tools {
+		d.Warnings = append(d.Warnings, toolSchemaWarnings(tool)...)
+	}
+	return d
+}
+
+// toolSchemaWarnings lists the ways a tool's name or schema may be rejected or misread by Bedrock
+func toolSchemaWarnings(tool Tool) []string {
+	var warnings []string
+	if !bedrockToolNamePattern.MatchString(tool.Name) {
+		warnings = append(warnings, fmt.Sprintf("tool %q: name must match %s", tool.Name, bedrockToolNamePattern))
+	}
+	if strings.TrimSpace(tool.Description) == "" {
+		warnings = append(warnings, fmt.Sprintf("tool %s: no description, so the model has to guess when to use it", tool.Name))
+	}
+	if tool.InputSchema == nil {
+		return append(warnings, fmt.Sprintf("tool %s: no input schema", tool.Name))
+	}
+	if t, _ := tool.InputSchema["type"].(string); t != "object" {
+		warnings = append(warnings, fmt.Sprintf("tool %s: input schema type is %q, Bedrock requires \"object\"", tool.Name, t))
+	}
+	for _, keyword := range []string{"oneOf", "anyOf", "allOf"} {
+		if _, ok := tool.InputSchema[keyword]; ok {
+			warnings = append(warnings, fmt.Sprintf("tool %s: top-level %s is not supported in input schemas", tool.Name, keyword))
+		}
+	}
+	if schemaContains(tool.InputSchema, "$ref") {
+		warnings = append(warnings, fmt.Sprintf("tool %s: input schema uses $ref, which some models don't resolve", tool.Name))
+	}
+	return warnings
+}
+
+// schemaContains reports whether key appears anywhere in a JSON schema
+func schemaContains(v interface{}, key string) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if k == key || schemaContains(child, key) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if schemaContains(child, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pingModel makes the smallest possible model call to check model access
+func (a *InlineAgent) pingModel(ctx context.Context) error {
+	_, err := a.bedrockClient.Converse(ctx, &bedrockruntime.ConverseInput{
+		ModelId: aws.String(a.FoundationModel),
+		Messages: []types.Message{{
+			Role:    types.ConversationRoleUser,
+			Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: "ping"}},
+		}},
+		InferenceConfig: &types.InferenceConfiguration{MaxTokens: aws.Int32(1)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", a.FoundationModel, err)
+	}
+	return nil
+}
+
+// printDoctorReport writes the report as a readable checklist
+func printDoctorReport(w io.Writer, report *DoctorReport) {
+	for _, s := range report.Servers {
+		if !s.OK {
+			fmt.Fprintf(w, "[FAIL] %s: failed at %s after %s: %s\n", s.Server, s.Stage, s.Duration.Round(time.Millisecond), s.Error)
+			continue
+		}
+		name := s.ServerName
+		if s.ServerVersion != "" {
+			name += " " + s.ServerVersion
+		}
+		fmt.Fprintf(w, "[ OK ] %s: %s, protocol %s, %d tools in %s\n", s.Server, name, s.ProtocolVersion, s.Tools, s.Duration.Round(time.Millisecond))
+		if len(s.Capabilities) > 0 {
+			fmt.Fprintf(w, "       capabilities: %s\n", strings.Join(s.Capabilities, ", "))
+		}
+		if s.Streams != nil {
+			fmt.Fprintf(w, "       streams: %d, dropped %d, read errors %d, parse errors %d, longest gap %s\n",
+				s.Streams.Streams, s.Streams.Dropped, s.Streams.ReadErrors, s.Streams.ParseErrors, s.Streams.MaxGap.Round(time.Millisecond))
+		}
+		for _, warning := range s.Warnings {
+			fmt.Fprintf(w, "[WARN] %s\n", warning)
+		}
+	}
+
+	if report.ModelOK {
+		fmt.Fprintf(w, "[ OK ] model %s is accessible\n", report.Model)
+	} else {
+		fmt.Fprintf(w, "[FAIL] model %s: %s\n", report.Model, report.ModelError)
+	}
+	fmt.Fprintf(w, "       tool config: %d bytes, about %d tokens per model call\n", report.ToolConfigBytes, report.ToolConfigTokens)
+	if report.ToolConfigLimit > 0 && report.ToolConfigTokens > report.ToolConfigLimit {
+		fmt.Fprintf(w, "[WARN] tool config is over the %d token limit\n", report.ToolConfigLimit)
+	}
+}
+
+// runDoctorCommand implements "doctor [-json] [-timeout D]" and exits non-zero when a check fails
+func runDoctorCommand(agent *InlineAgent, clients []MCPCaller, args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	timeout := fs.Duration("timeout", time.Minute, "overall time limit")
+	fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	report := agent.RunDoctor(ctx, clients)
+	if *asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		printDoctorReport(os.Stdout, report)
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
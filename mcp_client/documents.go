@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// maxDocumentBytes is Bedrock's size limit for a single document block
+const maxDocumentBytes = 4.5 * 1024 * 1024
+
+// documentFormats maps the MIME types Converse accepts as documents to their format
+var documentFormats = map[string]types.DocumentFormat{
+	"application/pdf":          types.DocumentFormatPdf,
+	"text/csv":                 types.DocumentFormatCsv,
+	"application/msword":       types.DocumentFormatDoc,
+	"application/vnd.ms-excel": types.DocumentFormatXls,
+	"text/html":                types.DocumentFormatHtml,
+	"text/plain":               types.DocumentFormatTxt,
+	"text/markdown":            types.DocumentFormatMd,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": types.DocumentFormatDocx,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       types.DocumentFormatXlsx,
+}
+
+// invalidDocumentName matches characters Converse rejects in document names
+var invalidDocumentName = regexp.MustCompile(`[^A-Za-z0-9\-()\[\] ]+`)
+
+// documentBlock converts an embedded resource into a Converse document block. ok is false
+// for MIME types Converse can't take as a document; the caller keeps those as text.
+func documentBlock(resource *EmbeddedResource, index int) (doc types.DocumentBlock, ok bool, err error) {
+	mediaType, _, _ := mime.ParseMediaType(resource.MimeType)
+	format, ok := documentFormats[mediaType]
+	if !ok {
+		return doc, false, nil
+	}
+
+	var data []byte
+	if resource.Blob != "" {
+		if data, err = base64.StdEncoding.DecodeString(resource.Blob); err != nil {
+			return doc, true, fmt.Errorf("failed to decode resource %s: %w", resource.URI, err)
+		}
+	} else {
+		data = []byte(resource.Text)
+	}
+	if len(data) > maxDocumentBytes {
+		return doc, true, fmt.Errorf("resource %s is %d bytes, over the %d byte document limit", resource.URI, len(data), int(maxDocumentBytes))
+	}
+
+	return types.DocumentBlock{
+		Format: format,
+		Name:   aws.String(documentName(resource.URI, index)),
+		Source: &types.DocumentSourceMemberBytes{Value: data},
+	}, true, nil
+}
+
+// documentName derives a Converse-safe name from the resource URI's base name. Names must be
+// unique within a request, so the block index is appended.
+func documentName(uri string, index int) string {
+	base := path.Base(uri)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	name := strings.Join(strings.Fields(invalidDocumentName.ReplaceAllString(base, " ")), " ")
+	if name == "" || name == "." || name == "/" {
+		name = "document"
+	}
+	return fmt.Sprintf("%s (%d)", name, index+1)
+}
+
+// toolResultContent formats MCP content blocks as Bedrock tool result content. Embedded
+// resources Converse accepts as documents become "document" entries in Converse's JSON shape;
+// other resources contribute their text. Audio blocks become an "audio" entry for the
+// caller and a text placeholder for the model.
+func toolResultContent(blocks []ContentBlock) []map[string]interface{} {
+	content := make([]map[string]interface{}, 0, len(blocks))
+	documents := 0
+	for _, block := range blocks {
+		if block.Type == "audio" {
+			content = append(content, audioResultContent(block)...)
+			continue
+		}
+		if block.Resource == nil {
+			content = append(content, map[string]interface{}{"text": block.Text})
+			continue
+		}
+
+		doc, ok, err := documentBlock(block.Resource, documents)
+		switch {
+		case err != nil:
+			log.Printf("Dropping resource %s from tool result: %v", block.Resource.URI, err)
+			content = append(content, map[string]interface{}{
+				"text": fmt.Sprintf("[resource %s omitted: %v]", block.Resource.URI, err),
+			})
+		case ok:
+			documents++
+			content = append(content, map[string]interface{}{
+				"document": map[string]interface{}{
+					"format": string(doc.Format),
+					"name":   aws.ToString(doc.Name),
+					"source": map[string]interface{}{
+						"bytes": doc.Source.(*types.DocumentSourceMemberBytes).Value,
+					},
+				},
+			})
+		default:
+			content = append(content, map[string]interface{}{"text": block.Resource.Text})
+		}
+	}
+	return content
+}
+
+// converseDocument converts a "document" entry made by toolResultContent back into a
+// Converse document block
+func converseDocument(entry map[string]interface{}) (types.DocumentBlock, bool) {
+	doc, ok := entry["document"].(map[string]interface{})
+	if !ok {
+		return types.DocumentBlock{}, false
+	}
+	format, _ := doc["format"].(string)
+	name, _ := doc["name"].(string)
+	source, _ := doc["source"].(map[string]interface{})
+	data, _ := source["bytes"].([]byte)
+	return types.DocumentBlock{
+		Format: types.DocumentFormat(format),
+		Name:   aws.String(name),
+		Source: &types.DocumentSourceMemberBytes{Value: data},
+	}, true
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// EvalSuite is a set of prompt fixtures checked against the agent with mocked tools
+type EvalSuite struct {
+	// Tools are offered to the model instead of the agent's discovered tools, so
+	// a suite can run without any MCP server
+	Tools    []Tool        `json:"tools,omitempty"`
+	Fixtures []EvalFixture `json:"fixtures"`
+}
+
+// EvalFixture is one prompt and what the agent is expected to do with it
+type EvalFixture struct {
+	Name   string `json:"name"`
+	Prompt string `json:"prompt"`
+	// ExpectTools must all be called, in any order
+	ExpectTools []ExpectedToolCall `json:"expectTools,omitempty"`
+	// ForbidTools must not be called
+	ForbidTools []string `json:"forbidTools,omitempty"`
+	// AnswerPatterns are regular expressions the final answer must match
+	AnswerPatterns []string `json:"answerPatterns,omitempty"`
+	// MockResults maps tool names to the output the mocked tool returns
+	MockResults map[string]string `json:"mockResults,omitempty"`
+}
+
+// ExpectedToolCall matches a tool call by name and argument patterns
+type ExpectedToolCall struct {
+	Name string `json:"name"`
+	// Args maps argument names to regular expressions matched against the argument's JSON value
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// EvalReport is the outcome of running a suite
+type EvalReport struct {
+	Passed  int              `json:"passed"`
+	Failed  int              `json:"failed"`
+	Results []EvalCaseResult `json:"results"`
+}
+
+// EvalCaseResult is the outcome of one fixture
+type EvalCaseResult struct {
+	Name      string           `json:"name"`
+	Passed    bool             `json:"passed"`
+	Failures  []string         `json:"failures,omitempty"`
+	Answer    string           `json:"answer"`
+	ToolCalls []ToolCallRecord `json:"toolCalls"`
+}
+
+// LoadEvalSuite reads a suite from a JSON file
+func LoadEvalSuite(path string) (*EvalSuite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read eval suite: %w", err)
+	}
+
+	var suite EvalSuite
+	if err := json.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse eval suite: %w", err)
+	}
+	return &suite, nil
+}
+
+// RunEval runs every fixture through the model with mocked tools and checks the expectations
+func (a *InlineAgent) RunEval(suite *EvalSuite) (*EvalReport, error) {
+	report := &EvalReport{}
+
+	for _, fixture := range suite.Fixtures {
+		evalAgent := a.withToolHandler(mockToolHandler(fixture.MockResults))
+		if len(suite.Tools) > 0 {
+			evalAgent.ActionGroups = []ActionGroup{{Name: "eval", Tools: suite.Tools}}
+		}
+
+		caseResult := EvalCaseResult{Name: fixture.Name}
+		result, err := evalAgent.Invoke(fixture.Prompt)
+		if err != nil {
+			caseResult.Failures = append(caseResult.Failures, fmt.Sprintf("invocation failed: %v", err))
+		} else {
+			caseResult.Answer = result.Text
+			caseResult.ToolCalls = result.ToolCalls
+			failures, err := fixture.check(result)
+			if err != nil {
+				return nil, fmt.Errorf("fixture %s: %w", fixture.Name, err)
+			}
+			caseResult.Failures = failures
+		}
+
+		caseResult.Passed = len(caseResult.Failures) == 0
+		if caseResult.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, caseResult)
+	}
+
+	return report, nil
+}
+
+// mockToolHandler answers every tool call with the fixture's canned output
+func mockToolHandler(results map[string]string) func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+	return func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+		toolUseID, _ := toolUse["toolUseId"].(string)
+		name, _ := toolUse["name"].(string)
+
+		status := "success"
+		output, ok := results[name]
+		if !ok {
+			status = "error"
+			output = fmt.Sprintf("No mock result for tool '%s'", name)
+		}
+
+		return map[string]interface{}{
+			"toolUseId": toolUseID,
+			"content": []map[string]interface{}{
+				{"text": output},
+			},
+			"status": status,
+		}, nil
+	}
+}
+
+// check returns a description of every expectation the result violates
+func (f EvalFixture) check(result *Result) ([]string, error) {
+	var failures []string
+
+	for _, expected := range f.ExpectTools {
+		matched, err := expected.matchesAny(result.ToolCalls)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			failures = append(failures, fmt.Sprintf("expected call to %s with args %v", expected.Name, expected.Args))
+		}
+	}
+
+	for _, forbidden := range f.ForbidTools {
+		for _, call := range result.ToolCalls {
+			if call.Name == forbidden {
+				failures = append(failures, fmt.Sprintf("unexpected call to %s", forbidden))
+				break
+			}
+		}
+	}
+
+	for _, pattern := range f.AnswerPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid answer pattern %q: %w", pattern, err)
+		}
+		if !re.MatchString(result.Text) {
+			failures = append(failures, fmt.Sprintf("answer does not match %q", pattern))
+		}
+	}
+
+	return failures, nil
+}
+
+func (e ExpectedToolCall) matchesAny(calls []ToolCallRecord) (bool, error) {
+	for _, call := range calls {
+		if call.Name != e.Name {
+			continue
+		}
+
+		matched := true
+		for arg, pattern := range e.Args {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return false, fmt.Errorf("invalid pattern %q for argument %s: %w", pattern, arg, err)
+			}
+			value, ok := call.Input[arg]
+			if !ok {
+				matched = false
+				break
+			}
+			// Strings are matched without their JSON quotes
+			text, isString := value.(string)
+			if !isString {
+				raw, _ := json.Marshal(value)
+				text = string(raw)
+			}
+			if !re.MatchString(text) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DiffEvalReports lists fixtures whose outcome changed between a baseline and a new run
+func DiffEvalReports(baseline, current *EvalReport) []string {
+	before := make(map[string]bool, len(baseline.Results))
+	for _, r := range baseline.Results {
+		before[r.Name] = r.Passed
+	}
+
+	var changes []string
+	for _, r := range current.Results {
+		passed, existed := before[r.Name]
+		switch {
+		case !existed:
+			changes = append(changes, fmt.Sprintf("NEW       %s (passed: %t)", r.Name, r.Passed))
+		case passed && !r.Passed:
+			changes = append(changes, fmt.Sprintf("REGRESSED %s: %v", r.Name, r.Failures))
+		case !passed && r.Passed:
+			changes = append(changes, fmt.Sprintf("FIXED     %s", r.Name))
+		}
+		delete(before, r.Name)
+	}
+	for name := range before {
+		changes = append(changes, fmt.Sprintf("REMOVED   %s", name))
+	}
+
+	sort.Strings(changes)
+	return changes
+}
+
+// runEvalCommand implements the "eval" subcommand
+func runEvalCommand(agent *InlineAgent, args []string) {
+	suite, err := LoadEvalSuite(args[0])
+	if err != nil {
+		log.Fatalf("Failed to load eval suite: %v", err)
+	}
+
+	report, err := agent.RunEval(suite)
+	if err != nil {
+		log.Fatalf("Eval failed: %v", err)
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	log.Printf("Eval: %d passed, %d failed", report.Passed, report.Failed)
+
+	if len(args) > 1 {
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			log.Fatalf("Failed to read baseline report: %v", err)
+		}
+		var baseline EvalReport
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			log.Fatalf("Failed to parse baseline report: %v", err)
+		}
+		for _, change := range DiffEvalReports(&baseline, report) {
+			log.Println(change)
+		}
+	}
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
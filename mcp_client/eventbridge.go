@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+const (
+	// defaultEventSource is the source of published events unless one is given
+	defaultEventSource = "mcp.agent"
+	// eventBridgeBatchSize is the most entries PutEvents accepts per call
+	eventBridgeBatchSize = 10
+	// eventBridgeFlushInterval bounds how long an event waits for a batch to fill
+	eventBridgeFlushInterval = time.Second
+	// eventBridgeBufferSize is how many events may wait to be published; more are dropped
+	eventBridgeBufferSize = 1000
+)
+
+// EventBridgeAPI is the subset of the EventBridge client the event sink uses
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// EventBridgeSink publishes agent lifecycle events to an EventBridge bus: invocations
+// started, completed and failed, guardrail blocks, and exceeded budgets. Other trace events
+// are ignored. Events are batched and published in the background so a slow bus never
+// delays an invocation.
+type EventBridgeSink struct {
+	client EventBridgeAPI
+	bus    string
+	source string
+
+	// mu guards closed so no event is queued after Close
+	mu     sync.RWMutex
+	closed bool
+	events chan ebtypes.PutEventsRequestEntry
+	done   chan struct{}
+}
+
+// NewEventBridgeSink publishes to bus using the default AWS config; an empty source uses "mcp.agent"
+func NewEventBridgeSink(ctx context.Context, bus, source string) (*EventBridgeSink, error) {
+	if bus == "" {
+		return nil, fmt.Errorf("an EventBridge bus name is required")
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return NewEventBridgeSinkWithClient(eventbridge.NewFromConfig(cfg), bus, source), nil
+}
+
+// NewEventBridgeSinkWithClient publishes to bus using client, e.g. a stub in tests
+func NewEventBridgeSinkWithClient(client EventBridgeAPI, bus, source string) *EventBridgeSink {
+	if source == "" {
+		source = defaultEventSource
+	}
+	s := &EventBridgeSink{
+		client: client,
+		bus:    bus,
+		source: source,
+		events: make(chan ebtypes.PutEventsRequestEntry, eventBridgeBufferSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// lifecycleDetailType returns the EventBridge detail type for a trace event, or false when
+// the event is not a lifecycle event
+func lifecycleDetailType(event TraceEvent) (string, bool) {
+	switch event.Type {
+	case TraceInvocationStart:
+		return "Invocation Started", true
+	case TraceInvocationEnd:
+		if event.Error != "" {
+			return "Invocation Failed", true
+		}
+		return "Invocation Completed", true
+	case TraceGuardrail:
+		if action, _ := event.Data["action"].(string); action == string(GuardrailBlock) {
+			return "Guardrail Blocked", true
+		}
+	case TraceBudgetExceeded:
+		return "Budget Exceeded", true
+	}
+	return "", false
+}
+
+// Emit queues lifecycle events for publishing
+func (s *EventBridgeSink) Emit(event TraceEvent) {
+	detailType, ok := lifecycleDetailType(event)
+	if !ok {
+		return
+	}
+	detail, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", event.Type, err)
+		return
+	}
+
+	entry := ebtypes.PutEventsRequestEntry{
+		EventBusName: aws.String(s.bus),
+		Source:       aws.String(s.source),
+		DetailType:   aws.String(detailType),
+		Detail:       aws.String(string(detail)),
+		Time:         aws.Time(event.Time),
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- entry:
+	default:
+		log.Printf("EventBridge buffer full, dropping %s event", detailType)
+	}
+}
+
+func (s *EventBridgeSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(eventBridgeFlushInterval)
+	defer ticker.Stop()
+
+	var batch []ebtypes.PutEventsRequestEntry
+	for {
+		select {
+		case entry, ok := <-s.events:
+			if !ok {
+				s.publish(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) < eventBridgeBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		s.publish(batch)
+		batch = nil
+	}
+}
+
+// publish sends a batch, logging entries EventBridge rejected
+func (s *EventBridgeSink) publish(batch []ebtypes.PutEventsRequestEntry) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := s.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: batch})
+	if err != nil {
+		log.Printf("Failed to publish %d events to %s: %v", len(batch), s.bus, err)
+		return
+	}
+	if out.FailedEntryCount > 0 {
+		for i, result := range out.Entries {
+			if result.ErrorCode != nil && i < len(batch) {
+				log.Printf("EventBridge rejected %s event: %s %s", aws.ToString(batch[i].DetailType), aws.ToString(result.ErrorCode), aws.ToString(result.ErrorMessage))
+			}
+		}
+	}
+}
+
+// Close publishes the queued events and stops the sink
+func (s *EventBridgeSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return nil
+}
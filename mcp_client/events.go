@@ -0,0 +1,171 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType identifies a lifecycle event
+type EventType string
+
+const (
+	EventServerConnected EventType = "server_connected"
+	EventServerFailed    EventType = "server_failed"
+	EventToolsRefreshed  EventType = "tools_refreshed"
+	// EventSLOViolated and EventSLORecovered report a server starting and stopping to miss
+	// its SLO; a violating server is the one to stop sending traffic to
+	EventSLOViolated  EventType = "slo_violated"
+	EventSLORecovered EventType = "slo_recovered"
+	// EventBudgetExceeded reports a tool call refused by a quota or the time budget
+	EventBudgetExceeded EventType = "budget_exceeded"
+)
+
+// defaultEventBuffer is how many events a subscriber may fall behind before events are dropped
+const defaultEventBuffer = 64
+
+// Event is a lifecycle event for applications embedding the agent or gateway, so they can
+// drive their own UI and alerting instead of scraping logs
+type Event struct {
+	Type      EventType              `json:"type"`
+	Time      time.Time              `json:"time"`
+	Server    string                 `json:"server,omitempty"`
+	SessionID string                 `json:"sessionId,omitempty"`
+	Tool      string                 `json:"tool,omitempty"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventBus fans events out to subscribers. Publishing never blocks: a subscriber that has
+// fallen behind by its buffer misses events, which are counted in Dropped. The zero value
+// is ready to use.
+type EventBus struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+
+	dropped atomic.Int64
+}
+
+// Subscribe returns a channel of events published from now on and a function that
+// unsubscribes and closes it. The channel is also closed when the bus is.
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = defaultEventBuffer
+	}
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs == nil {
+		b.subs = make(map[chan Event]struct{})
+	}
+	b.subs[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends event to every subscriber that has room for it; a nil bus does nothing
+func (b *EventBus) publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns how many events were not delivered because a subscriber was behind
+func (b *EventBus) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// Close closes every subscriber's channel; later subscriptions are closed immediately
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for ch := range b.subs {
+		close(ch)
+	}
+	b.subs = nil
+}
+
+// startupEvent returns the event for a server's handshake outcome
+func startupEvent(outcome ServerStartup) Event {
+	event := Event{
+		Type:    EventServerConnected,
+		Server:  outcome.Server,
+		Message: "MCP server connected",
+		Data: map[string]interface{}{
+			"tools":      outcome.Tools,
+			"durationMs": outcome.Duration.Milliseconds(),
+		},
+	}
+	if !outcome.OK {
+		event.Type = EventServerFailed
+		event.Message = outcome.Error
+		event.Data["stage"] = string(outcome.Stage)
+		event.Data["errorClass"] = outcome.ErrorClass
+	}
+	return event
+}
+
+// budgetEvent returns an EventBudgetExceeded event for a tool call trace event refused by a
+// quota or the time budget; ok is false for any other event
+func budgetEvent(trace TraceEvent) (event Event, ok bool) {
+	if trace.Type != TraceToolCall {
+		return Event{}, false
+	}
+	status, _ := trace.Data["status"].(string)
+	if status != statusQuotaExceeded && status != statusOutOfTime {
+		return Event{}, false
+	}
+	return Event{
+		Type:      EventBudgetExceeded,
+		Time:      trace.Time,
+		SessionID: trace.SessionID,
+		Tool:      trace.Tool,
+		Message:   "tool call refused: " + status,
+		Data:      map[string]interface{}{"status": status},
+	}, true
+}
+
+// Events returns a channel of the agent's lifecycle events: servers connecting or failing
+// their handshake, servers missing their SLO and tool calls refused by a budget. It is
+// closed by Close. Each call subscribes anew.
+func (a *InlineAgent) Events() <-chan Event {
+	ch, _ := a.events.Subscribe(defaultEventBuffer)
+	return ch
+}
+
+// Events returns a channel of the handler's lifecycle events: the server connecting or
+// failing its handshake, its tools changing and it missing its SLO. Each call subscribes anew.
+func (h *BedrockToolHandler) Events() <-chan Event {
+	ch, _ := h.events.Subscribe(defaultEventBuffer)
+	return ch
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+const (
+	// exampleTimeout bounds the model call that writes a tool's example
+	exampleTimeout = 20 * time.Second
+	// maxExampleDepth stops schema examples from following deeply nested objects
+	maxExampleDepth = 4
+)
+
+// hasExample reports whether a tool description already shows how to call it
+func hasExample(description string) bool {
+	lower := strings.ToLower(description)
+	return strings.Contains(lower, "example") || strings.Contains(lower, "e.g.")
+}
+
+// withExample appends an example call to a tool's description
+func withExample(tool Tool, args map[string]interface{}) Tool {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return tool
+	}
+	tool.Description = strings.TrimSpace(fmt.Sprintf("%s\n\nExample arguments: %s", tool.Description, data))
+	return tool
+}
+
+// SchemaExampleHook appends example arguments built from the input schema to the
+// description of every tool that has no example. Values come from the schema's examples,
+// defaults and enums where it has them, and placeholders of the right type otherwise.
+func SchemaExampleHook() ToolHook {
+	return func(tool Tool) Tool {
+		if hasExample(tool.Description) {
+			return tool
+		}
+		args, ok := schemaExample(tool.InputSchema, 0).(map[string]interface{})
+		if !ok || len(args) == 0 {
+			return tool
+		}
+		return withExample(tool, args)
+	}
+}
+
+// schemaExample returns an example value for a JSON schema
+func schemaExample(schema map[string]interface{}, depth int) interface{} {
+	if examples, ok := schema["examples"].([]interface{}); ok && len(examples) > 0 {
+		return examples[0]
+	}
+	if value, ok := schema["default"]; ok {
+		return value
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	schemaType, _ := schema["type"].(string)
+	if typeList, ok := schema["type"].([]interface{}); ok && len(typeList) > 0 {
+		schemaType, _ = typeList[0].(string)
+	}
+	switch schemaType {
+	case "object", "":
+		props, ok := schema["properties"].(map[string]interface{})
+		if !ok || depth >= maxExampleDepth {
+			return map[string]interface{}{}
+		}
+		// Only required parameters are shown, so the example is a minimal valid call
+		names := requiredParams(schema)
+		if len(names) == 0 {
+			for name := range props {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		args := make(map[string]interface{}, len(names))
+		for _, name := range names {
+			prop, _ := props[name].(map[string]interface{})
+			args[name] = schemaExample(prop, depth+1)
+		}
+		return args
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		return []interface{}{schemaExample(items, depth+1)}
+	case "integer":
+		if minimum, ok := schema["minimum"].(float64); ok {
+			return int64(minimum)
+		}
+		return 1
+	case "number":
+		if minimum, ok := schema["minimum"].(float64); ok {
+			return minimum
+		}
+		return 1.5
+	case "boolean":
+		return true
+	case "null":
+		return nil
+	}
+
+	switch format, _ := schema["format"].(string); format {
+	case "date-time":
+		return "2025-01-15T09:30:00Z"
+	case "date":
+		return "2025-01-15"
+	case "time":
+		return "09:30:00"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "https://example.com"
+	}
+	return "example"
+}
+
+// requiredParams returns a schema's required property names
+func requiredParams(schema map[string]interface{}) []string {
+	var names []string
+	required, _ := schema["required"].([]interface{})
+	for _, r := range required {
+		if name, ok := r.(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ModelExampleHook appends example arguments written by modelID, ideally a small, cheap
+// model, to the description of every tool that has no example. Realistic values help the
+// agent's model fill in arguments correctly. Examples are cached per tool and schema, so
+// rediscovering tools doesn't call the model again; when the call fails, or its answer isn't
+// a JSON object with the required parameters, the schema example is used instead.
+func ModelExampleHook(client ConverseAPI, modelID string) ToolHook {
+	var mu sync.Mutex
+	cache := map[string]map[string]interface{}{}
+	fallback := SchemaExampleHook()
+
+	return func(tool Tool) Tool {
+		if hasExample(tool.Description) {
+			return tool
+		}
+		schema, err := json.Marshal(tool.InputSchema)
+		if err != nil {
+			return fallback(tool)
+		}
+		key := tool.Name + "\x00" + tool.Description + "\x00" + string(schema)
+
+		mu.Lock()
+		args, ok := cache[key]
+		mu.Unlock()
+		if !ok {
+			ctx, cancel := context.WithTimeout(context.Background(), exampleTimeout)
+			args, err = modelExample(ctx, client, modelID, tool, string(schema))
+			cancel()
+			if err != nil {
+				log.Printf("Failed to generate an example for tool %s: %v", tool.Name, err)
+				return fallback(tool)
+			}
+			mu.Lock()
+			cache[key] = args
+			mu.Unlock()
+		}
+		return withExample(tool, args)
+	}
+}
+
+// NewModelExampleHook returns a ModelExampleHook calling modelID with the default AWS configuration
+func NewModelExampleHook(ctx context.Context, modelID string) (ToolHook, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return ModelExampleHook(bedrockruntime.NewFromConfig(cfg), modelID), nil
+}
+
+// modelExample asks the model for one example of a tool's arguments
+func modelExample(ctx context.Context, client ConverseAPI, modelID string, tool Tool, schema string) (map[string]interface{}, error) {
+	prompt := fmt.Sprintf("Write one realistic example of the arguments for a call to this tool, as a JSON object matching its input schema. Reply with only the JSON object.\n\nTool: %s\nDescription: %s\nInput schema: %s",
+		tool.Name, tool.Description, schema)
+
+	out, err := client.Converse(ctx, &bedrockruntime.ConverseInput{
+		ModelId: aws.String(modelID),
+		Messages: []types.Message{{
+			Role:    types.ConversationRoleUser,
+			Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: prompt}},
+		}},
+		InferenceConfig: &types.InferenceConfiguration{
+			MaxTokens:   aws.Int32(512),
+			Temperature: aws.Float32(0),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bedrock converse failed: %w", err)
+	}
+
+	var text strings.Builder
+	for _, content := range out.Output.Message.Content {
+		if c, ok := content.(*types.ContentBlockMemberText); ok {
+			text.WriteString(c.Value)
+		}
+	}
+	// Models often wrap JSON in a code fence despite being asked not to
+	answer := strings.TrimSpace(text.String())
+	if start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}"); start >= 0 && end > start {
+		answer = answer[start : end+1]
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(answer), &args); err != nil {
+		return nil, fmt.Errorf("failed to parse example: %w", err)
+	}
+	for _, name := range requiredParams(tool.InputSchema) {
+		if _, ok := args[name]; !ok {
+			return nil, fmt.Errorf("example is missing required parameter %s", name)
+		}
+	}
+	return args, nil
+}
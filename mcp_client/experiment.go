@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Variant is one arm of an experiment. Empty fields fall back to the agent's defaults.
+type Variant struct {
+	Name        string
+	Weight      int
+	Preset      string
+	ModelID     string
+	Instruction string
+	Tools       []string
+}
+
+// VariantStats aggregates the invocations served by a variant
+type VariantStats struct {
+	Invocations   int           `json:"invocations"`
+	Errors        int           `json:"errors"`
+	ToolCalls     int           `json:"toolCalls"`
+	Usage         Usage         `json:"usage"`
+	ModelLatency  time.Duration `json:"modelLatency"`
+	TotalLatency  time.Duration `json:"totalLatency"`
+	EstimatedCost float64       `json:"estimatedCost"`
+}
+
+// AverageLatency returns the mean total latency of successful invocations
+func (s VariantStats) AverageLatency() time.Duration {
+	succeeded := s.Invocations - s.Errors
+	if succeeded == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(succeeded)
+}
+
+// Experiment splits sessions across variants of an agent. Assignment is a hash of the
+// experiment name and session ID, so a session always sees the same variant.
+type Experiment struct {
+	Name     string
+	Agent    *InlineAgent
+	Variants []Variant
+
+	totalWeight int
+
+	mu    sync.Mutex
+	stats map[string]*VariantStats
+}
+
+// NewExperiment creates an experiment over the given variants
+func NewExperiment(name string, agent *InlineAgent, variants ...Variant) (*Experiment, error) {
+	if len(variants) < 2 {
+		return nil, fmt.Errorf("experiment %s needs at least two variants", name)
+	}
+
+	e := &Experiment{
+		Name:     name,
+		Agent:    agent,
+		Variants: variants,
+		stats:    make(map[string]*VariantStats),
+	}
+
+	for _, v := range variants {
+		if v.Name == "" {
+			return nil, fmt.Errorf("experiment %s has a variant without a name", name)
+		}
+		if v.Weight < 0 {
+			return nil, fmt.Errorf("variant %s has a negative weight", v.Name)
+		}
+		if _, dup := e.stats[v.Name]; dup {
+			return nil, fmt.Errorf("experiment %s has duplicate variant %s", name, v.Name)
+		}
+		e.stats[v.Name] = &VariantStats{}
+		e.totalWeight += v.Weight
+	}
+	if e.totalWeight == 0 {
+		return nil, fmt.Errorf("experiment %s has no weighted variants", name)
+	}
+
+	return e, nil
+}
+
+// Assign returns the variant for a session
+func (e *Experiment) Assign(sessionID string) Variant {
+	h := fnv.New32a()
+	h.Write([]byte(e.Name + "/" + sessionID))
+	bucket := int(h.Sum32() % uint32(e.totalWeight))
+
+	for _, v := range e.Variants {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+// Invoke runs the input through the session's variant and records its stats.
+// Trace events are tagged with the experiment and variant names.
+func (e *Experiment) Invoke(sessionID, inputText string) (*Result, Variant, error) {
+	variant := e.Assign(sessionID)
+
+	result, err := e.Agent.InvokeWithOptions(inputText, InvokeOptions{
+		SessionID:   sessionID,
+		Preset:      variant.Preset,
+		ModelID:     variant.ModelID,
+		Instruction: variant.Instruction,
+		Tools:       variant.Tools,
+		Tags: map[string]string{
+			"experiment": e.Name,
+			"variant":    variant.Name,
+		},
+	})
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stats := e.stats[variant.Name]
+	stats.Invocations++
+	if err != nil {
+		stats.Errors++
+		return nil, variant, err
+	}
+	stats.ToolCalls += len(result.ToolCalls)
+	stats.Usage.InputTokens += result.Usage.InputTokens
+	stats.Usage.OutputTokens += result.Usage.OutputTokens
+	stats.Usage.TotalTokens += result.Usage.TotalTokens
+	stats.ModelLatency += result.ModelLatency
+	stats.TotalLatency += result.TotalLatency
+	stats.EstimatedCost += result.EstimatedCost
+
+	return result, variant, nil
+}
+
+// Stats returns a snapshot of the per-variant aggregates
+func (e *Experiment) Stats() map[string]VariantStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	snapshot := make(map[string]VariantStats, len(e.stats))
+	for name, s := range e.stats {
+		snapshot[name] = *s
+	}
+	return snapshot
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// InvocationError is returned by InvokeWithOptions when an invocation fails. It wraps the
+// cause and carries a report of everything attempted, so support doesn't have to piece
+// the invocation together from logs; get it with errors.As.
+type InvocationError struct {
+	Err    error
+	Report *FailureReport
+}
+
+func (e *InvocationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvocationError) Unwrap() error {
+	return e.Err
+}
+
+// FailureReport lists what a failed invocation tried. It marshals to JSON.
+type FailureReport struct {
+	CorrelationID string         `json:"correlationId"`
+	SessionID     string         `json:"sessionId,omitempty"`
+	Error         string         `json:"error"`
+	ErrorClass    string         `json:"errorClass"`
+	Duration      time.Duration  `json:"duration"`
+	Models        []ModelAttempt `json:"models"`
+	// Retries are the MCP requests retried by RetryMiddleware or AuthRefreshMiddleware
+	Retries      []RetryAttempt `json:"retries,omitempty"`
+	ToolFailures []ToolFailure  `json:"toolFailures,omitempty"`
+	// ServersDown failed their handshake; ServersMissingSLO are the servers the stats
+	// tracker reports missing their SLO when the invocation failed
+	ServersDown       []ServerStartup `json:"serversDown,omitempty"`
+	ServersMissingSLO []ServerStats   `json:"serversMissingSlo,omitempty"`
+}
+
+// ModelAttempt is one model call
+type ModelAttempt struct {
+	Model    string        `json:"model,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Hedge is "hedge" or "primary" when a hedged request answered
+	Hedge string `json:"hedge,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// RetryAttempt is one failed MCP request that was tried again
+type RetryAttempt struct {
+	Method  string `json:"method"`
+	Attempt int    `json:"attempt"`
+	Error   string `json:"error"`
+}
+
+// ToolFailure is a tool call that didn't succeed. Code is the result status, such as
+// "error" or "quota_exceeded", or for calls that failed outright the ErrorClass.
+type ToolFailure struct {
+	Tool      string `json:"tool"`
+	ToolUseID string `json:"toolUseId,omitempty"`
+	Code      string `json:"code"`
+	Error     string `json:"error,omitempty"`
+}
+
+// attemptLog collects a FailureReport from an invocation's trace events and from the MCP
+// retry middlewares, which report to it through the request context
+type attemptLog struct {
+	mu     sync.Mutex
+	report FailureReport
+}
+
+func withAttemptLog(ctx context.Context, log *attemptLog) context.Context {
+	return mcpclient.WithRetryObserver(ctx, log.retried)
+}
+
+// observe records the attempts a trace event reports
+func (l *attemptLog) observe(event TraceEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch event.Type {
+	case TraceModelCall:
+		model, _ := event.Data["model"].(string)
+		hedge, _ := event.Data["hedge"].(string)
+		l.report.Models = append(l.report.Models, ModelAttempt{Model: model, Duration: event.Duration, Hedge: hedge, Error: event.Error})
+	case TraceToolCall:
+		toolUseID, _ := event.Data["toolUseId"].(string)
+		status, _ := event.Data["status"].(string)
+		if event.Error != "" {
+			code, _ := event.Data["errorClass"].(string)
+			l.report.ToolFailures = append(l.report.ToolFailures, ToolFailure{Tool: event.Tool, ToolUseID: toolUseID, Code: code, Error: event.Error})
+		} else if status != "" && status != "success" {
+			l.report.ToolFailures = append(l.report.ToolFailures, ToolFailure{Tool: event.Tool, ToolUseID: toolUseID, Code: status})
+		}
+	}
+}
+
+// retried records a failed MCP request about to be tried again; a nil log does nothing
+func (l *attemptLog) retried(method string, attempt int, err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.report.Retries = append(l.report.Retries, RetryAttempt{Method: method, Attempt: attempt, Error: err.Error()})
+}
+
+// fail wraps err with the report, completed with the servers' state at the time
+func (l *attemptLog) fail(a *InlineAgent, opts InvokeOptions, start time.Time, err error) error {
+	l.mu.Lock()
+	report := l.report
+	l.mu.Unlock()
+
+	report.CorrelationID = opts.CorrelationID
+	report.SessionID = opts.SessionID
+	report.Error = err.Error()
+	report.ErrorClass = mcpclient.ErrorClass(err)
+	report.Duration = time.Since(start)
+	report.ServersDown = a.startup.Failed()
+	for _, stats := range a.ServerStats.All() {
+		if len(stats.Violations) > 0 {
+			report.ServersMissingSLO = append(report.ServersMissingSLO, stats)
+		}
+	}
+	return &InvocationError{Err: err, Report: &report}
+}
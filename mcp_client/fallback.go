@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// toolFallbackPrompt is added to the system prompt once tool calls have failed too often
+const toolFallbackPrompt = "The tools have failed repeatedly and are unlikely to work now. Do not call any more tools. " +
+	"Answer the user from your own knowledge instead, say clearly that you could not check it with the tools, " +
+	"and point out anything that may be out of date or wrong as a result."
+
+// allToolCallsFailed reports whether every tool call of a turn ended in an error
+func allToolCallsFailed(calls []ToolCallRecord) bool {
+	if len(calls) == 0 {
+		return false
+	}
+	for _, call := range calls {
+		if call.Status != "error" {
+			return false
+		}
+	}
+	return true
+}
+
+// toolFallback counts consecutive turns whose tool calls all failed, and tells the model to
+// answer without tools once there have been limit of them
+type toolFallback struct {
+	limit       int
+	failedTurns int
+	triggered   bool
+}
+
+// observe records a turn's tool calls and, the first time the limit is reached, adds the
+// fallback prompt to input. It reports whether the invocation is now degraded.
+func (f *toolFallback) observe(input *bedrockruntime.ConverseInput, calls []ToolCallRecord) bool {
+	if f.limit <= 0 || f.triggered {
+		return f.triggered
+	}
+	if !allToolCallsFailed(calls) {
+		f.failedTurns = 0
+		return false
+	}
+	f.failedTurns++
+	if f.failedTurns < f.limit {
+		return false
+	}
+
+	log.Printf("All tool calls failed in %d consecutive turns, asking the model to answer without tools", f.failedTurns)
+	input.System = append(input.System, &types.SystemContentBlockMemberText{Value: toolFallbackPrompt})
+	f.triggered = true
+	return true
+}
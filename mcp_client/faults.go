@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFaultDropped is returned when the fault injector drops a response
+var ErrFaultDropped = errors.New("fault injection: response dropped")
+
+// FaultConfig sets the probability (0 to 1) of each injected fault
+type FaultConfig struct {
+	// Latency delays the request by up to MaxLatency
+	Latency    float64
+	MaxLatency time.Duration
+	// Drop forwards the request but discards the response, as if the connection was lost
+	Drop float64
+	// MalformedSSE replaces the response with a truncated event stream
+	MalformedSSE float64
+	// ServerError answers 503 without forwarding the request
+	ServerError float64
+	// Seed makes a run reproducible; 0 seeds from the clock
+	Seed int64
+}
+
+// Enabled reports whether any fault has a non-zero probability
+func (c FaultConfig) Enabled() bool {
+	return c.Latency > 0 || c.Drop > 0 || c.MalformedSSE > 0 || c.ServerError > 0
+}
+
+// FaultConfigFromEnv reads MCP_FAULT_LATENCY, MCP_FAULT_MAX_LATENCY, MCP_FAULT_DROP,
+// MCP_FAULT_MALFORMED_SSE, MCP_FAULT_5XX and MCP_FAULT_SEED
+func FaultConfigFromEnv() (FaultConfig, error) {
+	cfg := FaultConfig{MaxLatency: 2 * time.Second}
+
+	probabilities := map[string]*float64{
+		"MCP_FAULT_LATENCY":       &cfg.Latency,
+		"MCP_FAULT_DROP":          &cfg.Drop,
+		"MCP_FAULT_MALFORMED_SSE": &cfg.MalformedSSE,
+		"MCP_FAULT_5XX":           &cfg.ServerError,
+	}
+	for name, dst := range probabilities {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil || p < 0 || p > 1 {
+			return FaultConfig{}, fmt.Errorf("%s must be a probability between 0 and 1, got %q", name, v)
+		}
+		*dst = p
+	}
+
+	if v := os.Getenv("MCP_FAULT_MAX_LATENCY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return FaultConfig{}, fmt.Errorf("invalid MCP_FAULT_MAX_LATENCY: %w", err)
+		}
+		cfg.MaxLatency = d
+	}
+	if v := os.Getenv("MCP_FAULT_SEED"); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return FaultConfig{}, fmt.Errorf("invalid MCP_FAULT_SEED: %w", err)
+		}
+		cfg.Seed = seed
+	}
+
+	return cfg, nil
+}
+
+// FaultInjector is an http.RoundTripper that injects faults in front of another transport
+type FaultInjector struct {
+	next   http.RoundTripper
+	config FaultConfig
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewFaultInjector wraps next, or http.DefaultTransport when next is nil
+func NewFaultInjector(next http.RoundTripper, config FaultConfig) *FaultInjector {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &FaultInjector{
+		next:   next,
+		config: config,
+		rnd:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (f *FaultInjector) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rnd.Float64() < p
+}
+
+func (f *FaultInjector) latency() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.config.MaxLatency <= 0 {
+		return 0
+	}
+	return time.Duration(f.rnd.Int63n(int64(f.config.MaxLatency)))
+}
+
+// RoundTrip implements http.RoundTripper
+func (f *FaultInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.roll(f.config.Latency) {
+		select {
+		case <-time.After(f.latency()):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	if f.roll(f.config.ServerError) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return syntheticResponse(req, http.StatusServiceUnavailable, "text/plain", "fault injection: service unavailable"), nil
+	}
+
+	resp, err := f.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.roll(f.config.Drop) {
+		resp.Body.Close()
+		return nil, ErrFaultDropped
+	}
+
+	if f.roll(f.config.MalformedSSE) {
+		resp.Body.Close()
+		return syntheticResponse(req, http.StatusOK, "text/event-stream",
+			"event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":"), nil
+	}
+
+	return resp, nil
+}
+
+func syntheticResponse(req *http.Request, status int, contentType, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+// ResultFlag marks a way an answer may be less complete or reliable than usual, so calling
+// applications can warn their users
+type ResultFlag string
+
+const (
+	// FlagToolErrors means at least one tool call failed
+	FlagToolErrors ResultFlag = "tool_errors"
+	// FlagTruncatedResults means the answer was cut off at max_tokens, or a tool output was
+	// replaced with a preview
+	FlagTruncatedResults ResultFlag = "truncated_results"
+	// FlagBudgetHit means a tool call was refused by a quota or the time budget
+	FlagBudgetHit ResultFlag = "budget_hit"
+	// FlagCompactionApplied means earlier conversation was dropped or shortened to fit the
+	// context window
+	FlagCompactionApplied ResultFlag = "compaction_applied"
+	// FlagGuardrailIntervened means an output guardrail redacted, cut or flagged the answer
+	FlagGuardrailIntervened ResultFlag = "guardrail_intervened"
+	// FlagInjectionDetected means a tool output looked like a prompt injection and was
+	// flagged, stripped or withheld
+	FlagInjectionDetected ResultFlag = "injection_detected"
+)
+
+// HasFlag reports whether the result carries flag
+func (r *Result) HasFlag(flag ResultFlag) bool {
+	for _, f := range r.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Result) flag(flag ResultFlag) {
+	if !r.HasFlag(flag) {
+		r.Flags = append(r.Flags, flag)
+	}
+}
+
+// flagEvent sets the flags a trace event of the invocation implies
+func (r *Result) flagEvent(event TraceEvent) {
+	switch event.Type {
+	case TraceToolCall:
+		switch status, _ := event.Data["status"].(string); status {
+		case "error":
+			r.flag(FlagToolErrors)
+		case statusQuotaExceeded, statusOutOfTime:
+			r.flag(FlagBudgetHit)
+		}
+	case TraceCompaction:
+		if event.Error == "" {
+			r.flag(FlagCompactionApplied)
+		}
+	case TraceGuardrail:
+		r.flag(FlagGuardrailIntervened)
+	case TraceInjection:
+		r.flag(FlagInjectionDetected)
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"mcp-client/gatewayv1"
+	"mcp-client/pkg/mcpclient"
+)
+
+// grpcGateway serves the gateway agent's invoke, stream and session APIs over gRPC for
+// internal services, with the messages declared in gateway.proto. Tenants are identified
+// from request metadata the way HTTP requests are from headers.
+type grpcGateway struct {
+	gatewayv1.UnimplementedGatewayServer
+	agent           *InlineAgent
+	tenants         *tenantGateway
+	approvalTimeout time.Duration
+	stream          StreamBuffer
+}
+
+// newGRPCServer returns a gRPC server with the gateway service registered
+func newGRPCServer(agent *InlineAgent, tenants *tenantGateway, approvalTimeout time.Duration, stream StreamBuffer) *grpc.Server {
+	server := grpc.NewServer()
+	gatewayv1.RegisterGatewayServer(server, &grpcGateway{agent: agent, tenants: tenants, approvalTimeout: approvalTimeout, stream: stream})
+	return server
+}
+
+// grpcStruct converts a value to a Struct through its JSON encoding, so tool inputs and
+// failure reports get the same fields as in the REST API. A value encoding to null
+// converts to nil.
+func grpcStruct(v interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to marshal %T: %v", v, err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to unmarshal %T: %v", v, err)
+	}
+	if fields == nil {
+		return nil, nil
+	}
+	s, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to convert %T to protobuf: %v", v, err)
+	}
+	return s, nil
+}
+
+// grpcRequest returns an HTTP request with the call's metadata as headers, so it carries
+// the tenant header, bearer token and correlation ID as an HTTP client would send them
+func grpcRequest(ctx context.Context) *http.Request {
+	r := &http.Request{Header: make(http.Header), URL: &url.URL{}}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		for _, v := range values {
+			r.Header.Add(key, v)
+		}
+	}
+	return r
+}
+
+// tenant identifies the caller's tenant from the request metadata
+func (g *grpcGateway) tenant(ctx context.Context) (*tenantState, error) {
+	if g.tenants == nil {
+		return nil, nil
+	}
+	tenant, code, err := g.tenants.resolve(grpcRequest(ctx))
+	if err != nil {
+		return nil, status.Error(grpcCode(code), err.Error())
+	}
+	return tenant, nil
+}
+
+// grpcCode maps the HTTP status the REST API answers with to a gRPC code
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
+
+// Invoke answers an input text like POST /invoke
+func (g *grpcGateway) Invoke(ctx context.Context, request *gatewayv1.InvokeRequest) (*gatewayv1.InvokeResponse, error) {
+	tenant, err := g.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inputText := request.GetInputText()
+	if inputText == "" {
+		return nil, status.Error(codes.InvalidArgument, "input_text is required")
+	}
+	opts, err := grpcInvokeOptions(request)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	opts.CorrelationID = acceptCorrelationID(grpcRequest(ctx).Header.Get(mcpclient.CorrelationIDHeader))
+	ctx = mcpclient.WithCorrelationID(ctx, opts.CorrelationID)
+	ctx = mcpclient.WithRequestMeta(ctx, tenant.meta(nil))
+	sessionID := opts.SessionID
+
+	err = tenant.limit(true)
+	if err == nil {
+		opts, err = tenant.scope(ctx, g.agent, opts)
+	}
+	var answer *Result
+	if err == nil {
+		answer, err = g.agent.InvokeContext(ctx, inputText, opts)
+	}
+	tenant.record(auditRecord{Endpoint: "grpc:Invoke", CorrelationID: opts.CorrelationID, SessionID: sessionID}, answer, err)
+	var invocationErr *InvocationError
+	if errors.As(err, &invocationErr) {
+		report, _ := json.Marshal(invocationErr.Report)
+		logf(ctx, "Invocation failed: %s", report)
+	}
+	if err != nil {
+		return nil, status.Error(grpcCode(tenantStatus(err)), err.Error())
+	}
+	return grpcInvokeResponse(answer)
+}
+
+// grpcInvokeOptions returns the invoke options of an InvokeRequest, as agentInvokeOptions
+// does for a REST request
+func grpcInvokeOptions(request *gatewayv1.InvokeRequest) (InvokeOptions, error) {
+	priority, err := ParsePriority(request.GetPriority())
+	if err != nil {
+		return InvokeOptions{}, err
+	}
+	opts := InvokeOptions{SessionID: request.GetSessionId(), Priority: priority}
+	if request.GetTimeoutMs() > 0 {
+		opts.Timeout = time.Duration(request.GetTimeoutMs()) * time.Millisecond
+	}
+	for _, clip := range request.GetAudio() {
+		opts.Audio = append(opts.Audio, AudioContent{MimeType: clip.GetMimeType(), Data: base64.StdEncoding.EncodeToString(clip.GetData())})
+	}
+	return opts, nil
+}
+
+// grpcInvokeResponse converts an invocation's result
+func grpcInvokeResponse(result *Result) (*gatewayv1.InvokeResponse, error) {
+	resp := &gatewayv1.InvokeResponse{
+		Answer:        result.Text,
+		StopReason:    string(result.StopReason),
+		LatencyMs:     result.LatencyMs,
+		Degraded:      result.Degraded,
+		Usage:         grpcUsage(result.Usage),
+		CorrelationId: result.CorrelationID,
+	}
+	for _, clip := range result.Audio {
+		data, err := base64.StdEncoding.DecodeString(clip.Data)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to decode audio from %s: %v", clip.Tool, err)
+		}
+		resp.Audio = append(resp.Audio, &gatewayv1.Audio{MimeType: clip.MimeType, Data: data, Tool: clip.Tool})
+	}
+	for _, c := range result.Citations {
+		resp.Citations = append(resp.Citations, &gatewayv1.Citation{
+			Index:           int32(c.Index),
+			SourceUri:       c.SourceURI,
+			Excerpt:         c.Excerpt,
+			Score:           c.Score,
+			KnowledgeBaseId: c.KnowledgeBaseID,
+		})
+	}
+	for _, flag := range result.Flags {
+		resp.Flags = append(resp.Flags, string(flag))
+	}
+	toolCalls, err := grpcToolCalls(result.ToolCalls)
+	if err != nil {
+		return nil, err
+	}
+	resp.ToolCalls = toolCalls
+	return resp, nil
+}
+
+// grpcToolCalls converts the tool calls of a result or transcript
+func grpcToolCalls(records []ToolCallRecord) ([]*gatewayv1.ToolCall, error) {
+	var calls []*gatewayv1.ToolCall
+	for _, record := range records {
+		input, err := grpcStruct(record.Input)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, &gatewayv1.ToolCall{
+			ToolUseId:  record.ToolUseID,
+			Name:       record.Name,
+			Input:      input,
+			Output:     record.Output,
+			Status:     record.Status,
+			DurationMs: record.Duration.Milliseconds(),
+		})
+	}
+	return calls, nil
+}
+
+func grpcUsage(usage Usage) *gatewayv1.Usage {
+	return &gatewayv1.Usage{
+		InputTokens:  int64(usage.InputTokens),
+		OutputTokens: int64(usage.OutputTokens),
+		TotalTokens:  int64(usage.TotalTokens),
+	}
+}
+
+// GetSession returns a session's transcript, as exported by ExportSession
+func (g *grpcGateway) GetSession(ctx context.Context, request *gatewayv1.GetSessionRequest) (*gatewayv1.Transcript, error) {
+	tenant, err := g.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sessionID := request.GetSessionId()
+	if sessionID == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+
+	data, err := g.agent.ExportSession(tenant.scopedKey(sessionID))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	var transcript Transcript
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to unmarshal transcript: %v", err)
+	}
+
+	resp := &gatewayv1.Transcript{
+		SessionId:  sessionID,
+		Model:      transcript.Model,
+		CreatedAt:  timestamppb.New(transcript.CreatedAt),
+		ExportedAt: timestamppb.New(transcript.ExportedAt),
+		Usage:      grpcUsage(transcript.Usage),
+	}
+	if transcript.ForkedFrom != "" {
+		resp.ForkedFrom = tenant.unscopedKey(transcript.ForkedFrom)
+	}
+	for _, msg := range transcript.Messages {
+		m := &gatewayv1.TranscriptMessage{Role: msg.Role}
+		for _, block := range msg.Content {
+			content, err := grpcTranscriptContent(block)
+			if err != nil {
+				return nil, err
+			}
+			m.Content = append(m.Content, content)
+		}
+		resp.Messages = append(resp.Messages, m)
+	}
+	if resp.ToolCalls, err = grpcToolCalls(transcript.ToolCalls); err != nil {
+		return nil, err
+	}
+	if resp.Variables, err = grpcStruct(transcript.Variables); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func grpcTranscriptContent(block TranscriptContent) (*gatewayv1.TranscriptContent, error) {
+	input, err := grpcStruct(block.Input)
+	if err != nil {
+		return nil, err
+	}
+	content := &gatewayv1.TranscriptContent{
+		Type:      block.Type,
+		Text:      block.Text,
+		ToolUseId: block.ToolUseID,
+		Name:      block.Name,
+		Input:     input,
+		Status:    block.Status,
+		Format:    block.Format,
+		Bytes:     block.Bytes,
+	}
+	if block.Type == "json" {
+		if content.Json, err = structpb.NewValue(block.JSON); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to convert JSON content to protobuf: %v", err)
+		}
+	}
+	for _, c := range block.Content {
+		converted, err := grpcTranscriptContent(c)
+		if err != nil {
+			return nil, err
+		}
+		content.Content = append(content.Content, converted)
+	}
+	return content, nil
+}
+
+// ForkSession copies a session into a new one and returns its ID
+func (g *grpcGateway) ForkSession(ctx context.Context, request *gatewayv1.ForkSessionRequest) (*gatewayv1.ForkSessionResponse, error) {
+	tenant, err := g.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sessionID := request.GetSessionId()
+	if sessionID == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+
+	forkID, err := g.agent.ForkSession(tenant.scopedKey(sessionID))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &gatewayv1.ForkSessionResponse{SessionId: tenant.unscopedKey(forkID)}, nil
+}
+
+// Stream is the bidirectional equivalent of /ws: the client sends prompts and approvals
+// and receives events, approval requests, results and errors
+func (g *grpcGateway) Stream(stream gatewayv1.Gateway_StreamServer) error {
+	tenant, err := g.tenant(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	c := &wsConn{
+		write: func(msg wsServerMessage) error {
+			resp, err := grpcStreamResponse(msg)
+			if err != nil {
+				return err
+			}
+			return stream.Send(resp)
+		},
+		approvalTimeout: g.approvalTimeout,
+		tenant:          tenant,
+		stream:          g.stream,
+		pending:         make(map[string]chan bool),
+		closed:          make(chan struct{}),
+	}
+	defer close(c.closed)
+
+	for {
+		in, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			log.Printf("gRPC stream read failed: %v", err)
+			return err
+		}
+
+		var msg wsClientMessage
+		switch m := in.GetMessage().(type) {
+		case *gatewayv1.StreamRequest_Prompt:
+			msg = wsClientMessage{Type: "prompt", SessionID: m.Prompt.GetSessionId(), Text: m.Prompt.GetText(), RequireApproval: m.Prompt.GetRequireApproval()}
+		case *gatewayv1.StreamRequest_Approval:
+			msg = wsClientMessage{Type: "approval", ToolUseID: m.Approval.GetToolUseId(), Approved: m.Approval.GetApproved()}
+		default:
+			c.send(wsServerMessage{Type: "error", Error: "invalid message: expected a prompt or an approval"})
+			continue
+		}
+		c.handle(g.agent, msg)
+	}
+}
+
+// grpcStreamResponse converts a message of the /ws protocol
+func grpcStreamResponse(msg wsServerMessage) (*gatewayv1.StreamResponse, error) {
+	switch msg.Type {
+	case "event":
+		data, err := grpcStruct(msg.Event.Data)
+		if err != nil {
+			return nil, err
+		}
+		return &gatewayv1.StreamResponse{Message: &gatewayv1.StreamResponse_Event{Event: &gatewayv1.TraceEvent{
+			Time:          timestamppb.New(msg.Event.Time),
+			Type:          msg.Event.Type,
+			SessionId:     msg.Event.SessionID,
+			Tool:          msg.Event.Tool,
+			DurationMs:    msg.Event.Duration.Milliseconds(),
+			Error:         msg.Event.Error,
+			Data:          data,
+			Tags:          msg.Event.Tags,
+			CorrelationId: msg.Event.CorrelationID,
+		}}}, nil
+	case "approval_request":
+		input, err := grpcStruct(msg.Input)
+		if err != nil {
+			return nil, err
+		}
+		return &gatewayv1.StreamResponse{Message: &gatewayv1.StreamResponse_ApprovalRequest{ApprovalRequest: &gatewayv1.ApprovalRequest{
+			ToolUseId: msg.ToolUseID,
+			Tool:      msg.Tool,
+			Input:     input,
+		}}}, nil
+	case "result":
+		result, err := grpcInvokeResponse(msg.Result)
+		if err != nil {
+			return nil, err
+		}
+		return &gatewayv1.StreamResponse{Message: &gatewayv1.StreamResponse_Result{Result: result}}, nil
+	case "error":
+		report, err := grpcStruct(msg.Report)
+		if err != nil {
+			return nil, err
+		}
+		return &gatewayv1.StreamResponse{Message: &gatewayv1.StreamResponse_Error{Error: &gatewayv1.StreamError{
+			Message:   msg.Error,
+			Report:    report,
+			ToolUseId: msg.ToolUseID,
+		}}}, nil
+	}
+	return nil, status.Errorf(codes.Internal, "unknown stream message type %q", msg.Type)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// ErrOutputBlocked is returned by Invoke when an output guardrail blocks the final answer
+var ErrOutputBlocked = errors.New("answer blocked by output guardrail")
+
+// GuardrailAction is what a rule does when it matches
+type GuardrailAction string
+
+const (
+	GuardrailRedact GuardrailAction = "redact"
+	GuardrailBlock  GuardrailAction = "block"
+)
+
+// OutputRule matches text in the final answer
+type OutputRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Action  GuardrailAction
+	// Replacement is used by redact rules; empty uses "[REDACTED:<name>]"
+	Replacement string
+}
+
+// OutputGuardrails filter the agent's final answer before Invoke returns it. They run on
+// the text alone, so they work the same whatever model produced the answer.
+type OutputGuardrails struct {
+	Rules []OutputRule
+	// MaxLength caps the answer in bytes; 0 disables the check
+	MaxLength int
+	// BlockOverLength blocks answers over MaxLength instead of truncating them
+	BlockOverLength bool
+}
+
+// GuardrailFinding records one rule that fired
+type GuardrailFinding struct {
+	Rule    string          `json:"rule"`
+	Action  GuardrailAction `json:"action"`
+	Matches int             `json:"matches"`
+}
+
+// SecretDetectorRules redact common credential formats
+func SecretDetectorRules() []OutputRule {
+	return []OutputRule{
+		{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`), Action: GuardrailRedact},
+		{Name: "aws_secret_key", Pattern: regexp.MustCompile(`(?i)aws_secret_access_key\s*[=:]\s*[A-Za-z0-9/+=]{40}`), Action: GuardrailRedact},
+		{Name: "private_key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), Action: GuardrailRedact},
+		{Name: "bearer_token", Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{20,}=*`), Action: GuardrailRedact},
+		{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`), Action: GuardrailRedact},
+		{Name: "github_token", Pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`), Action: GuardrailRedact},
+	}
+}
+
+// DenyListRule builds a rule matching any of the given terms case-insensitively
+func DenyListRule(name string, action GuardrailAction, terms ...string) OutputRule {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	pattern := `(?i)\b(` + strings.Join(quoted, "|") + `)\b`
+	return OutputRule{Name: name, Pattern: regexp.MustCompile(pattern), Action: action}
+}
+
+// Apply runs every rule over text and returns the filtered text. A block rule stops
+// processing and returns ErrOutputBlocked.
+func (g *OutputGuardrails) Apply(text string) (string, []GuardrailFinding, error) {
+	var findings []GuardrailFinding
+
+	for _, rule := range g.Rules {
+		matches := rule.Pattern.FindAllStringIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		findings = append(findings, GuardrailFinding{Rule: rule.Name, Action: rule.Action, Matches: len(matches)})
+
+		switch rule.Action {
+		case GuardrailBlock:
+			return "", findings, fmt.Errorf("%w: rule %s", ErrOutputBlocked, rule.Name)
+		case GuardrailRedact:
+			replacement := rule.Replacement
+			if replacement == "" {
+				replacement = "[REDACTED:" + rule.Name + "]"
+			}
+			text = rule.Pattern.ReplaceAllLiteralString(text, replacement)
+		default:
+			return "", findings, fmt.Errorf("rule %s has unknown action %q", rule.Name, rule.Action)
+		}
+	}
+
+	if g.MaxLength > 0 && len(text) > g.MaxLength {
+		if g.BlockOverLength {
+			findings = append(findings, GuardrailFinding{Rule: "max_length", Action: GuardrailBlock, Matches: 1})
+			return "", findings, fmt.Errorf("%w: answer is %d bytes, limit is %d", ErrOutputBlocked, len(text), g.MaxLength)
+		}
+		findings = append(findings, GuardrailFinding{Rule: "max_length", Action: GuardrailRedact, Matches: 1})
+		text = truncateUTF8(text, g.MaxLength)
+	}
+
+	return text, findings, nil
+}
+
+// outputGuardrailsFile is the JSON layout read by LoadOutputGuardrails
+type outputGuardrailsFile struct {
+	SecretDetection bool     `json:"secretDetection"`
+	Deny            []string `json:"deny"`
+	Redact          []string `json:"redact"`
+	MaxLength       int      `json:"maxLength"`
+	BlockOverLength bool     `json:"blockOverLength"`
+}
+
+// LoadOutputGuardrails reads guardrails from a JSON file with "deny" and "redact" regex lists,
+// "secretDetection", "maxLength" and "blockOverLength"
+func LoadOutputGuardrails(path string) (*OutputGuardrails, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read guardrails file: %w", err)
+	}
+
+	var file outputGuardrailsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse guardrails file: %w", err)
+	}
+
+	g := &OutputGuardrails{MaxLength: file.MaxLength, BlockOverLength: file.BlockOverLength}
+	for i, pattern := range file.Deny {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+		g.Rules = append(g.Rules, OutputRule{Name: fmt.Sprintf("deny_%d", i), Pattern: re, Action: GuardrailBlock})
+	}
+	for i, pattern := range file.Redact {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		g.Rules = append(g.Rules, OutputRule{Name: fmt.Sprintf("redact_%d", i), Pattern: re, Action: GuardrailRedact})
+	}
+	if file.SecretDetection {
+		g.Rules = append(g.Rules, SecretDetectorRules()...)
+	}
+
+	return g, nil
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !isRuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// applyOutputGuardrails filters the final answer and, when it was redacted, rewrites the last
+// assistant message so the stored session doesn't keep the original text
+func (a *InlineAgent) applyOutputGuardrails(text string, messages []types.Message, sessionID string, emit func(TraceEvent)) (string, error) {
+	if a.OutputGuardrails == nil {
+		return text, nil
+	}
+
+	filtered, findings, err := a.OutputGuardrails.Apply(text)
+	for _, f := range findings {
+		emit(TraceEvent{
+			Type:      TraceGuardrail,
+			SessionID: sessionID,
+			Data: map[string]interface{}{
+				"rule":    f.Rule,
+				"action":  string(f.Action),
+				"matches": f.Matches,
+			},
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if filtered != text && len(messages) > 0 {
+		last := &messages[len(messages)-1]
+		last.Content = []types.ContentBlock{
+			&types.ContentBlockMemberText{Value: filtered},
+		}
+	}
+	return filtered, nil
+}
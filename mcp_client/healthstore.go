@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// healthStoreTimeout bounds writes of a server's health, which happen off the call path
+const healthStoreTimeout = 2 * time.Second
+
+// ServerHealth is a server's SLO state as shared between gateway replicas
+type ServerHealth struct {
+	Server     string    `json:"server"`
+	Violating  bool      `json:"violating"`
+	Violations []string  `json:"violations,omitempty"`
+	Updated    time.Time `json:"updated"`
+	// Until is when a replica that hasn't called the server itself stops trusting the state
+	Until time.Time `json:"until"`
+}
+
+// HealthStore keeps servers' SLO state across restarts and shares it between replicas, so a
+// freshly started gateway passes over a server others already found missing its SLO
+type HealthStore interface {
+	// Get returns a server's last reported health and whether there was an entry
+	Get(ctx context.Context, server string) (ServerHealth, bool, error)
+	Put(ctx context.Context, health ServerHealth) error
+}
+
+// RedisHealthStore stores server health as JSON under "<prefix>health:<server>"
+type RedisHealthStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisHealthStore creates a health store on the Redis server at addr. Entries expire,
+// and are no longer trusted, ttl after they were written.
+func NewRedisHealthStore(addr string, ttl time.Duration) *RedisHealthStore {
+	return &RedisHealthStore{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		prefix: "mcp:",
+		ttl:    ttl,
+	}
+}
+
+func (s *RedisHealthStore) key(server string) string {
+	return s.prefix + "health:" + server
+}
+
+func (s *RedisHealthStore) Get(ctx context.Context, server string) (ServerHealth, bool, error) {
+	data, err := s.client.Get(ctx, s.key(server)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ServerHealth{}, false, nil
+	}
+	if err != nil {
+		return ServerHealth{}, false, fmt.Errorf("failed to read server health: %w", err)
+	}
+
+	var health ServerHealth
+	if err := json.Unmarshal(data, &health); err != nil {
+		return ServerHealth{}, false, fmt.Errorf("failed to unmarshal server health: %w", err)
+	}
+	return health, true, nil
+}
+
+func (s *RedisHealthStore) Put(ctx context.Context, health ServerHealth) error {
+	if health.Until.IsZero() {
+		health.Until = health.Updated.Add(s.ttl)
+	}
+	data, err := json.Marshal(health)
+	if err != nil {
+		return fmt.Errorf("failed to marshal server health: %w", err)
+	}
+	if err := s.client.Set(ctx, s.key(health.Server), data, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to write server health: %w", err)
+	}
+	return nil
+}
+
+// Close releases the Redis connection pool
+func (s *RedisHealthStore) Close() error {
+	return s.client.Close()
+}
+
+// Restore seeds the tracker with the health the store holds for servers. A server reported
+// missing its SLO is treated as violating, and Admit refuses calls to it, until the entry's
+// Until.
+func (t *ServerStatsTracker) Restore(ctx context.Context, servers ...string) error {
+	if t == nil || t.Store == nil {
+		return nil
+	}
+	for _, server := range servers {
+		health, ok, err := t.Store.Get(ctx, server)
+		if err != nil {
+			return err
+		}
+		if !ok || !health.Violating || time.Now().After(health.Until) {
+			continue
+		}
+
+		t.mu.Lock()
+		if _, exists := t.servers[server]; !exists {
+			t.servers[server] = &serverSamples{violating: true, restoredUntil: health.Until}
+			log.Printf("MCP server %s was missing its SLO as of %s: %v", server, health.Updated.Format(time.RFC3339), health.Violations)
+		}
+		t.mu.Unlock()
+	}
+	return nil
+}
+
+// persist writes a server's new SLO state to the store in the background
+func (t *ServerStatsTracker) persist(stats ServerStats) {
+	if t.Store == nil {
+		return
+	}
+	health := ServerHealth{
+		Server:     stats.Server,
+		Violating:  len(stats.Violations) > 0,
+		Violations: stats.Violations,
+		Updated:    time.Now(),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), healthStoreTimeout)
+		defer cancel()
+		if err := t.Store.Put(ctx, health); err != nil {
+			log.Printf("Failed to store health of MCP server %s: %v", stats.Server, err)
+		}
+	}()
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+const (
+	// defaultHedgePercentile is the latency percentile after which a hedge is sent
+	defaultHedgePercentile = 0.95
+	// defaultHedgeRate is the largest share of recent model calls that may be hedged
+	defaultHedgeRate = 0.1
+	// defaultHedgeWindow is how many recent model calls the delay and rate are computed over
+	defaultHedgeWindow = 200
+	// minHedgeSamples is how many model calls must have been seen before any is hedged
+	minHedgeSamples = 20
+)
+
+// Hedge outcomes reported in model_call trace events
+const (
+	// HedgePrimaryWon means a hedge was sent but the original request answered first
+	HedgePrimaryWon = "primary"
+	// HedgeWon means the hedge answered first
+	HedgeWon = "hedge"
+)
+
+// ConverseHedging cuts tail latency of model calls for people waiting on an answer. When a
+// Converse call is slower than Percentile of recent calls, a second identical request, or
+// one to FallbackModel, is sent and whichever succeeds first is used; the other is
+// cancelled. A cancelled request may still be billed, so at most MaxRate of calls are
+// hedged. Batch invocations are never hedged.
+type ConverseHedging struct {
+	// Percentile of recent model call latencies to wait before hedging; 0 uses 0.95
+	Percentile float64
+	// MinDelay and MaxDelay bound the wait before hedging; zero doesn't bound it
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// FallbackModel is the model the hedge is sent to; empty resends to the same model
+	FallbackModel string
+	// MaxRate is the largest share of recent calls that may be hedged; 0 uses 0.1
+	MaxRate float64
+	// Window is how many recent calls the delay and rate are computed over; 0 uses 200
+	Window int
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	hedged    []bool
+	next      int
+	stats     HedgingStats
+}
+
+// HedgingStats counts hedged model calls since the agent was created
+type HedgingStats struct {
+	Calls     int64 `json:"calls"`
+	Hedged    int64 `json:"hedged"`
+	HedgeWins int64 `json:"hedgeWins"`
+	// OverBudget counts calls that were slow enough to hedge but over the MaxRate budget
+	OverBudget int64 `json:"overBudget"`
+	// Delay is the current wait before hedging; 0 until enough calls have been seen
+	Delay time.Duration `json:"delay"`
+}
+
+// hedgeAttempt is the outcome of one of the requests of a hedged call
+type hedgeAttempt struct {
+	out   *bedrockruntime.ConverseOutput
+	err   error
+	hedge bool
+}
+
+// converse makes a Converse call, hedging it once it has taken longer than the current
+// delay. fallbackModel overrides FallbackModel for the hedge, e.g. with "" when the
+// invocation may not use it. It returns the hedge outcome, empty when no hedge was sent.
+func (h *ConverseHedging) converse(ctx context.Context, client ConverseAPI, input *bedrockruntime.ConverseInput, fallbackModel string) (*bedrockruntime.ConverseOutput, string, error) {
+	start := time.Now()
+	delay, ok := h.delay()
+	if !ok {
+		out, err := client.Converse(ctx, input)
+		if err == nil {
+			h.record(time.Since(start), false, false)
+		}
+		return out, "", err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Buffered so the losing request's goroutine doesn't block once the call has returned
+	attempts := make(chan hedgeAttempt, 2)
+	send := func(input *bedrockruntime.ConverseInput, hedge bool) {
+		go func() {
+			out, err := client.Converse(ctx, input)
+			attempts <- hedgeAttempt{out: out, err: err, hedge: hedge}
+		}()
+	}
+	send(hedgeInput(input, ""), false)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending, hedged := 1, false
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if h.allow() {
+				hedged = true
+				pending++
+				send(hedgeInput(input, fallbackModel), true)
+			}
+		case attempt := <-attempts:
+			pending--
+			if attempt.err == nil {
+				h.record(time.Since(start), hedged, attempt.hedge)
+				return attempt.out, hedgeOutcome(hedged, attempt.hedge), nil
+			}
+			if firstErr == nil {
+				firstErr = attempt.err
+			}
+			// A failure is returned once nothing else is in flight; the primary failing
+			// before the delay is not hedged, that is for retries to deal with
+			if pending == 0 {
+				return nil, hedgeOutcome(hedged, attempt.hedge), firstErr
+			}
+		}
+	}
+}
+
+// hedgeInput copies input for one request of a hedged call, so the agent can append to the
+// conversation while the losing request is still being cancelled
+func hedgeInput(input *bedrockruntime.ConverseInput, modelID string) *bedrockruntime.ConverseInput {
+	copied := *input
+	copied.Messages = append([]types.Message(nil), input.Messages...)
+	copied.System = append([]types.SystemContentBlock(nil), input.System...)
+	if modelID != "" {
+		copied.ModelId = aws.String(modelID)
+	}
+	return &copied
+}
+
+func hedgeOutcome(hedged, hedgeAnswered bool) string {
+	switch {
+	case !hedged:
+		return ""
+	case hedgeAnswered:
+		return HedgeWon
+	default:
+		return HedgePrimaryWon
+	}
+}
+
+// delay returns the wait before hedging, or false until enough calls have been seen
+func (h *ConverseHedging) delay() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delayLocked()
+}
+
+// delayLocked computes the delay; it must be called with mu held
+func (h *ConverseHedging) delayLocked() (time.Duration, bool) {
+	if len(h.latencies) < minHedgeSamples {
+		return 0, false
+	}
+	p := h.Percentile
+	if p <= 0 || p >= 1 {
+		p = defaultHedgePercentile
+	}
+	delay := percentile(sortedDurations(h.latencies), p)
+	if h.MinDelay > 0 && delay < h.MinDelay {
+		delay = h.MinDelay
+	}
+	if h.MaxDelay > 0 && delay > h.MaxDelay {
+		delay = h.MaxDelay
+	}
+	return delay, true
+}
+
+// allow reports whether another call may be hedged without going over MaxRate
+func (h *ConverseHedging) allow() bool {
+	rate := h.MaxRate
+	if rate <= 0 {
+		rate = defaultHedgeRate
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hedged := 0
+	for _, was := range h.hedged {
+		if was {
+			hedged++
+		}
+	}
+	if float64(hedged+1) > rate*float64(len(h.hedged)) {
+		h.stats.OverBudget++
+		return false
+	}
+	return true
+}
+
+// record adds a successful call's latency, as seen by the caller, to the window
+func (h *ConverseHedging) record(latency time.Duration, hedged, hedgeWon bool) {
+	window := h.Window
+	if window <= 0 {
+		window = defaultHedgeWindow
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < window {
+		h.latencies = append(h.latencies, latency)
+		h.hedged = append(h.hedged, hedged)
+	} else {
+		h.latencies[h.next] = latency
+		h.hedged[h.next] = hedged
+		h.next = (h.next + 1) % len(h.latencies)
+	}
+	h.stats.Calls++
+	if hedged {
+		h.stats.Hedged++
+	}
+	if hedgeWon {
+		h.stats.HedgeWins++
+	}
+}
+
+// Stats returns the hedging counts so far; a nil ConverseHedging has none
+func (h *ConverseHedging) Stats() HedgingStats {
+	if h == nil {
+		return HedgingStats{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stats := h.stats
+	stats.Delay, _ = h.delayLocked()
+	return stats
+}
+
+func sortedDurations(durations []time.Duration) []time.Duration {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
@@ -0,0 +1,11 @@
+package main
+
+import "context"
+
+// Hooks are callbacks around an invocation. Nil hooks are skipped.
+type Hooks struct {
+	BeforeInvoke   func(ctx context.Context, sessionID, inputText string)
+	BeforeToolCall func(ctx context.Context, toolUse map[string]interface{})
+	AfterToolCall  func(ctx context.Context, call ToolCallRecord)
+	AfterInvoke    func(ctx context.Context, sessionID string, result *Result, err error)
+}
@@ -1,372 +1,101 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
-)
-
-// MCP Protocol Types
-type MCPRequest struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      int         `json:"id"`
-	Method  string      `json:"method"`
-	Params  interface{} `json:"params,omitempty"`
-}
-
-type MCPResponse struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      int         `json:"id"`
-	Result  interface{} `json:"result,omitempty"`
-	Error   *MCPError   `json:"error,omitempty"`
-}
-
-type MCPError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-}
-
-// Tool definitions
-type Tool struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	InputSchema map[string]interface{} `json:"inputSchema"`
-}
-
-type ToolCall struct {
-	Name      string                 `json:"name"`
-	Arguments map[string]interface{} `json:"arguments"`
-}
 
-type ToolResult struct {
-	Content []ContentBlock `json:"content"`
-	IsError bool           `json:"isError,omitempty"`
-}
-
-type ContentBlock struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
-}
-
-// MCP Client
-type MCPClient struct {
-	baseURL    string
-	httpClient *http.Client
-	requestID  int
-}
-
-// NewMCPClient creates a new MCP client
-func NewMCPClient(baseURL string) *MCPClient {
-	return &MCPClient{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		requestID: 0,
-	}
-}
-
-// extractSSEData extracts JSON data from Server-Sent Events format
-func extractSSEData(sseResponse string) string {
-	scanner := bufio.NewScanner(strings.NewReader(sseResponse))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "data:") {
-			// Extract everything after "data: "
-			return strings.TrimSpace(line[5:])
-		}
-	}
-	return ""
-}
-
-// sendRequest sends an MCP request and returns the response
-func (c *MCPClient) sendRequest(ctx context.Context, method string, params interface{}) (*MCPResponse, error) {
-	c.requestID++
-	
-	req := MCPRequest{
-		JSONRPC: "2.0",
-		ID:      c.requestID,
-		Method:  method,
-		Params:  params,
-	}
-
-	reqBody, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	log.Printf("Sending MCP request to %s: %s", c.baseURL, method)
-	log.Printf("Request body: %s", string(reqBody))
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "application/json, text/event-stream")
-
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+	"mcp-client/gatewayv1"
+	"mcp-client/pkg/mcpclient"
+)
 
-	log.Printf("Response status: %d", resp.StatusCode)
-	log.Printf("Response body: %s", string(body))
+// BedrockToolHandler handles tool calls from Bedrock agents
+type BedrockToolHandler struct {
+	mcpClient *MCPClient
+	init      *lazyInit
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
-	}
+	// catalog shares discovered tools with other gateway replicas; nil lists them locally
+	catalog ToolCatalog
+	toolsMu sync.RWMutex
+	tools   []Tool
+	stale   bool
 
-	body, err = io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+	// startup records the outcome of each handshake attempt
+	startup StartupReport
 
-	// Handle empty responses (common with notifications)
-	if len(body) == 0 {
-		return &MCPResponse{
-			JSONRPC: "2.0",
-			ID:      c.requestID,
-			Result:  nil,
-		}, nil
-	}
+	// OnToolsChanged is called, after logging, when a refresh finds the server's tools changed
+	OnToolsChanged func(diff *ToolSchemaDiff)
 
-	// Check if response is Server-Sent Events format
-	bodyStr := string(body)
-	if strings.HasPrefix(bodyStr, "event:") {
-		// Parse SSE format
-		jsonData := extractSSEData(bodyStr)
-		if jsonData == "" {
-			log.Printf("No data found in SSE response: %s", bodyStr)
-			return &MCPResponse{
-				JSONRPC: "2.0",
-				ID:      c.requestID,
-				Result:  nil,
-			}, nil
-		}
-		
-		var mcpResp MCPResponse
-		if err := json.Unmarshal([]byte(jsonData), &mcpResp); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal SSE JSON data: %w", err)
-		}
-		
-		if mcpResp.Error != nil {
-			return nil, fmt.Errorf("MCP error %d: %s", mcpResp.Error.Code, mcpResp.Error.Message)
-		}
-		
-		return &mcpResp, nil
-	}
+	// Shadow also sends tool calls to a candidate server to compare results; nil doesn't
+	Shadow *ShadowCaller
 
-	var mcpResp MCPResponse
-	if err := json.Unmarshal(body, &mcpResp); err != nil {
-		// If it's not valid JSON, it might be a notification or SSE response
-		log.Printf("Non-JSON response received: %s", string(body))
-		return &MCPResponse{
-			JSONRPC: "2.0",
-			ID:      c.requestID,
-			Result:  map[string]interface{}{"raw": string(body)},
-		}, nil
-	}
+	// Injection screens tool outputs for likely prompt injection; nil doesn't
+	Injection *InjectionScreen
 
-	if mcpResp.Error != nil {
-		return nil, fmt.Errorf("MCP error %d: %s", mcpResp.Error.Code, mcpResp.Error.Message)
-	}
+	// Stats tracks the server's latency and result size against an SLO; nil doesn't
+	Stats *ServerStatsTracker
 
-	return &mcpResp, nil
+	// events fans lifecycle events out to Events subscribers
+	events EventBus
 }
 
-// Initialize initializes the MCP connection
-func (c *MCPClient) Initialize(ctx context.Context) error {
-	params := map[string]interface{}{
-		"protocolVersion": "2024-11-05",
-		"capabilities": map[string]interface{}{
-			"tools": map[string]interface{}{
-				"listChanged": true,
-			},
-		},
-		"clientInfo": map[string]interface{}{
-			"name":    "bedrock-mcp-client",
-			"version": "1.0.0",
-		},
-	}
-
-	resp, err := c.sendRequest(ctx, "initialize", params)
-	if err != nil {
-		return err
-	}
-
-	log.Printf("Initialize response: %+v", resp.Result)
-
-	// Send initialized notification - required for server to be ready
-	log.Printf("Sending initialized notification...")
-	
-	notifyParams := map[string]interface{}{}
-	c.requestID++
-	
-	notifyReq := MCPRequest{
-		JSONRPC: "2.0",
-		Method:  "notifications/initialized",
-		Params:  notifyParams,
-		// Note: notifications don't have an ID in MCP spec
-	}
-
-	reqBody, err := json.Marshal(notifyReq)
-	if err != nil {
-		return fmt.Errorf("failed to marshal notification: %w", err)
-	}
-
-	log.Printf("Notification request: %s", string(reqBody))
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return fmt.Errorf("failed to create notification request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "application/json, text/event-stream")
-
-	resp2, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("notification request failed: %w", err)
-	}
-	defer resp2.Body.Close()
-
-	// Read and parse notification response
-	body, err := io.ReadAll(resp2.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read notification response: %w", err)
-	}
-
-	log.Printf("Notification response status: %d", resp2.StatusCode)
-	log.Printf("Notification response body: %s", string(body))
-
-	// Parse the notification response if it contains JSON
-	if len(body) > 0 {
-		bodyStr := string(body)
-		if strings.HasPrefix(bodyStr, "event:") {
-			// Extract JSON from SSE
-			jsonData := extractSSEData(bodyStr)
-			log.Printf("Extracted notification JSON: %s", jsonData)
-			
-			if jsonData != "" {
-				var notifyResp MCPResponse
-				if err := json.Unmarshal([]byte(jsonData), &notifyResp); err == nil {
-					if notifyResp.Error != nil {
-						return fmt.Errorf("notification error %d: %s", notifyResp.Error.Code, notifyResp.Error.Message)
-					}
-				}
-			}
-		} else {
-			// Try to parse as direct JSON
-			var notifyResp MCPResponse
-			if err := json.Unmarshal(body, &notifyResp); err == nil {
-				if notifyResp.Error != nil {
-					return fmt.Errorf("notification error %d: %s", notifyResp.Error.Code, notifyResp.Error.Message)
-				}
-			}
+// NewBedrockToolHandler creates a new Bedrock tool handler
+func NewBedrockToolHandler(mcpServerURL string) *BedrockToolHandler {
+	h := &BedrockToolHandler{
+		mcpClient: mcpclient.New(mcpServerURL),
+	}
+	h.startup.events = &h.events
+	h.init = newLazyInit(func(ctx context.Context) error {
+		tools, err := handshake(ctx, h.mcpClient, func(ctx context.Context) ([]Tool, error) {
+			tools, _, err := h.discoverTools(ctx, nil)
+			return tools, err
+		}, &h.startup)
+		if err != nil {
+			return err
 		}
-	}
-
-	log.Printf("MCP client successfully initialized")
-	return nil
-}
-
-// ListTools retrieves available tools from the MCP server
-func (c *MCPClient) ListTools(ctx context.Context) ([]Tool, error) {
-	resp, err := c.sendRequest(ctx, "tools/list", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Parse the tools from the response
-	resultMap, ok := resp.Result.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("unexpected response format")
-	}
-
-	toolsInterface, ok := resultMap["tools"]
-	if !ok {
-		return nil, fmt.Errorf("no tools found in response")
-	}
-
-	toolsBytes, err := json.Marshal(toolsInterface)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal tools: %w", err)
-	}
 
-	var tools []Tool
-	if err := json.Unmarshal(toolsBytes, &tools); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal tools: %w", err)
-	}
-
-	return tools, nil
+		h.toolsMu.Lock()
+		h.tools = tools
+		h.toolsMu.Unlock()
+		return nil
+	})
+	return h
 }
 
-// CallTool executes a tool with the given arguments
-func (c *MCPClient) CallTool(ctx context.Context, toolCall ToolCall) (*ToolResult, error) {
-	params := map[string]interface{}{
-		"name":      toolCall.Name,
-		"arguments": toolCall.Arguments,
-	}
-
-	resp, err := c.sendRequest(ctx, "tools/call", params)
-	if err != nil {
+// Initialize sets up the MCP connection and retrieves available tools.
+// It only talks to the server until initialization has succeeded once, so it is
+// also how lazily started handlers are brought up on first use.
+func (h *BedrockToolHandler) Initialize(ctx context.Context) ([]Tool, error) {
+	if err := h.init.Do(ctx); err != nil {
 		return nil, err
 	}
 
-	// Parse the tool result
-	resultBytes, err := json.Marshal(resp.Result)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	h.toolsMu.RLock()
+	stale := h.stale
+	h.toolsMu.RUnlock()
+	if stale {
+		h.refreshTools(ctx)
 	}
 
-	var result ToolResult
-	if err := json.Unmarshal(resultBytes, &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
-	}
-
-	return &result, nil
+	h.toolsMu.RLock()
+	defer h.toolsMu.RUnlock()
+	return h.tools, nil
 }
 
-// BedrockToolHandler handles tool calls from Bedrock agents
-type BedrockToolHandler struct {
-	mcpClient *MCPClient
-}
-
-// NewBedrockToolHandler creates a new Bedrock tool handler
-func NewBedrockToolHandler(mcpServerURL string) *BedrockToolHandler {
-	return &BedrockToolHandler{
-		mcpClient: NewMCPClient(mcpServerURL),
-	}
-}
-
-// Initialize sets up the MCP connection and retrieves available tools
-func (h *BedrockToolHandler) Initialize(ctx context.Context) ([]Tool, error) {
-	if err := h.mcpClient.Initialize(ctx); err != nil {
-		return nil, fmt.Errorf("failed to initialize MCP client: %w", err)
-	}
-
-	tools, err := h.mcpClient.ListTools(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list tools: %w", err)
-	}
-
-	return tools, nil
+// Ready reports whether the MCP server has been initialized
+func (h *BedrockToolHandler) Ready() bool {
+	ready, _ := h.init.Status()
+	return ready
 }
 
 // HandleToolUse processes a tool call from Bedrock
@@ -383,14 +112,37 @@ func (h *BedrockToolHandler) HandleToolUse(ctx context.Context, toolUse map[stri
 		input = make(map[string]interface{})
 	}
 
+	// Bring the MCP server up on first use
+	if _, err := h.Initialize(ctx); err != nil {
+		return map[string]interface{}{
+			"toolUseId": toolUseID,
+			"content": []map[string]interface{}{
+				{
+					"text": fmt.Sprintf("Tool server unavailable: %v", err),
+				},
+			},
+			"status": "error",
+		}, nil
+	}
+
 	// Create tool call
 	toolCall := ToolCall{
 		Name:      name,
 		Arguments: input,
 	}
+	if key := toolCallIdempotencyKey(ctx, name, input); key != "" {
+		toolCall.Meta = map[string]interface{}{"idempotencyKey": key}
+	}
 
 	// Execute the tool
-	result, err := h.mcpClient.CallTool(ctx, toolCall)
+	var result *ToolResult
+	err := h.Stats.Admit(h.mcpClient.BaseURL())
+	if err == nil {
+		callStart := time.Now()
+		result, err = h.mcpClient.CallTool(ctx, toolCall)
+		h.Shadow.Shadow(ctx, toolCall, result, err, time.Since(callStart))
+		h.Stats.Record(h.mcpClient.BaseURL(), time.Since(callStart), resultSize(result), err)
+	}
 	if err != nil {
 		return map[string]interface{}{
 			"toolUseId": toolUseID,
@@ -404,23 +156,20 @@ func (h *BedrockToolHandler) HandleToolUse(ctx context.Context, toolUse map[stri
 	}
 
 	// Format response for Bedrock
-	content := make([]map[string]interface{}, len(result.Content))
-	for i, block := range result.Content {
-		content[i] = map[string]interface{}{
-			"text": block.Text,
-		}
-	}
+	content := toolResultContent(result.Content)
 
 	status := "success"
 	if result.IsError {
 		status = "error"
 	}
 
-	return map[string]interface{}{
+	response := map[string]interface{}{
 		"toolUseId": toolUseID,
 		"content":   content,
 		"status":    status,
-	}, nil
+	}
+	h.Injection.screen(name, response)
+	return response, nil
 }
 
 // ConvertToolsForBedrock converts MCP tools to Bedrock tool format
@@ -444,20 +193,91 @@ func (h *BedrockToolHandler) ConvertToolsForBedrock(tools []Tool) []map[string]i
 
 // Example usage and HTTP server for Bedrock integration
 func main() {
+	// MCP_INIT_MODE=lazy|background lets the server start before the MCP server is reachable
+	initMode, err := ParseInitMode(os.Getenv("MCP_INIT_MODE"))
+	if err != nil {
+		log.Fatalf("Invalid MCP_INIT_MODE: %v", err)
+	}
+
 	// Try different common MCP endpoints
 	mcpEndpoints := []string{
 		"http://localhost:3001/mcp",  // We know this one works
 	}
 	
+	// MCP_PROXY_OVERRIDES sends chosen servers through their own proxy, or directly
+	proxies, err := mcpclient.ProxyOverridesFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid proxy overrides: %v", err)
+	}
+
+	// GATEWAY_REDIS_ADDR shares tool discovery between gateway replicas
+	var catalog *RedisToolCatalog
+	if addr := os.Getenv("GATEWAY_REDIS_ADDR"); addr != "" {
+		catalog = NewRedisToolCatalog(addr, 10*time.Minute)
+		defer catalog.Close()
+		log.Printf("Sharing tool catalog through Redis at %s", addr)
+	}
+
+	// GATEWAY_MCP_ROOTS is a comma-separated list of URIs the server may ask for with roots/list
+	var roots []mcpclient.Root
+	for _, uri := range strings.Split(os.Getenv("GATEWAY_MCP_ROOTS"), ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			roots = append(roots, mcpclient.Root{URI: uri})
+		}
+	}
+
+	// GATEWAY_SAMPLING_MODEL answers the server's sampling/createMessage requests with a Bedrock model
+	var sampling mcpclient.ServerRequestHandler
+	if model := os.Getenv("GATEWAY_SAMPLING_MODEL"); model != "" {
+		if sampling, err = NewSamplingHandler(context.Background(), model); err != nil {
+			log.Fatalf("Failed to set up sampling: %v", err)
+		}
+		log.Printf("Answering sampling requests with %s", model)
+	}
+
 	var handler *BedrockToolHandler
 	var workingEndpoint string
 	
+	if initMode != InitEager {
+		// Without probing we can't pick between endpoints, so use the first
+		handler = NewBedrockToolHandler(mcpEndpoints[0])
+		workingEndpoint = mcpEndpoints[0]
+		if err := proxies.Apply(handler.mcpClient); err != nil {
+			log.Fatalf("Failed to set proxy: %v", err)
+		}
+		if len(roots) > 0 {
+			handler.mcpClient.HandleServerRequest(mcpclient.MethodRootsList, mcpclient.RootsHandler(roots...))
+		}
+		if sampling != nil {
+			handler.mcpClient.HandleServerRequest(mcpclient.MethodCreateMessage, sampling)
+		}
+		if catalog != nil {
+			handler.SetToolCatalog(catalog)
+		}
+	}
+
 	for _, endpoint := range mcpEndpoints {
+		if handler != nil {
+			break
+		}
+
 		log.Printf("Trying MCP endpoint: %s", endpoint)
 		testHandler := NewBedrockToolHandler(endpoint)
+		if err := proxies.Apply(testHandler.mcpClient); err != nil {
+			log.Fatalf("Failed to set proxy: %v", err)
+		}
+		if len(roots) > 0 {
+			testHandler.mcpClient.HandleServerRequest(mcpclient.MethodRootsList, mcpclient.RootsHandler(roots...))
+		}
+		if sampling != nil {
+			testHandler.mcpClient.HandleServerRequest(mcpclient.MethodCreateMessage, sampling)
+		}
+		if catalog != nil {
+			testHandler.SetToolCatalog(catalog)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		
-		if err := testHandler.mcpClient.Initialize(ctx); err != nil {
+		if _, err := testHandler.Initialize(ctx); err != nil {
 			log.Printf("Failed to connect to %s: %v", endpoint, err)
 			cancel()
 			continue
@@ -476,62 +296,622 @@ func main() {
 		log.Fatal("3. The server accepts HTTP POST requests with JSON-RPC 2.0")
 		return
 	}
-	
-	log.Printf("Successfully connected to MCP server at: %s", workingEndpoint)
+
+	if handler.catalog != nil {
+		go handler.WatchToolCatalog(context.Background())
+	}
+
+	// GATEWAY_TOOLS_POLL_INTERVAL (default 5m) is how often tools are re-listed on a server
+	// that doesn't announce tool changes with tools/list_changed
+	pollInterval := 5 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("GATEWAY_TOOLS_POLL_INTERVAL")); err == nil && d > 0 {
+		pollInterval = d
+	}
+	go handler.PollTools(context.Background(), pollInterval)
+
+	// GATEWAY_TRACE_FILE records tool schema changes, and the gateway agent's traces, as JSON lines
+	var traceSink TraceSink
+	if path := os.Getenv("GATEWAY_TRACE_FILE"); path != "" {
+		sink, err := NewJSONLTraceSink(path)
+		if err != nil {
+			log.Fatalf("Failed to open trace file: %v", err)
+		}
+		defer sink.Close()
+		traceSink = sink
+	}
+	// GATEWAY_EVENT_BUS publishes lifecycle events, such as failed invocations and exceeded
+	// budgets, to an EventBridge bus
+	if bus := os.Getenv("GATEWAY_EVENT_BUS"); bus != "" {
+		events, err := NewEventBridgeSink(context.Background(), bus, os.Getenv("GATEWAY_EVENT_SOURCE"))
+		if err != nil {
+			log.Fatalf("Failed to set up event publishing: %v", err)
+		}
+		defer events.Close()
+		traceSink = NewMultiTraceSink(traceSink, events)
+	}
+	if traceSink != nil {
+		handler.OnToolsChanged = func(diff *ToolSchemaDiff) {
+			traceSink.Emit(diff.TraceEvent())
+		}
+	}
+
+	// GATEWAY_SHADOW_MCP_URL sends tool calls also to a candidate server release, comparing
+	// its results with the live server's without using them. GATEWAY_SHADOW_TOOLS limits this
+	// to a comma-separated list of tools that are safe to run twice; GATEWAY_SHADOW_SAMPLE_RATE
+	// shadows only that fraction of calls.
+	var gatewayCaller MCPCaller = handler.mcpClient
+	if url := os.Getenv("GATEWAY_SHADOW_MCP_URL"); url != "" {
+		candidate := mcpclient.New(url)
+		if err := proxies.Apply(candidate); err != nil {
+			log.Fatalf("Failed to set proxy: %v", err)
+		}
+		shadow := NewShadowCaller(handler.mcpClient, candidate)
+		for _, tool := range strings.Split(os.Getenv("GATEWAY_SHADOW_TOOLS"), ",") {
+			if tool = strings.TrimSpace(tool); tool != "" {
+				shadow.Tools = append(shadow.Tools, tool)
+			}
+		}
+		shadow.SampleRate, _ = strconv.ParseFloat(os.Getenv("GATEWAY_SHADOW_SAMPLE_RATE"), 64)
+		shadow.TraceSink = traceSink
+		if err := candidate.Initialize(context.Background()); err != nil {
+			log.Printf("Shadow candidate %s failed to initialize: %v", url, err)
+		}
+		handler.Shadow = shadow
+		gatewayCaller = shadow
+		log.Printf("Shadowing tool calls on %s", url)
+	}
+
+	// GATEWAY_SLO_P95_LATENCY (e.g. 2s) and GATEWAY_SLO_P95_RESPONSE_BYTES set the SLO tool
+	// calls are checked against; per-server stats are served on /metrics either way
+	var slo ServerSLO
+	slo.MaxP95Latency, _ = time.ParseDuration(os.Getenv("GATEWAY_SLO_P95_LATENCY"))
+	slo.MaxP95ResponseBytes, _ = strconv.ParseInt(os.Getenv("GATEWAY_SLO_P95_RESPONSE_BYTES"), 10, 64)
+	serverStats := NewServerStatsTracker(slo)
+	serverStats.TraceSink = traceSink
+	serverStats.Events = &handler.events
+	handler.Stats = serverStats
+	// With GATEWAY_REDIS_ADDR, servers found missing their SLO stay passed over by new replicas
+	if addr := os.Getenv("GATEWAY_REDIS_ADDR"); addr != "" {
+		healthStore := NewRedisHealthStore(addr, 5*time.Minute)
+		defer healthStore.Close()
+		serverStats.Store = healthStore
+		if err := serverStats.Restore(context.Background(), handler.mcpClient.BaseURL()); err != nil {
+			log.Printf("Failed to restore MCP server health: %v", err)
+		}
+	}
+
+	// GATEWAY_INJECTION_ACTION (flag, strip or block) screens tool outputs for likely prompt
+	// injection before they reach a model
+	injectionAction := InjectionAction(os.Getenv("GATEWAY_INJECTION_ACTION"))
+	switch injectionAction {
+	case "":
+	case InjectionFlag, InjectionStrip, InjectionBlock:
+		handler.Injection = &InjectionScreen{Rules: InjectionRules(injectionAction)}
+	default:
+		log.Fatalf("Invalid GATEWAY_INJECTION_ACTION %q", injectionAction)
+	}
+
+	// Inject transport faults when any MCP_FAULT_* probability is set; endpoint probing above runs without them
+	faults, err := FaultConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid fault injection config: %v", err)
+	}
+	if faults.Enabled() {
+		log.Printf("Fault injection enabled: %+v", faults)
+		handler.mcpClient.SetTransport(NewFaultInjector(handler.mcpClient.Transport(), faults))
+	}
 	
 	ctx := context.Background()
 	
-	// Initialize and get tools
-	tools, err := handler.Initialize(ctx)
-	if err != nil {
-		log.Fatalf("Failed to initialize: %v", err)
+	switch initMode {
+	case InitEager:
+		log.Printf("Successfully connected to MCP server at: %s", workingEndpoint)
+
+		tools, _ := handler.Initialize(ctx)
+		log.Printf("Found %d tools:", len(tools))
+		for _, tool := range tools {
+			log.Printf("- %s: %s", tool.Name, tool.Description)
+		}
+	case InitBackground:
+		log.Printf("Initializing MCP server at %s in the background", workingEndpoint)
+		go func() {
+			if _, err := handler.Initialize(ctx); err != nil {
+				log.Printf("Background initialization failed, will retry on first use: %v", err)
+			}
+		}()
+	case InitLazy:
+		log.Printf("MCP server at %s will be initialized on first use", workingEndpoint)
 	}
 	
-	log.Printf("Found %d tools:", len(tools))
-	for _, tool := range tools {
-		log.Printf("- %s: %s", tool.Name, tool.Description)
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":      "ok",
+			"mcpReady":    handler.Ready(),
+			"startup":     handler.startup.Servers(),
+			"correlation": handler.mcpClient.CorrelationStats(),
+		})
+	})
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"servers": serverStats.All(),
+			"streams": map[string]mcpclient.SSEStreamStats{
+				handler.mcpClient.BaseURL(): handler.mcpClient.SSEStats(),
+			},
+		})
+	})
+
+	// GATEWAY_TENANTS_FILE lets several teams share the gateway, each with its own sessions,
+	// rate limit, token budget, action groups and audit log
+	var tenants *tenantGateway
+	if path := os.Getenv("GATEWAY_TENANTS_FILE"); path != "" {
+		cfg, err := LoadTenantsConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load tenants: %v", err)
+		}
+		if tenants, err = newTenantGateway(ctx, cfg, traceSink); err != nil {
+			log.Fatalf("Failed to set up tenants: %v", err)
+		}
+		defer tenants.Close()
+		log.Printf("Serving %d tenants", len(cfg.Tenants))
 	}
-	
-	// Convert tools for Bedrock format
-	bedrockTools := handler.ConvertToolsForBedrock(tools)
-	
+
+	// GATEWAY_TOOL_POLICY (a JSON rules file or an OPA decision URL) is checked before every tool call
+	var toolPolicy ToolPolicy
+	if location := os.Getenv("GATEWAY_TOOL_POLICY"); location != "" {
+		if toolPolicy, err = OpenToolPolicy(location); err != nil {
+			log.Fatalf("Failed to load tool policy: %v", err)
+		}
+	}
+
+	// GATEWAY_AGENT_MODEL runs an inline agent over the MCP server and streams it to browsers on /ws
+	// GATEWAY_KNOWLEDGE_BASE_ID adds retrieval, and /invoke then also answers {"inputText": ...} with citations
+	var gatewayAgent *InlineAgent
+	var warmUpEnabled bool
+	// drain turns new requests away once an operator takes the instance out of service
+	var drain gatewayDrain
+	agentModel := os.Getenv("GATEWAY_AGENT_MODEL")
+	if agentModel != "" {
+		instruction := os.Getenv("GATEWAY_AGENT_INSTRUCTION")
+		if instruction == "" {
+			instruction = "You are a friendly assistant for resolving user queries using available tools."
+		}
+		instructionOpt := WithInstruction(instruction)
+
+		// GATEWAY_AGENT_PROMPT (e.g. "cluster-ops/v3") takes the instruction from the prompt
+		// library in PROMPT_STORE, a directory or dynamodb://<table>
+		if ref := os.Getenv("GATEWAY_AGENT_PROMPT"); ref != "" {
+			store, err := OpenPromptStore(ctx, os.Getenv("PROMPT_STORE"))
+			if err != nil {
+				log.Fatalf("Failed to open prompt store: %v", err)
+			}
+			instructionOpt = WithPrompt(ctx, store, ref, nil)
+		}
+
+		// GATEWAY_TOOL_EXAMPLES adds example arguments to tool descriptions that have none:
+		// "schema" builds them from the input schema, anything else is the model ID to write them
+		var toolHooks []ToolHook
+		switch examples := os.Getenv("GATEWAY_TOOL_EXAMPLES"); examples {
+		case "":
+		case "schema":
+			toolHooks = append(toolHooks, SchemaExampleHook())
+		default:
+			hook, err := NewModelExampleHook(ctx, examples)
+			if err != nil {
+				log.Fatalf("Failed to set up tool examples: %v", err)
+			}
+			toolHooks = append(toolHooks, hook)
+		}
+
+		agentOpts := []Option{
+			WithModel(agentModel),
+			instructionOpt,
+			WithName("GatewayAgent"),
+			WithServerStats(serverStats),
+			WithActionGroup(ActionGroup{
+				Name:       gatewayActionGroup,
+				MCPClients: []MCPCaller{gatewayCaller},
+				InitMode:   initMode,
+				ToolHooks:  toolHooks,
+			}),
+		}
+		if traceSink != nil {
+			agentOpts = append(agentOpts, WithTraceSink(traceSink))
+		}
+		if toolPolicy != nil {
+			agentOpts = append(agentOpts, WithToolPolicy(toolPolicy))
+		}
+		if injectionAction != "" {
+			agentOpts = append(agentOpts, WithInjectionScreen(injectionAction))
+		}
+		if kb := os.Getenv("GATEWAY_KNOWLEDGE_BASE_ID"); kb != "" {
+			agentOpts = append(agentOpts, WithKnowledgeBase(kb, 0))
+		}
+		// GATEWAY_WORKSPACE (s3://bucket/prefix or a directory) saves large tool outputs per session
+		if location := os.Getenv("GATEWAY_WORKSPACE"); location != "" {
+			store, err := OpenWorkspaceStore(ctx, location)
+			if err != nil {
+				log.Fatalf("Failed to open workspace: %v", err)
+			}
+			inlineLimit, _ := strconv.Atoi(os.Getenv("GATEWAY_WORKSPACE_INLINE_LIMIT"))
+			agentOpts = append(agentOpts, WithWorkspace(store, inlineLimit))
+		}
+		// GATEWAY_MAX_CONCURRENT_MODEL_CALLS queues model calls beyond the limit, interactive
+		// requests ahead of {"priority": "batch"} ones
+		if n, err := strconv.Atoi(os.Getenv("GATEWAY_MAX_CONCURRENT_MODEL_CALLS")); err == nil {
+			agentOpts = append(agentOpts, WithScheduler(n))
+		}
+		// GATEWAY_CONTEXT_WINDOW compacts long sessions before they overflow the model's
+		// context window; 0 uses the model's window
+		if n, err := strconv.Atoi(os.Getenv("GATEWAY_CONTEXT_WINDOW")); err == nil {
+			agentOpts = append(agentOpts, WithContextLimit(n, 0))
+		}
+		// GATEWAY_INVOKE_TIMEOUT (e.g. 60s) bounds each invocation, ending tool calls in time
+		// for the final model call; GATEWAY_MODEL_RESERVE sets the time kept back for it
+		if timeout, err := time.ParseDuration(os.Getenv("GATEWAY_INVOKE_TIMEOUT")); err == nil {
+			reserve, _ := time.ParseDuration(os.Getenv("GATEWAY_MODEL_RESERVE"))
+			agentOpts = append(agentOpts, WithTimeBudget(timeout, reserve))
+		}
+		// GATEWAY_TOOL_FAILURE_LIMIT has the agent answer without tools, marked degraded, after
+		// that many turns in which every tool call failed
+		if n, err := strconv.Atoi(os.Getenv("GATEWAY_TOOL_FAILURE_LIMIT")); err == nil {
+			agentOpts = append(agentOpts, WithToolFailureFallback(n))
+		}
+		// GATEWAY_TOOL_COMPOSITION runs the follow-up tool calls a tool result asks for in its
+		// _meta, up to that many per model tool call
+		if n, err := strconv.Atoi(os.Getenv("GATEWAY_TOOL_COMPOSITION")); err == nil {
+			agentOpts = append(agentOpts, WithToolComposition(n, nil))
+		}
+		// GATEWAY_HEDGE_PERCENTILE (e.g. 0.95) resends chat model calls slower than that
+		// percentile of recent ones, to GATEWAY_HEDGE_MODEL if set, and uses the first answer
+		if p, err := strconv.ParseFloat(os.Getenv("GATEWAY_HEDGE_PERCENTILE"), 64); err == nil {
+			agentOpts = append(agentOpts, WithConverseHedging(p, os.Getenv("GATEWAY_HEDGE_MODEL")))
+		}
+		// GATEWAY_PREFETCH_FILE lists read-only tools to run ahead of the model when a chat
+		// message matches their keywords or pattern, or is similar to their examples by the
+		// embeddings of GATEWAY_PREFETCH_EMBEDDING_MODEL
+		if path := os.Getenv("GATEWAY_PREFETCH_FILE"); path != "" {
+			rules, err := LoadPrefetchRules(path)
+			if err != nil {
+				log.Fatalf("Failed to load prefetch rules: %v", err)
+			}
+			agentOpts = append(agentOpts, WithToolPrefetch(rules...))
+			if modelID := os.Getenv("GATEWAY_PREFETCH_EMBEDDING_MODEL"); modelID != "" {
+				embed, err := NewBedrockEmbedder(context.Background(), modelID)
+				if err != nil {
+					log.Fatalf("Failed to create prefetch embedder: %v", err)
+				}
+				agentOpts = append(agentOpts, WithPrefetchEmbedder(embed))
+			}
+		}
+		// GATEWAY_SESSION_VARIABLES=true keeps per-session variables that tools read from
+		// _meta.sessionVariables and set with _meta.setSessionVariables
+		if enabled, _ := strconv.ParseBool(os.Getenv("GATEWAY_SESSION_VARIABLES")); enabled {
+			agentOpts = append(agentOpts, WithSessionVariables(0, 0))
+		}
+		// GATEWAY_RESPONSE_POLICY is a JSON response policy, e.g.
+		// {"language": "German", "tone": "formal", "maxLength": 2000, "format": "plain"}
+		if data := os.Getenv("GATEWAY_RESPONSE_POLICY"); data != "" {
+			policy, err := ParseResponsePolicy([]byte(data))
+			if err != nil {
+				log.Fatalf("Invalid GATEWAY_RESPONSE_POLICY: %v", err)
+			}
+			agentOpts = append(agentOpts, WithResponsePolicy(*policy))
+		}
+		// GATEWAY_TRANSCRIBE_URL accepts audio in /invoke, posting it to a speech-to-text
+		// service that answers with the transcript as plain text
+		if url := os.Getenv("GATEWAY_TRANSCRIBE_URL"); url != "" {
+			agentOpts = append(agentOpts, WithAudioTranscriber(HTTPTranscriber(url)))
+		}
+		// GATEWAY_TRANSLATE_TOOL_RESULTS (e.g. English) translates tool outputs written in
+		// another script, such as Japanese, into that language before the model sees them
+		if language := os.Getenv("GATEWAY_TRANSLATE_TOOL_RESULTS"); language != "" {
+			agentOpts = append(agentOpts, WithToolTranslation(language))
+		}
+		// GATEWAY_ARGUMENT_REPAIR checks tool arguments against the tool's schema, fixing up to
+		// that many simple mistakes per call, such as numbers sent as strings (0 allows 5)
+		if n, err := strconv.Atoi(os.Getenv("GATEWAY_ARGUMENT_REPAIR")); err == nil {
+			agentOpts = append(agentOpts, WithArgumentRepair(n))
+		}
+		// GATEWAY_SESSION_IDLE_TTL (e.g. 30m) and GATEWAY_SESSION_MAX_AGE (e.g. 24h) expire
+		// sessions, so a long-running gateway doesn't keep every conversation in memory
+		idleTTL, _ := time.ParseDuration(os.Getenv("GATEWAY_SESSION_IDLE_TTL"))
+		maxAge, _ := time.ParseDuration(os.Getenv("GATEWAY_SESSION_MAX_AGE"))
+		agentOpts = append(agentOpts, WithSessionTTL(idleTTL, maxAge))
+		// GATEWAY_TOOL_ANALYTICS=true aggregates tool usage per day, served on
+		// /admin/analytics/tools as JSON or CSV
+		if os.Getenv("GATEWAY_TOOL_ANALYTICS") == "true" {
+			agentOpts = append(agentOpts, WithToolAnalytics(NewToolAnalytics()))
+		}
+		// GATEWAY_LARGE_RESULT_MAX_ITEMS keeps that many items of each array in JSON tool
+		// outputs of 1 MiB or more, truncating them as the MCP response is read
+		if n, err := strconv.Atoi(os.Getenv("GATEWAY_LARGE_RESULT_MAX_ITEMS")); err == nil {
+			agentOpts = append(agentOpts, WithLargeResultTruncation(n))
+		}
+		// GATEWAY_AGENT_MAX_CONTINUATIONS continues answers cut off at max_tokens
+		if n, err := strconv.Atoi(os.Getenv("GATEWAY_AGENT_MAX_CONTINUATIONS")); err == nil {
+			agentOpts = append(agentOpts, WithAutoContinue(n))
+		}
+
+		agent, err := NewInlineAgent(agentOpts...)
+		if err != nil {
+			log.Fatalf("Failed to create agent: %v", err)
+		}
+
+		if agent.PromptRef != "" {
+			log.Printf("Gateway agent using prompt %s", agent.PromptRef)
+		}
+
+		// GATEWAY_WS_EVENT_BUFFER queues that many events per /ws connection (default 256);
+		// GATEWAY_WS_OVERFLOW is what a full queue does: coalesce model text and drop other
+		// events (the default), or block the agent until the browser catches up
+		stream := StreamBuffer{Size: 256}
+		if n, err := strconv.Atoi(os.Getenv("GATEWAY_WS_EVENT_BUFFER")); err == nil {
+			stream.Size = n
+		}
+		if stream.Overflow, err = ParseStreamOverflow(os.Getenv("GATEWAY_WS_OVERFLOW")); err != nil {
+			log.Fatalf("Invalid GATEWAY_WS_OVERFLOW: %v", err)
+		}
+
+		// GATEWAY_WARMUP=true initializes every MCP server and builds the tool configuration
+		// at start instead of on the first request; "converse" also makes a one-token model call
+		switch warmUp := os.Getenv("GATEWAY_WARMUP"); warmUp {
+		case "":
+		case "true", "converse":
+			warmUpEnabled = true
+			go func() {
+				if _, err := handler.Initialize(ctx); err != nil {
+					log.Printf("Warm-up failed to initialize the MCP server: %v", err)
+				}
+				if err := agent.WarmUp(ctx, warmUp == "converse"); err != nil {
+					log.Printf("Warm-up failed: %v", err)
+					return
+				}
+				log.Printf("Warm-up finished")
+			}()
+		default:
+			log.Fatalf("Invalid GATEWAY_WARMUP %q, want true or converse", warmUp)
+		}
+
+		gatewayAgent = agent
+		http.HandleFunc("/ws", newWebSocketHandler(agent, tenants, defaultApprovalTimeout, stream))
+		http.HandleFunc("/", serveChatUI)
+
+		// GATEWAY_GRPC_ADDR (e.g. :9090) also serves the agent's invoke, stream and session
+		// APIs over gRPC, as declared in gateway.proto
+		if addr := os.Getenv("GATEWAY_GRPC_ADDR"); addr != "" {
+			lis, err := net.Listen("tcp", addr)
+			if err != nil {
+				log.Fatalf("Failed to listen for gRPC on %s: %v", addr, err)
+			}
+			server := newGRPCServer(agent, tenants, defaultApprovalTimeout, stream)
+			drain.OnDrain(server.GracefulStop)
+			go func() {
+				log.Printf("Serving gRPC on %s", addr)
+				if err := server.Serve(lis); err != nil {
+					log.Printf("gRPC server failed: %v", err)
+				}
+			}()
+		}
+	}
+
+	// /readyz answers 200 once the MCP server is initialized and any warm-up has succeeded,
+	// so load balancers only route requests that won't pay cold-path costs
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ready := handler.Ready()
+		status := map[string]interface{}{"mcpReady": ready, "draining": drain.Draining()}
+		ready = ready && !drain.Draining()
+		if warmUpEnabled {
+			warmUp := gatewayAgent.WarmUpStatus()
+			ready = ready && warmUp.State == WarmUpReady
+			status["warmUp"] = warmUp
+		}
+		status["ready"] = ready
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+
+	// GATEWAY_ADMIN_TOKEN enables /admin/, authenticated with the token as a bearer token,
+	// to inspect the MCP server and sessions, refresh tools, trip or reset a server and
+	// drain the instance without restarting it
+	adminToken := os.Getenv("GATEWAY_ADMIN_TOKEN")
+	if adminToken != "" {
+		http.Handle("/admin/", newAdminHandler(adminToken, handler, gatewayAgent, &drain))
+	}
+
 	// Set up HTTP server for Bedrock integration
 	http.HandleFunc("/tools", func(w http.ResponseWriter, r *http.Request) {
+		tenant, ok := tenants.identify(w, r)
+		if !ok {
+			return
+		}
+		tools, err := handler.Initialize(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if !tenant.allowsGroup(gatewayActionGroup) {
+			tools = nil
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"tools": bedrockTools,
+			"tools": handler.ConvertToolsForBedrock(tools),
 		})
 	})
 	
+	idempotency := newIdempotencyStore(defaultIdempotencyTTL)
+
 	http.HandleFunc("/invoke", func(w http.ResponseWriter, r *http.Request) {
-		var request map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		tenant, ok := tenants.identify(w, r)
+		if !ok {
+			return
+		}
+
+		// Clients may pass their own correlation ID to find this request in the gateway's logs
+		correlationID := acceptCorrelationID(r.Header.Get(mcpclient.CorrelationIDHeader))
+		w.Header().Set(mcpclient.CorrelationIDHeader, correlationID)
+		ctx := mcpclient.WithCorrelationID(r.Context(), correlationID)
+		// MCP servers see the tenant the tool call is made for in _meta
+		ctx = mcpclient.WithRequestMeta(ctx, tenant.meta(nil))
+
+		rawRequest, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request", http.StatusBadRequest)
+			return
+		}
+
+		// Backend workers may use a binary codec for the internal hop; browsers and curl send JSON
+		requestCodec, err := codecFor(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		responseCodec := requestCodec
+		if accept := r.Header.Get("Accept"); accept != "" {
+			if responseCodec, err = codecFor(accept); err != nil {
+				http.Error(w, err.Error(), http.StatusNotAcceptable)
+				return
+			}
+		}
+
+		request, err := requestCodec.Unmarshal(rawRequest)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 		
+		// Prompts are answered by the gateway agent, with citations when retrieval is enabled
+		if inputText, ok := request["inputText"].(string); ok && gatewayAgent != nil {
+			opts, err := agentInvokeOptions(request)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			sessionID := opts.SessionID
+			opts.CorrelationID = correlationID
+			err = tenant.limit(true)
+			if err == nil {
+				opts, err = tenant.scope(ctx, gatewayAgent, opts)
+			}
+			var answer *Result
+			if err == nil {
+				answer, err = gatewayAgent.InvokeContext(ctx, inputText, opts)
+			}
+			tenant.record(auditRecord{Endpoint: "/invoke", CorrelationID: correlationID, SessionID: sessionID}, answer, err)
+			var invocationErr *InvocationError
+			if errors.As(err, &invocationErr) {
+				report, _ := json.Marshal(invocationErr.Report)
+				logf(ctx, "Invocation failed: %s", report)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), tenantStatus(err))
+				return
+			}
+			writeAgentAnswer(w, responseCodec, answer)
+			return
+		}
+
 		toolUse, ok := request["toolUse"].(map[string]interface{})
 		if !ok {
 			http.Error(w, "Missing toolUse", http.StatusBadRequest)
 			return
 		}
+		toolName, _ := toolUse["name"].(string)
+		toolInput, _ := toolUse["input"].(map[string]interface{})
+		auditedCall := []auditToolCall{newAuditToolCall(toolName, toolInput)}
+		if err := tenant.limit(false); err != nil {
+			tenant.record(auditRecord{Endpoint: "/invoke", CorrelationID: correlationID, Tools: auditedCall}, nil, err)
+			http.Error(w, err.Error(), tenantStatus(err))
+			return
+		}
+		if !tenant.allowsGroup(gatewayActionGroup) {
+			tenant.record(auditRecord{Endpoint: "/invoke", CorrelationID: correlationID, Tools: auditedCall}, nil, ErrTenantForbidden)
+			http.Error(w, ErrTenantForbidden.Error(), http.StatusForbidden)
+			return
+		}
+		if toolPolicy != nil {
+			input, _ := toolUse["input"].(map[string]interface{})
+			policyInput := PolicyInput{Tool: toolName, Arguments: input}
+			if tenant != nil {
+				policyInput.Tenant = tenant.ID
+			}
+			decision, err := toolPolicy.Evaluate(r.Context(), policyInput)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			switch decision.Effect {
+			case PolicyDeny:
+				tenant.record(auditRecord{Endpoint: "/invoke", CorrelationID: correlationID, Tools: auditedCall}, nil, fmt.Errorf("%w: %s", ErrToolCallDenied, decision.Reason))
+				http.Error(w, fmt.Sprintf("tool call denied by policy: %s", decision.Reason), http.StatusForbidden)
+				return
+			case PolicyTransform:
+				toolUse["input"] = decision.Arguments
+			}
+		}
 		
-		result, err := handler.HandleToolUse(ctx, toolUse)
+		// Retries carrying the same Idempotency-Key get the original result instead of re-running the tool
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+		var result map[string]interface{}
+		var replayed bool
+		if idempotencyKey == "" {
+			result, err = handler.HandleToolUse(ctx, toolUse)
+		} else {
+			result, replayed, err = idempotency.Do(tenant.scopedKey(idempotencyKey), request, func() (map[string]interface{}, error) {
+				return handler.HandleToolUse(withIdempotencyKey(ctx, idempotencyKey), toolUse)
+			})
+		}
+		tenant.record(auditRecord{Endpoint: "/invoke", CorrelationID: correlationID, Tools: auditedCall}, nil, err)
+		if errors.Is(err, ErrIdempotencyKeyReused) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(result)
+		encoded, err := responseCodec.Marshal(result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", responseCodec.ContentType())
+		if replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		w.Write(encoded)
 	})
 	
 	log.Println("Starting server on :8080")
 	log.Println("Endpoints:")
+	log.Println("  GET /healthz - Health check")
+	log.Println("  GET /readyz - Readiness, including warm-up")
 	log.Println("  GET /tools - List available tools")
-	log.Println("  POST /invoke - Execute tool")
+	log.Println("  GET /metrics - Per-server latency, response size and stream health stats")
+	log.Println("  POST /invoke - Execute tool, or answer inputText when the gateway agent is enabled")
+	if agentModel != "" {
+		log.Println("  GET / - Chat UI")
+		log.Println("  GET /ws - Stream agent output over WebSocket")
+		if addr := os.Getenv("GATEWAY_GRPC_ADDR"); addr != "" {
+			log.Printf("  gRPC %s on %s - Invoke, Stream, GetSession and ForkSession", gatewayv1.Gateway_ServiceDesc.ServiceName, addr)
+		}
+	}
+	if adminToken != "" {
+		log.Println("  GET /admin/servers, /admin/sessions, /admin/drain - Inspect the running gateway")
+		log.Println("  GET /admin/analytics/tools - Tool usage per day, as JSON or ?format=csv")
+		log.Println("  POST /admin/tools/refresh, /admin/servers/trip, /admin/servers/reset, /admin/drain - Control it")
+	}
 	
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	if err := http.ListenAndServe(":8080", drain.wrap(http.DefaultServeMux)); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
\ No newline at end of file
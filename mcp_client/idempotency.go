@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultIdempotencyTTL is how long a completed /invoke result is kept for replays
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// ErrIdempotencyKeyReused is returned when a key is sent again with a different request body
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+
+type idempotencyEntry struct {
+	fingerprint string
+	done        chan struct{}
+	result      map[string]interface{}
+	err         error
+	expires     time.Time
+}
+
+// idempotencyStore remembers the outcome of requests by idempotency key so a retried
+// request gets the original result instead of executing the tool again
+type idempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &idempotencyStore{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Do runs fn once per key. Concurrent and later calls with the same key wait for and
+// return the first call's result, with replayed set. Failed calls are not remembered,
+// so the client can retry them.
+func (s *idempotencyStore) Do(key string, request map[string]interface{}, fn func() (map[string]interface{}, error)) (result map[string]interface{}, replayed bool, err error) {
+	// The decoded request is fingerprinted in canonical form, so a retry that encodes the same
+	// request differently, e.g. with another codec or key order, is still recognized
+	fingerprint, err := canonicalHash(request)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fingerprint request: %w", err)
+	}
+
+	s.mu.Lock()
+	s.evictExpired()
+	if entry, ok := s.entries[key]; ok {
+		s.mu.Unlock()
+		if entry.fingerprint != fingerprint {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		<-entry.done
+		return entry.result, true, entry.err
+	}
+
+	entry := &idempotencyEntry{fingerprint: fingerprint, done: make(chan struct{})}
+	s.entries[key] = entry
+	s.mu.Unlock()
+
+	// Waiters are released even if fn panics; they get an error and the panic carries on
+	defer func() {
+		r := recover()
+		if r != nil {
+			entry.result, entry.err = nil, fmt.Errorf("request panicked: %v", r)
+		}
+		entry.expires = time.Now().Add(s.ttl)
+		close(entry.done)
+
+		if entry.err != nil {
+			s.mu.Lock()
+			delete(s.entries, key)
+			s.mu.Unlock()
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	entry.result, entry.err = fn()
+	return entry.result, false, entry.err
+}
+
+// evictExpired drops completed entries past their TTL; callers must hold s.mu
+func (s *idempotencyStore) evictExpired() {
+	now := time.Now()
+	for key, entry := range s.entries {
+		select {
+		case <-entry.done:
+			if now.After(entry.expires) {
+				delete(s.entries, key)
+			}
+		default:
+		}
+	}
+}
+
+type idempotencyKeyContextKey struct{}
+
+// withIdempotencyKey attaches the caller's idempotency key to the context
+func withIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// toolCallIdempotencyKey derives a deterministic key for one tool call from the caller's
+// idempotency key, so the MCP server sees the same key every time the request is retried
+func toolCallIdempotencyKey(ctx context.Context, toolName string, arguments map[string]interface{}) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	if key == "" {
+		return ""
+	}
+
+	args, _ := canonicalJSON(arguments)
+	return hashBytes([]byte(key + "\x00" + toolName + "\x00" + string(args)))
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
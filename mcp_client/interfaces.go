@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+//go:generate moq -out mocks.go . Agent
+
+// Agent is the public surface of InlineAgent. MCPCaller, the MCP client surface action
+// groups accept, is in pkg/mcpclient with its mock in pkg/mcpclient/mcptest; Agent's
+// methods take the agent's own types, so it stays with them.
+type Agent interface {
+	AddActionGroup(actionGroup ActionGroup) error
+	Invoke(inputText string) (*Result, error)
+	InvokeText(inputText string) (string, error)
+	InvokeSession(sessionID, inputText string) (*Result, error)
+	InvokeWithOptions(inputText string, opts InvokeOptions) (*Result, error)
+	InvokeContext(ctx context.Context, inputText string, opts InvokeOptions) (*Result, error)
+	ExportSession(sessionID string) ([]byte, error)
+	ImportSession(sessionID string, data []byte) error
+	ForkSession(sessionID string) (string, error)
+	Close(ctx context.Context) error
+}
+
+var (
+	_ MCPCaller = (*ReplicaSet)(nil)
+	_ MCPCaller = (*ShadowCaller)(nil)
+	_ Agent     = (*InlineAgent)(nil)
+)
+
+// callerName identifies an MCP caller in logs and errors
+func callerName(c MCPCaller) string {
+	if client, ok := c.(*MCPClient); ok {
+		return client.BaseURL()
+	}
+	if set, ok := c.(*ReplicaSet); ok {
+		return set.Name
+	}
+	if shadow, ok := c.(*ShadowCaller); ok {
+		return callerName(shadow.Primary)
+	}
+	return fmt.Sprintf("%T", c)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// defaultLargeResultBytes is the response size from which LargeResultTruncation applies
+const defaultLargeResultBytes = 1 << 20
+
+// LargeResultTruncation keeps the first MaxItems items of every array in large JSON tool
+// outputs, such as a listing of thousands of resources, before result processors and the
+// model see them. The MCP client truncates the output's text as it reads the response,
+// so neither the dropped items nor the whole text are ever built in memory. The arrays cut
+// short and their full lengths are listed under "_truncated", keyed by path, e.g.
+// {"_truncated": {"clusters": 12000, "clusters[].nodes": 340}}; an output that is an array
+// itself becomes {"items": [...], "_truncated": {"items": n}}.
+type LargeResultTruncation struct {
+	// MaxItems is how many items of each array are kept
+	MaxItems int
+	// MinBytes is the tools/call response size from which outputs are truncated; 0 uses 1 MiB
+	MinBytes int
+}
+
+// context returns ctx with the truncation attached for the MCP client to apply to a
+// tools/call made with it
+func (t *LargeResultTruncation) context(ctx context.Context) context.Context {
+	if t == nil {
+		return ctx
+	}
+	minBytes := t.MinBytes
+	if minBytes <= 0 {
+		minBytes = defaultLargeResultBytes
+	}
+	return mcpclient.WithResultTruncation(ctx, t.MaxItems, int64(minBytes))
+}
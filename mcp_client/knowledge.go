@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	agenttypes "github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+)
+
+// maxCitationExcerpt caps the excerpt returned with each citation
+const maxCitationExcerpt = 300
+
+// KnowledgeBaseConfig enables retrieval from a Bedrock knowledge base before each invocation
+type KnowledgeBaseConfig struct {
+	ID string
+	// NumberOfResults is how many passages to retrieve; 0 uses 5
+	NumberOfResults int
+	// MinScore drops passages scoring below it
+	MinScore float64
+}
+
+// RetrieveAPI is the part of the Bedrock agent runtime client used for retrieval
+type RetrieveAPI interface {
+	Retrieve(ctx context.Context, params *bedrockagentruntime.RetrieveInput, optFns ...func(*bedrockagentruntime.Options)) (*bedrockagentruntime.RetrieveOutput, error)
+}
+
+// Citation is a retrieved passage the answer refers to
+type Citation struct {
+	// Index is the [n] marker used in the answer text
+	Index           int     `json:"index"`
+	SourceURI       string  `json:"sourceUri"`
+	Excerpt         string  `json:"excerpt"`
+	Score           float64 `json:"score"`
+	KnowledgeBaseID string  `json:"knowledgeBaseId"`
+}
+
+// passage is one retrieved chunk offered to the model as a numbered source
+type passage struct {
+	citation Citation
+	text     string
+}
+
+// citationMarker matches [n] and [n, m] source references in an answer
+var citationMarker = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// retrieve queries every configured knowledge base and numbers the passages from 1
+func (a *InlineAgent) retrieve(ctx context.Context, query string) ([]passage, error) {
+	var passages []passage
+	for _, kb := range a.KnowledgeBases {
+		n := kb.NumberOfResults
+		if n <= 0 {
+			n = 5
+		}
+
+		out, err := a.retrieveClient.Retrieve(ctx, &bedrockagentruntime.RetrieveInput{
+			KnowledgeBaseId: aws.String(kb.ID),
+			RetrievalQuery:  &agenttypes.KnowledgeBaseQuery{Text: aws.String(query)},
+			RetrievalConfiguration: &agenttypes.KnowledgeBaseRetrievalConfiguration{
+				VectorSearchConfiguration: &agenttypes.KnowledgeBaseVectorSearchConfiguration{
+					NumberOfResults: aws.Int32(int32(n)),
+				},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve from knowledge base %s: %w", kb.ID, err)
+		}
+
+		for _, r := range out.RetrievalResults {
+			score := aws.ToFloat64(r.Score)
+			if score < kb.MinScore || r.Content == nil {
+				continue
+			}
+			text := aws.ToString(r.Content.Text)
+			passages = append(passages, passage{
+				citation: Citation{
+					Index:           len(passages) + 1,
+					SourceURI:       retrievalSourceURI(r.Location),
+					Excerpt:         truncateUTF8(strings.TrimSpace(text), maxCitationExcerpt),
+					Score:           score,
+					KnowledgeBaseID: kb.ID,
+				},
+				text: text,
+			})
+		}
+	}
+	return passages, nil
+}
+
+// retrievalSourceURI picks the URI of whichever location type the result has
+func retrievalSourceURI(loc *agenttypes.RetrievalResultLocation) string {
+	if loc == nil {
+		return ""
+	}
+	switch {
+	case loc.S3Location != nil:
+		return aws.ToString(loc.S3Location.Uri)
+	case loc.WebLocation != nil:
+		return aws.ToString(loc.WebLocation.Url)
+	case loc.ConfluenceLocation != nil:
+		return aws.ToString(loc.ConfluenceLocation.Url)
+	case loc.SharePointLocation != nil:
+		return aws.ToString(loc.SharePointLocation.Url)
+	case loc.SalesforceLocation != nil:
+		return aws.ToString(loc.SalesforceLocation.Url)
+	}
+	return ""
+}
+
+// sourcesPrompt lists the passages as numbered sources for the system prompt
+func sourcesPrompt(passages []passage) string {
+	var b strings.Builder
+	b.WriteString("Use the following sources when they are relevant. Cite each source you use with its number in square brackets, e.g. [1].\n")
+	for _, p := range passages {
+		fmt.Fprintf(&b, "\n[%d] %s\n%s\n", p.citation.Index, p.citation.SourceURI, strings.TrimSpace(p.text))
+	}
+	return b.String()
+}
+
+// citationsFromAnswer returns the passages the answer cites, in index order
+func citationsFromAnswer(answer string, passages []passage) []Citation {
+	cited := make(map[int]bool)
+	for _, match := range citationMarker.FindAllStringSubmatch(answer, -1) {
+		for _, part := range strings.Split(match[1], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+				cited[n] = true
+			}
+		}
+	}
+
+	var citations []Citation
+	for _, p := range passages {
+		if cited[p.citation.Index] {
+			citations = append(citations, p.citation)
+		}
+	}
+	return citations
+}
+
+// writeAgentAnswer writes an agent result as an /invoke response; citations are always
+// present so clients can render footnotes without checking for the key
+func writeAgentAnswer(w http.ResponseWriter, codec Codec, result *Result) {
+	encoded, err := codec.Marshal(agentAnswer(result))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.Write(encoded)
+}
+
+// agentInvokeOptions reads the options of an inputText request: sessionId, priority,
+// timeoutMs, which sets this invocation's deadline, e.g. to fit within the client's own,
+// and audio, voice input as [{"mimeType": "audio/wav", "data": "<base64>"}]
+func agentInvokeOptions(request map[string]interface{}) (InvokeOptions, error) {
+	sessionID, _ := request["sessionId"].(string)
+	priorityName, _ := request["priority"].(string)
+	priority, err := ParsePriority(priorityName)
+	if err != nil {
+		return InvokeOptions{}, err
+	}
+	opts := InvokeOptions{SessionID: sessionID, Priority: priority}
+	if timeoutMs, ok := jsonFloat(request["timeoutMs"]); ok && timeoutMs > 0 {
+		opts.Timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	audio, _ := request["audio"].([]interface{})
+	for _, item := range audio {
+		clip, _ := item.(map[string]interface{})
+		mimeType, _ := clip["mimeType"].(string)
+		data, _ := clip["data"].(string)
+		opts.Audio = append(opts.Audio, AudioContent{MimeType: mimeType, Data: data})
+	}
+	return opts, nil
+}
+
+// agentAnswer is the gateway's response to an answered inputText
+func agentAnswer(result *Result) map[string]interface{} {
+	citations := make([]interface{}, len(result.Citations))
+	for i, c := range result.Citations {
+		citations[i] = map[string]interface{}{
+			"index":           c.Index,
+			"sourceUri":       c.SourceURI,
+			"excerpt":         c.Excerpt,
+			"score":           c.Score,
+			"knowledgeBaseId": c.KnowledgeBaseID,
+		}
+	}
+
+	audio := make([]interface{}, len(result.Audio))
+	for i, clip := range result.Audio {
+		audio[i] = map[string]interface{}{
+			"mimeType": clip.MimeType,
+			"data":     clip.Data,
+			"tool":     clip.Tool,
+		}
+	}
+
+	return map[string]interface{}{
+		"answer":     result.Text,
+		"audio":      audio,
+		"citations":  citations,
+		"stopReason": string(result.StopReason),
+		"latencyMs":  result.LatencyMs,
+		"degraded":   result.Degraded,
+		"flags":      result.Flags,
+		"usage": map[string]interface{}{
+			"inputTokens":  result.Usage.InputTokens,
+			"outputTokens": result.Usage.OutputTokens,
+		},
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// InitMode controls when an MCP server is initialized
+type InitMode int
+
+const (
+	// InitEager initializes the server when it is registered
+	InitEager InitMode = iota
+	// InitLazy defers initialization until the server is first used
+	InitLazy
+	// InitBackground starts initialization right after registration without waiting for it
+	InitBackground
+)
+
+// ParseInitMode parses "eager", "lazy" or "background"; an empty string means eager
+func ParseInitMode(s string) (InitMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "eager":
+		return InitEager, nil
+	case "lazy":
+		return InitLazy, nil
+	case "background":
+		return InitBackground, nil
+	default:
+		return InitEager, fmt.Errorf("unknown init mode %q", s)
+	}
+}
+
+// lazyInit runs an initialization function once it succeeds. Failed attempts are
+// retried on the next call, so a slow server that comes up later is picked up.
+type lazyInit struct {
+	mu   sync.Mutex
+	done bool
+	err  error
+	fn   func(ctx context.Context) error
+}
+
+func newLazyInit(fn func(ctx context.Context) error) *lazyInit {
+	return &lazyInit{fn: fn}
+}
+
+// Do runs the initialization if it hasn't succeeded yet
+func (l *lazyInit) Do(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.done {
+		return nil
+	}
+
+	l.err = l.fn(ctx)
+	l.done = l.err == nil
+	return l.err
+}
+
+// Status reports whether initialization has completed and the last error, without blocking
+// behind an attempt that is in progress.
+func (l *lazyInit) Status() (ready bool, err error) {
+	if !l.mu.TryLock() {
+		return false, nil
+	}
+	defer l.mu.Unlock()
+	return l.done, l.err
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLoadTestPrompts are used for in-process runs when no prompts file is given
+var defaultLoadTestPrompts = []string{
+	"Convert 11am from NYC time to London time",
+	"What time is it in Tokyo right now?",
+	"If it is 9pm in Sydney, what time is it in Los Angeles?",
+}
+
+// LoadTestConfig controls a load test run
+type LoadTestConfig struct {
+	// Gateway is the base URL of a running gateway; empty runs the agent in-process
+	Gateway     string
+	Concurrency int
+	Requests    int
+	// Prompts are sent round-robin to the in-process agent
+	Prompts []string
+	// Payloads are POSTed round-robin to the gateway's /invoke endpoint
+	Payloads []json.RawMessage
+	// Codec encodes gateway payloads; nil sends JSON
+	Codec   Codec
+	Timeout time.Duration
+}
+
+// loadOutcome is the result of a single load test request
+type loadOutcome struct {
+	latency   time.Duration
+	throttled bool
+	// errKind is empty on success, otherwise a short category for the breakdown
+	errKind string
+}
+
+// LoadTestReport summarizes a load test run
+type LoadTestReport struct {
+	Requests     int            `json:"requests"`
+	Succeeded    int            `json:"succeeded"`
+	Throttled    int            `json:"throttled"`
+	ThrottleRate float64        `json:"throttleRate"`
+	Errors       map[string]int `json:"errors"`
+	P50          time.Duration  `json:"p50"`
+	P95          time.Duration  `json:"p95"`
+	P99          time.Duration  `json:"p99"`
+	Elapsed      time.Duration  `json:"elapsed"`
+	Throughput   float64        `json:"throughputPerSecond"`
+}
+
+// RunLoadTest fires cfg.Requests calls to target with cfg.Concurrency workers
+func RunLoadTest(ctx context.Context, cfg LoadTestConfig, target func(ctx context.Context, i int) loadOutcome) *LoadTestReport {
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+
+	outcomes := make([]loadOutcome, cfg.Requests)
+	jobs := make(chan int)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				reqCtx := ctx
+				var cancel context.CancelFunc
+				if cfg.Timeout > 0 {
+					reqCtx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+				}
+				outcomes[i] = target(reqCtx, i)
+				if cancel != nil {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < cfg.Requests; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			outcomes[i] = loadOutcome{errKind: "cancelled"}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return summarizeLoadTest(outcomes, time.Since(start))
+}
+
+func summarizeLoadTest(outcomes []loadOutcome, elapsed time.Duration) *LoadTestReport {
+	report := &LoadTestReport{
+		Requests: len(outcomes),
+		Errors:   make(map[string]int),
+		Elapsed:  elapsed,
+	}
+
+	var latencies []time.Duration
+	for _, o := range outcomes {
+		switch {
+		case o.throttled:
+			report.Throttled++
+		case o.errKind != "":
+			report.Errors[o.errKind]++
+		default:
+			report.Succeeded++
+			latencies = append(latencies, o.latency)
+		}
+	}
+
+	if report.Requests > 0 {
+		report.ThrottleRate = float64(report.Throttled) / float64(report.Requests)
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(report.Requests) / elapsed.Seconds()
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report.P50 = percentile(latencies, 0.50)
+	report.P95 = percentile(latencies, 0.95)
+	report.P99 = percentile(latencies, 0.99)
+
+	return report
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[percentileRank(len(sorted), p)]
+}
+
+// gatewayTarget POSTs the payloads round-robin to a running gateway's /invoke endpoint
+func gatewayTarget(baseURL string, payloads []json.RawMessage, codec Codec) (func(ctx context.Context, i int) loadOutcome, error) {
+	client := &http.Client{}
+	endpoint := strings.TrimRight(baseURL, "/") + "/invoke"
+	if codec == nil {
+		codec = jsonCodec{}
+	}
+
+	// Encode up front so the codec's cost isn't measured as gateway latency
+	encoded := make([][]byte, len(payloads))
+	for i, p := range payloads {
+		v, err := jsonCodec{}.Unmarshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("payload %d: %w", i, err)
+		}
+		if encoded[i], err = codec.Marshal(v); err != nil {
+			return nil, fmt.Errorf("payload %d: %w", i, err)
+		}
+	}
+
+	return func(ctx context.Context, i int) loadOutcome {
+		payload := encoded[i%len(encoded)]
+
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return loadOutcome{errKind: "request"}
+		}
+		req.Header.Set("Content-Type", codec.ContentType())
+		req.Header.Set("Accept", codec.ContentType())
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return loadOutcome{errKind: "timeout"}
+			}
+			return loadOutcome{errKind: "transport"}
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		latency := time.Since(start)
+		if err != nil {
+			return loadOutcome{errKind: "transport"}
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return loadOutcome{latency: latency, throttled: true}
+		case resp.StatusCode != http.StatusOK:
+			return loadOutcome{latency: latency, errKind: fmt.Sprintf("http_%d", resp.StatusCode)}
+		}
+
+		result, err := codec.Unmarshal(body)
+		if err != nil {
+			return loadOutcome{latency: latency, errKind: "invalid_response"}
+		}
+		if status, _ := result["status"].(string); status == "error" {
+			return loadOutcome{latency: latency, errKind: "mcp_tool_error"}
+		}
+
+		return loadOutcome{latency: latency}
+	}, nil
+}
+
+// agentTarget sends the prompts round-robin to an in-process agent
+func agentTarget(agent *InlineAgent, prompts []string) func(ctx context.Context, i int) loadOutcome {
+	return func(ctx context.Context, i int) loadOutcome {
+		prompt := prompts[i%len(prompts)]
+
+		start := time.Now()
+		result, err := agent.InvokeWithOptions(prompt, InvokeOptions{
+			SessionID: fmt.Sprintf("loadtest-%d", i),
+		})
+		latency := time.Since(start)
+		if err != nil {
+			if strings.Contains(err.Error(), "ThrottlingException") {
+				return loadOutcome{latency: latency, throttled: true}
+			}
+			return loadOutcome{latency: latency, errKind: "invoke"}
+		}
+
+		// Failed tool calls are reported per tool so MCP issues stand out from model errors
+		for _, call := range result.ToolCalls {
+			if call.Status == "error" {
+				return loadOutcome{latency: latency, errKind: "mcp_tool_error:" + call.Name}
+			}
+		}
+
+		return loadOutcome{latency: latency}
+	}
+}
+
+// readLoadTestFile reads one JSON value per non-empty line
+func readLoadTestFile(path string) ([]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var entries []json.RawMessage
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !json.Valid([]byte(line)) {
+			return nil, fmt.Errorf("%s:%d: invalid JSON", path, n+1)
+		}
+		entries = append(entries, json.RawMessage(line))
+	}
+	return entries, nil
+}
+
+// runLoadTestCommand implements the "loadtest" subcommand
+func runLoadTestCommand(agent *InlineAgent, args []string) {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	gateway := fs.String("gateway", "", "base URL of a running gateway; empty runs the agent in-process")
+	concurrency := fs.Int("concurrency", 4, "number of concurrent workers")
+	requests := fs.Int("requests", 20, "total number of requests")
+	timeout := fs.Duration("timeout", 60*time.Second, "per-request timeout")
+	input := fs.String("input", "", "JSONL file of /invoke payloads (gateway) or prompt strings (in-process)")
+	contentType := fs.String("codec", contentTypeJSON, "media type used for gateway payloads, e.g. "+contentTypeProtobuf)
+	fs.Parse(args)
+
+	codec, err := codecFor(*contentType)
+	if err != nil {
+		log.Fatalf("Invalid -codec: %v", err)
+	}
+
+	cfg := LoadTestConfig{
+		Gateway:     *gateway,
+		Concurrency: *concurrency,
+		Requests:    *requests,
+		Timeout:     *timeout,
+		Prompts:     defaultLoadTestPrompts,
+		Codec:       codec,
+	}
+
+	if *input != "" {
+		entries, err := readLoadTestFile(*input)
+		if err != nil {
+			log.Fatalf("Failed to load input: %v", err)
+		}
+		if len(entries) == 0 {
+			log.Fatalf("Input file %s is empty", *input)
+		}
+		if cfg.Gateway != "" {
+			cfg.Payloads = entries
+		} else {
+			cfg.Prompts = nil
+			for _, e := range entries {
+				var prompt string
+				if err := json.Unmarshal(e, &prompt); err != nil {
+					log.Fatalf("In-process input must be JSON strings: %v", err)
+				}
+				cfg.Prompts = append(cfg.Prompts, prompt)
+			}
+		}
+	}
+
+	var target func(ctx context.Context, i int) loadOutcome
+	if cfg.Gateway != "" {
+		if len(cfg.Payloads) == 0 {
+			log.Fatal("Gateway load tests need -input with /invoke payloads")
+		}
+		log.Printf("Load testing gateway %s: %d requests, concurrency %d", cfg.Gateway, cfg.Requests, cfg.Concurrency)
+		if target, err = gatewayTarget(cfg.Gateway, cfg.Payloads, cfg.Codec); err != nil {
+			log.Fatalf("Failed to encode payloads: %v", err)
+		}
+	} else {
+		log.Printf("Load testing in-process agent: %d requests, concurrency %d", cfg.Requests, cfg.Concurrency)
+		target = agentTarget(agent, cfg.Prompts)
+	}
+
+	report := RunLoadTest(context.Background(), cfg, target)
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	log.Printf("p50 %s, p95 %s, p99 %s, throttled %.1f%%",
+		report.P50, report.P95, report.P99, report.ThrottleRate*100)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "mcp-client/pkg/mcpclient"
+
+// The MCP client and protocol types live in pkg/mcpclient, shared with other programs;
+// these aliases keep the names the agent and gateway have always used
+type (
+	MCPClient        = mcpclient.Client
+	MCPCaller        = mcpclient.MCPCaller
+	Tool             = mcpclient.Tool
+	ToolCall         = mcpclient.ToolCall
+	ToolResult       = mcpclient.ToolResult
+	ContentBlock     = mcpclient.ContentBlock
+	EmbeddedResource = mcpclient.EmbeddedResource
+)
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+
+	"github.com/aws/smithy-go/document"
+)
+
+// jsonFloat returns a decoded JSON number as a float64, for comparisons; ok is false for
+// anything that isn't a number
+func jsonFloat(v interface{}) (f float64, ok bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		return f, err == nil
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// compareJSONNumbers compares two decoded JSON numbers exactly, so integers too large for a
+// float64 still compare correctly. ok is false unless both are numbers.
+func compareJSONNumbers(a, b interface{}) (cmp int, ok bool) {
+	x, okA := jsonBigFloat(a)
+	y, okB := jsonBigFloat(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	return x.Cmp(y), true
+}
+
+func jsonBigFloat(v interface{}) (*big.Float, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, _, err := big.ParseFloat(n.String(), 10, 256, big.ToNearestEven)
+		return f, err == nil
+	default:
+		f, ok := jsonFloat(v)
+		if !ok {
+			return nil, false
+		}
+		return big.NewFloat(f), true
+	}
+}
+
+// documentNumbers returns v with its json.Number values converted to document.Number, for
+// encoding into a Bedrock document; a document encoder writes a json.Number as a string
+func documentNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		return document.Number(v)
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			converted[k] = documentNumbers(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = documentNumbers(item)
+		}
+		return converted
+	}
+	return v
+}
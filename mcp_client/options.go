@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// Option configures an InlineAgent
+type Option func(*InlineAgent) error
+
+// WithModel sets the foundation model ID (required)
+func WithModel(modelID string) Option {
+	return func(a *InlineAgent) error {
+		a.FoundationModel = modelID
+		return nil
+	}
+}
+
+// WithInstruction sets the system prompt
+func WithInstruction(instruction string) Option {
+	return func(a *InlineAgent) error {
+		a.Instruction = instruction
+		return nil
+	}
+}
+
+// WithName sets the agent name
+func WithName(name string) Option {
+	return func(a *InlineAgent) error {
+		a.AgentName = name
+		return nil
+	}
+}
+
+// WithActionGroup adds an action group, as AddActionGroup does. The group's MCP clients are
+// initialized once every other option has been applied, so a failing option leaks none.
+func WithActionGroup(group ActionGroup) Option {
+	return func(a *InlineAgent) error {
+		a.pendingGroups = append(a.pendingGroups, group)
+		return nil
+	}
+}
+
+// WithInferenceConfig sets the default inference parameters; a model preset replaces them
+func WithInferenceConfig(inference *types.InferenceConfiguration) Option {
+	return func(a *InlineAgent) error {
+		a.InferenceConfig = inference
+		return nil
+	}
+}
+
+// WithStore replaces the default in-memory session store
+func WithStore(store SessionStore) Option {
+	return func(a *InlineAgent) error {
+		if store == nil {
+			return fmt.Errorf("session store must not be nil")
+		}
+		a.store = store
+		return nil
+	}
+}
+
+// WithHooks sets callbacks run around each invocation and tool call
+func WithHooks(hooks Hooks) Option {
+	return func(a *InlineAgent) error {
+		a.Hooks = hooks
+		return nil
+	}
+}
+
+// WithTraceSink sets the sink for structured trace events
+func WithTraceSink(sink TraceSink) Option {
+	return func(a *InlineAgent) error {
+		a.TraceSink = sink
+		return nil
+	}
+}
+
+// WithBedrockClient uses client instead of one built from the default AWS config,
+// e.g. a stub in tests
+func WithBedrockClient(client ConverseAPI) Option {
+	return func(a *InlineAgent) error {
+		a.bedrockClient = client
+		return nil
+	}
+}
+
+// WithKnowledgeBase retrieves up to numberOfResults passages from a Bedrock knowledge base
+// for each invocation and reports the ones the answer cites in Result.Citations
+func WithKnowledgeBase(id string, numberOfResults int) Option {
+	return func(a *InlineAgent) error {
+		if id == "" {
+			return fmt.Errorf("knowledge base ID must not be empty")
+		}
+		a.KnowledgeBases = append(a.KnowledgeBases, KnowledgeBaseConfig{ID: id, NumberOfResults: numberOfResults})
+		return nil
+	}
+}
+
+// WithRetrieveClient uses client for knowledge base retrieval, e.g. a stub in tests
+func WithRetrieveClient(client RetrieveAPI) Option {
+	return func(a *InlineAgent) error {
+		a.retrieveClient = client
+		return nil
+	}
+}
+
+// WithWorkspace saves tool outputs over inlineLimit bytes to store, per session, and gives
+// the model read_file and list_workspace tools to read them. An inlineLimit of 0 uses 16 KiB.
+func WithWorkspace(store WorkspaceStore, inlineLimit int) Option {
+	return func(a *InlineAgent) error {
+		if store == nil {
+			return fmt.Errorf("workspace store must not be nil")
+		}
+		a.Workspace = &Workspace{Store: store, InlineLimit: inlineLimit}
+		return nil
+	}
+}
+
+// WithAutoContinue continues answers cut off at max_tokens up to maxContinuations times,
+// stitching the pieces into one answer
+func WithAutoContinue(maxContinuations int) Option {
+	return func(a *InlineAgent) error {
+		if maxContinuations < 0 {
+			return fmt.Errorf("max continuations must not be negative")
+		}
+		a.MaxContinuations = maxContinuations
+		return nil
+	}
+}
+
+// WithToolPolicy checks every tool call against policy before it runs
+func WithToolPolicy(policy ToolPolicy) Option {
+	return func(a *InlineAgent) error {
+		a.ToolPolicy = policy
+		return nil
+	}
+}
+
+// WithScheduler runs at most maxConcurrent model calls at once, serving interactive
+// invocations before batch ones when calls have to wait
+func WithScheduler(maxConcurrent int) Option {
+	return func(a *InlineAgent) error {
+		if maxConcurrent < 1 {
+			return fmt.Errorf("max concurrent model calls must be at least 1")
+		}
+		a.Scheduler = NewScheduler(maxConcurrent)
+		return nil
+	}
+}
+
+// WithToolConfigLimit warns when the tool configuration is estimated at over maxTokens, or
+// fails the invocation when fail is set. A maxTokens of 0 uses 8000.
+func WithToolConfigLimit(maxTokens int, fail bool) Option {
+	return func(a *InlineAgent) error {
+		a.ToolConfigLimit = &ToolConfigLimit{MaxTokens: maxTokens, Fail: fail}
+		return nil
+	}
+}
+
+// WithContextLimit compacts conversations estimated to overflow the context window before
+// each model call. A maxTokens of 0 uses the model's window; a reserve of 0 keeps the
+// configured max tokens free for the answer.
+func WithContextLimit(maxTokens, reserve int) Option {
+	return func(a *InlineAgent) error {
+		if maxTokens < 0 || reserve < 0 {
+			return fmt.Errorf("context limit and reserve must not be negative")
+		}
+		a.ContextLimit = &ContextLimit{MaxTokens: maxTokens, ReserveTokens: reserve}
+		return nil
+	}
+}
+
+// WithTimeBudget gives every invocation a timeout, ending tool calls early enough to leave
+// modelReserve for the model call after them. A modelReserve of 0 uses 10s.
+func WithTimeBudget(timeout, modelReserve time.Duration) Option {
+	return func(a *InlineAgent) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invocation timeout must be positive")
+		}
+		if modelReserve < 0 || modelReserve >= timeout {
+			return fmt.Errorf("model reserve must be less than the invocation timeout")
+		}
+		a.TimeBudget = &TimeBudget{Timeout: timeout, ModelReserve: modelReserve}
+		return nil
+	}
+}
+
+// WithToolFailureFallback tells the model to answer without tools once every tool call has
+// failed in failedTurns turns in a row, and marks the result degraded
+func WithToolFailureFallback(failedTurns int) Option {
+	return func(a *InlineAgent) error {
+		if failedTurns < 1 {
+			return fmt.Errorf("failed turns must be at least 1")
+		}
+		a.ToolFailureLimit = failedTurns
+		return nil
+	}
+}
+
+// WithServerStats tracks each MCP server's latency and result size in tracker, which may be
+// shared with other agents or the gateway, and prefers servers meeting its SLO
+func WithServerStats(tracker *ServerStatsTracker) Option {
+	return func(a *InlineAgent) error {
+		if tracker != nil && tracker.Events == nil {
+			tracker.Events = &a.events
+		}
+		a.ServerStats = tracker
+		return nil
+	}
+}
+
+// WithInjectionScreen checks tool outputs with InjectionRules, taking action on matches
+func WithInjectionScreen(action InjectionAction) Option {
+	return func(a *InlineAgent) error {
+		switch action {
+		case InjectionFlag, InjectionStrip, InjectionBlock:
+		default:
+			return fmt.Errorf("unknown injection action %q", action)
+		}
+		a.InjectionScreen = &InjectionScreen{Rules: InjectionRules(action)}
+		return nil
+	}
+}
+
+// WithToolComposition runs follow-up tool calls that tool results request, up to maxSteps
+// per model tool call (0 uses 5). allowed maps each tool to the tools it may request; nil
+// allows any.
+func WithToolComposition(maxSteps int, allowed map[string][]string) Option {
+	return func(a *InlineAgent) error {
+		if maxSteps < 0 {
+			return fmt.Errorf("max follow-up steps must not be negative")
+		}
+		a.Composition = &ToolComposition{MaxSteps: maxSteps, Allowed: allowed}
+		return nil
+	}
+}
+
+// WithConverseHedging sends a second model request, to fallbackModel or the same model when
+// empty, when an interactive invocation's model call is slower than percentile of recent
+// calls (0 uses 0.95), hedging at most 10% of calls
+func WithConverseHedging(percentile float64, fallbackModel string) Option {
+	return func(a *InlineAgent) error {
+		if percentile < 0 || percentile >= 1 {
+			return fmt.Errorf("hedge percentile must be between 0 and 1")
+		}
+		a.Hedging = &ConverseHedging{Percentile: percentile, FallbackModel: fallbackModel}
+		return nil
+	}
+}
+
+// WithToolPrefetch runs the rules' read-only tools alongside the first model call when the
+// user's message matches them
+func WithToolPrefetch(rules ...PrefetchRule) Option {
+	return func(a *InlineAgent) error {
+		prefetch, err := NewToolPrefetch(rules)
+		if err != nil {
+			return err
+		}
+		if a.Prefetch != nil {
+			prefetch.Embed = a.Prefetch.Embed
+		}
+		a.Prefetch = prefetch
+		return nil
+	}
+}
+
+// WithPrefetchEmbedder matches prefetch rules with examples by embedding similarity, using embed
+func WithPrefetchEmbedder(embed Embedder) Option {
+	return func(a *InlineAgent) error {
+		if a.Prefetch == nil {
+			a.Prefetch = &ToolPrefetch{}
+		}
+		a.Prefetch.Embed = embed
+		return nil
+	}
+}
+
+// WithSessionVariables keeps key-value state per session for tools and the instruction,
+// holding up to maxVariables values of up to maxValueBytes each; 0 uses the defaults
+func WithSessionVariables(maxVariables, maxValueBytes int) Option {
+	return func(a *InlineAgent) error {
+		if maxVariables < 0 || maxValueBytes < 0 {
+			return fmt.Errorf("session variable limits must not be negative")
+		}
+		a.Variables = &SessionVariables{MaxVariables: maxVariables, MaxValueBytes: maxValueBytes}
+		return nil
+	}
+}
+
+// WithResponsePolicy sets the language, tone, maximum length and format of answers
+func WithResponsePolicy(policy ResponsePolicy) Option {
+	return func(a *InlineAgent) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		a.ResponsePolicy = &policy
+		return nil
+	}
+}
+
+// WithAudioTranscriber accepts audio input, transcribed by transcriber for the model
+func WithAudioTranscriber(transcriber AudioTranscriber) Option {
+	return func(a *InlineAgent) error {
+		a.Transcriber = transcriber
+		return nil
+	}
+}
+
+// WithToolTranslation translates the outputs of tools, or of all tools when none are given,
+// into language with the agent's model when they are written in another script
+func WithToolTranslation(language string, tools ...string) Option {
+	return func(a *InlineAgent) error {
+		if language == "" {
+			return fmt.Errorf("a translation language is required")
+		}
+		a.Translation = &ToolTranslation{Language: language, Tools: tools}
+		return nil
+	}
+}
+
+// WithArgumentRepair checks tool arguments against the tool's schema and fixes up to
+// maxFixes simple mistakes per call; 0 allows 5
+func WithArgumentRepair(maxFixes int) Option {
+	return func(a *InlineAgent) error {
+		if maxFixes < 0 {
+			return fmt.Errorf("argument repair max fixes must not be negative")
+		}
+		a.ArgumentRepair = &ArgumentRepair{MaxFixes: maxFixes}
+		return nil
+	}
+}
+
+// WithSessionTTL expires sessions idle for longer than idle, or older than absolute however
+// busy, deleting them in the background; a zero duration doesn't expire by that measure
+func WithSessionTTL(idle, absolute time.Duration) Option {
+	return func(a *InlineAgent) error {
+		if idle < 0 || absolute < 0 {
+			return fmt.Errorf("session TTLs must not be negative")
+		}
+		if idle == 0 && absolute == 0 {
+			return nil
+		}
+		a.SessionTTL = &SessionTTL{Idle: idle, Absolute: absolute}
+		return nil
+	}
+}
+
+// WithToolAnalytics aggregates the agent's tool calls into analytics
+func WithToolAnalytics(analytics *ToolAnalytics) Option {
+	return func(a *InlineAgent) error {
+		a.Analytics = analytics
+		return nil
+	}
+}
+
+// WithLargeResultTruncation keeps the first maxItems items of every array in JSON tool
+// outputs whose tools/call response is 1 MiB or more, with a count of the rest
+func WithLargeResultTruncation(maxItems int) Option {
+	return func(a *InlineAgent) error {
+		if maxItems <= 0 {
+			return fmt.Errorf("large result max items must be positive")
+		}
+		a.LargeResults = &LargeResultTruncation{MaxItems: maxItems}
+		return nil
+	}
+}
+
+// NewInlineAgent creates a new inline agent. WithModel is required.
+func NewInlineAgent(opts ...Option) (*InlineAgent, error) {
+	agent := &InlineAgent{
+		ActionGroups: []ActionGroup{},
+		store:        NewMemorySessionStore(),
+	}
+	agent.startup.events = &agent.events
+
+	for _, opt := range opts {
+		if err := opt(agent); err != nil {
+			return nil, err
+		}
+	}
+
+	if agent.FoundationModel == "" {
+		return nil, fmt.Errorf("a foundation model is required, use WithModel")
+	}
+
+	needRetrieve := len(agent.KnowledgeBases) > 0 && agent.retrieveClient == nil
+	if agent.bedrockClient == nil || needRetrieve {
+		cfg, err := config.LoadDefaultConfig(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		if agent.bedrockClient == nil {
+			agent.bedrockClient = bedrockruntime.NewFromConfig(cfg)
+		}
+		if needRetrieve {
+			agent.retrieveClient = bedrockagentruntime.NewFromConfig(cfg)
+		}
+	}
+
+	// Action groups are added last, as nothing else can fail once their clients are initialized.
+	// If one fails, the groups already added are closed with it.
+	for _, group := range agent.pendingGroups {
+		if err := agent.AddActionGroup(group); err != nil {
+			group.Close(context.Background())
+			agent.Close(context.Background())
+			return nil, err
+		}
+	}
+	agent.pendingGroups = nil
+
+	if agent.SessionTTL != nil {
+		agent.startSessionReaper()
+	}
+	return agent, nil
+}
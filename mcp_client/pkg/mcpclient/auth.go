@@ -0,0 +1,96 @@
+package mcpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrAuthFailed is matched by errors for requests an MCP server rejected with HTTP 401 or 403
+var ErrAuthFailed = errors.New("mcp server rejected the credentials")
+
+// Error classes returned by ErrorClass, so stats and dashboards can tell
+// broken credentials apart from server outages
+const (
+	ErrorClassAuth     = "auth"
+	ErrorClassTimeout  = "timeout"
+	ErrorClassCanceled = "canceled"
+	ErrorClassClosed   = "closed"
+	ErrorClassServer   = "server"
+)
+
+// AuthError is an HTTP 401 or 403 response from an MCP server
+type AuthError struct {
+	Server string
+	Status int
+	// Challenge is the WWW-Authenticate header, if the server sent one
+	Challenge string
+	Body      string
+}
+
+func (e *AuthError) Error() string {
+	msg := fmt.Sprintf("HTTP error: %d - %s", e.Status, e.Body)
+	if e.Challenge != "" {
+		msg += " (WWW-Authenticate: " + e.Challenge + ")"
+	}
+	return msg
+}
+
+func (e *AuthError) Unwrap() error {
+	return ErrAuthFailed
+}
+
+// authError returns an AuthError for a 401 or 403 response, or nil for any other status
+func authError(server string, resp *http.Response, body string) error {
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return nil
+	}
+	return &AuthError{
+		Server:    server,
+		Status:    resp.StatusCode,
+		Challenge: resp.Header.Get("WWW-Authenticate"),
+		Body:      body,
+	}
+}
+
+// ErrorClass sorts an MCP request error into auth, timeout, canceled, closed or server
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrAuthFailed):
+		return ErrorClassAuth
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, errConnectTimeout):
+		return ErrorClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, ErrClientClosed):
+		return ErrorClassClosed
+	default:
+		return ErrorClassServer
+	}
+}
+
+// AuthRefreshMiddleware calls refresh when a server rejects a request's credentials, e.g.
+// to fetch a new token or re-run a login, and retries the request once. A rejected request
+// was never executed, so tools/call is retried too. It must come before the HeaderMiddleware
+// that sets the credentials, so the retry picks up the refreshed ones.
+func AuthRefreshMiddleware(refresh func(ctx context.Context, authErr *AuthError) error) Middleware {
+	return func(next Sender) Sender {
+		return SenderFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			resp, err := next.Send(ctx, req)
+			var authErr *AuthError
+			if !errors.As(err, &authErr) {
+				return resp, err
+			}
+
+			logf(ctx, "MCP server %s rejected %s with HTTP %d, refreshing credentials", authErr.Server, req.Method, authErr.Status)
+			retried(ctx, req.Method, 1, err)
+			if refreshErr := refresh(ctx, authErr); refreshErr != nil {
+				return nil, fmt.Errorf("failed to refresh credentials: %w (after %w)", refreshErr, err)
+			}
+			return next.Send(ctx, req)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package mcpclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// defaultMaxInMemoryResponse is how much of a response is buffered in memory before spilling to disk
+	defaultMaxInMemoryResponse = 8 << 20
+	// defaultMaxResponseSize is the hard cap after which a response is rejected
+	defaultMaxResponseSize = 256 << 20
+	// defaultSpilledMaxItems is how many items of each array are kept from a spilled response
+	defaultSpilledMaxItems = 1000
+)
+
+// ErrResponseTooLarge is returned when a response exceeds the hard size limit
+var ErrResponseTooLarge = errors.New("response too large")
+
+// ResponseBody holds a response body that may be partly spilled to a temporary file.
+// Close must be called to remove the file.
+type ResponseBody struct {
+	mem  []byte
+	file *os.File
+	size int64
+}
+
+// readResponseBody reads r, keeping the first maxInMemory bytes in memory and streaming any
+// overflow to a temporary file. Reading stops with ErrResponseTooLarge once maxTotal is exceeded.
+func readResponseBody(r io.Reader, maxInMemory, maxTotal int64) (*ResponseBody, error) {
+	mem, err := io.ReadAll(io.LimitReader(r, maxInMemory))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	body := &ResponseBody{mem: mem, size: int64(len(mem))}
+	if body.size < maxInMemory {
+		return body, nil
+	}
+
+	file, err := os.CreateTemp("", "mcp-response-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	body.file = file
+
+	// Copy one byte past the limit so an oversized response can be detected
+	n, err := io.Copy(file, io.LimitReader(r, maxTotal-body.size+1))
+	body.size += n
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to spill response to disk: %w", err)
+	}
+	if body.size > maxTotal {
+		body.Close()
+		return nil, fmt.Errorf("%w: exceeded %d bytes", ErrResponseTooLarge, maxTotal)
+	}
+
+	return body, nil
+}
+
+// Size returns the total size of the body in bytes
+func (b *ResponseBody) Size() int64 {
+	return b.size
+}
+
+// Spilled reports whether part of the body was written to disk
+func (b *ResponseBody) Spilled() bool {
+	return b.file != nil
+}
+
+// Path returns the spill file path, or "" if the body is held entirely in memory
+func (b *ResponseBody) Path() string {
+	if b.file == nil {
+		return ""
+	}
+	return b.file.Name()
+}
+
+// Prefix returns up to n bytes from the start of the body
+func (b *ResponseBody) Prefix(n int) []byte {
+	if n > len(b.mem) {
+		n = len(b.mem)
+	}
+	return b.mem[:n]
+}
+
+// Reader returns a reader over the whole body, starting from the beginning
+func (b *ResponseBody) Reader() io.Reader {
+	if b.file == nil {
+		return bytes.NewReader(b.mem)
+	}
+	spilled := io.NewSectionReader(b.file, 0, b.size-int64(len(b.mem)))
+	return io.MultiReader(bytes.NewReader(b.mem), spilled)
+}
+
+// Close removes the spill file, if any. It is safe to call more than once.
+func (b *ResponseBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	name := b.file.Name()
+	b.file.Close()
+	b.file = nil
+	return os.Remove(name)
+}
+
+// limitedReader fails with ErrResponseTooLarge once more than max bytes are read, for
+// responses parsed as they arrive instead of through readResponseBody
+type limitedReader struct {
+	r         io.Reader
+	max       int64
+	remaining int64
+}
+
+func newLimitedReader(r io.Reader, max int64) *limitedReader {
+	return &limitedReader{r: r, max: max, remaining: max}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, fmt.Errorf("%w: exceeded %d bytes", ErrResponseTooLarge, l.max)
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,17 @@
+package mcpclient
+
+import "context"
+
+//go:generate moq -out mcptest/mocks.go -pkg mcptest . MCPCaller
+
+// MCPCaller is the MCP client surface an agent depends on. Client implements it, and so do
+// replica sets and shadow callers built on it, so orchestration can be tested without a
+// server using mcptest.MCPCallerMock.
+type MCPCaller interface {
+	Initialize(ctx context.Context) error
+	ListTools(ctx context.Context) ([]Tool, error)
+	CallTool(ctx context.Context, toolCall ToolCall) (*ToolResult, error)
+	Close(ctx context.Context) error
+}
+
+var _ MCPCaller = (*Client)(nil)
@@ -0,0 +1,59 @@
+package mcpclient
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrUnsupportedCapability is returned for requests the server didn't declare support for
+var ErrUnsupportedCapability = errors.New("server does not support this capability")
+
+// ListCapability is a server feature that may notify the client when its list changes
+type ListCapability struct {
+	ListChanged bool `json:"listChanged"`
+}
+
+// ResourcesCapability is the server's resources feature
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe"`
+	ListChanged bool `json:"listChanged"`
+}
+
+// ServerCapabilities are the features a server declared in its initialize result; a nil
+// field means the feature is not offered
+type ServerCapabilities struct {
+	Tools        *ListCapability        `json:"tools,omitempty"`
+	Prompts      *ListCapability        `json:"prompts,omitempty"`
+	Resources    *ResourcesCapability   `json:"resources,omitempty"`
+	Logging      map[string]interface{} `json:"logging,omitempty"`
+	Completions  map[string]interface{} `json:"completions,omitempty"`
+	Experimental map[string]interface{} `json:"experimental,omitempty"`
+}
+
+// ToolsListChanged reports whether the server sends tools/list_changed notifications. When
+// it doesn't, the client must poll to notice tool changes.
+func (c ServerCapabilities) ToolsListChanged() bool {
+	return c.Tools != nil && c.Tools.ListChanged
+}
+
+// ResourceSubscribe reports whether the server accepts resources/subscribe
+func (c ServerCapabilities) ResourceSubscribe() bool {
+	return c.Resources != nil && c.Resources.Subscribe
+}
+
+// parseServerCapabilities reads the capabilities of an initialize result. ok is false when
+// the result declares none, as before initialization.
+func parseServerCapabilities(initResult map[string]interface{}) (capabilities ServerCapabilities, ok bool) {
+	raw, ok := initResult["capabilities"].(map[string]interface{})
+	if !ok {
+		return ServerCapabilities{}, false
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return ServerCapabilities{}, false
+	}
+	if err := json.Unmarshal(data, &capabilities); err != nil {
+		return ServerCapabilities{}, false
+	}
+	return capabilities, true
+}
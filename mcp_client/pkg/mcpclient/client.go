@@ -0,0 +1,527 @@
+// Package mcpclient is a client for MCP servers over the streamable HTTP transport: the
+// JSON-RPC protocol types, a Client with middleware, handshake timeouts and response
+// limits, and the Server-Sent Events parsing it uses to read streamed responses.
+package mcpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client is an MCP client for one server over the streamable HTTP transport. It is safe
+// for concurrent use once configured.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	// requests assigns request IDs and matches responses to them
+	requests *requestTable
+	// sseHealth counts dropped, failed and stalled response streams
+	sseHealth *sseStreamHealth
+
+	// maxInMemoryResponse and maxResponseSize bound how response bodies are buffered
+	maxInMemoryResponse int64
+	maxResponseSize     int64
+	// spilledMaxItems is how many items of each array the JSON content text of a spilled
+	// tools/call response keeps; 0 keeps all
+	spilledMaxItems int
+
+	// compressRequests gzips large request bodies; only enable it for servers that accept Content-Encoding: gzip
+	compressRequests bool
+
+	// closeCtx is cancelled by Close to abort in-flight requests
+	closeCtx context.Context
+	closeFn  context.CancelFunc
+
+	// onNotification receives server notifications that arrive on response streams
+	onNotification func(method string)
+
+	// handshakeTimeouts bound each stage of Initialize and the first tools/list
+	handshakeTimeouts HandshakeTimeouts
+
+	// middleware wraps every request; the first entry is the outermost
+	middleware []Middleware
+
+	// serverRequests answers requests the server sends on response streams, such as ping
+	serverRequests *ServerRequests
+
+	// initResult is the server's initialize result: protocol version, capabilities and server info
+	initResult map[string]interface{}
+}
+
+// New creates a client for the MCP server at baseURL
+func New(baseURL string) *Client {
+	closeCtx, closeFn := context.WithCancel(context.Background())
+	return &Client{
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		requests:            newRequestTable(baseURL),
+		sseHealth:           newSSEStreamHealth(baseURL),
+		maxInMemoryResponse: defaultMaxInMemoryResponse,
+		maxResponseSize:     defaultMaxResponseSize,
+		spilledMaxItems:     defaultSpilledMaxItems,
+		closeCtx:            closeCtx,
+		closeFn:             closeFn,
+		handshakeTimeouts:   DefaultHandshakeTimeouts(),
+		serverRequests:      NewServerRequests(),
+	}
+}
+
+// Close aborts in-flight requests and releases idle connections. Later calls fail with
+// ErrClientClosed. It is safe to call more than once.
+func (c *Client) Close(ctx context.Context) error {
+	c.closeFn()
+	closeHTTPClient(c.httpClient)
+	return nil
+}
+
+// SetResponseLimits sets how many bytes of a response are kept in memory before spilling
+// to a temporary file, and the hard cap after which the call fails
+func (c *Client) SetResponseLimits(maxInMemory, maxTotal int64) {
+	c.maxInMemoryResponse = maxInMemory
+	c.maxResponseSize = maxTotal
+}
+
+// SetSpilledResponseMaxItems sets how many items of each array are kept in the JSON content
+// text of a tools/call response too large to hold in memory. The text is truncated as it is
+// read back from disk, before it is decoded into a string; responses to other methods,
+// such as tools/list, are always decoded whole. 0 decodes spilled responses whole.
+func (c *Client) SetSpilledResponseMaxItems(maxItems int) {
+	c.spilledMaxItems = maxItems
+}
+
+// SetTransport replaces the HTTP transport, e.g. to wrap the one Transport returns
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.httpClient.Transport = rt
+}
+
+// Transport returns the HTTP transport; nil means http.DefaultTransport
+func (c *Client) Transport() http.RoundTripper {
+	return c.httpClient.Transport
+}
+
+// BaseURL returns the URL of the client's MCP server
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// SetProxy routes the client through a proxy URL, or "direct" to bypass HTTPS_PROXY for
+// this server. It replaces the transport, so call it before SetTransport wrappers.
+func (c *Client) SetProxy(proxy string) error {
+	transport, err := newProxyTransport(proxy)
+	if err != nil {
+		return err
+	}
+	c.httpClient.Transport = transport
+	return nil
+}
+
+// Use appends middleware to the client's request chain. Middleware added first runs first.
+func (c *Client) Use(middleware ...Middleware) {
+	c.middleware = append(c.middleware, middleware...)
+}
+
+// sender builds the request chain ending in send
+func (c *Client) sender() Sender {
+	return chainSenders(SenderFunc(c.send), c.middleware)
+}
+
+// SetHandshakeTimeouts sets the per-stage timeouts used by Initialize
+func (c *Client) SetHandshakeTimeouts(timeouts HandshakeTimeouts) {
+	c.handshakeTimeouts = timeouts
+}
+
+// HandshakeTimeouts returns the per-stage handshake timeouts
+func (c *Client) HandshakeTimeouts() HandshakeTimeouts {
+	return c.handshakeTimeouts
+}
+
+// SetNotificationHandler registers fn for server notifications such as
+// notifications/tools/list_changed
+func (c *Client) SetNotificationHandler(fn func(method string)) {
+	c.onNotification = fn
+}
+
+// HandleServerRequest registers handler for requests the server sends with method, e.g.
+// roots/list or sampling/createMessage. Register handlers before Initialize so the matching
+// capabilities are declared.
+func (c *Client) HandleServerRequest(method string, handler ServerRequestHandler) {
+	c.serverRequests.Handle(method, handler)
+}
+
+// answerServerRequest returns the callback that answers server requests found on the
+// response stream of a request made with ctx
+func (c *Client) answerServerRequest(ctx context.Context) func(payload string) {
+	return func(payload string) {
+		answerServerRequest(ctx, c.httpClient, c.baseURL, c.serverRequests, payload)
+	}
+}
+
+// streamHandlers routes the other messages on the response stream of request id
+func (c *Client) streamHandlers(ctx context.Context, id int) sseHandlers {
+	return sseHandlers{
+		notify:  c.onNotification,
+		request: c.answerServerRequest(ctx),
+		accept: func(payload string) bool {
+			// A notification (ID 0) has no response of its own, so any answer is taken
+			responseID, ok := responseID(payload)
+			return id == 0 || (ok && responseID == id)
+		},
+		stray: c.requests.deliver,
+	}
+}
+
+// CorrelationStats reports pending requests and responses that arrived late, on the wrong
+// stream or for unknown requests
+func (c *Client) CorrelationStats() map[string]interface{} {
+	return c.requests.Stats()
+}
+
+// SSEStats reports how the server's response streams have behaved
+func (c *Client) SSEStats() SSEStreamStats {
+	return c.sseHealth.Stats()
+}
+
+// SetRequestCompression enables gzip compression of large request bodies
+func (c *Client) SetRequestCompression(enabled bool) {
+	c.compressRequests = enabled
+}
+
+// sendRequest sends an MCP request through the client's middleware and returns the response
+func (c *Client) sendRequest(ctx context.Context, method string, params interface{}) (*Response, error) {
+	if c.closeCtx.Err() != nil {
+		return nil, ErrClientClosed
+	}
+	ctx, cancel := withCloseSignal(ctx, c.closeCtx)
+	defer cancel()
+
+	id := c.requests.begin(ctx, method)
+	defer c.requests.finish(id)
+
+	req := &Request{
+		JSONRPC: "2.0",
+		ID:      id,
+		Method:  method,
+		Params:  params,
+	}
+
+	return c.sender().Send(ctx, req)
+}
+
+// notify sends a notification through the client's middleware. Servers usually answer
+// with 202 Accepted and no body; a JSON-RPC error in the answer fails the call.
+func (c *Client) notify(ctx context.Context, method string, params interface{}) error {
+	if c.closeCtx.Err() != nil {
+		return ErrClientClosed
+	}
+	ctx, cancel := withCloseSignal(ctx, c.closeCtx)
+	defer cancel()
+
+	_, err := c.sender().Send(ctx, &Request{JSONRPC: "2.0", Method: method, Params: params})
+	return err
+}
+
+// send is the innermost Sender: it posts req over HTTP and decodes the response
+func (c *Client) send(ctx context.Context, req *Request) (*Response, error) {
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	httpReq.Header.Set("Accept-Encoding", "gzip")
+	if id := CorrelationID(ctx); id != "" {
+		httpReq.Header.Set(CorrelationIDHeader, id)
+	}
+	for k, v := range requestHeaders(ctx) {
+		httpReq.Header[k] = v
+	}
+
+	if c.compressRequests {
+		if err := compressRequest(httpReq, reqBody); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := decodeResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// A server may send requests of its own ahead of the response and wait for the answers,
+	// so an event stream is parsed as it arrives instead of being buffered first
+	respBody, live := liveEventStream(resp.Header.Get("Content-Type"), respBody)
+	if live && resp.StatusCode == http.StatusOK {
+		jsonData, err := c.sseHealth.read(newLimitedReader(respBody, c.maxResponseSize), int(c.maxResponseSize), c.streamHandlers(ctx, req.ID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSE response: %w", err)
+		}
+		return c.decodeStreamed(ctx, req, c.requests.resolve(req.ID, jsonData))
+	}
+
+	body, err := readResponseBody(respBody, c.maxInMemoryResponse, c.maxResponseSize)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if err := authError(c.baseURL, resp, string(body.Prefix(4096))); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body.Prefix(4096)))
+	}
+
+	if body.Spilled() {
+		log.Printf("Response from %s is %d bytes, spilled to %s", c.baseURL, body.Size(), body.Path())
+	}
+	// Handle empty responses
+	if body.Size() == 0 {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result:  nil,
+		}, nil
+	}
+
+	// Servers may answer JSON or SSE per request, so dispatch on Content-Type and sniff the body when it's missing or wrong
+	if IsEventStream(resp.Header.Get("Content-Type"), body.Prefix(512)) {
+		jsonData, err := c.sseHealth.read(body.Reader(), int(c.maxResponseSize), c.streamHandlers(ctx, req.ID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSE response: %w", err)
+		}
+		return c.decodeStreamed(ctx, req, c.requests.resolve(req.ID, jsonData))
+	}
+
+	// A large tool result is read back with its content text truncated, so it is never decoded whole
+	var respReader io.Reader = body.Reader()
+	if maxItems := c.resultMaxItems(ctx, req.Method, body.Size()); maxItems > 0 {
+		if truncated := c.truncateResult(body.Reader(), maxItems); truncated != "" {
+			respReader = strings.NewReader(truncated)
+		}
+	}
+
+	var mcpResp Response
+	dec := json.NewDecoder(respReader)
+	dec.UseNumber()
+	if err := dec.Decode(&mcpResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if mcpResp.ID != req.ID {
+		log.Printf("Response from %s has ID %d, expected %d", c.baseURL, mcpResp.ID, req.ID)
+	}
+
+	if mcpResp.Error != nil {
+		return nil, fmt.Errorf("MCP error %d: %s", mcpResp.Error.Code, mcpResp.Error.Message)
+	}
+
+	return &mcpResp, nil
+}
+
+// decodeStreamed decodes the response to req read from an event stream, truncating its
+// content text first when it is large enough to truncate
+func (c *Client) decodeStreamed(ctx context.Context, req *Request, jsonData string) (*Response, error) {
+	if maxItems := c.resultMaxItems(ctx, req.Method, int64(len(jsonData))); maxItems > 0 {
+		if truncated := c.truncateResult(strings.NewReader(jsonData), maxItems); truncated != "" {
+			jsonData = truncated
+		}
+	}
+	return decodeSSEResponse(req.ID, jsonData)
+}
+
+// resultMaxItems returns how many items of each array to keep in the content text of a
+// response of size bytes to method, or 0 to decode it whole: the truncation attached to
+// ctx, if the response is large enough, or else the spilled response limit. Only
+// tools/call results are truncated; a tools/list result cut short would silently drop tools.
+func (c *Client) resultMaxItems(ctx context.Context, method string, size int64) int {
+	if method != "tools/call" {
+		return 0
+	}
+	if t, ok := ctx.Value(resultTruncationKey{}).(resultTruncation); ok && t.maxItems > 0 && size >= t.minBytes {
+		return t.maxItems
+	}
+	if size < c.maxInMemoryResponse {
+		return 0
+	}
+	return c.spilledMaxItems
+}
+
+// truncateResult truncates the content text of the tool result read from r, returning ""
+// when no array was cut or the text can't be truncated, in which case the response is
+// decoded whole
+func (c *Client) truncateResult(r io.Reader, maxItems int) string {
+	truncated, counts, err := TruncateToolResult(r, maxItems)
+	if err != nil {
+		log.Printf("Decoding tool result from %s whole: %v", c.baseURL, err)
+		return ""
+	}
+	if len(counts) > 0 {
+		log.Printf("Truncated arrays in tool result from %s to %d items, to %d bytes: %v", c.baseURL, maxItems, len(truncated), counts)
+	}
+	return truncated
+}
+
+// Initialize initializes the MCP connection
+func (c *Client) Initialize(ctx context.Context) error {
+	params := map[string]interface{}{
+		"protocolVersion": "2024-11-05",
+		"capabilities":    c.capabilities(),
+		"clientInfo": map[string]interface{}{
+			"name":    "bedrock-mcp-client",
+			"version": "1.0.0",
+		},
+	}
+
+	t := c.handshakeTimeouts
+	initCtx, connected, cancel := withConnectTimeout(ctx, t.Connect, t.Initialize)
+	resp, err := c.sendRequest(initCtx, "initialize", params)
+	cause := context.Cause(initCtx)
+	cancel()
+	if err != nil {
+		if !connected() {
+			if errors.Is(cause, errConnectTimeout) {
+				err = fmt.Errorf("no connection after %s: %w", t.Connect, err)
+			}
+			return &StageError{Server: c.baseURL, Stage: StageConnect, Err: err}
+		}
+		return &StageError{Server: c.baseURL, Stage: StageInitialize, Err: err}
+	}
+
+	log.Printf("Initialize response: %+v", resp.Result)
+	c.initResult, _ = resp.Result.(map[string]interface{})
+
+	// Some servers answer the notification with a JSON-RPC error, e.g. for an unsupported
+	// protocol version
+	notifyCtx, cancelNotify := context.WithTimeout(ctx, t.Initialized)
+	defer cancelNotify()
+	if err := c.notify(notifyCtx, "notifications/initialized", map[string]interface{}{}); err != nil {
+		return &StageError{Server: c.baseURL, Stage: StageInitialized, Err: err}
+	}
+
+	return nil
+}
+
+// capabilities are the client capabilities declared in initialize
+func (c *Client) capabilities() map[string]interface{} {
+	capabilities := c.serverRequests.capabilities()
+	capabilities["tools"] = map[string]interface{}{
+		"listChanged": true,
+	}
+	return capabilities
+}
+
+// InitializeResult returns the server's initialize result, or nil before Initialize succeeds
+func (c *Client) InitializeResult() map[string]interface{} {
+	return c.initResult
+}
+
+// Capabilities returns the capabilities the server declared in initialize; ok is false
+// before Initialize succeeds or when it declared none
+func (c *Client) Capabilities() (ServerCapabilities, bool) {
+	return parseServerCapabilities(c.initResult)
+}
+
+// SubscribeResource asks the server to notify the client when the resource at uri changes.
+// It fails with ErrUnsupportedCapability unless the server declared resource subscriptions.
+func (c *Client) SubscribeResource(ctx context.Context, uri string) error {
+	if capabilities, _ := c.Capabilities(); !capabilities.ResourceSubscribe() {
+		return fmt.Errorf("cannot subscribe to %s on %s: %w", uri, c.baseURL, ErrUnsupportedCapability)
+	}
+	_, err := c.sendRequest(ctx, "resources/subscribe", map[string]interface{}{"uri": uri})
+	return err
+}
+
+// HasCapability reports whether the server declared capability, e.g. "tools", in its
+// initialize result. It is true before Initialize, or when the server declared none at all.
+func (c *Client) HasCapability(capability string) bool {
+	capabilities, ok := c.initResult["capabilities"].(map[string]interface{})
+	if !ok {
+		return true
+	}
+	_, ok = capabilities[capability]
+	return ok
+}
+
+// ListTools retrieves available tools from the MCP server. A server without the tools
+// capability, e.g. one serving only resources, has none and isn't asked.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	if !c.HasCapability("tools") {
+		return nil, nil
+	}
+
+	resp, err := c.sendRequest(ctx, "tools/list", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resultMap, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+
+	toolsInterface, ok := resultMap["tools"]
+	if !ok {
+		return nil, fmt.Errorf("no tools found in response")
+	}
+
+	toolsBytes, err := json.Marshal(toolsInterface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tools: %w", err)
+	}
+
+	var tools []Tool
+	if err := json.Unmarshal(toolsBytes, &tools); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tools: %w", err)
+	}
+
+	return tools, nil
+}
+
+// CallTool executes a tool with the given arguments
+func (c *Client) CallTool(ctx context.Context, toolCall ToolCall) (*ToolResult, error) {
+	params := map[string]interface{}{
+		"name":      toolCall.Name,
+		"arguments": toolCall.Arguments,
+	}
+	if meta := toolCallMeta(ctx, toolCall.Meta); len(meta) > 0 {
+		params["_meta"] = meta
+	}
+
+	resp, err := c.sendRequest(ctx, "tools/call", params)
+	if err != nil {
+		return nil, err
+	}
+
+	resultBytes, err := json.Marshal(resp.Result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	var result ToolResult
+	if err := UnmarshalJSONNumbers(resultBytes, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return &result, nil
+}
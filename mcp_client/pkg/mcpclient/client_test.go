@@ -0,0 +1,236 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// handshakeServer answers initialize and passes notifications/initialized to notified,
+// recording each notification's headers
+type handshakeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	notified []http.Header
+}
+
+func newHandshakeServer(t *testing.T, notified func(w http.ResponseWriter, r *http.Request, attempt int)) *handshakeServer {
+	s := &handshakeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Method != "notifications/initialized" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(Response{JSONRPC: "2.0", ID: req.ID, Result: map[string]interface{}{"protocolVersion": "2025-03-26"}})
+			return
+		}
+		s.mu.Lock()
+		s.notified = append(s.notified, r.Header.Clone())
+		attempt := len(s.notified)
+		s.mu.Unlock()
+		notified(w, r, attempt)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestInitializedNotificationAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		// status answers the notification's attempt, counting from 1
+		status      func(attempt int) int
+		wantRefresh int
+		wantClass   string
+	}{
+		{"accepted", func(int) int { return http.StatusAccepted }, 0, ""},
+		{"refreshed after 401", func(attempt int) int {
+			if attempt == 1 {
+				return http.StatusUnauthorized
+			}
+			return http.StatusAccepted
+		}, 1, ""},
+		{"refreshed after 403", func(attempt int) int {
+			if attempt == 1 {
+				return http.StatusForbidden
+			}
+			return http.StatusOK
+		}, 1, ""},
+		{"still rejected after refresh", func(int) int { return http.StatusUnauthorized }, 1, ErrorClassAuth},
+		{"server error", func(int) int { return http.StatusInternalServerError }, 0, ErrorClassServer},
+		{"not found", func(int) int { return http.StatusNotFound }, 0, ErrorClassServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newHandshakeServer(t, func(w http.ResponseWriter, r *http.Request, attempt int) {
+				w.WriteHeader(tt.status(attempt))
+			})
+			client := New(server.URL)
+			defer client.Close(context.Background())
+
+			var refreshed int
+			client.Use(AuthRefreshMiddleware(func(ctx context.Context, authErr *AuthError) error {
+				refreshed++
+				return nil
+			}))
+
+			err := client.Initialize(context.Background())
+			if refreshed != tt.wantRefresh {
+				t.Errorf("refreshed %d times, want %d", refreshed, tt.wantRefresh)
+			}
+			if tt.wantClass == "" {
+				if err != nil {
+					t.Fatalf("Initialize failed: %v", err)
+				}
+				return
+			}
+
+			var stageErr *StageError
+			if !errors.As(err, &stageErr) || stageErr.Stage != StageInitialized {
+				t.Fatalf("err = %v, want a StageError for %s", err, StageInitialized)
+			}
+			if class := ErrorClass(err); class != tt.wantClass {
+				t.Errorf("ErrorClass(%v) = %q, want %q", err, class, tt.wantClass)
+			}
+		})
+	}
+}
+
+func TestInitializedNotificationError(t *testing.T) {
+	server := newHandshakeServer(t, func(w http.ResponseWriter, r *http.Request, attempt int) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{JSONRPC: "2.0", Error: &Error{Code: -32602, Message: "unsupported protocol version"}})
+	})
+	client := New(server.URL)
+	defer client.Close(context.Background())
+
+	var stageErr *StageError
+	if err := client.Initialize(context.Background()); !errors.As(err, &stageErr) || stageErr.Stage != StageInitialized {
+		t.Fatalf("err = %v, want a StageError for %s", err, StageInitialized)
+	}
+}
+
+func TestInitializedNotificationCorrelationID(t *testing.T) {
+	server := newHandshakeServer(t, func(w http.ResponseWriter, r *http.Request, attempt int) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	client := New(server.URL)
+	defer client.Close(context.Background())
+
+	ctx := WithCorrelationID(context.Background(), "inv-123")
+	if err := client.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if len(server.notified) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(server.notified))
+	}
+	if got := server.notified[0].Get(CorrelationIDHeader); got != "inv-123" {
+		t.Errorf("%s = %q, want %q", CorrelationIDHeader, got, "inv-123")
+	}
+}
+
+func TestSpilledResponseTruncated(t *testing.T) {
+	items := make([]int, 5000)
+	text, _ := json.Marshal(map[string]interface{}{"items": items})
+	tools := make([]Tool, 5000)
+	for i := range tools {
+		tools[i] = Tool{Name: fmt.Sprintf("tool_%d", i)}
+	}
+
+	for _, contentType := range []string{"application/json", "text/event-stream"} {
+		t.Run(contentType, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req Request
+				json.NewDecoder(r.Body).Decode(&req)
+				var result interface{}
+				switch req.Method {
+				case "tools/call":
+					result = ToolResult{Content: []ContentBlock{{Type: "text", Text: string(text)}}}
+				case "tools/list":
+					result = map[string]interface{}{"tools": tools}
+				}
+				response, _ := json.Marshal(Response{JSONRPC: "2.0", ID: req.ID, Result: result})
+				w.Header().Set("Content-Type", contentType)
+				if contentType == "text/event-stream" {
+					fmt.Fprintf(w, "data: %s\n\n", response)
+					return
+				}
+				w.Write(response)
+			}))
+			defer server.Close()
+
+			client := New(server.URL)
+			defer client.Close(context.Background())
+			// Keep little enough in memory that the responses spill
+			client.SetResponseLimits(1024, 1<<20)
+			client.SetSpilledResponseMaxItems(10)
+
+			result, err := client.CallTool(context.Background(), ToolCall{Name: "list_items"})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			var got struct {
+				Items     []int          `json:"items"`
+				Truncated map[string]int `json:"_truncated"`
+			}
+			if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+				t.Fatalf("content text is not JSON: %v", err)
+			}
+			if len(got.Items) != 10 || got.Truncated["items"] != 5000 {
+				t.Errorf("got %d items and %v truncated, want 10 of 5000", len(got.Items), got.Truncated)
+			}
+
+			// A tools/list result is never cut short
+			listed, err := client.ListTools(context.Background())
+			if err != nil {
+				t.Fatalf("ListTools failed: %v", err)
+			}
+			if len(listed) != len(tools) {
+				t.Errorf("got %d tools, want %d", len(listed), len(tools))
+			}
+		})
+	}
+}
+
+func TestResultTruncationContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{JSONRPC: "2.0", ID: req.ID, Result: ToolResult{
+			Content: []ContentBlock{{Type: "text", Text: `[1,2,3,4,5]`}},
+		}})
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	defer client.Close(context.Background())
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"no truncation", context.Background(), `[1,2,3,4,5]`},
+		{"large enough", WithResultTruncation(context.Background(), 2, 10), `{"items":[1,2],"_truncated":{"items":5}}`},
+		{"too small", WithResultTruncation(context.Background(), 2, 1<<20), `[1,2,3,4,5]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := client.CallTool(tt.ctx, ToolCall{Name: "list_items"})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			if got := result.Content[0].Text; got != tt.want {
+				t.Errorf("text = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
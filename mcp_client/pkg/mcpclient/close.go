@@ -0,0 +1,26 @@
+package mcpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrClientClosed is returned by Client calls made after Close
+var ErrClientClosed = errors.New("mcp client is closed")
+
+// withCloseSignal derives a request context that is also cancelled when done is, so Close
+// aborts in-flight requests and their response streams
+func withCloseSignal(ctx, done context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(done, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// closeHTTPClient drops idle keep-alive connections held by client's transport
+func closeHTTPClient(client *http.Client) {
+	client.CloseIdleConnections()
+}
@@ -0,0 +1,54 @@
+package mcpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// minCompressSize is the smallest request body worth gzipping
+const minCompressSize = 1024
+
+// compressRequest replaces the request body with its gzipped form and sets
+// Content-Encoding, unless the body is too small to benefit
+func compressRequest(req *http.Request, body []byte) error {
+	if len(body) < minCompressSize {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return fmt.Errorf("failed to compress request: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress request: %w", err)
+	}
+
+	compressed := buf.Bytes()
+	req.Body = io.NopCloser(bytes.NewReader(compressed))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	req.ContentLength = int64(len(compressed))
+	req.Header.Set("Content-Encoding", "gzip")
+	return nil
+}
+
+// decodeResponseBody returns the response body with any gzip content encoding removed.
+// Go's transport only decompresses transparently when it added Accept-Encoding itself,
+// so this is needed whenever we ask for gzip explicitly.
+func decodeResponseBody(resp *http.Response) (io.Reader, error) {
+	if resp.Uncompressed || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp.Body, nil
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress response: %w", err)
+	}
+	return zr, nil
+}
@@ -0,0 +1,194 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultPendingTimeout is how long a request without a context deadline stays pending
+	defaultPendingTimeout = 5 * time.Minute
+	// finishedRetention is how long finished request IDs are remembered, so a response that
+	// turns up afterwards is reported as late rather than unknown
+	finishedRetention = 10 * time.Minute
+)
+
+// pendingRequest is a request waiting for its response
+type pendingRequest struct {
+	method   string
+	deadline time.Time
+	// rerouted receives the request's response when it arrives on another request's stream
+	rerouted chan string
+}
+
+// requestTable hands out JSON-RPC request IDs and tracks the requests awaiting responses,
+// so responses are matched to requests by ID rather than by the stream they arrive on.
+// Responses for a request still pending elsewhere are passed on to it; responses for
+// finished or unknown requests are logged and counted.
+type requestTable struct {
+	server string
+
+	mu       sync.Mutex
+	lastID   int
+	pending  map[int]*pendingRequest
+	finished map[int]time.Time
+
+	rerouted, late, orphaned, timedOut int64
+}
+
+func newRequestTable(server string) *requestTable {
+	return &requestTable{
+		server:   server,
+		pending:  map[int]*pendingRequest{},
+		finished: map[int]time.Time{},
+	}
+}
+
+// begin assigns the next ID to a request and marks it pending until ctx's deadline
+func (t *requestTable) begin(ctx context.Context, method string) int {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultPendingTimeout)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep()
+	t.lastID++
+	t.pending[t.lastID] = &pendingRequest{method: method, deadline: deadline, rerouted: make(chan string, 1)}
+	return t.lastID
+}
+
+// finish ends a request, whether or not it got a response
+func (t *requestTable) finish(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pending[id]; ok {
+		delete(t.pending, id)
+		t.finished[id] = time.Now()
+	}
+}
+
+// sweep counts and drops requests past their deadline, and forgets old finished IDs; it
+// must be called with mu held
+func (t *requestTable) sweep() {
+	now := time.Now()
+	for id, req := range t.pending {
+		if now.After(req.deadline) {
+			log.Printf("Request %d (%s) to %s timed out without a response", id, req.method, t.server)
+			delete(t.pending, id)
+			t.finished[id] = now
+			t.timedOut++
+		}
+	}
+	for id, at := range t.finished {
+		if now.Sub(at) > finishedRetention {
+			delete(t.finished, id)
+		}
+	}
+}
+
+// deliver handles a response that arrived on another request's stream
+func (t *requestTable) deliver(payload string) {
+	id, ok := responseID(payload)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !ok {
+		t.orphaned++
+		log.Printf("Response from %s has no usable ID: %s", t.server, truncateUTF8(payload, 256))
+		return
+	}
+	if req, ok := t.pending[id]; ok {
+		select {
+		case req.rerouted <- payload:
+			t.rerouted++
+		default:
+			log.Printf("Duplicate response for request %d (%s) from %s", id, req.method, t.server)
+		}
+		return
+	}
+	if _, ok := t.finished[id]; ok {
+		t.late++
+		log.Printf("Late response for finished request %d from %s", id, t.server)
+		return
+	}
+	t.orphaned++
+	log.Printf("Orphaned response for unknown request %d from %s", id, t.server)
+}
+
+// reroutedResponse returns a response for id that arrived on another stream, if any
+func (t *requestTable) reroutedResponse(id int) (string, bool) {
+	t.mu.Lock()
+	req, ok := t.pending[id]
+	t.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	select {
+	case payload := <-req.rerouted:
+		return payload, true
+	default:
+		return "", false
+	}
+}
+
+// resolve returns the response to request id: jsonData, read from the request's own stream,
+// unless it isn't that response and the response turned up on another stream instead
+func (t *requestTable) resolve(id int, jsonData string) string {
+	if responseID, ok := responseID(jsonData); ok && responseID == id {
+		return jsonData
+	}
+	if payload, ok := t.reroutedResponse(id); ok {
+		return payload
+	}
+	return jsonData
+}
+
+// Stats reports pending requests and counts of responses that didn't arrive where expected
+func (t *requestTable) Stats() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return map[string]interface{}{
+		"pending":  len(t.pending),
+		"rerouted": t.rerouted,
+		"late":     t.late,
+		"orphaned": t.orphaned,
+		"timedOut": t.timedOut,
+	}
+}
+
+// responseID returns the ID of a JSON-RPC response; IDs this client sends are integers,
+// but some servers echo them back as strings
+func responseID(payload string) (int, bool) {
+	var msg struct {
+		ID interface{} `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		return 0, false
+	}
+	switch id := msg.ID.(type) {
+	case float64:
+		return int(id), id == float64(int(id))
+	case string:
+		n, err := strconv.Atoi(id)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
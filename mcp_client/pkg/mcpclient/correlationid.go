@@ -0,0 +1,34 @@
+package mcpclient
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// CorrelationIDHeader carries the correlation ID attached to a request's context on the
+// MCP requests made with it
+const CorrelationIDHeader = "X-Correlation-ID"
+
+type correlationIDKey struct{}
+
+// WithCorrelationID attaches a correlation ID to ctx, e.g. an invocation's
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID attached to ctx, or "" when there is none
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// logf logs like log.Printf, prefixed with the correlation ID of ctx when there is one, so
+// one grep finds every line of a request
+func logf(ctx context.Context, format string, args ...interface{}) {
+	if id := CorrelationID(ctx); id != "" {
+		log.Printf("[%s] %s", id, fmt.Sprintf(format, args...))
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,81 @@
+package mcpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// StartupStage is one step of the MCP handshake
+type StartupStage string
+
+const (
+	StageConnect     StartupStage = "connect"
+	StageInitialize  StartupStage = "initialize"
+	StageInitialized StartupStage = "initialized_notification"
+	StageListTools   StartupStage = "tools/list"
+)
+
+// errConnectTimeout is the cause when no connection was established within the connect timeout
+var errConnectTimeout = errors.New("connect timeout")
+
+// HandshakeTimeouts bounds each handshake stage separately, so a slow tools/list isn't
+// reported as a connection problem
+type HandshakeTimeouts struct {
+	Connect     time.Duration
+	Initialize  time.Duration
+	Initialized time.Duration
+	ListTools   time.Duration
+}
+
+// DefaultHandshakeTimeouts are used by clients that haven't set their own
+func DefaultHandshakeTimeouts() HandshakeTimeouts {
+	return HandshakeTimeouts{
+		Connect:     5 * time.Second,
+		Initialize:  10 * time.Second,
+		Initialized: 5 * time.Second,
+		ListTools:   15 * time.Second,
+	}
+}
+
+// StageError reports the server and handshake stage that failed
+type StageError struct {
+	Server string
+	Stage  StartupStage
+	Err    error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("MCP server %s failed at %s: %v", e.Server, e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// withConnectTimeout bounds a request by timeout, and fails it early with errConnectTimeout
+// when no connection has been established after connectTimeout. connected reports whether a
+// connection was obtained, to tell connect failures from slow responses.
+func withConnectTimeout(ctx context.Context, connectTimeout, timeout time.Duration) (reqCtx context.Context, connected func() bool, cancel context.CancelFunc) {
+	var gotConn atomic.Bool
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { gotConn.Store(true) },
+	})
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	ctx, cancelCause := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(connectTimeout, func() {
+		if !gotConn.Load() {
+			cancelCause(errConnectTimeout)
+		}
+	})
+
+	return ctx, gotConn.Load, func() {
+		timer.Stop()
+		cancelCause(nil)
+		cancelTimeout()
+	}
+}
@@ -0,0 +1,526 @@
+package mcpclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TruncatedKey is the field TruncateJSON adds listing the arrays it cut short
+const TruncatedKey = "_truncated"
+
+// TruncateJSON copies the JSON array or object in r with every array cut to maxItems items,
+// returning the full lengths of the arrays cut short by path, e.g. "clusters[].nodes". The
+// document is read as a token stream, so dropped items are never built in memory. The
+// lengths are added to the copy under TruncatedKey, merged into the object already there
+// if the document has one; an array document becomes {"items": [...], "_truncated":
+// {"items": n}}. It returns "" when no array was cut, and an error when anything but
+// whitespace follows the document.
+func TruncateJSON(r io.Reader, maxItems int) (string, map[string]int, error) {
+	out, counts, err := truncateJSON(r, maxItems)
+	if err != nil || len(counts) == 0 {
+		return "", nil, err
+	}
+	return string(out), counts, nil
+}
+
+// truncateJSON is TruncateJSON, returning the copy even when no array was cut
+func truncateJSON(r io.Reader, maxItems int) ([]byte, map[string]int, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	tr := &jsonTruncator{dec: dec, maxItems: maxItems, counts: make(map[string]int)}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, fmt.Errorf("output is not JSON: %w", err)
+	}
+	switch tok {
+	case json.Delim('['):
+		tr.out.WriteString(`{"items":`)
+		if err := tr.value("items", tok); err != nil {
+			return nil, nil, err
+		}
+		tr.out.WriteString("}")
+	case json.Delim('{'):
+		if err := tr.value("", tok); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("output is not a JSON array or object")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, fmt.Errorf("output has data after its JSON value")
+	}
+	if len(tr.counts) == 0 {
+		return tr.out.Bytes(), tr.counts, nil
+	}
+
+	// Add the truncated lengths as the root object's last field
+	out := tr.out.Bytes()
+	out = out[:len(out)-1]
+	if len(out) > 1 {
+		out = append(out, ',')
+	}
+	merged := tr.existing
+	if merged == nil {
+		merged = make(map[string]interface{}, len(tr.counts))
+	}
+	for path, n := range tr.counts {
+		merged[path] = n
+	}
+	counts, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	out = append(out, `"`+TruncatedKey+`":`...)
+	out = append(out, counts...)
+	out = append(out, '}')
+	return out, tr.counts, nil
+}
+
+// jsonTruncator re-encodes a token stream, dropping array items past maxItems
+type jsonTruncator struct {
+	dec      *json.Decoder
+	out      bytes.Buffer
+	maxItems int
+	counts   map[string]int
+	// existing is the document's own TruncatedKey object, which counts are merged into
+	existing map[string]interface{}
+}
+
+// value writes the value starting with tok, found at path
+func (t *jsonTruncator) value(path string, tok json.Token) error {
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		data, err := json.Marshal(tok)
+		if err != nil {
+			return err
+		}
+		t.out.Write(data)
+		return nil
+	}
+
+	switch delim {
+	case '{':
+		t.out.WriteByte('{')
+		for first := true; t.dec.More(); {
+			keyTok, err := t.dec.Token()
+			if err != nil {
+				return fmt.Errorf("output is not JSON: %w", err)
+			}
+			key, _ := keyTok.(string)
+			// The root object's own TruncatedKey is written back, merged, at the end
+			if path == "" && key == TruncatedKey {
+				if err := t.dec.Decode(&t.existing); err != nil {
+					return fmt.Errorf("output's %s field is not an object: %w", TruncatedKey, err)
+				}
+				continue
+			}
+			if !first {
+				t.out.WriteByte(',')
+			}
+			first = false
+			data, _ := json.Marshal(key)
+			t.out.Write(data)
+			t.out.WriteByte(':')
+
+			next, err := t.dec.Token()
+			if err != nil {
+				return fmt.Errorf("output is not JSON: %w", err)
+			}
+			if err := t.value(jsonPath(path, key), next); err != nil {
+				return err
+			}
+		}
+		t.out.WriteByte('}')
+	case '[':
+		t.out.WriteByte('[')
+		n := 0
+		for ; t.dec.More(); n++ {
+			next, err := t.dec.Token()
+			if err != nil {
+				return fmt.Errorf("output is not JSON: %w", err)
+			}
+			if n >= t.maxItems {
+				if err := t.skip(next); err != nil {
+					return err
+				}
+				continue
+			}
+			if n > 0 {
+				t.out.WriteByte(',')
+			}
+			if err := t.value(path+"[]", next); err != nil {
+				return err
+			}
+		}
+		t.out.WriteByte(']')
+		if n > t.maxItems {
+			t.counts[path] = max(t.counts[path], n)
+		}
+	}
+
+	// Consume the closing delimiter
+	if _, err := t.dec.Token(); err != nil {
+		return fmt.Errorf("output is not JSON: %w", err)
+	}
+	return nil
+}
+
+// skip reads past the value starting with tok without keeping it
+func (t *jsonTruncator) skip(tok json.Token) error {
+	delim, ok := tok.(json.Delim)
+	if !ok || (delim != '{' && delim != '[') {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		tok, err := t.dec.Token()
+		if err != nil {
+			return fmt.Errorf("output is not JSON: %w", err)
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// jsonPath returns the path of key in the object at parent
+func jsonPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// toolResultTextPath is the path of the content text TruncateToolResult truncates
+const toolResultTextPath = "result.content[].text"
+
+// TruncateToolResult copies the tools/call response in r with the arrays of each text
+// content block holding a JSON array or object cut to maxItems items, as TruncateJSON cuts
+// them. A block's text is unescaped and truncated as it is read, so it is never held in
+// memory whole; the rest of the response is copied as it is. It returns the full lengths
+// of the arrays cut short, and "" when no array was cut. Text that starts like JSON but
+// isn't is an error, as it has been consumed by then, and so is a response that isn't JSON.
+func TruncateToolResult(r io.Reader, maxItems int) (string, map[string]int, error) {
+	s := &resultScanner{in: bufio.NewReader(r), maxItems: maxItems, counts: make(map[string]int)}
+	if err := s.value(""); err != nil {
+		return "", nil, err
+	}
+	if _, err := s.next(); err != io.EOF {
+		return "", nil, fmt.Errorf("response has data after its JSON value")
+	}
+	if len(s.counts) == 0 {
+		return "", nil, nil
+	}
+	return s.out.String(), s.counts, nil
+}
+
+// resultScanner copies a JSON-RPC response byte by byte, handing content text to truncateJSON
+type resultScanner struct {
+	in       *bufio.Reader
+	out      strings.Builder
+	maxItems int
+	counts   map[string]int
+}
+
+// next reads the next byte that isn't whitespace
+func (s *resultScanner) next() (byte, error) {
+	for {
+		b, err := s.in.ReadByte()
+		if err != nil || (b != ' ' && b != '\t' && b != '\n' && b != '\r') {
+			return b, err
+		}
+	}
+}
+
+// value copies the value at path
+func (s *resultScanner) value(path string) error {
+	b, err := s.next()
+	if err != nil {
+		return notJSON(err)
+	}
+	switch {
+	case b == '{':
+		return s.object(path)
+	case b == '[':
+		return s.array(path)
+	case b == '"' && path == toolResultTextPath:
+		return s.text()
+	case b == '"':
+		s.out.WriteByte(b)
+		return s.copyString()
+	default:
+		s.out.WriteByte(b)
+		return s.copyLiteral()
+	}
+}
+
+// object copies an object whose opening brace has been read
+func (s *resultScanner) object(path string) error {
+	s.out.WriteByte('{')
+	b, err := s.next()
+	if err != nil {
+		return notJSON(err)
+	}
+	if b == '}' {
+		s.out.WriteByte(b)
+		return nil
+	}
+	for {
+		if b != '"' {
+			return fmt.Errorf("response is not JSON: expected an object key, found %q", b)
+		}
+		start := s.out.Len()
+		s.out.WriteByte(b)
+		if err := s.copyString(); err != nil {
+			return err
+		}
+		var key string
+		if err := json.Unmarshal([]byte(s.out.String()[start:]), &key); err != nil {
+			return notJSON(err)
+		}
+		if b, err = s.next(); err != nil || b != ':' {
+			return fmt.Errorf("response is not JSON: expected ':' after object key %q", key)
+		}
+		s.out.WriteByte(b)
+		if err := s.value(jsonPath(path, key)); err != nil {
+			return err
+		}
+
+		if b, err = s.next(); err != nil {
+			return notJSON(err)
+		}
+		s.out.WriteByte(b)
+		switch b {
+		case '}':
+			return nil
+		case ',':
+		default:
+			return fmt.Errorf("response is not JSON: unexpected %q in object", b)
+		}
+		if b, err = s.next(); err != nil {
+			return notJSON(err)
+		}
+	}
+}
+
+// array copies an array whose opening bracket has been read
+func (s *resultScanner) array(path string) error {
+	s.out.WriteByte('[')
+	if b, err := s.next(); err != nil {
+		return notJSON(err)
+	} else if b == ']' {
+		s.out.WriteByte(b)
+		return nil
+	}
+	if err := s.in.UnreadByte(); err != nil {
+		return err
+	}
+	for {
+		if err := s.value(path + "[]"); err != nil {
+			return err
+		}
+		b, err := s.next()
+		if err != nil {
+			return notJSON(err)
+		}
+		s.out.WriteByte(b)
+		switch b {
+		case ']':
+			return nil
+		case ',':
+		default:
+			return fmt.Errorf("response is not JSON: unexpected %q in array", b)
+		}
+	}
+}
+
+// copyString copies the rest of a string whose opening quote has been copied
+func (s *resultScanner) copyString() error {
+	for escaped := false; ; {
+		b, err := s.in.ReadByte()
+		if err != nil {
+			return notJSON(err)
+		}
+		s.out.WriteByte(b)
+		switch {
+		case escaped:
+			escaped = false
+		case b == '\\':
+			escaped = true
+		case b == '"':
+			return nil
+		}
+	}
+}
+
+// copyLiteral copies the rest of a number, true, false or null
+func (s *resultScanner) copyLiteral() error {
+	for {
+		b, err := s.in.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.ContainsRune("0123456789+-.eEtrufalsn", rune(b)) {
+			return s.in.UnreadByte()
+		}
+		s.out.WriteByte(b)
+	}
+}
+
+// text copies content text whose opening quote has been read, truncating it when it holds
+// a JSON array or object
+func (s *resultScanner) text() error {
+	// Look past leading whitespace, escaped or not, for the start of a document
+	for i := 0; ; {
+		peeked, _ := s.in.Peek(i + 2)
+		switch {
+		case len(peeked) > i && peeked[i] == ' ':
+			i++
+		case len(peeked) > i+1 && peeked[i] == '\\' && strings.IndexByte("nrt", peeked[i+1]) >= 0:
+			i += 2
+		case len(peeked) > i && (peeked[i] == '[' || peeked[i] == '{'):
+			return s.truncateText()
+		default:
+			s.out.WriteByte('"')
+			return s.copyString()
+		}
+	}
+}
+
+// truncateText truncates the JSON document in content text as it is unescaped
+func (s *resultScanner) truncateText() error {
+	text, counts, err := truncateJSON(&jsonStringReader{in: s.in}, s.maxItems)
+	if err != nil {
+		return fmt.Errorf("failed to truncate content text: %w", err)
+	}
+	for path, n := range counts {
+		s.counts[path] = max(s.counts[path], n)
+	}
+	data, err := json.Marshal(string(text))
+	if err != nil {
+		return err
+	}
+	s.out.Write(data)
+	return nil
+}
+
+// notJSON wraps a read error from a response that ended or broke off mid-value
+func notJSON(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("response is not JSON: %w", err)
+}
+
+// jsonStringReader reads the unescaped contents of a JSON string whose opening quote has
+// been read, returning io.EOF at its closing quote
+type jsonStringReader struct {
+	in   *bufio.Reader
+	done bool
+	// pending is an unescaped character not yet returned
+	pending []byte
+}
+
+func (r *jsonStringReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.pending) > 0 {
+			c := copy(p[n:], r.pending)
+			r.pending = r.pending[c:]
+			n += c
+			continue
+		}
+		if r.done {
+			break
+		}
+		b, err := r.in.ReadByte()
+		if err != nil {
+			return n, notJSON(err)
+		}
+		switch b {
+		case '"':
+			r.done = true
+		case '\\':
+			if err := r.escape(); err != nil {
+				return n, err
+			}
+		default:
+			p[n] = b
+			n++
+		}
+	}
+	if n == 0 && r.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// escape unescapes the character after a backslash into pending
+func (r *jsonStringReader) escape() error {
+	b, err := r.in.ReadByte()
+	if err != nil {
+		return notJSON(err)
+	}
+	switch b {
+	case '"', '\\', '/':
+		r.pending = append(r.pending[:0], b)
+	case 'b':
+		r.pending = append(r.pending[:0], '\b')
+	case 'f':
+		r.pending = append(r.pending[:0], '\f')
+	case 'n':
+		r.pending = append(r.pending[:0], '\n')
+	case 'r':
+		r.pending = append(r.pending[:0], '\r')
+	case 't':
+		r.pending = append(r.pending[:0], '\t')
+	case 'u':
+		var hex [4]byte
+		if _, err := io.ReadFull(r.in, hex[:]); err != nil {
+			return notJSON(err)
+		}
+		c, ok := parseHex4(hex[:])
+		if !ok {
+			return fmt.Errorf("response is not JSON: invalid escape \\u%s", hex[:])
+		}
+		// A character outside the BMP is escaped as a surrogate pair; a lone surrogate
+		// becomes U+FFFD, as encoding/json decodes it
+		if utf16.IsSurrogate(c) {
+			hi := c
+			c = unicode.ReplacementChar
+			if next, err := r.in.Peek(6); err == nil && next[0] == '\\' && next[1] == 'u' {
+				if lo, ok := parseHex4(next[2:]); ok {
+					if pair := utf16.DecodeRune(hi, lo); pair != unicode.ReplacementChar {
+						c = pair
+						r.in.Discard(6)
+					}
+				}
+			}
+		}
+		r.pending = utf8.AppendRune(r.pending[:0], c)
+	default:
+		return fmt.Errorf("response is not JSON: invalid escape \\%c", b)
+	}
+	return nil
+}
+
+// parseHex4 parses the four hex digits of a \u escape
+func parseHex4(hex []byte) (rune, bool) {
+	v, err := strconv.ParseUint(string(hex), 16, 16)
+	return rune(v), err == nil
+}
@@ -0,0 +1,108 @@
+package mcpclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTruncateJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"short arrays kept", `{"a":[1,2]}`, "", false},
+		{"object", `{"a":[1,2,3,4],"b":{"c":[5,6,7]}}`, `{"a":[1,2],"b":{"c":[5,6]},"_truncated":{"a":4,"b.c":3}}`, false},
+		{"array", `[{"n":[1,2,3]},2,3]`, `{"items":[{"n":[1,2]},2],"_truncated":{"items":3,"items[].n":3}}`, false},
+		{"existing key merged", `{"_truncated":{"x":10},"a":[1,2,3]}`, `{"a":[1,2],"_truncated":{"a":3,"x":10}}`, false},
+		{"existing key last", `{"a":[1,2,3],"_truncated":{"a":99,"x":10}}`, `{"a":[1,2],"_truncated":{"a":3,"x":10}}`, false},
+		{"existing key only", `{"_truncated":{"x":10}}`, "", false},
+		{"nested key kept", `{"b":{"_truncated":true},"a":[1,2,3]}`, `{"b":{"_truncated":true},"a":[1,2],"_truncated":{"a":3}}`, false},
+		{"existing key not an object", `{"_truncated":true,"a":[1,2,3]}`, "", true},
+		{"trailing whitespace", "{\"a\":[1,2,3]}\n\t ", `{"a":[1,2],"_truncated":{"a":3}}`, false},
+		{"trailing value", `{"a":[1,2,3]} {"b":1}`, "", true},
+		{"trailing garbage", `[1,2,3]]`, "", true},
+		{"not an object", `"text"`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := TruncateJSON(strings.NewReader(tt.in), 2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want == "" || got == "" {
+				if got != tt.want {
+					t.Errorf("got %s, want %q", got, tt.want)
+				}
+				return
+			}
+			var gotValue, wantValue interface{}
+			if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+				t.Fatalf("output is not JSON: %v: %s", err, got)
+			}
+			json.Unmarshal([]byte(tt.want), &wantValue)
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if n := strings.Count(got, `"`+TruncatedKey+`":{`); n != 1 {
+				t.Errorf("output has %d %s objects: %s", n, TruncatedKey, got)
+			}
+		})
+	}
+}
+
+func TestTruncateToolResult(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		// want is the first content block's text after truncation, or "" when nothing is cut
+		want    string
+		wantErr bool
+	}{
+		{"object text", `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"{\"a\":[1,2,3]}"}]}}`, `{"a":[1,2],"_truncated":{"a":3}}`, false},
+		{"array text", `{"id":1,"result":{"content":[{"type":"text","text":" \n[1,2,3]"}]}}`, `{"items":[1,2],"_truncated":{"items":3}}`, false},
+		{"escapes", `{"id":1,"result":{"content":[{"text":"[\"a\\\"bé😀\ud800x\",2,3]","type":"text"}]}}`, `{"items":["a\"bé😀�x",2],"_truncated":{"items":3}}`, false},
+		{"short arrays", `{"id":1,"result":{"content":[{"type":"text","text":"[1,2]"}]}}`, "", false},
+		{"plain text", `{"id":1,"result":{"content":[{"type":"text","text":"1, 2, 3"}]}}`, "", false},
+		{"arrays outside content text", `{"id":1,"result":{"tools":[1,2,3],"content":[{"type":"text","text":"x","items":[1,2,3]}]}}`, "", false},
+		{"text like JSON", `{"id":1,"result":{"content":[{"type":"text","text":"[1,2,3] and more"}]}}`, "", true},
+		{"trailing data", `{"id":1,"result":{"content":[{"type":"text","text":"[1,2,3]"}]}} {}`, "", true},
+		{"not JSON", `{"id":1,"result":{"content":[{"type":"text","text":"[1,2,3]"`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := TruncateToolResult(strings.NewReader(tt.in), 2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("got %s, want nothing cut", got)
+				}
+				return
+			}
+
+			var resp Response
+			if err := json.Unmarshal([]byte(got), &resp); err != nil {
+				t.Fatalf("output is not JSON: %v: %s", err, got)
+			}
+			var result ToolResult
+			data, _ := json.Marshal(resp.Result)
+			json.Unmarshal(data, &result)
+			if len(result.Content) == 0 {
+				t.Fatalf("output has no content: %s", got)
+			}
+			var gotValue, wantValue interface{}
+			if err := json.Unmarshal([]byte(result.Content[0].Text), &gotValue); err != nil {
+				t.Fatalf("text is not JSON: %v: %s", err, result.Content[0].Text)
+			}
+			json.Unmarshal([]byte(tt.want), &wantValue)
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("got text %s, want %s", result.Content[0].Text, tt.want)
+			}
+		})
+	}
+}
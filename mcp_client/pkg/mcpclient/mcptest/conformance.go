@@ -0,0 +1,242 @@
+// Package mcptest helps test code built on pkg/mcpclient: a moq mock of MCPCaller, and a
+// conformance harness that checks an MCPCaller implementation against a real server.
+package mcptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+const (
+	// conformanceConcurrency is how many calls the concurrency check runs at once
+	conformanceConcurrency = 16
+	// conformancePayloadBytes is the size of the large payload check's request
+	conformancePayloadBytes = 1 << 20
+	// cancellationGrace is how long a call with a done context may take to return
+	cancellationGrace = time.Second
+)
+
+// ConformanceConfig describes the server a transport is checked against
+type ConformanceConfig struct {
+	// Server names the server in the report; empty uses the caller's base URL when it has one
+	Server string
+	// NewCaller creates a fresh, uninitialized caller for the transport under test
+	NewCaller func() mcpclient.MCPCaller
+	// Tool is a cheap, side-effect free tool to call, with Arguments
+	Tool      string
+	Arguments map[string]interface{}
+}
+
+// ConformanceCheck is the outcome of one conformance check
+type ConformanceCheck struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ConformanceReport is the outcome of a conformance run
+type ConformanceReport struct {
+	Server string             `json:"server"`
+	Checks []ConformanceCheck `json:"checks"`
+	OK     bool               `json:"ok"`
+}
+
+// conformanceChecks are run in order on one caller; reconnection runs last on a new one
+var conformanceChecks = []struct {
+	name string
+	run  func(ctx context.Context, caller mcpclient.MCPCaller, cfg ConformanceConfig) error
+}{
+	{"handshake", checkHandshake},
+	{"call", checkCall},
+	{"concurrency", checkConcurrency},
+	{"cancellation", checkCancellation},
+	{"large_payload", checkLargePayload},
+	{"close", checkClose},
+}
+
+// RunConformance checks that an MCP transport behaves like the HTTP one the agent was built
+// on: handshake, concurrent calls matched to the right responses, prompt cancellation,
+// payloads of a megabyte, calls failing after Close and a fresh caller reconnecting. Every
+// new MCPCaller implementation should pass it against a known server before it is used.
+func RunConformance(ctx context.Context, cfg ConformanceConfig) *ConformanceReport {
+	caller := cfg.NewCaller()
+	report := &ConformanceReport{Server: cfg.Server, OK: true}
+	if named, ok := caller.(interface{ BaseURL() string }); ok && report.Server == "" {
+		report.Server = named.BaseURL()
+	}
+	record := func(name string, run func() error) bool {
+		start := time.Now()
+		err := run()
+		check := ConformanceCheck{Name: name, OK: err == nil, Duration: time.Since(start)}
+		if err != nil {
+			check.Error = err.Error()
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, check)
+		return err == nil
+	}
+
+	for _, check := range conformanceChecks {
+		ok := record(check.name, func() error { return check.run(ctx, caller, cfg) })
+		// Nothing else can be checked without a working handshake
+		if !ok && check.name == "handshake" {
+			caller.Close(ctx)
+			return report
+		}
+	}
+
+	record("reconnect", func() error {
+		fresh := cfg.NewCaller()
+		defer fresh.Close(ctx)
+		if err := fresh.Initialize(ctx); err != nil {
+			return fmt.Errorf("failed to initialize a new caller after closing the first: %w", err)
+		}
+		return checkCall(ctx, fresh, cfg)
+	})
+	return report
+}
+
+func checkHandshake(ctx context.Context, caller mcpclient.MCPCaller, cfg ConformanceConfig) error {
+	if err := caller.Initialize(ctx); err != nil {
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	tools, err := caller.ListTools(ctx)
+	if err != nil {
+		return fmt.Errorf("tools/list failed: %w", err)
+	}
+	for _, tool := range tools {
+		if tool.Name == cfg.Tool {
+			return nil
+		}
+	}
+	return fmt.Errorf("tool %s not among the %d tools listed", cfg.Tool, len(tools))
+}
+
+func checkCall(ctx context.Context, caller mcpclient.MCPCaller, cfg ConformanceConfig) error {
+	result, err := caller.CallTool(ctx, mcpclient.ToolCall{Name: cfg.Tool, Arguments: cfg.Arguments})
+	if err != nil {
+		return fmt.Errorf("tools/call failed: %w", err)
+	}
+	if result == nil {
+		return fmt.Errorf("tools/call returned no result")
+	}
+	if result.IsError {
+		return fmt.Errorf("tool %s reported an error: %s", cfg.Tool, resultText(result))
+	}
+	return nil
+}
+
+// checkConcurrency runs calls in parallel; a client that matched responses by arrival order
+// rather than ID would misroute some of them
+func checkConcurrency(ctx context.Context, caller mcpclient.MCPCaller, cfg ConformanceConfig) error {
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < conformanceConcurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := checkCall(ctx, caller, cfg); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("call %d: %w", i, err))
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if client, ok := caller.(*mcpclient.Client); ok {
+		stats := client.CorrelationStats()
+		if n, _ := stats["orphaned"].(int64); n > 0 {
+			errs = append(errs, fmt.Errorf("%d responses did not match a pending request", n))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkCancellation checks calls return promptly with the context's error once it is done
+func checkCancellation(ctx context.Context, caller mcpclient.MCPCaller, cfg ConformanceConfig) error {
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	expired, cancelExpired := context.WithTimeout(ctx, time.Nanosecond)
+	defer cancelExpired()
+	<-expired.Done()
+
+	for _, c := range []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{"cancelled", cancelled, context.Canceled},
+		{"expired", expired, context.DeadlineExceeded},
+	} {
+		start := time.Now()
+		_, err := caller.CallTool(c.ctx, mcpclient.ToolCall{Name: cfg.Tool, Arguments: cfg.Arguments})
+		if elapsed := time.Since(start); elapsed > cancellationGrace {
+			return fmt.Errorf("call with a %s context took %s to return", c.name, elapsed.Round(time.Millisecond))
+		}
+		if !errors.Is(err, c.want) {
+			return fmt.Errorf("call with a %s context returned %v, want an error wrapping %v", c.name, err, c.want)
+		}
+	}
+	return nil
+}
+
+// checkLargePayload sends a megabyte of padding in the request's _meta, which servers ignore
+func checkLargePayload(ctx context.Context, caller mcpclient.MCPCaller, cfg ConformanceConfig) error {
+	call := mcpclient.ToolCall{
+		Name:      cfg.Tool,
+		Arguments: cfg.Arguments,
+		Meta:      map[string]interface{}{"padding": strings.Repeat("x", conformancePayloadBytes)},
+	}
+	if _, err := caller.CallTool(ctx, call); err != nil {
+		return fmt.Errorf("call with a %d byte request failed: %w", conformancePayloadBytes, err)
+	}
+	return nil
+}
+
+// checkClose checks Close succeeds and later calls fail instead of hanging
+func checkClose(ctx context.Context, caller mcpclient.MCPCaller, cfg ConformanceConfig) error {
+	if err := caller.Close(ctx); err != nil {
+		return fmt.Errorf("close failed: %w", err)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, cancellationGrace)
+	defer cancel()
+	if _, err := caller.CallTool(callCtx, mcpclient.ToolCall{Name: cfg.Tool, Arguments: cfg.Arguments}); err == nil {
+		return fmt.Errorf("call after close succeeded")
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("call after close hung until its deadline")
+	}
+	return nil
+}
+
+// resultText joins the text blocks of a tool result
+func resultText(result *mcpclient.ToolResult) string {
+	var text []string
+	for _, block := range result.Content {
+		if block.Text != "" {
+			text = append(text, block.Text)
+		}
+	}
+	return strings.Join(text, " ")
+}
+
+// PrintConformanceReport writes the report as a checklist
+func PrintConformanceReport(w io.Writer, report *ConformanceReport) {
+	fmt.Fprintf(w, "Conformance of %s\n", report.Server)
+	for _, check := range report.Checks {
+		if check.OK {
+			fmt.Fprintf(w, "[ OK ] %s in %s\n", check.Name, check.Duration.Round(time.Millisecond))
+		} else {
+			fmt.Fprintf(w, "[FAIL] %s: %s\n", check.Name, check.Error)
+		}
+	}
+}
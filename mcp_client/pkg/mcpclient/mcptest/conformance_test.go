@@ -0,0 +1,97 @@
+package mcptest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// newTimeServer serves a minimal MCP server with one get_current_time tool
+func newTimeServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req mcpclient.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result interface{}
+		switch req.Method {
+		case "initialize":
+			result = map[string]interface{}{
+				"protocolVersion": "2024-11-05",
+				"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+				"serverInfo":      map[string]interface{}{"name": "time", "version": "1.0.0"},
+			}
+		case "notifications/initialized":
+			w.WriteHeader(http.StatusAccepted)
+			return
+		case "tools/list":
+			result = map[string]interface{}{"tools": []map[string]interface{}{{
+				"name":        "get_current_time",
+				"description": "Returns the current time",
+				"inputSchema": map[string]interface{}{"type": "object"},
+			}}}
+		case "tools/call":
+			result = map[string]interface{}{"content": []map[string]interface{}{{
+				"type": "text",
+				"text": time.Now().UTC().Format(time.RFC3339),
+			}}}
+		default:
+			json.NewEncoder(w).Encode(mcpclient.Response{JSONRPC: "2.0", ID: req.ID, Error: &mcpclient.Error{Code: -32601, Message: "method not found"}})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mcpclient.Response{JSONRPC: "2.0", ID: req.ID, Result: result})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRunConformanceHTTPClient(t *testing.T) {
+	server := newTimeServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report := RunConformance(ctx, ConformanceConfig{
+		NewCaller: func() mcpclient.MCPCaller { return mcpclient.New(server.URL) },
+		Tool:      "get_current_time",
+		Arguments: map[string]interface{}{"timezone": "UTC"},
+	})
+
+	if report.Server != server.URL {
+		t.Errorf("report server = %q, want %q", report.Server, server.URL)
+	}
+	want := []string{"handshake", "call", "concurrency", "cancellation", "large_payload", "close", "reconnect"}
+	if len(report.Checks) != len(want) {
+		t.Fatalf("got %d checks, want %d: %+v", len(report.Checks), len(want), report.Checks)
+	}
+	for i, check := range report.Checks {
+		if check.Name != want[i] {
+			t.Errorf("check %d is %s, want %s", i, check.Name, want[i])
+		}
+		if !check.OK {
+			t.Errorf("check %s failed: %s", check.Name, check.Error)
+		}
+	}
+	if !report.OK {
+		t.Error("report is not OK")
+	}
+}
+
+func TestRunConformanceMissingTool(t *testing.T) {
+	server := newTimeServer(t)
+	report := RunConformance(context.Background(), ConformanceConfig{
+		NewCaller: func() mcpclient.MCPCaller { return mcpclient.New(server.URL) },
+		Tool:      "get_weather",
+	})
+
+	// A failed handshake stops the run
+	if report.OK || len(report.Checks) != 1 || report.Checks[0].Name != "handshake" || report.Checks[0].OK {
+		t.Errorf("report = %+v, want only a failed handshake", report)
+	}
+}
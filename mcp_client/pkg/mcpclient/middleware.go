@@ -0,0 +1,128 @@
+package mcpclient
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Sender sends one JSON-RPC request to an MCP server
+type Sender interface {
+	Send(ctx context.Context, req *Request) (*Response, error)
+}
+
+// SenderFunc adapts a function to a Sender
+type SenderFunc func(ctx context.Context, req *Request) (*Response, error)
+
+func (f SenderFunc) Send(ctx context.Context, req *Request) (*Response, error) {
+	return f(ctx, req)
+}
+
+// Middleware wraps a Sender with a cross-cutting concern such as auth, retries or metrics
+type Middleware func(next Sender) Sender
+
+// chainSenders wraps base in middleware so that middleware[0] runs first
+func chainSenders(base Sender, middleware []Middleware) Sender {
+	sender := base
+	for i := len(middleware) - 1; i >= 0; i-- {
+		sender = middleware[i](sender)
+	}
+	return sender
+}
+
+type requestHeadersKey struct{}
+
+// withRequestHeaders attaches HTTP headers for send to set on the outgoing request
+func withRequestHeaders(ctx context.Context, header http.Header) context.Context {
+	merged := requestHeaders(ctx).Clone()
+	if merged == nil {
+		merged = make(http.Header)
+	}
+	for k, v := range header {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, requestHeadersKey{}, merged)
+}
+
+// requestHeaders returns the headers attached by withRequestHeaders
+func requestHeaders(ctx context.Context) http.Header {
+	header, _ := ctx.Value(requestHeadersKey{}).(http.Header)
+	return header
+}
+
+type retryObserverKey struct{}
+
+// WithRetryObserver attaches fn to ctx. RetryMiddleware and AuthRefreshMiddleware call it
+// with every failed request made with ctx that they try again, e.g. to list retries in a
+// failure report.
+func WithRetryObserver(ctx context.Context, fn func(method string, attempt int, err error)) context.Context {
+	return context.WithValue(ctx, retryObserverKey{}, fn)
+}
+
+// retried reports a failed request about to be tried again to the observer attached to ctx
+func retried(ctx context.Context, method string, attempt int, err error) {
+	if fn, ok := ctx.Value(retryObserverKey{}).(func(method string, attempt int, err error)); ok {
+		fn(method, attempt, err)
+	}
+}
+
+// HeaderMiddleware adds headers to every request, e.g. an Authorization header. The header
+// function is called per request so tokens can be refreshed.
+func HeaderMiddleware(header func(ctx context.Context) (http.Header, error)) Middleware {
+	return func(next Sender) Sender {
+		return SenderFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			h, err := header(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return next.Send(withRequestHeaders(ctx, h), req)
+		})
+	}
+}
+
+// RetryMiddleware retries requests whose method passes retryable, waiting backoff, then twice
+// as long, between attempts. Errors from a closed client or a done context are not retried.
+func RetryMiddleware(attempts int, backoff time.Duration, retryable func(method string) bool) Middleware {
+	return func(next Sender) Sender {
+		return SenderFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			resp, err := next.Send(ctx, req)
+			delay := backoff
+			for attempt := 1; attempt < attempts && err != nil && retryable(req.Method); attempt++ {
+				if errors.Is(err, ErrClientClosed) || ctx.Err() != nil {
+					break
+				}
+				log.Printf("MCP %s failed (attempt %d/%d), retrying in %s: %v", req.Method, attempt, attempts, delay, err)
+				retried(ctx, req.Method, attempt, err)
+
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				delay *= 2
+				resp, err = next.Send(ctx, req)
+			}
+			return resp, err
+		})
+	}
+}
+
+// MetricsMiddleware reports the method, duration and error of every request to observe
+func MetricsMiddleware(observe func(method string, duration time.Duration, err error)) Middleware {
+	return func(next Sender) Sender {
+		return SenderFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			start := time.Now()
+			resp, err := next.Send(ctx, req)
+			observe(req.Method, time.Since(start), err)
+			return resp, err
+		})
+	}
+}
+
+// ReadOnlyMethods is a retryable predicate for RetryMiddleware that skips tools/call, since
+// tools are not assumed to be idempotent
+func ReadOnlyMethods(method string) bool {
+	return method != "tools/call"
+}
@@ -0,0 +1,15 @@
+package mcpclient
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// UnmarshalJSONNumbers unmarshals data into v, keeping numbers in interface{} values as
+// json.Number. Decoding them as float64 would silently round integers above 2^53, such as
+// nanosecond timestamps and some IDs, on their way between the model and MCP servers.
+func UnmarshalJSONNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,76 @@
+package mcpclient
+
+import "encoding/json"
+
+// Request is a JSON-RPC request or, with ID 0, a notification
+type Request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC response
+type Response struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *Error      `json:"error,omitempty"`
+}
+
+// Error is the error of a JSON-RPC response
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Tool is a tool a server offers in tools/list
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations map[string]interface{} `json:"annotations,omitempty"`
+
+	// raw is the JSON the value was decoded from; see rawjson.go
+	raw json.RawMessage
+}
+
+// ToolCall is a tools/call request
+type ToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Meta      map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// ToolResult is the result of a tools/call request
+type ToolResult struct {
+	Content []ContentBlock         `json:"content"`
+	IsError bool                   `json:"isError,omitempty"`
+	Meta    map[string]interface{} `json:"_meta,omitempty"`
+
+	// raw is the JSON the value was decoded from; see rawjson.go
+	raw json.RawMessage
+}
+
+// ContentBlock is one block of a tool result
+type ContentBlock struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text"`
+	Resource *EmbeddedResource `json:"resource,omitempty"`
+	// MimeType and Data are set on audio and image blocks; Data is base64
+	MimeType string `json:"mimeType,omitempty"`
+	Data     string `json:"data,omitempty"`
+
+	// raw is the JSON the value was decoded from; see rawjson.go
+	raw json.RawMessage
+}
+
+// EmbeddedResource is the resource of an MCP "resource" content block. Binary contents
+// are base64 in Blob, textual contents are in Text.
+type EmbeddedResource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
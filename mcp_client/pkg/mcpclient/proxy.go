@@ -0,0 +1,98 @@
+package mcpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// proxyDirect in a proxy setting bypasses every proxy, including HTTPS_PROXY
+const proxyDirect = "direct"
+
+// ProxyOverrides maps an MCP server host ("host" or "host:port") to the proxy used for it:
+// a proxy URL, or "direct" to connect without one. Servers without an override follow
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+type ProxyOverrides map[string]string
+
+// ProxyOverridesFromEnv parses MCP_PROXY_OVERRIDES, a comma-separated list of host=proxy
+// pairs, e.g. "tools.internal=direct,mcp.example.com=http://egress:3128"
+func ProxyOverridesFromEnv() (ProxyOverrides, error) {
+	overrides := make(ProxyOverrides)
+	raw := os.Getenv("MCP_PROXY_OVERRIDES")
+	if raw == "" {
+		return overrides, nil
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, proxy, ok := strings.Cut(entry, "=")
+		if !ok || host == "" || proxy == "" {
+			return nil, fmt.Errorf("invalid MCP_PROXY_OVERRIDES entry %q, expected host=proxy", entry)
+		}
+		if _, err := proxyFunc(proxy); err != nil {
+			return nil, err
+		}
+		overrides[strings.ToLower(host)] = proxy
+	}
+	return overrides, nil
+}
+
+// lookup returns the override for a server URL, preferring an exact host:port match
+func (o ProxyOverrides) lookup(serverURL string) (string, bool) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", false
+	}
+	if proxy, ok := o[strings.ToLower(u.Host)]; ok {
+		return proxy, true
+	}
+	proxy, ok := o[strings.ToLower(u.Hostname())]
+	return proxy, ok
+}
+
+// Apply sets the client's proxy when its server has an override
+func (o ProxyOverrides) Apply(c *Client) error {
+	proxy, ok := o.lookup(c.baseURL)
+	if !ok {
+		return nil
+	}
+	return c.SetProxy(proxy)
+}
+
+// proxyFunc resolves a proxy setting: "" follows the environment (including NO_PROXY),
+// "direct" never proxies, and anything else is used as the proxy URL
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case proxyDirect:
+		return nil, nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", proxy)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q in %q", u.Scheme, proxy)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// newProxyTransport returns a copy of the default transport using the given proxy setting
+func newProxyTransport(proxy string) (*http.Transport, error) {
+	fn, err := proxyFunc(proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = fn
+	return transport, nil
+}
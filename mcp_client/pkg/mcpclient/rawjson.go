@@ -0,0 +1,126 @@
+package mcpclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Tool, ToolResult and ContentBlock keep the JSON they were decoded from, so fields this
+// client doesn't model, such as a tool's title and outputSchema, a result's
+// structuredContent, image data or experimental keys, survive being marshaled again when
+// tools and results are cataloged, recorded or forwarded. Modeled fields are always written
+// from the struct, so changes to them take effect.
+
+var (
+	toolFields         = jsonFieldNames(reflect.TypeOf(Tool{}))
+	toolResultFields   = jsonFieldNames(reflect.TypeOf(ToolResult{}))
+	contentBlockFields = jsonFieldNames(reflect.TypeOf(ContentBlock{}))
+)
+
+func (t *Tool) UnmarshalJSON(data []byte) error {
+	type plain Tool
+	if err := json.Unmarshal(data, (*plain)(t)); err != nil {
+		return err
+	}
+	t.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (t Tool) MarshalJSON() ([]byte, error) {
+	type plain Tool
+	return marshalWithUnknown(plain(t), t.raw, toolFields)
+}
+
+func (r *ToolResult) UnmarshalJSON(data []byte) error {
+	type plain ToolResult
+	if err := UnmarshalJSONNumbers(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (r ToolResult) MarshalJSON() ([]byte, error) {
+	type plain ToolResult
+	return marshalWithUnknown(plain(r), r.raw, toolResultFields)
+}
+
+func (b *ContentBlock) UnmarshalJSON(data []byte) error {
+	type plain ContentBlock
+	if err := UnmarshalJSONNumbers(data, (*plain)(b)); err != nil {
+		return err
+	}
+	b.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (b ContentBlock) MarshalJSON() ([]byte, error) {
+	type plain ContentBlock
+	return marshalWithUnknown(plain(b), b.raw, contentBlockFields)
+}
+
+// UnknownFields returns the raw JSON of the fields a decoded result had that ToolResult
+// doesn't model, e.g. "structuredContent"
+func (r *ToolResult) UnknownFields() map[string]json.RawMessage {
+	return unknownFields(r.raw, toolResultFields)
+}
+
+// marshalWithUnknown marshals typed, then adds the fields of raw that aren't in modeled,
+// keeping their bytes as they were
+func marshalWithUnknown(typed interface{}, raw json.RawMessage, modeled map[string]bool) ([]byte, error) {
+	data, err := json.Marshal(typed)
+	if err != nil {
+		return nil, err
+	}
+	extra := unknownFields(raw, modeled)
+	if len(extra) == 0 {
+		return data, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	return json.Marshal(fields)
+}
+
+// unknownFields returns the fields of a raw JSON object whose names aren't in modeled
+func unknownFields(raw json.RawMessage, modeled map[string]bool) map[string]json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+	for k := range fields {
+		if modeled[k] {
+			delete(fields, k)
+		}
+	}
+	return fields
+}
+
+// jsonFieldNames returns the JSON names of a struct's exported fields
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
@@ -0,0 +1,49 @@
+package mcpclient
+
+import "context"
+
+type requestMetaKey struct{}
+
+// WithRequestMeta attaches metadata such as the end user's ID or feature flags to ctx.
+// Every tools/call made with the context sends it in _meta, so MCP servers can authorize
+// and record calls by the end user rather than the gateway's identity. Keys already
+// attached to ctx are kept unless meta sets them again.
+func WithRequestMeta(ctx context.Context, meta map[string]interface{}) context.Context {
+	if len(meta) == 0 {
+		return ctx
+	}
+	merged := RequestMeta(ctx)
+	if merged == nil {
+		merged = make(map[string]interface{}, len(meta))
+	}
+	for k, v := range meta {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, requestMetaKey{}, merged)
+}
+
+// RequestMeta returns a copy of the metadata attached to ctx, or nil when there is none
+func RequestMeta(ctx context.Context) map[string]interface{} {
+	meta, _ := ctx.Value(requestMetaKey{}).(map[string]interface{})
+	if meta == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(meta))
+	for k, v := range meta {
+		copied[k] = v
+	}
+	return copied
+}
+
+// toolCallMeta merges a call's own _meta over the metadata attached to ctx; the call's
+// entries, such as its idempotency key, take precedence
+func toolCallMeta(ctx context.Context, meta map[string]interface{}) map[string]interface{} {
+	merged := RequestMeta(ctx)
+	if merged == nil {
+		return meta
+	}
+	for k, v := range meta {
+		merged[k] = v
+	}
+	return merged
+}
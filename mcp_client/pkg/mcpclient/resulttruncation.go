@@ -0,0 +1,19 @@
+package mcpclient
+
+import "context"
+
+type resultTruncationKey struct{}
+
+// resultTruncation is the truncation WithResultTruncation attaches to a context
+type resultTruncation struct {
+	maxItems int
+	minBytes int64
+}
+
+// WithResultTruncation makes tools/call responses of minBytes or more received with ctx
+// keep the first maxItems items of every array in their JSON content text. The text is
+// truncated as the response is read, before it is decoded into a string, with the full
+// lengths under TruncatedKey as TruncateJSON lists them.
+func WithResultTruncation(ctx context.Context, maxItems int, minBytes int64) context.Context {
+	return context.WithValue(ctx, resultTruncationKey{}, resultTruncation{maxItems: maxItems, minBytes: minBytes})
+}
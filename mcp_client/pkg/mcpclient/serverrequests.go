@@ -0,0 +1,183 @@
+package mcpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Requests an MCP server may send the client
+const (
+	MethodPing          = "ping"
+	MethodRootsList     = "roots/list"
+	MethodCreateMessage = "sampling/createMessage"
+)
+
+// JSON-RPC error codes used in answers to server requests
+const (
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInternalError  = -32603
+)
+
+// ServerRequestHandler answers a request from the server with its JSON-RPC result
+type ServerRequestHandler func(ctx context.Context, params map[string]interface{}) (interface{}, error)
+
+// ServerRequests routes requests that servers send the client while it waits on a response
+// stream, such as ping, roots/list and sampling/createMessage, to registered handlers. Ping
+// is always answered; other methods get a "method not found" error unless registered.
+type ServerRequests struct {
+	mu       sync.RWMutex
+	handlers map[string]ServerRequestHandler
+}
+
+// NewServerRequests returns a dispatcher that answers ping
+func NewServerRequests() *ServerRequests {
+	s := &ServerRequests{handlers: map[string]ServerRequestHandler{}}
+	s.Handle(MethodPing, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return map[string]interface{}{}, nil
+	})
+	return s
+}
+
+// Handle registers handler for method, replacing any earlier one
+func (s *ServerRequests) Handle(method string, handler ServerRequestHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = handler
+}
+
+func (s *ServerRequests) handler(method string) ServerRequestHandler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.handlers[method]
+}
+
+// capabilities returns the client capabilities the registered handlers provide, merged into
+// the initialize request
+func (s *ServerRequests) capabilities() map[string]interface{} {
+	capabilities := map[string]interface{}{}
+	if s == nil {
+		return capabilities
+	}
+	if s.handler(MethodRootsList) != nil {
+		capabilities["roots"] = map[string]interface{}{"listChanged": false}
+	}
+	if s.handler(MethodCreateMessage) != nil {
+		capabilities["sampling"] = map[string]interface{}{}
+	}
+	return capabilities
+}
+
+// serverRequest is a JSON-RPC request sent by the server; its ID may be a number or a string
+type serverRequest struct {
+	ID     json.RawMessage        `json:"id"`
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// serverResponse is the client's answer to a serverRequest
+type serverResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// serverRequestMethod returns the method of a JSON-RPC request, or "" for anything else
+func serverRequestMethod(payload string) string {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil || len(msg.ID) == 0 || string(msg.ID) == "null" {
+		return ""
+	}
+	return msg.Method
+}
+
+// dispatch runs the handler for a request payload and returns the response to send back
+func (s *ServerRequests) dispatch(ctx context.Context, payload string) *serverResponse {
+	var req serverRequest
+	if err := json.Unmarshal([]byte(payload), &req); err != nil {
+		return nil
+	}
+	resp := &serverResponse{JSONRPC: "2.0", ID: req.ID}
+
+	handler := s.handler(req.Method)
+	if handler == nil {
+		resp.Error = &Error{Code: jsonRPCMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+		return resp
+	}
+	result, err := handler(ctx, req.Params)
+	if err != nil {
+		resp.Error = &Error{Code: jsonRPCInternalError, Message: err.Error()}
+		return resp
+	}
+	if result == nil {
+		result = map[string]interface{}{}
+	}
+	resp.Result = result
+	return resp
+}
+
+// answerServerRequest dispatches a request from the server and posts the response to the
+// server's endpoint, as the streamable HTTP transport expects
+func answerServerRequest(ctx context.Context, client *http.Client, baseURL string, requests *ServerRequests, payload string) {
+	resp := requests.dispatch(ctx, payload)
+	if resp == nil {
+		return
+	}
+	method := serverRequestMethod(payload)
+	if err := postServerResponse(ctx, client, baseURL, resp); err != nil {
+		log.Printf("Failed to answer %s request from %s: %v", method, baseURL, err)
+	}
+}
+
+func postServerResponse(ctx context.Context, client *http.Client, baseURL string, resp *serverResponse) error {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", baseURL, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range requestHeaders(ctx) {
+		httpReq.Header[k] = v
+	}
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+	io.Copy(io.Discard, httpResp.Body)
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return fmt.Errorf("HTTP error: %d", httpResp.StatusCode)
+	}
+	return nil
+}
+
+// Root is a directory or file the client exposes to servers through roots/list
+type Root struct {
+	URI  string `json:"uri"`
+	Name string `json:"name,omitempty"`
+}
+
+// RootsHandler answers roots/list with roots
+func RootsHandler(roots ...Root) ServerRequestHandler {
+	return func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		list := make([]Root, len(roots))
+		copy(list, roots)
+		return map[string]interface{}{"roots": list}, nil
+	}
+}
@@ -0,0 +1,294 @@
+package mcpclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// sseFieldPrefixes are the line starts that identify an event stream when sniffing
+var sseFieldPrefixes = [][]byte{
+	[]byte("event:"),
+	[]byte("data:"),
+	[]byte("id:"),
+	[]byte("retry:"),
+	[]byte(":"),
+}
+
+// IsEventStream decides whether a response body is SSE. A text/event-stream or JSON
+// Content-Type is trusted unless the body clearly contradicts it; anything else is sniffed
+// from the first non-blank line.
+func IsEventStream(contentType string, prefix []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	trimmed := bytes.TrimLeft(prefix, " \t\r\n\ufeff")
+
+	switch mediaType {
+	case "text/event-stream":
+		// Some servers label plain JSON errors as event streams
+		return !(bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")))
+	case "application/json":
+		if bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")) {
+			return false
+		}
+	}
+
+	for _, p := range sseFieldPrefixes {
+		if bytes.HasPrefix(trimmed, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// liveEventStream decides whether a response is read as its events arrive, which lets the
+// client answer requests the server sends before it responds. Only responses labelled
+// text/event-stream are; a JSON body labelled as a stream is still buffered. The returned
+// reader replaces body either way.
+func liveEventStream(contentType string, body io.Reader) (io.Reader, bool) {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/event-stream" {
+		return body, false
+	}
+	// Peek only at what has arrived; the server may be waiting on us for the rest
+	br := bufio.NewReader(body)
+	if _, err := br.Peek(1); err != nil {
+		return br, false
+	}
+	prefix, _ := br.Peek(br.Buffered())
+	return br, IsEventStream(contentType, prefix)
+}
+
+// SSEEvent is one dispatched Server-Sent Event
+type SSEEvent struct {
+	// Type is the event field, "message" when the event didn't set one
+	Type string
+	// ID is the last event ID seen on the stream, which persists across events
+	ID   string
+	Data string
+	// Retry is the reconnection time in milliseconds, or -1 when the event didn't set one
+	Retry int
+}
+
+// ParseSSE reads an event stream as the HTML spec describes: lines end in CRLF, LF or CR,
+// data lines accumulate with newlines between them, "event", "id" and "retry" are tracked,
+// and comments and unknown fields are ignored. fn is called for every dispatched event and
+// stops parsing by returning false. Unlike the spec, an event left unterminated at EOF is
+// still dispatched, as some servers close the stream without a final blank line.
+func ParseSSE(r io.Reader, maxLine int, fn func(event SSEEvent) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	scanner.Split(scanSSELines)
+
+	var data strings.Builder
+	var eventType, lastID string
+	retry := -1
+	hasData := false
+	first := true
+
+	// dispatch ends the current event; events without data are dropped per spec
+	dispatch := func() bool {
+		defer func() {
+			data.Reset()
+			eventType = ""
+			retry = -1
+			hasData = false
+		}()
+		if !hasData {
+			return true
+		}
+		event := SSEEvent{Type: eventType, ID: lastID, Data: strings.TrimSuffix(data.String(), "\n"), Retry: retry}
+		if event.Type == "" {
+			event.Type = "message"
+		}
+		return fn(event)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+
+		if line == "" {
+			if !dispatch() {
+				return nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteString("\n")
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				lastID = value
+			}
+		case "retry":
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 && strings.Trim(value, "0123456789") == "" {
+				retry = n
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	dispatch()
+	return nil
+}
+
+// scanSSELines is a bufio.SplitFunc for SSE line endings: CRLF, LF or a lone CR
+func scanSSELines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A CR at the end of the buffer may be the first half of a CRLF
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// sseHandlers receive the messages on a response stream that are not the awaited response;
+// any of them may be nil
+type sseHandlers struct {
+	// notify receives the method of each notification
+	notify func(method string)
+	// request receives requests from the server
+	request func(payload string)
+	// accept picks out the awaited response; nil takes the first response
+	accept func(payload string) bool
+	// stray receives responses accept rejected, such as one for another request
+	stray func(payload string)
+}
+
+// extractSSEDataFrom returns the JSON-RPC response carried by an event stream, allowing
+// lines up to maxLine bytes. Only "message" events carry JSON-RPC messages; other event types
+// are ignored. Notifications, server requests and other requests' responses are passed to
+// handlers and skipped. If no event is the awaited response, the last other message's data
+// is returned.
+func extractSSEDataFrom(r io.Reader, maxLine int, handlers sseHandlers) (string, error) {
+	var last string
+	found := false
+
+	err := ParseSSE(r, maxLine, func(event SSEEvent) bool {
+		if event.Type != "message" {
+			return true
+		}
+		if isJSONRPCResponse(event.Data) {
+			if handlers.accept == nil || handlers.accept(event.Data) {
+				last = event.Data
+				found = true
+				return false
+			}
+			if handlers.stray != nil {
+				handlers.stray(event.Data)
+			}
+			return true
+		}
+		last = event.Data
+		if serverRequestMethod(event.Data) != "" {
+			if handlers.request != nil {
+				handlers.request(event.Data)
+			}
+			return true
+		}
+		if method := notificationMethod(event.Data); method != "" && handlers.notify != nil {
+			handlers.notify(method)
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if found {
+		return last, nil
+	}
+	return strings.TrimSpace(last), nil
+}
+
+// ExtractSSEData returns the JSON-RPC message carried by a complete event stream body, or ""
+// when it carries none
+func ExtractSSEData(body string) string {
+	data, err := extractSSEDataFrom(strings.NewReader(body), len(body)+1, sseHandlers{})
+	if err != nil {
+		return ""
+	}
+	return data
+}
+
+// isJSONRPCResponse reports whether payload is a JSON-RPC response rather than a notification or request
+func isJSONRPCResponse(payload string) bool {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		return false
+	}
+	return msg.Method == "" && len(msg.ID) > 0 && (msg.Result != nil || msg.Error != nil)
+}
+
+// notificationMethod returns the method of a JSON-RPC notification, or "" for anything else
+func notificationMethod(payload string) string {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil || len(msg.ID) > 0 {
+		return ""
+	}
+	return msg.Method
+}
+
+// decodeSSEResponse decodes the JSON-RPC response found in an event stream for request id;
+// an empty stream is an empty result
+func decodeSSEResponse(id int, jsonData string) (*Response, error) {
+	if jsonData == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      id,
+			Result:  nil,
+		}, nil
+	}
+
+	var mcpResp Response
+	if err := UnmarshalJSONNumbers([]byte(jsonData), &mcpResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal SSE JSON data: %w", err)
+	}
+
+	if mcpResp.Error != nil {
+		return nil, fmt.Errorf("MCP error %d: %s", mcpResp.Error.Code, mcpResp.Error.Message)
+	}
+
+	return &mcpResp, nil
+}
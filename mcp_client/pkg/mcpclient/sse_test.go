@@ -0,0 +1,131 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsEventStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        bool
+	}{
+		{"event stream", "text/event-stream", "data: {}\n\n", true},
+		{"starts with id", "text/event-stream", "id: 1\ndata: {}\n\n", true},
+		{"starts with comment", "text/event-stream", ": keep-alive\n\ndata: {}\n\n", true},
+		{"missing content type", "", "event: message\ndata: {}\n\n", true},
+		{"labelled as JSON", "application/json", "data: {}\n\n", true},
+		{"labelled as text", "text/plain; charset=utf-8", "retry: 1000\ndata: {}\n\n", true},
+		{"JSON labelled as event stream", "text/event-stream", `{"jsonrpc":"2.0","id":1,"result":{}}`, false},
+		{"JSON", "application/json", `{"jsonrpc":"2.0","id":1,"result":{}}`, false},
+		{"JSON without content type", "", "\n  {\"jsonrpc\":\"2.0\"}", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEventStream(tt.contentType, []byte(tt.body)); got != tt.want {
+				t.Errorf("IsEventStream(%q, %q) = %v, want %v", tt.contentType, tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractSSEData(t *testing.T) {
+	const response = `{"jsonrpc":"2.0","id":1,"result":{}}`
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"single event", "data: " + response + "\n\n", response},
+		{"starts with id", "id: 42\nevent: message\ndata: " + response + "\n\n", response},
+		{"comments", ": keep-alive\n\n: still here\ndata: " + response + "\n\n", response},
+		{"CRLF line endings", "id: 1\r\ndata: " + response + "\r\n\r\n", response},
+		{"no final blank line", "data: " + response, response},
+		{"byte order mark", "\ufeffdata: " + response + "\n\n", response},
+		{"notification first", "data: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\ndata: " + response + "\n\n", response},
+		{"other event types ignored", "event: endpoint\ndata: /messages\n\ndata: " + response + "\n\n", response},
+		{"data split over lines", "data: {\"jsonrpc\":\"2.0\",\ndata: \"id\":1,\"result\":{}}\n\n", "{\"jsonrpc\":\"2.0\",\n\"id\":1,\"result\":{}}"},
+		{"empty stream", ": nothing\n\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractSSEData(tt.body); got != tt.want {
+				t.Errorf("ExtractSSEData(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestClientResponseVariants sends requests through one client to a server that answers
+// each in a different way, as servers seen in practice do, including JSON to one request
+// and SSE to the next
+func TestClientResponseVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		// contentType is the response's Content-Type; "-" sends none
+		contentType string
+		// body formats the response; %[1]s is the JSON-RPC response
+		body string
+	}{
+		{"JSON", "application/json", "%[1]s"},
+		{"event stream", "text/event-stream", "data: %[1]s\n\n"},
+		{"JSON after event stream", "application/json", "%[1]s"},
+		{"stream starting with id", "text/event-stream", "id: 17\nevent: message\ndata: %[1]s\n\n"},
+		{"stream with comments", "text/event-stream", ": keep-alive\n\n: padding\ndata: %[1]s\n\n"},
+		{"stream without content type", "-", "data: %[1]s\n\n"},
+		{"stream labelled as JSON", "application/json", "event: message\ndata: %[1]s\n\n"},
+		{"stream labelled as text", "text/plain", "id: 3\ndata: %[1]s\n\n"},
+		{"JSON labelled as event stream", "text/event-stream", "%[1]s"},
+		{"notification before response", "text/event-stream", "data: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/tools/list_changed\"}\n\ndata: %[1]s\n\n"},
+	}
+
+	var current int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tt := tests[current]
+		response, _ := json.Marshal(Response{JSONRPC: "2.0", ID: req.ID, Result: map[string]interface{}{"case": tt.name}})
+		if tt.contentType == "-" {
+			w.Header()["Content-Type"] = nil
+		} else {
+			w.Header().Set("Content-Type", tt.contentType)
+		}
+		fmt.Fprintf(w, tt.body, response)
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	defer client.Close(context.Background())
+	var notified []string
+	client.SetNotificationHandler(func(method string) { notified = append(notified, method) })
+
+	for i, tt := range tests {
+		current = i
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.sendRequest(context.Background(), "test/echo", nil)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			result, _ := resp.Result.(map[string]interface{})
+			if result["case"] != tt.name {
+				t.Errorf("result = %v, want case %q", resp.Result, tt.name)
+			}
+		})
+	}
+
+	if len(notified) != 1 || notified[0] != "notifications/tools/list_changed" {
+		t.Errorf("notifications = %v, want the tools/list_changed one", notified)
+	}
+	if stats := client.SSEStats(); !stats.Healthy() {
+		t.Errorf("SSE stats report problems: %+v", stats)
+	}
+}
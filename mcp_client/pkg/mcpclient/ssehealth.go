@@ -0,0 +1,122 @@
+package mcpclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// streamGapThreshold is how long a response stream may go without data before the wait is
+// counted as a gap
+const streamGapThreshold = 10 * time.Second
+
+// SSEStreamStats counts how a server's response streams have behaved since the client was
+// created, so a flaky streaming server shows up as dropped streams and gaps rather than as
+// unexplained tool timeouts
+type SSEStreamStats struct {
+	// Streams is how many responses were read as event streams
+	Streams int64 `json:"streams"`
+	// Dropped streams ended without a response to the request
+	Dropped int64 `json:"dropped"`
+	// ReadErrors are streams that failed mid-read, e.g. on a reset connection
+	ReadErrors int64 `json:"readErrors"`
+	// ParseErrors are streams with an over-long line or a response that isn't valid JSON
+	ParseErrors int64 `json:"parseErrors"`
+	// Gaps counts waits of over 10s for more of a stream; MaxGap is the longest wait seen
+	Gaps   int64         `json:"gaps"`
+	MaxGap time.Duration `json:"maxGap"`
+	// LastError describes the latest dropped or failed stream
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// Healthy reports whether no stream has been dropped or failed
+func (s SSEStreamStats) Healthy() bool {
+	return s.Dropped == 0 && s.ReadErrors == 0 && s.ParseErrors == 0
+}
+
+// sseStreamHealth accumulates SSEStreamStats for one server
+type sseStreamHealth struct {
+	server string
+
+	mu    sync.Mutex
+	stats SSEStreamStats
+}
+
+func newSSEStreamHealth(server string) *sseStreamHealth {
+	return &sseStreamHealth{server: server}
+}
+
+// read extracts the response from an event stream like extractSSEDataFrom, recording how
+// the stream behaved
+func (h *sseStreamHealth) read(r io.Reader, maxLine int, handlers sseHandlers) (string, error) {
+	timed := &gapReader{r: r, last: time.Now()}
+	data, err := extractSSEDataFrom(timed, maxLine, handlers)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stats.Streams++
+	h.stats.Gaps += timed.gaps
+	if timed.maxGap > h.stats.MaxGap {
+		h.stats.MaxGap = timed.maxGap
+	}
+
+	switch {
+	case errors.Is(err, bufio.ErrTooLong):
+		h.stats.ParseErrors++
+		h.failed(err)
+	case err != nil:
+		h.stats.ReadErrors++
+		h.failed(err)
+	case data != "" && !json.Valid([]byte(data)):
+		h.stats.ParseErrors++
+		h.failed(fmt.Errorf("stream data is not valid JSON"))
+	case !isJSONRPCResponse(data):
+		h.stats.Dropped++
+		h.failed(fmt.Errorf("stream ended without a response"))
+	}
+	return data, err
+}
+
+// failed records the latest stream problem; it must be called with mu held
+func (h *sseStreamHealth) failed(err error) {
+	h.stats.LastError = err.Error()
+	h.stats.LastErrorAt = time.Now()
+	log.Printf("SSE stream from %s: %v", h.server, err)
+}
+
+// Stats returns the counts so far
+func (h *sseStreamHealth) Stats() SSEStreamStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// gapReader times the waits between reads of a stream that return data
+type gapReader struct {
+	r      io.Reader
+	last   time.Time
+	gaps   int64
+	maxGap time.Duration
+}
+
+func (g *gapReader) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	if n > 0 {
+		now := time.Now()
+		gap := now.Sub(g.last)
+		if gap > g.maxGap {
+			g.maxGap = gap
+		}
+		if gap > streamGapThreshold {
+			g.gaps++
+		}
+		g.last = now
+	}
+	return n, err
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// statusPolicyDenied marks tool calls refused by the tool policy
+const statusPolicyDenied = "policy_denied"
+
+// ErrToolCallDenied is returned when the tool policy denies a call made outside an agent loop
+var ErrToolCallDenied = errors.New("tool call denied by policy")
+
+// PolicyEffect is what a tool policy decided about a call
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "allow"
+	PolicyDeny  PolicyEffect = "deny"
+	// PolicyTransform runs the call with the decision's arguments instead of the model's
+	PolicyTransform PolicyEffect = "transform"
+)
+
+// PolicyInput is what a tool policy decides on
+type PolicyInput struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	SessionID string                 `json:"sessionId,omitempty"`
+	Tenant    string                 `json:"tenant,omitempty"`
+	// Tags are the invocation's tags
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// PolicyDecision is a tool policy's answer
+type PolicyDecision struct {
+	Effect PolicyEffect `json:"effect"`
+	// Reason explains a denial to the model and in traces
+	Reason string `json:"reason,omitempty"`
+	// Arguments replace the call's arguments when Effect is PolicyTransform
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	// Rule names the rule that decided, when the policy has named rules
+	Rule string `json:"rule,omitempty"`
+}
+
+// ToolPolicy decides, before each tool call, whether it may run. An error fails the call's
+// invocation rather than letting the call through.
+type ToolPolicy interface {
+	Evaluate(ctx context.Context, input PolicyInput) (PolicyDecision, error)
+}
+
+// ToolPolicyFunc adapts a function to a ToolPolicy
+type ToolPolicyFunc func(ctx context.Context, input PolicyInput) (PolicyDecision, error)
+
+func (f ToolPolicyFunc) Evaluate(ctx context.Context, input PolicyInput) (PolicyDecision, error) {
+	return f(ctx, input)
+}
+
+// OpenToolPolicy opens a policy from location: an OPA decision URL such as
+// "http://localhost:8181/v1/data/mcp/tools/decision", or a JSON rules file
+func OpenToolPolicy(location string) (ToolPolicy, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return &OPAPolicy{URL: location}, nil
+	}
+	return LoadPolicyRules(location)
+}
+
+// PolicyCondition tests one argument of a call. Arg is a dot-separated path into the
+// arguments, e.g. "filter.namespace".
+type PolicyCondition struct {
+	Arg string `json:"arg"`
+	// Op is "equals", "not_equals", "in", "matches" (a regular expression), "exists",
+	// "missing", "gt" or "lt"
+	Op    string      `json:"op"`
+	Value interface{} `json:"value,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// PolicyRule applies its effect to calls matching all of its fields; empty fields match any call
+type PolicyRule struct {
+	Name string `json:"name"`
+	// Tools are tool names or path.Match patterns such as "delete_*"
+	Tools   []string          `json:"tools,omitempty"`
+	Tenants []string          `json:"tenants,omitempty"`
+	When    []PolicyCondition `json:"when,omitempty"`
+	Effect  PolicyEffect      `json:"effect"`
+	Reason  string            `json:"reason,omitempty"`
+	// Set and Remove change the arguments of a transform rule
+	Set    map[string]interface{} `json:"set,omitempty"`
+	Remove []string               `json:"remove,omitempty"`
+}
+
+// PolicyRules is a simple rules policy. Rules are checked in order: the first matching allow
+// or deny rule decides, while matching transform rules change the arguments and checking
+// continues with the changed arguments. Calls no allow or deny rule matches get Default.
+type PolicyRules struct {
+	// Default is "allow" or "deny"; empty allows
+	Default PolicyEffect `json:"default,omitempty"`
+	Rules   []PolicyRule `json:"rules"`
+}
+
+// LoadPolicyRules reads a JSON rules file
+func LoadPolicyRules(file string) (*PolicyRules, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tool policy: %w", err)
+	}
+	var rules PolicyRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse tool policy %s: %w", file, err)
+	}
+	if err := rules.compile(); err != nil {
+		return nil, fmt.Errorf("invalid tool policy %s: %w", file, err)
+	}
+	return &rules, nil
+}
+
+// compile validates the rules and compiles their patterns
+func (p *PolicyRules) compile() error {
+	switch p.Default {
+	case "", PolicyAllow, PolicyDeny:
+	default:
+		return fmt.Errorf("default must be allow or deny, got %q", p.Default)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		switch rule.Effect {
+		case PolicyAllow, PolicyDeny, PolicyTransform:
+		default:
+			return fmt.Errorf("rule %q: invalid effect %q", rule.Name, rule.Effect)
+		}
+		for _, pattern := range rule.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %q: invalid tool pattern %q", rule.Name, pattern)
+			}
+		}
+		for j := range rule.When {
+			cond := &rule.When[j]
+			switch cond.Op {
+			case "equals", "not_equals", "in", "exists", "missing", "gt", "lt":
+			case "matches":
+				s, _ := cond.Value.(string)
+				pattern, err := regexp.Compile(s)
+				if err != nil {
+					return fmt.Errorf("rule %q: invalid pattern for %s: %w", rule.Name, cond.Arg, err)
+				}
+				cond.pattern = pattern
+			default:
+				return fmt.Errorf("rule %q: unknown operator %q", rule.Name, cond.Op)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *PolicyRules) Evaluate(ctx context.Context, input PolicyInput) (PolicyDecision, error) {
+	args := input.Arguments
+	transformed := false
+	var transformedBy []string
+
+	for _, rule := range p.Rules {
+		if !rule.matches(input.Tool, input.Tenant, args) {
+			continue
+		}
+		switch rule.Effect {
+		case PolicyTransform:
+			args = rule.transform(args)
+			transformed = true
+			transformedBy = append(transformedBy, rule.Name)
+		case PolicyDeny:
+			return PolicyDecision{Effect: PolicyDeny, Reason: rule.Reason, Rule: rule.Name}, nil
+		case PolicyAllow:
+			if transformed {
+				return PolicyDecision{Effect: PolicyTransform, Arguments: args, Rule: strings.Join(transformedBy, ",")}, nil
+			}
+			return PolicyDecision{Effect: PolicyAllow, Rule: rule.Name}, nil
+		}
+	}
+
+	if p.Default == PolicyDeny {
+		return PolicyDecision{Effect: PolicyDeny, Reason: "no policy rule allows this call"}, nil
+	}
+	if transformed {
+		return PolicyDecision{Effect: PolicyTransform, Arguments: args, Rule: strings.Join(transformedBy, ",")}, nil
+	}
+	return PolicyDecision{Effect: PolicyAllow}, nil
+}
+
+func (r PolicyRule) matches(tool, tenant string, args map[string]interface{}) bool {
+	if len(r.Tools) > 0 {
+		matched := false
+		for _, pattern := range r.Tools {
+			if ok, _ := path.Match(pattern, tool); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.Tenants) > 0 && !containsString(r.Tenants, tenant) {
+		return false
+	}
+	for _, cond := range r.When {
+		if !cond.holds(args) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c PolicyCondition) holds(args map[string]interface{}) bool {
+	value, ok := argumentAt(args, c.Arg)
+	switch c.Op {
+	case "exists":
+		return ok
+	case "missing":
+		return !ok
+	}
+	if !ok {
+		return false
+	}
+
+	switch c.Op {
+	case "equals":
+		return policyEqual(value, c.Value)
+	case "not_equals":
+		return !policyEqual(value, c.Value)
+	case "in":
+		list, _ := c.Value.([]interface{})
+		for _, v := range list {
+			if policyEqual(value, v) {
+				return true
+			}
+		}
+		return false
+	case "matches":
+		s, isString := value.(string)
+		return isString && c.pattern != nil && c.pattern.MatchString(s)
+	case "gt", "lt":
+		cmp, ok := compareJSONNumbers(value, c.Value)
+		if !ok {
+			return false
+		}
+		if c.Op == "gt" {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return false
+}
+
+// policyEqual compares JSON values by their canonical form, so 1 equals 1.0 and large
+// integers are compared exactly
+func policyEqual(a, b interface{}) bool {
+	x, errA := canonicalJSON(a)
+	y, errB := canonicalJSON(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(normalizeJSON(a), normalizeJSON(b))
+	}
+	return bytes.Equal(x, y)
+}
+
+func normalizeJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// argumentAt looks up a dot-separated path in the arguments
+func argumentAt(args map[string]interface{}, argPath string) (interface{}, bool) {
+	var current interface{} = args
+	for _, key := range strings.Split(argPath, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// transform returns a copy of the top-level arguments with the rule's changes applied
+func (r PolicyRule) transform(args map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(args)+len(r.Set))
+	for k, v := range args {
+		out[k] = v
+	}
+	for _, k := range r.Remove {
+		delete(out, k)
+	}
+	for k, v := range r.Set {
+		out[k] = v
+	}
+	return out
+}
+
+// OPAPolicy asks an Open Policy Agent server for decisions. The policy input is posted as
+// {"input": ...} to URL, and the decision is read from the response's "result", which has
+// the fields of PolicyDecision.
+type OPAPolicy struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *OPAPolicy) Evaluate(ctx context.Context, input PolicyInput) (PolicyDecision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return PolicyDecision{}, fmt.Errorf("failed to marshal policy input: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return PolicyDecision{}, fmt.Errorf("failed to create policy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return PolicyDecision{}, fmt.Errorf("failed to query policy: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return PolicyDecision{}, fmt.Errorf("policy server returned status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Result *PolicyDecision `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return PolicyDecision{}, fmt.Errorf("failed to decode policy decision: %w", err)
+	}
+	// An undefined decision means the policy has no rule for this input
+	if out.Result == nil {
+		return PolicyDecision{Effect: PolicyDeny, Reason: "the policy has no decision for this call"}, nil
+	}
+	return *out.Result, nil
+}
+
+// evaluateToolPolicy runs the agent's policy on a tool call. A transform rewrites the call's
+// input in place; a denial is returned so it can be reported to the model.
+func (a *InlineAgent) evaluateToolPolicy(ctx context.Context, toolUse map[string]interface{}, sessionID string, tags map[string]string, emit func(TraceEvent)) (*PolicyDecision, error) {
+	if a.ToolPolicy == nil {
+		return nil, nil
+	}
+	name, _ := toolUse["name"].(string)
+	input, _ := toolUse["input"].(map[string]interface{})
+
+	decision, err := a.ToolPolicy.Evaluate(ctx, PolicyInput{
+		Tool:      name,
+		Arguments: input,
+		SessionID: sessionID,
+		Tenant:    tags["tenant"],
+		Tags:      tags,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tool policy failed for %s: %w", name, err)
+	}
+	if decision.Effect == PolicyAllow || decision.Effect == "" {
+		return nil, nil
+	}
+
+	emit(TraceEvent{
+		Type:      TracePolicy,
+		SessionID: sessionID,
+		Tool:      name,
+		Data: map[string]interface{}{
+			"effect": string(decision.Effect),
+			"rule":   decision.Rule,
+			"reason": decision.Reason,
+		},
+	})
+
+	switch decision.Effect {
+	case PolicyTransform:
+		toolUse["input"] = decision.Arguments
+		return nil, nil
+	case PolicyDeny:
+		return &decision, nil
+	}
+	return nil, fmt.Errorf("tool policy returned unknown effect %q for %s", decision.Effect, name)
+}
+
+// handler returns a tool handler that reports the denial instead of running the tool
+func (d *PolicyDecision) handler() func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+	reason := d.Reason
+	if reason == "" {
+		reason = "this call is not allowed by policy"
+	}
+	return func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"toolUseId": toolUse["toolUseId"],
+			"content": []map[string]interface{}{
+				{"text": fmt.Sprintf("The tool call was denied: %s. Do not retry it.", reason)},
+			},
+			"status": statusPolicyDenied,
+		}, nil
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// postProcessAnnotation is the tool annotation naming a registered processor, e.g.
+// "annotations": {"postProcess": "markdown-table"} in a tools/list entry
+const postProcessAnnotation = "postProcess"
+
+// maxTableCell caps the width of a markdown table cell
+const maxTableCell = 80
+
+// ResultProcessor rewrites the text output of a tool before it goes into the model's context
+type ResultProcessor func(toolName, text string) (string, error)
+
+var (
+	resultProcessorsMu sync.RWMutex
+	resultProcessors   = map[string]ResultProcessor{
+		"markdown-table": MarkdownTableProcessor,
+		"compact-json":   CompactJSONProcessor,
+	}
+)
+
+// RegisterResultProcessor makes a processor selectable by name from ActionGroup.ResultProcessors
+// and from the postProcess tool annotation
+func RegisterResultProcessor(name string, processor ResultProcessor) {
+	resultProcessorsMu.Lock()
+	defer resultProcessorsMu.Unlock()
+	resultProcessors[name] = processor
+}
+
+// lookupResultProcessor returns the registered processor with the given name
+func lookupResultProcessor(name string) (ResultProcessor, bool) {
+	resultProcessorsMu.RLock()
+	defer resultProcessorsMu.RUnlock()
+	processor, ok := resultProcessors[name]
+	return processor, ok
+}
+
+// resultProcessorFor finds the processor for a tool: the group's configured one first, then
+// the processor named by the tool's postProcess annotation
+func (a *InlineAgent) resultProcessorFor(toolName string) (string, ResultProcessor) {
+	for _, group := range a.ActionGroups {
+		if name, ok := group.ResultProcessors[toolName]; ok {
+			if processor, ok := lookupResultProcessor(name); ok {
+				return name, processor
+			}
+			log.Printf("Unknown result processor %q for tool %s", name, toolName)
+			return "", nil
+		}
+		for _, tool := range group.Tools {
+			if tool.Name != toolName {
+				continue
+			}
+			if name, ok := tool.Annotations[postProcessAnnotation].(string); ok {
+				if processor, ok := lookupResultProcessor(name); ok {
+					return name, processor
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// postProcessResult runs the tool's processor over each text block. A failing processor
+// leaves the raw output in place, so a format change upstream never loses data.
+func (a *InlineAgent) postProcessResult(toolName string, result *ToolResult) {
+	name, processor := a.resultProcessorFor(toolName)
+	if processor == nil || result.IsError {
+		return
+	}
+
+	for i, block := range result.Content {
+		if block.Type != "" && block.Type != "text" {
+			continue
+		}
+		processed, err := processor(toolName, block.Text)
+		if err != nil {
+			log.Printf("Result processor %s failed for tool %s, keeping raw output: %v", name, toolName, err)
+			continue
+		}
+		log.Printf("Result processor %s reduced %s output from %d to %d bytes", name, toolName, len(block.Text), len(processed))
+		result.Content[i].Text = processed
+	}
+}
+
+// CompactJSONProcessor strips insignificant whitespace from JSON output, leaving numbers
+// exactly as written
+func CompactJSONProcessor(toolName, text string) (string, error) {
+	var out bytes.Buffer
+	if err := json.Compact(&out, []byte(text)); err != nil {
+		return "", fmt.Errorf("output is not JSON: %w", err)
+	}
+	return out.String(), nil
+}
+
+// MarkdownTableProcessor renders a JSON list of objects as a markdown table. The list may
+// be the whole output or the only list-valued field of an object, as in {"clusters": [...]};
+// the object's other scalar fields are kept as lines above the table.
+func MarkdownTableProcessor(toolName, text string) (string, error) {
+	var v interface{}
+	if err := mcpclient.UnmarshalJSONNumbers([]byte(text), &v); err != nil {
+		return "", fmt.Errorf("output is not JSON: %w", err)
+	}
+
+	var header []string
+	rows, ok := v.([]interface{})
+	if obj, isObj := v.(map[string]interface{}); isObj {
+		listKey := ""
+		for key, value := range obj {
+			if _, isList := value.([]interface{}); isList {
+				if listKey != "" {
+					return "", fmt.Errorf("output has more than one list")
+				}
+				listKey = key
+			}
+		}
+		if listKey == "" {
+			return "", fmt.Errorf("output has no list to tabulate")
+		}
+		rows, ok = obj[listKey].([]interface{})
+
+		keys := sortedKeys(obj)
+		for _, key := range keys {
+			if key != listKey {
+				header = append(header, fmt.Sprintf("%s: %s", key, tableCell(obj[key])))
+			}
+		}
+		header = append(header, fmt.Sprintf("%s (%d):", listKey, len(rows)))
+	}
+	if !ok {
+		return "", fmt.Errorf("output is not a list")
+	}
+
+	// Columns are the union of row keys, in first-seen order after sorting each row
+	var columns []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		obj, ok := row.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("list items are not objects")
+		}
+		for _, key := range sortedKeys(obj) {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range header {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	if len(rows) == 0 {
+		b.WriteString("(none)\n")
+		return b.String(), nil
+	}
+
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, row := range rows {
+		obj := row.(map[string]interface{})
+		cells := make([]string, len(columns))
+		for i, col := range columns {
+			if value, ok := obj[col]; ok {
+				cells[i] = tableCell(value)
+			}
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	return b.String(), nil
+}
+
+// tableCell formats a value for a markdown table cell, compacting nested values
+func tableCell(v interface{}) string {
+	var s string
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = value
+	case map[string]interface{}, []interface{}:
+		out, _ := json.Marshal(value)
+		s = string(out)
+	default:
+		s = fmt.Sprint(value)
+	}
+
+	s = strings.ReplaceAll(s, "\n", " ")
+	s = strings.ReplaceAll(s, "|", `\|`)
+	if len(s) > maxTableCell {
+		s = truncateUTF8(s, maxTableCell-3) + "..."
+	}
+	return s
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// prefetchToolUsePrefix starts the toolUseId of prefetched calls in traces and server logs
+const prefetchToolUsePrefix = "prefetch-"
+
+// PrefetchRule runs a read-only tool ahead of the model when the user's message suggests the
+// model will ask for it
+type PrefetchRule struct {
+	// Tool is the tool to run and Arguments its input; the result is only used for a model
+	// call with the same arguments
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	// Keywords match the user's message case-insensitively; any one is enough
+	Keywords []string `json:"keywords"`
+	// Pattern is a regular expression matching the user's message, as an alternative to keywords
+	Pattern string `json:"pattern"`
+	// Examples are messages the rule is meant for; the user's message matches when the cosine
+	// similarity of its embedding to any example's reaches Threshold. They need the
+	// ToolPrefetch's Embed.
+	Examples  []string `json:"examples"`
+	Threshold float64  `json:"threshold"`
+
+	pattern  *regexp.Regexp
+	examples [][]float64
+}
+
+// defaultPrefetchThreshold is the similarity an example rule needs when it sets no threshold
+const defaultPrefetchThreshold = 0.8
+
+// Embedder returns the embedding vector of text
+type Embedder func(ctx context.Context, text string) ([]float64, error)
+
+// matches reports whether the rule applies to a user message
+func (r *PrefetchRule) matches(message string) bool {
+	lower := strings.ToLower(message)
+	for _, keyword := range r.Keywords {
+		if keyword != "" && strings.Contains(lower, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return r.pattern != nil && r.pattern.MatchString(message)
+}
+
+// similar reports whether an embedded user message is close enough to one of the rule's examples
+func (r *PrefetchRule) similar(embedding []float64) bool {
+	threshold := r.Threshold
+	if threshold == 0 {
+		threshold = defaultPrefetchThreshold
+	}
+	for _, example := range r.examples {
+		if cosineSimilarity(embedding, example) >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// cosineSimilarity of two vectors, or 0 if their lengths differ or either is zero
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// ToolPrefetch starts configured read-only tools in parallel with the first model call when
+// the user's message matches their rules, so the common "list first, then answer" path
+// doesn't wait a full tool round trip. A prefetched result is used only if the model calls
+// the tool with the same arguments and the call passes quotas, policy and approval; otherwise
+// it is discarded. Only tools annotated with readOnlyHint true are prefetched, and only
+// when quotas and policy would allow the call; invocations that ask for approval of tool
+// calls prefetch nothing.
+//
+// Rules with examples are matched once Embed returns the message's embedding, which runs
+// alongside the model call too; a model tool call made before then is simply called live.
+type ToolPrefetch struct {
+	Rules []PrefetchRule
+	// Embed embeds user messages and rule examples; rules with examples are skipped without it
+	Embed Embedder
+
+	examplesMu sync.Mutex
+}
+
+// NewToolPrefetch validates rules and compiles their patterns
+func NewToolPrefetch(rules []PrefetchRule) (*ToolPrefetch, error) {
+	p := &ToolPrefetch{}
+	for _, rule := range rules {
+		if rule.Tool == "" {
+			return nil, fmt.Errorf("prefetch rule without a tool")
+		}
+		if len(rule.Keywords) == 0 && rule.Pattern == "" && len(rule.Examples) == 0 {
+			return nil, fmt.Errorf("prefetch rule for %s has no keywords, pattern or examples", rule.Tool)
+		}
+		if rule.Threshold < 0 || rule.Threshold > 1 {
+			return nil, fmt.Errorf("prefetch threshold for %s must be between 0 and 1", rule.Tool)
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid prefetch pattern %q: %w", rule.Pattern, err)
+			}
+			rule.pattern = re
+		}
+		if rule.Arguments == nil {
+			rule.Arguments = map[string]interface{}{}
+		}
+		p.Rules = append(p.Rules, rule)
+	}
+	return p, nil
+}
+
+// LoadPrefetchRules reads a JSON list of prefetch rules, each with "tool", "arguments",
+// "keywords", "pattern", "examples" and "threshold"
+func LoadPrefetchRules(path string) ([]PrefetchRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prefetch rules file: %w", err)
+	}
+	var rules []PrefetchRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse prefetch rules file: %w", err)
+	}
+	return rules, nil
+}
+
+// prefetchedCall is a tool call started ahead of the model
+type prefetchedCall struct {
+	tool string
+	key  string
+	done chan struct{}
+
+	result map[string]interface{}
+	err    error
+}
+
+// prefetchedCalls are an invocation's prefetched calls not yet used
+type prefetchedCalls struct {
+	mu    sync.Mutex
+	calls []*prefetchedCall
+}
+
+// start runs the tools whose rules match message and are among tools, with run, which
+// executes a tool use like prefetchToolUse. A nil prefetch starts nothing.
+func (p *ToolPrefetch) start(ctx context.Context, message string, tools []Tool, run func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error)) *prefetchedCalls {
+	if p == nil {
+		return nil
+	}
+	offered := make(map[string]Tool, len(tools))
+	for _, tool := range tools {
+		offered[tool.Name] = tool
+	}
+
+	pending := &prefetchedCalls{}
+	var bySimilarity []int
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if _, ok := offered[rule.Tool]; !ok {
+			continue
+		}
+		if rule.matches(message) {
+			pending.launch(ctx, i, rule, offered[rule.Tool], run)
+		} else if len(rule.Examples) > 0 && p.Embed != nil {
+			bySimilarity = append(bySimilarity, i)
+		}
+	}
+
+	if len(bySimilarity) > 0 {
+		go func() {
+			if err := p.embedExamples(ctx); err != nil {
+				logf(ctx, "Failed to embed prefetch examples: %v", err)
+				return
+			}
+			embedding, err := p.Embed(ctx, message)
+			if err != nil {
+				logf(ctx, "Failed to embed message for prefetch: %v", err)
+				return
+			}
+			for _, i := range bySimilarity {
+				rule := &p.Rules[i]
+				if rule.similar(embedding) {
+					pending.launch(ctx, i, rule, offered[rule.Tool], run)
+				}
+			}
+		}()
+	}
+	return pending
+}
+
+// embedExamples embeds the rules' examples the first time they are needed
+func (p *ToolPrefetch) embedExamples(ctx context.Context) error {
+	p.examplesMu.Lock()
+	defer p.examplesMu.Unlock()
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if len(rule.examples) == len(rule.Examples) {
+			continue
+		}
+		examples := make([][]float64, 0, len(rule.Examples))
+		for _, example := range rule.Examples {
+			embedding, err := p.Embed(ctx, example)
+			if err != nil {
+				return fmt.Errorf("failed to embed example for %s: %w", rule.Tool, err)
+			}
+			examples = append(examples, embedding)
+		}
+		rule.examples = examples
+	}
+	return nil
+}
+
+// launch runs rule's tool with run and adds the call to c, unless the tool isn't read-only
+func (c *prefetchedCalls) launch(ctx context.Context, index int, rule *PrefetchRule, tool Tool, run func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error)) {
+	if readOnly, _ := tool.Annotations["readOnlyHint"].(bool); !readOnly {
+		log.Printf("Not prefetching %s: the tool doesn't declare readOnlyHint", rule.Tool)
+		return
+	}
+	key, err := canonicalHash(rule.Arguments)
+	if err != nil {
+		return
+	}
+
+	call := &prefetchedCall{tool: rule.Tool, key: key, done: make(chan struct{})}
+	c.mu.Lock()
+	c.calls = append(c.calls, call)
+	c.mu.Unlock()
+	toolUse := map[string]interface{}{
+		"toolUseId": fmt.Sprintf("%s%d", prefetchToolUsePrefix, index),
+		"name":      rule.Tool,
+		"input":     rule.Arguments,
+	}
+	go func() {
+		defer close(call.done)
+		call.result, call.err = run(ctx, toolUse)
+	}()
+}
+
+// errPrefetchRefused fails a prefetch that quotas or policy would refuse, so it never reaches
+// the server; the model's own call, if any, is refused the usual way
+var errPrefetchRefused = errors.New("refused by quota or policy")
+
+// prefetchToolUse runs a prefetched call like handleToolUse, after the quota and policy
+// checks the model's call would get. Policy decisions are traced for the model's call only.
+func (a *InlineAgent) prefetchToolUse(ctx context.Context, toolUse map[string]interface{}, sessionID string, sessionToolCalls int, tags map[string]string) (map[string]interface{}, error) {
+	name, _ := toolUse["name"].(string)
+	if a.ToolQuotas != nil && a.ToolQuotas.exceeded(name, nil, sessionToolCalls) != nil {
+		return nil, errPrefetchRefused
+	}
+	denial, err := a.evaluateToolPolicy(ctx, toolUse, sessionID, tags, func(TraceEvent) {})
+	if err != nil {
+		return nil, err
+	}
+	if denial != nil {
+		return nil, errPrefetchRefused
+	}
+	return a.handleToolUse(ctx, toolUse)
+}
+
+// take removes and returns the prefetched call matching a model's tool use, or nil
+func (c *prefetchedCalls) take(toolUse map[string]interface{}) *prefetchedCall {
+	if c == nil {
+		return nil
+	}
+	name, _ := toolUse["name"].(string)
+	key, err := canonicalHash(toolUse["input"])
+	if err != nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, call := range c.calls {
+		if call.tool == name && call.key == key {
+			c.calls = append(c.calls[:i], c.calls[i+1:]...)
+			return call
+		}
+	}
+	return nil
+}
+
+// handler answers the model's tool use with the prefetched result, waiting for it if it is
+// still running, and calls the tool with live if the prefetch failed. It gives up with the
+// context's error if ctx ends first.
+func (call *prefetchedCall) handler(live func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error)) func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+	return func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.err != nil {
+			logf(ctx, "Prefetch of %s failed, calling it again: %v", call.tool, call.err)
+			return live(ctx, toolUse)
+		}
+		result := make(map[string]interface{}, len(call.result))
+		for k, v := range call.result {
+			result[k] = v
+		}
+		result["toolUseId"] = toolUse["toolUseId"]
+		return result, nil
+	}
+}
+
+// InvokeModelAPI is the part of the Bedrock runtime client used for embeddings
+type InvokeModelAPI interface {
+	InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error)
+}
+
+// BedrockEmbedder embeds text with a Titan text embeddings model such as
+// amazon.titan-embed-text-v2:0
+func BedrockEmbedder(client InvokeModelAPI, modelID string) Embedder {
+	return func(ctx context.Context, text string) ([]float64, error) {
+		body, err := json.Marshal(map[string]interface{}{"inputText": text})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+		}
+		out, err := client.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(modelID),
+			Body:        body,
+			ContentType: aws.String("application/json"),
+			Accept:      aws.String("application/json"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("bedrock invoke model failed: %w", err)
+		}
+		var response struct {
+			Embedding []float64 `json:"embedding"`
+		}
+		if err := json.Unmarshal(out.Body, &response); err != nil {
+			return nil, fmt.Errorf("failed to parse embedding response: %w", err)
+		}
+		if len(response.Embedding) == 0 {
+			return nil, fmt.Errorf("embedding response from %s has no embedding", modelID)
+		}
+		return response.Embedding, nil
+	}
+}
+
+// NewBedrockEmbedder returns a BedrockEmbedder calling modelID with the default AWS configuration
+func NewBedrockEmbedder(ctx context.Context, modelID string) (Embedder, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return BedrockEmbedder(bedrockruntime.NewFromConfig(cfg), modelID), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/aws/smithy-go/document"
+)
+
+// ModelPreset bundles a model with its inference parameters
+type ModelPreset struct {
+	ModelID     string
+	MaxTokens   int32
+	Temperature float32
+	// ReasoningBudget enables extended thinking with this many tokens; 0 disables it
+	ReasoningBudget int
+}
+
+// ModelPresets are the named presets selectable per invocation
+var ModelPresets = map[string]ModelPreset{
+	"fast": {
+		ModelID:     "us.anthropic.claude-3-5-haiku-20241022-v1:0",
+		MaxTokens:   1024,
+		Temperature: 0.2,
+	},
+	"balanced": {
+		ModelID:     "us.anthropic.claude-3-5-sonnet-20241022-v2:0",
+		MaxTokens:   2048,
+		Temperature: 0.5,
+	},
+	"deep": {
+		ModelID:         "us.anthropic.claude-3-7-sonnet-20250219-v1:0",
+		MaxTokens:       8192,
+		ReasoningBudget: 4096,
+	},
+}
+
+// lookupPreset returns the named preset
+func lookupPreset(name string) (ModelPreset, error) {
+	preset, ok := ModelPresets[name]
+	if !ok {
+		return ModelPreset{}, fmt.Errorf("unknown model preset %q", name)
+	}
+	return preset, nil
+}
+
+// apply sets the preset's model and parameters on a Converse request
+func (p ModelPreset) apply(input *bedrockruntime.ConverseInput) error {
+	input.ModelId = aws.String(p.ModelID)
+
+	inference := &types.InferenceConfiguration{}
+	if p.MaxTokens > 0 {
+		inference.MaxTokens = aws.Int32(p.MaxTokens)
+	}
+
+	if p.ReasoningBudget > 0 {
+		// Extended thinking requires the default temperature
+		fields, err := document.NewEncoder().Encode(map[string]interface{}{
+			"thinking": map[string]interface{}{
+				"type":          "enabled",
+				"budget_tokens": p.ReasoningBudget,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode reasoning config: %w", err)
+		}
+		input.AdditionalModelRequestFields = fields
+	} else if p.Temperature > 0 {
+		inference.Temperature = aws.Float32(p.Temperature)
+	}
+
+	input.InferenceConfig = inference
+	return nil
+}
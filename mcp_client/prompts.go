@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ErrPromptNotFound is returned when a prompt name or version does not exist
+var ErrPromptNotFound = errors.New("prompt not found")
+
+// PromptTemplate is one version of a named agent instruction. Text may use text/template
+// syntax, filled in by Render.
+type PromptTemplate struct {
+	Name        string    `json:"name"`
+	Version     int       `json:"version"`
+	Text        string    `json:"text"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt,omitempty"`
+}
+
+// PromptStore holds versioned instructions. Version 0 asks for the active version: the one
+// pinned by the store's active pointer, or the highest version when none is pinned.
+// Moving the pointer rolls an instruction back without redeploying.
+type PromptStore interface {
+	Get(ctx context.Context, name string, version int) (*PromptTemplate, error)
+	Versions(ctx context.Context, name string) ([]int, error)
+}
+
+// promptNamePattern allows names that are safe as file names and DynamoDB keys
+var promptNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ParsePromptRef splits a reference such as "cluster-ops/v3" into name and version.
+// A bare name ("cluster-ops") or "cluster-ops/latest" returns version 0, the active version.
+func ParsePromptRef(ref string) (string, int, error) {
+	name, version, hasVersion := strings.Cut(strings.TrimSpace(ref), "/")
+	if !promptNamePattern.MatchString(name) {
+		return "", 0, fmt.Errorf("invalid prompt name in %q", ref)
+	}
+	if !hasVersion || version == "latest" {
+		return name, 0, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil || n < 1 {
+		return "", 0, fmt.Errorf("invalid prompt version in %q, expected v<N>", ref)
+	}
+	return name, n, nil
+}
+
+// Ref returns the reference that pins this exact version
+func (p *PromptTemplate) Ref() string {
+	return fmt.Sprintf("%s/v%d", p.Name, p.Version)
+}
+
+// Render executes the template with vars. Text without template actions is returned as-is.
+func (p *PromptTemplate) Render(vars map[string]interface{}) (string, error) {
+	if !strings.Contains(p.Text, "{{") {
+		return p.Text, nil
+	}
+
+	// {{session "name"}} is left in place for the agent to render with session variables
+	tmpl, err := template.New(p.Ref()).Option("missingkey=error").Funcs(template.FuncMap{
+		"session": func(key string) string { return fmt.Sprintf("{{session %q}}", key) },
+	}).Parse(p.Text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt %s: %w", p.Ref(), err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", p.Ref(), err)
+	}
+	return buf.String(), nil
+}
+
+// ResolvePrompt loads the prompt ref points at and renders it with vars
+func ResolvePrompt(ctx context.Context, store PromptStore, ref string, vars map[string]interface{}) (*PromptTemplate, string, error) {
+	name, version, err := ParsePromptRef(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	prompt, err := store.Get(ctx, name, version)
+	if err != nil {
+		return nil, "", err
+	}
+	text, err := prompt.Render(vars)
+	if err != nil {
+		return nil, "", err
+	}
+	return prompt, text, nil
+}
+
+// WithPrompt sets the instruction from a prompt library reference such as "cluster-ops/v3"
+func WithPrompt(ctx context.Context, store PromptStore, ref string, vars map[string]interface{}) Option {
+	return func(a *InlineAgent) error {
+		prompt, text, err := ResolvePrompt(ctx, store, ref, vars)
+		if err != nil {
+			return fmt.Errorf("failed to load prompt %s: %w", ref, err)
+		}
+		a.Instruction = text
+		a.PromptRef = prompt.Ref()
+		return nil
+	}
+}
+
+// OpenPromptStore opens a store from a location: "dynamodb://<table>" or a directory path
+func OpenPromptStore(ctx context.Context, location string) (PromptStore, error) {
+	if table, ok := strings.CutPrefix(location, "dynamodb://"); ok {
+		return NewDynamoDBPromptStore(ctx, table)
+	}
+	return NewFilePromptStore(strings.TrimPrefix(location, "file://"))
+}
+
+// FilePromptStore reads prompts from a directory laid out as <dir>/<name>/v<N>.txt.
+// An optional <dir>/<name>/active file holding a version number pins the active version.
+type FilePromptStore struct {
+	dir string
+}
+
+// NewFilePromptStore creates a store over dir
+func NewFilePromptStore(dir string) (*FilePromptStore, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open prompt directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("prompt store %s is not a directory", dir)
+	}
+	return &FilePromptStore{dir: dir}, nil
+}
+
+func (s *FilePromptStore) Get(ctx context.Context, name string, version int) (*PromptTemplate, error) {
+	if !promptNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid prompt name %q", name)
+	}
+
+	if version == 0 {
+		var err error
+		if version, err = s.activeVersion(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	path := filepath.Join(s.dir, name, fmt.Sprintf("v%d.txt", version))
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s/v%d", ErrPromptNotFound, name, version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt: %w", err)
+	}
+
+	prompt := &PromptTemplate{Name: name, Version: version, Text: strings.TrimSpace(string(data))}
+	if info, err := os.Stat(path); err == nil {
+		prompt.CreatedAt = info.ModTime()
+	}
+	return prompt, nil
+}
+
+func (s *FilePromptStore) Versions(ctx context.Context, name string) ([]int, error) {
+	if !promptNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid prompt name %q", name)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrPromptNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt versions: %w", err)
+	}
+
+	var versions []int
+	for _, entry := range entries {
+		base, ok := strings.CutSuffix(entry.Name(), ".txt")
+		if !ok || !strings.HasPrefix(base, "v") {
+			continue
+		}
+		if n, err := strconv.Atoi(base[1:]); err == nil && n > 0 {
+			versions = append(versions, n)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// activeVersion reads the active pointer, falling back to the highest version
+func (s *FilePromptStore) activeVersion(ctx context.Context, name string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name, "active"))
+	if err == nil {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(string(data)), "v"))
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid active version for prompt %s", name)
+		}
+		return n, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("failed to read active version: %w", err)
+	}
+
+	versions, err := s.Versions(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, fmt.Errorf("%w: %s has no versions", ErrPromptNotFound, name)
+	}
+	return versions[len(versions)-1], nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDBAPI is the subset of the DynamoDB client the prompt store uses
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// DynamoDBPromptStore reads prompts from a table keyed by "name" (string) and "version"
+// (number), with "text", "description" and "createdAt" (RFC 3339) attributes. The item with
+// version 0 is the active pointer: its "activeVersion" attribute pins the active version.
+type DynamoDBPromptStore struct {
+	client DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBPromptStore creates a store over table using the default AWS config
+func NewDynamoDBPromptStore(ctx context.Context, table string) (*DynamoDBPromptStore, error) {
+	if table == "" {
+		return nil, fmt.Errorf("a DynamoDB table name is required")
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return NewDynamoDBPromptStoreWithClient(dynamodb.NewFromConfig(cfg), table), nil
+}
+
+// NewDynamoDBPromptStoreWithClient creates a store using client, e.g. a stub in tests
+func NewDynamoDBPromptStoreWithClient(client DynamoDBAPI, table string) *DynamoDBPromptStore {
+	return &DynamoDBPromptStore{client: client, table: table}
+}
+
+func (s *DynamoDBPromptStore) Get(ctx context.Context, name string, version int) (*PromptTemplate, error) {
+	if version == 0 {
+		var err error
+		if version, err = s.activeVersion(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	item, err := s.getItem(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, fmt.Errorf("%w: %s/v%d", ErrPromptNotFound, name, version)
+	}
+
+	prompt := &PromptTemplate{
+		Name:        name,
+		Version:     version,
+		Text:        stringAttr(item, "text"),
+		Description: stringAttr(item, "description"),
+	}
+	if created := stringAttr(item, "createdAt"); created != "" {
+		prompt.CreatedAt, _ = time.Parse(time.RFC3339, created)
+	}
+	return prompt, nil
+}
+
+func (s *DynamoDBPromptStore) Versions(ctx context.Context, name string) ([]int, error) {
+	var versions []int
+	var startKey map[string]dbtypes.AttributeValue
+
+	for {
+		out, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table),
+			KeyConditionExpression: aws.String("#n = :name AND #v > :zero"),
+			ExpressionAttributeNames: map[string]string{
+				"#n": "name",
+				"#v": "version",
+			},
+			ExpressionAttributeValues: map[string]dbtypes.AttributeValue{
+				":name": &dbtypes.AttributeValueMemberS{Value: name},
+				":zero": &dbtypes.AttributeValueMemberN{Value: "0"},
+			},
+			ProjectionExpression: aws.String("#v"),
+			ExclusiveStartKey:    startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query prompt versions: %w", err)
+		}
+
+		for _, item := range out.Items {
+			if n, ok := numberAttr(item, "version"); ok {
+				versions = append(versions, n)
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPromptNotFound, name)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// activeVersion reads the version 0 pointer item, falling back to the highest version
+func (s *DynamoDBPromptStore) activeVersion(ctx context.Context, name string) (int, error) {
+	pointer, err := s.getItem(ctx, name, 0)
+	if err != nil {
+		return 0, err
+	}
+	if pointer != nil {
+		if n, ok := numberAttr(pointer, "activeVersion"); ok && n > 0 {
+			return n, nil
+		}
+	}
+
+	versions, err := s.Versions(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// getItem returns the item for name and version, or nil when it doesn't exist
+func (s *DynamoDBPromptStore) getItem(ctx context.Context, name string, version int) (map[string]dbtypes.AttributeValue, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]dbtypes.AttributeValue{
+			"name":    &dbtypes.AttributeValueMemberS{Value: name},
+			"version": &dbtypes.AttributeValueMemberN{Value: strconv.Itoa(version)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt %s/v%d: %w", name, version, err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	return out.Item, nil
+}
+
+func stringAttr(item map[string]dbtypes.AttributeValue, key string) string {
+	if v, ok := item[key].(*dbtypes.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func numberAttr(item map[string]dbtypes.AttributeValue, key string) (int, bool) {
+	v, ok := item[key].(*dbtypes.AttributeValueMemberN)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v.Value)
+	return n, err == nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// statusQuotaExceeded marks tool calls refused by a quota; they don't count against later limits
+const statusQuotaExceeded = "quota_exceeded"
+
+// ToolQuotas cap how often the model may call tools. Zero values mean no limit.
+type ToolQuotas struct {
+	// PerTool caps calls to each named tool within one invocation
+	PerTool map[string]int
+	// MaxPerInvocation caps tool calls within one invocation
+	MaxPerInvocation int
+	// MaxPerSession caps tool calls across all invocations of a session
+	MaxPerSession int
+}
+
+// quotaRefusal describes an exceeded quota to the model
+type quotaRefusal struct {
+	Error   string `json:"error"`
+	Tool    string `json:"tool"`
+	Scope   string `json:"scope"`
+	Limit   int    `json:"limit"`
+	Message string `json:"message"`
+}
+
+// exceeded returns the refusal for calling name, or nil if the call is within quota.
+// invocationCalls are the calls made so far in this invocation; sessionCalls counts earlier invocations.
+func (q *ToolQuotas) exceeded(name string, invocationCalls []ToolCallRecord, sessionCalls int) *quotaRefusal {
+	total, sameTool := 0, 0
+	for _, call := range invocationCalls {
+		if call.Status == statusQuotaExceeded {
+			continue
+		}
+		total++
+		if call.Name == name {
+			sameTool++
+		}
+	}
+
+	refuse := func(scope string, limit int) *quotaRefusal {
+		return &quotaRefusal{
+			Error: "quota_exceeded",
+			Tool:  name,
+			Scope: scope,
+			Limit: limit,
+			Message: fmt.Sprintf("The %s limit of %d tool calls has been reached. Do not call tools again; "+
+				"answer with the information you already have and say what is missing.", scope, limit),
+		}
+	}
+
+	if limit, ok := q.PerTool[name]; ok && sameTool >= limit {
+		r := refuse("per-tool", limit)
+		r.Message = fmt.Sprintf("%s may be called at most %d times per request. Do not call it again; "+
+			"answer with the information you already have.", name, limit)
+		return r
+	}
+	if q.MaxPerInvocation > 0 && total >= q.MaxPerInvocation {
+		return refuse("per-request", q.MaxPerInvocation)
+	}
+	if q.MaxPerSession > 0 && sessionCalls+total >= q.MaxPerSession {
+		return refuse("per-session", q.MaxPerSession)
+	}
+	return nil
+}
+
+// handler returns a tool handler that answers with the refusal instead of running the tool
+func (r *quotaRefusal) handler() func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+	return func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+		body, err := json.Marshal(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal quota refusal: %w", err)
+		}
+		return map[string]interface{}{
+			"toolUseId": toolUse["toolUseId"],
+			"content": []map[string]interface{}{
+				{"text": string(body)},
+			},
+			"status": statusQuotaExceeded,
+		}, nil
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// ReplayReport describes how the current agent implementation compares against a recorded transcript
+type ReplayReport struct {
+	SessionID string       `json:"sessionId"`
+	Steps     []ReplayStep `json:"steps"`
+	Matched   bool         `json:"matched"`
+}
+
+// ReplayStep is one model call made during replay
+type ReplayStep struct {
+	Index   int    `json:"index"`
+	Matched bool   `json:"matched"`
+	Diff    string `json:"diff,omitempty"`
+}
+
+// replayModel stands in for Bedrock: it returns the recorded assistant messages in order and
+// captures every payload the agent sends so it can be compared with the recording.
+type replayModel struct {
+	responses []types.Message
+	expected  [][]TranscriptMessage
+	steps     []ReplayStep
+}
+
+func (m *replayModel) Converse(ctx context.Context, params *bedrockruntime.ConverseInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ConverseOutput, error) {
+	index := len(m.steps)
+	if index >= len(m.responses) {
+		return nil, fmt.Errorf("replay: model called %d times but the transcript only recorded %d responses", index+1, len(m.responses))
+	}
+
+	actual := make([]TranscriptMessage, 0, len(params.Messages))
+	for _, msg := range params.Messages {
+		m, err := toTranscriptMessage(msg)
+		if err != nil {
+			return nil, fmt.Errorf("replay: %w", err)
+		}
+		actual = append(actual, m)
+	}
+
+	diff, err := diffPayloads(m.expected[index], actual)
+	if err != nil {
+		return nil, err
+	}
+	m.steps = append(m.steps, ReplayStep{Index: index, Matched: diff == "", Diff: diff})
+
+	response := m.responses[index]
+	return &bedrockruntime.ConverseOutput{
+		Output: &types.ConverseOutput{Message: &response},
+	}, nil
+}
+
+// Replay re-runs a transcript through the agent's current tool loop. Recorded user turns are fed
+// in again, the model is replaced by the recorded assistant responses and tools return their
+// recorded results, so no live calls are made. Every payload the agent would send to the model is
+// diffed against what was sent when the transcript was recorded.
+func (a *InlineAgent) Replay(data []byte) (*ReplayReport, error) {
+	var transcript Transcript
+	if err := mcpclient.UnmarshalJSONNumbers(data, &transcript); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transcript: %w", err)
+	}
+
+	model := &replayModel{}
+	toolResults := make(map[string]TranscriptContent)
+	var userTurns []string
+
+	for i, msg := range transcript.Messages {
+		switch msg.Role {
+		case string(types.ConversationRoleAssistant):
+			m, err := fromTranscriptMessage(msg)
+			if err != nil {
+				return nil, err
+			}
+			model.responses = append(model.responses, m)
+			model.expected = append(model.expected, transcript.Messages[:i])
+		case string(types.ConversationRoleUser):
+			for _, content := range msg.Content {
+				switch content.Type {
+				case "text":
+					userTurns = append(userTurns, content.Text)
+				case "toolResult":
+					toolResults[content.ToolUseID] = content
+				}
+			}
+		}
+	}
+
+	replayAgent := a.withToolHandler(func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+		toolUseID, _ := toolUse["toolUseId"].(string)
+		recorded, ok := toolResults[toolUseID]
+		if !ok {
+			return nil, fmt.Errorf("replay: no recorded result for tool use %s", toolUseID)
+		}
+		status := recorded.Status
+		if status == "" {
+			status = "success"
+		}
+		// Recorded documents go back in toolResultContent's shape so the agent rebuilds them
+		content := []map[string]interface{}{{"text": recorded.Text}}
+		for _, c := range recorded.Content {
+			if c.Type == "document" {
+				content = append(content, map[string]interface{}{
+					"document": map[string]interface{}{
+						"format": c.Format,
+						"name":   c.Name,
+						"source": map[string]interface{}{"bytes": c.Bytes},
+					},
+				})
+			}
+		}
+		return map[string]interface{}{
+			"toolUseId": toolUseID,
+			"content":   content,
+			"status":    status,
+		}, nil
+	})
+	replayAgent.bedrockClient = model
+	replayAgent.TraceSink = nil
+	// The recording stands in for every live call, so knowledge base retrieval, hedged model
+	// requests and the MCP handshakes of lazily initialized action groups are all off
+	replayAgent.KnowledgeBases = nil
+	replayAgent.retrieveClient = nil
+	replayAgent.Hedging = nil
+	for i := range replayAgent.ActionGroups {
+		replayAgent.ActionGroups[i].lazy = nil
+	}
+
+	sessionID := "replay-" + transcript.SessionID
+	for _, turn := range userTurns {
+		if _, err := replayAgent.InvokeSession(sessionID, turn); err != nil {
+			return nil, fmt.Errorf("replay failed after %d model calls: %w", len(model.steps), err)
+		}
+	}
+
+	report := &ReplayReport{
+		SessionID: transcript.SessionID,
+		Steps:     model.steps,
+		Matched:   len(model.steps) == len(model.responses),
+	}
+	for _, step := range model.steps {
+		if !step.Matched {
+			report.Matched = false
+		}
+	}
+
+	return report, nil
+}
+
+// diffPayloads returns a line diff of the two payloads as indented JSON, or "" if they are equal
+func diffPayloads(expected, actual []TranscriptMessage) (string, error) {
+	expectedJSON, err := json.MarshalIndent(expected, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal expected payload: %w", err)
+	}
+	actualJSON, err := json.MarshalIndent(actual, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal actual payload: %w", err)
+	}
+	if string(expectedJSON) == string(actualJSON) {
+		return "", nil
+	}
+
+	return diffLines(strings.Split(string(expectedJSON), "\n"), strings.Split(string(actualJSON), "\n")), nil
+}
+
+// diffLines renders a minimal line diff based on the longest common subsequence
+func diffLines(a, b []string) string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			fmt.Fprintf(&out, "- %s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(&out, "+ %s\n", b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		fmt.Fprintf(&out, "- %s\n", a[i])
+	}
+	for ; j < len(b); j++ {
+		fmt.Fprintf(&out, "+ %s\n", b[j])
+	}
+
+	return out.String()
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// BalanceStrategy selects how a ReplicaSet spreads tool calls over its replicas
+type BalanceStrategy string
+
+const (
+	// BalanceRoundRobin rotates through healthy replicas, weighted by observed latency
+	BalanceRoundRobin BalanceStrategy = "round_robin"
+	// BalanceLeastOutstanding picks the replica with the fewest in-flight calls, scaled by latency
+	BalanceLeastOutstanding BalanceStrategy = "least_outstanding"
+)
+
+// latencySmoothing is the weight of the newest sample in a replica's latency average
+const latencySmoothing = 0.2
+
+// ReplicaSet is one logical MCP server backed by several identical replicas. It implements
+// MCPCaller, so it can be placed in an ActionGroup in place of a single client.
+type ReplicaSet struct {
+	Name     string
+	Strategy BalanceStrategy
+	// UnhealthyAfter consecutive failures take a replica out of rotation for Cooldown
+	UnhealthyAfter int
+	Cooldown       time.Duration
+
+	mu       sync.Mutex
+	replicas []*replica
+}
+
+// replica tracks the health and load of one member of a ReplicaSet
+type replica struct {
+	caller      MCPCaller
+	outstanding int
+	latency     time.Duration // moving average of successful calls
+	failures    int           // consecutive failures
+	downUntil   time.Time
+	current     float64 // smooth weighted round-robin state
+}
+
+// NewReplicaSet creates a replica set over callers that all serve the same tools
+func NewReplicaSet(name string, strategy BalanceStrategy, callers ...MCPCaller) *ReplicaSet {
+	set := &ReplicaSet{
+		Name:           name,
+		Strategy:       strategy,
+		UnhealthyAfter: 3,
+		Cooldown:       30 * time.Second,
+	}
+	for _, c := range callers {
+		set.replicas = append(set.replicas, &replica{caller: c})
+	}
+	return set
+}
+
+// NewHTTPReplicaSet creates a replica set of MCPClients, one per URL
+func NewHTTPReplicaSet(name string, strategy BalanceStrategy, urls ...string) *ReplicaSet {
+	callers := make([]MCPCaller, len(urls))
+	for i, url := range urls {
+		callers[i] = mcpclient.New(strings.TrimSpace(url))
+	}
+	return NewReplicaSet(name, strategy, callers...)
+}
+
+// Replicas returns the underlying callers, e.g. to configure their transports
+func (s *ReplicaSet) Replicas() []MCPCaller {
+	callers := make([]MCPCaller, len(s.replicas))
+	for i, r := range s.replicas {
+		callers[i] = r.caller
+	}
+	return callers
+}
+
+// Initialize initializes every replica. It succeeds as long as one replica is up;
+// the others are taken out of rotation until their cooldown expires.
+func (s *ReplicaSet) Initialize(ctx context.Context) error {
+	if len(s.replicas) == 0 {
+		return fmt.Errorf("replica set %s has no replicas", s.Name)
+	}
+
+	var errs []error
+	for _, r := range s.replicas {
+		if err := r.caller.Initialize(ctx); err != nil {
+			log.Printf("Replica %s of %s failed to initialize: %v", callerName(r.caller), s.Name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", callerName(r.caller), err))
+			s.markDown(r)
+		}
+	}
+
+	if len(errs) == len(s.replicas) {
+		return fmt.Errorf("no replica of %s initialized: %w", s.Name, errors.Join(errs...))
+	}
+	return nil
+}
+
+// ListTools lists tools from one healthy replica; replicas are assumed to serve the same tools
+func (s *ReplicaSet) ListTools(ctx context.Context) ([]Tool, error) {
+	r := s.pick()
+	start := time.Now()
+	tools, err := r.caller.ListTools(ctx)
+	s.done(r, time.Since(start), err)
+	return tools, err
+}
+
+// CallTool sends the call to the replica chosen by the set's strategy. Calls are not
+// retried on another replica, since tools are not assumed to be idempotent.
+func (s *ReplicaSet) CallTool(ctx context.Context, toolCall ToolCall) (*ToolResult, error) {
+	r := s.pick()
+	start := time.Now()
+	result, err := r.caller.CallTool(ctx, toolCall)
+	s.done(r, time.Since(start), err)
+	if err != nil {
+		return nil, fmt.Errorf("replica %s: %w", callerName(r.caller), err)
+	}
+	return result, nil
+}
+
+// Close closes every replica
+func (s *ReplicaSet) Close(ctx context.Context) error {
+	var errs []error
+	for _, r := range s.replicas {
+		if err := r.caller.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close replica %s: %w", callerName(r.caller), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pick chooses a replica and counts the call as outstanding on it
+func (s *ReplicaSet) pick() *replica {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var healthy []*replica
+	for _, r := range s.replicas {
+		if !now.Before(r.downUntil) {
+			healthy = append(healthy, r)
+		}
+	}
+
+	var chosen *replica
+	if len(healthy) == 0 {
+		// Everything is down; try the replica that has been out the longest
+		for _, r := range s.replicas {
+			if chosen == nil || r.downUntil.Before(chosen.downUntil) {
+				chosen = r
+			}
+		}
+	} else if s.Strategy == BalanceLeastOutstanding {
+		best := 0.0
+		for _, r := range healthy {
+			score := float64(r.outstanding+1) / r.weight()
+			if chosen == nil || score < best {
+				chosen, best = r, score
+			}
+		}
+	} else {
+		// Smooth weighted round-robin: faster replicas get proportionally more calls
+		// without being picked in bursts
+		total := 0.0
+		for _, r := range healthy {
+			w := r.weight()
+			r.current += w
+			total += w
+			if chosen == nil || r.current > chosen.current {
+				chosen = r
+			}
+		}
+		chosen.current -= total
+	}
+
+	chosen.outstanding++
+	return chosen
+}
+
+// done records the outcome of a call started by pick
+func (s *ReplicaSet) done(r *replica, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.outstanding--
+	if err != nil {
+		r.failures++
+		if s.UnhealthyAfter > 0 && r.failures >= s.UnhealthyAfter {
+			r.downUntil = time.Now().Add(s.Cooldown)
+			log.Printf("Replica %s of %s marked unhealthy after %d failures", callerName(r.caller), s.Name, r.failures)
+		}
+		return
+	}
+
+	r.failures = 0
+	r.downUntil = time.Time{}
+	if r.latency == 0 {
+		r.latency = latency
+	} else {
+		r.latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(r.latency))
+	}
+}
+
+// markDown takes a replica out of rotation for the cooldown period
+func (s *ReplicaSet) markDown(r *replica) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.failures = s.UnhealthyAfter
+	r.downUntil = time.Now().Add(s.Cooldown)
+}
+
+// weight is inversely proportional to the replica's average latency. Replicas without
+// samples yet get the weight of a 1ms replica so they are tried early.
+func (r *replica) weight() float64 {
+	latency := r.latency
+	if latency < time.Millisecond {
+		latency = time.Millisecond
+	}
+	return float64(time.Second) / float64(latency)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// ResponseFormat is the markup a response policy asks answers to use
+type ResponseFormat string
+
+const (
+	FormatMarkdown  ResponseFormat = "markdown"
+	FormatPlainText ResponseFormat = "plain"
+)
+
+// ResponsePolicy keeps answers consistent across product surfaces. Every field is added to
+// the system prompt; format and length are also enforced on the final answer, since models
+// don't reliably follow them. Language and tone are only prompted for.
+type ResponsePolicy struct {
+	// Language is the language to answer in, e.g. "German"; empty answers in the user's
+	Language string `json:"language,omitempty"`
+	// Tone describes the register, e.g. "friendly and concise"
+	Tone string `json:"tone,omitempty"`
+	// MaxLength caps the answer in characters, cut at a sentence or word boundary; 0 doesn't
+	MaxLength int `json:"maxLength,omitempty"`
+	// Format is markdown or plain; plain text answers have their markdown stripped
+	Format ResponseFormat `json:"format,omitempty"`
+}
+
+// ParseResponsePolicy reads a policy from JSON such as {"language": "German", "format": "plain"}
+func ParseResponsePolicy(data []byte) (*ResponsePolicy, error) {
+	var policy ResponsePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse response policy: %w", err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (p *ResponsePolicy) validate() error {
+	switch p.Format {
+	case "", FormatMarkdown, FormatPlainText:
+	default:
+		return fmt.Errorf("unknown response format %q", p.Format)
+	}
+	if p.MaxLength < 0 {
+		return fmt.Errorf("response max length must not be negative")
+	}
+	return nil
+}
+
+// instruction returns the system prompt fragment for the policy, or "" when it asks nothing
+func (p *ResponsePolicy) instruction() string {
+	var rules []string
+	if p.Language != "" {
+		rules = append(rules, fmt.Sprintf("Always answer in %s, whatever language the user or the tool results use.", p.Language))
+	}
+	if p.Tone != "" {
+		rules = append(rules, fmt.Sprintf("Use a %s tone.", p.Tone))
+	}
+	switch p.Format {
+	case FormatMarkdown:
+		rules = append(rules, "Format answers as Markdown.")
+	case FormatPlainText:
+		rules = append(rules, "Answer in plain text without any Markdown: no headings, emphasis, code blocks, tables or links syntax.")
+	}
+	if p.MaxLength > 0 {
+		rules = append(rules, fmt.Sprintf("Keep answers under %d characters.", p.MaxLength))
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	return "Response requirements:\n- " + strings.Join(rules, "\n- ")
+}
+
+var (
+	markdownFence    = regexp.MustCompile("(?m)^\\s*```[^\\n]*\\n?")
+	markdownHeading  = regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+`)
+	markdownQuote    = regexp.MustCompile(`(?m)^\s{0,3}>\s?`)
+	markdownRule     = regexp.MustCompile(`(?m)^\s{0,3}([-*_]\s*){3,}$`)
+	markdownImage    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	markdownStrong   = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	markdownEmphasis = regexp.MustCompile(`(^|[^\w*])\*(\S(?:[^*]*?\S)?)\*`)
+	markdownCode     = regexp.MustCompile("`([^`]+)`")
+	markdownTableSep = regexp.MustCompile(`(?m)^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$\n?`)
+)
+
+// stripMarkdown rewrites Markdown as plain text, keeping link targets and list bullets
+func stripMarkdown(text string) string {
+	text = markdownFence.ReplaceAllString(text, "")
+	text = markdownTableSep.ReplaceAllString(text, "")
+	text = markdownRule.ReplaceAllString(text, "")
+	text = markdownHeading.ReplaceAllString(text, "")
+	text = markdownQuote.ReplaceAllString(text, "")
+	text = markdownImage.ReplaceAllString(text, "$1")
+	text = markdownLink.ReplaceAllString(text, "$1 ($2)")
+	text = markdownStrong.ReplaceAllString(text, "$2")
+	text = markdownEmphasis.ReplaceAllString(text, "$1$2")
+	text = markdownCode.ReplaceAllString(text, "$1")
+	return text
+}
+
+// shorten cuts text to at most max characters, at the last sentence end or else the last
+// word boundary in the second half, and marks the cut with an ellipsis
+func shorten(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	cut := runes[:max-1]
+	end := len(cut)
+	for i := len(cut) - 1; i >= len(cut)/2; i-- {
+		if strings.ContainsRune(".!?", cut[i]) && (i+1 == len(cut) || unicode.IsSpace(cut[i+1])) {
+			return string(cut[:i+1])
+		}
+	}
+	for i := len(cut) - 1; i >= len(cut)/2; i-- {
+		if unicode.IsSpace(cut[i]) {
+			end = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(cut[:end]), unicode.IsSpace) + "…"
+}
+
+// Apply enforces the policy's format and length on an answer, returning the changed text
+// and the rules that changed it
+func (p *ResponsePolicy) Apply(text string) (string, []string) {
+	var fixes []string
+	if p.Format == FormatPlainText {
+		if plain := stripMarkdown(text); plain != text {
+			text = plain
+			fixes = append(fixes, "plain_text")
+		}
+	}
+	if p.MaxLength > 0 {
+		if short := shorten(text, p.MaxLength); short != text {
+			text = short
+			fixes = append(fixes, "max_length")
+		}
+	}
+	return text, fixes
+}
+
+// responsePolicy returns the invocation's policy: its own, else the agent's, else nil
+func (a *InlineAgent) responsePolicy(opts InvokeOptions) *ResponsePolicy {
+	if opts.ResponsePolicy != nil {
+		return opts.ResponsePolicy
+	}
+	return a.ResponsePolicy
+}
+
+// applyResponsePolicy enforces policy on the final answer and, when it changed the text,
+// rewrites the last assistant message so the session keeps what the user was shown
+func applyResponsePolicy(policy *ResponsePolicy, text string, messages []types.Message, sessionID string, emit func(TraceEvent)) string {
+	if policy == nil {
+		return text
+	}
+	fixed, fixes := policy.Apply(text)
+	if len(fixes) == 0 {
+		return text
+	}
+	emit(TraceEvent{
+		Type:      TraceResponsePolicy,
+		SessionID: sessionID,
+		Data:      map[string]interface{}{"fixes": fixes},
+	})
+	if len(messages) > 0 {
+		last := &messages[len(messages)-1]
+		last.Content = []types.ContentBlock{
+			&types.ContentBlockMemberText{Value: fixed},
+		}
+	}
+	return fixed
+}
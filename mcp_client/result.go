@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// Result is the outcome of a single Invoke call
+type Result struct {
+	Text          string           `json:"text"`
+	Usage         Usage            `json:"usage"`
+	ToolCalls     []ToolCallRecord `json:"toolCalls"`
+	ModelLatency  time.Duration    `json:"modelLatency"`
+	TotalLatency  time.Duration    `json:"totalLatency"`
+	EstimatedCost float64          `json:"estimatedCost"`
+	// Citations are the knowledge base passages the answer cites
+	Citations []Citation `json:"citations,omitempty"`
+	// StopReason is why the final model call stopped, e.g. end_turn, or max_tokens when the
+	// answer was cut off
+	StopReason types.StopReason `json:"stopReason"`
+	// LatencyMs is the model latency Bedrock reported, summed over the invocation's model calls
+	LatencyMs int64 `json:"latencyMs"`
+	// Degraded is set when tools kept failing and the model was told to answer from its own
+	// knowledge, so the answer is unverified
+	Degraded bool `json:"degraded,omitempty"`
+	// Flags list what may make the answer less complete or reliable, e.g. tool errors or
+	// compaction, in the order they first happened
+	Flags []ResultFlag `json:"flags,omitempty"`
+	// CorrelationID identifies the invocation in logs, traces and audit records
+	CorrelationID string `json:"correlationId,omitempty"`
+	// Audio is the audio tool calls returned, for the caller to play back
+	Audio []AudioContent `json:"audio,omitempty"`
+}
+
+// Truncated reports whether the answer was cut off by the token limit, so the caller can
+// retry with a higher MaxTokens
+func (r *Result) Truncated() bool {
+	return r.StopReason == types.StopReasonMaxTokens
+}
+
+// ToolCallRecord describes one tool execution within an invocation
+type ToolCallRecord struct {
+	ToolUseID string                 `json:"toolUseId"`
+	Name      string                 `json:"name"`
+	Input     map[string]interface{} `json:"input"`
+	Output    string                 `json:"output"`
+	Status    string                 `json:"status"`
+	Duration  time.Duration          `json:"duration"`
+}
+
+// Usage counts the tokens consumed by model calls
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+	TotalTokens  int `json:"totalTokens"`
+}
+
+func (u *Usage) add(usage *types.TokenUsage) {
+	if usage == nil {
+		return
+	}
+	u.InputTokens += int(aws.ToInt32(usage.InputTokens))
+	u.OutputTokens += int(aws.ToInt32(usage.OutputTokens))
+	u.TotalTokens += int(aws.ToInt32(usage.TotalTokens))
+}
+
+// modelPrice is the on-demand price in USD per million tokens
+type modelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// modelPricing lists prices for the models we use; unknown models are costed at zero
+var modelPricing = map[string]modelPrice{
+	"us.anthropic.claude-3-5-sonnet-20241022-v2:0": {Input: 3.00, Output: 15.00},
+	"us.anthropic.claude-3-7-sonnet-20250219-v1:0": {Input: 3.00, Output: 15.00},
+	"us.anthropic.claude-3-5-haiku-20241022-v1:0":  {Input: 0.80, Output: 4.00},
+	"us.anthropic.claude-3-haiku-20240307-v1:0":    {Input: 0.25, Output: 1.25},
+}
+
+// estimateCost returns the approximate USD cost of the given usage on a model
+func estimateCost(modelID string, usage Usage) float64 {
+	price, ok := modelPricing[modelID]
+	if !ok {
+		return 0
+	}
+	return (float64(usage.InputTokens)*price.Input + float64(usage.OutputTokens)*price.Output) / 1_000_000
+}
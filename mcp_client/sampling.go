@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// samplingStopReasons maps Converse stop reasons to the names MCP sampling uses
+var samplingStopReasons = map[types.StopReason]string{
+	types.StopReasonEndTurn:      "endTurn",
+	types.StopReasonMaxTokens:    "maxTokens",
+	types.StopReasonStopSequence: "stopSequence",
+}
+
+// SamplingHandler answers sampling/createMessage by calling modelID through client. Only
+// text messages are supported; the server's model preferences are ignored.
+func SamplingHandler(client ConverseAPI, modelID string) mcpclient.ServerRequestHandler {
+	return func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		input, err := samplingInput(modelID, params)
+		if err != nil {
+			return nil, err
+		}
+		out, err := client.Converse(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("bedrock converse failed: %w", err)
+		}
+
+		var text strings.Builder
+		for _, content := range out.Output.Message.Content {
+			if c, ok := content.(*types.ContentBlockMemberText); ok {
+				text.WriteString(c.Value)
+			}
+		}
+		stopReason, ok := samplingStopReasons[out.StopReason]
+		if !ok {
+			stopReason = string(out.StopReason)
+		}
+		return map[string]interface{}{
+			"role":       "assistant",
+			"content":    map[string]interface{}{"type": "text", "text": text.String()},
+			"model":      modelID,
+			"stopReason": stopReason,
+		}, nil
+	}
+}
+
+// NewSamplingHandler returns a SamplingHandler calling modelID with the default AWS configuration
+func NewSamplingHandler(ctx context.Context, modelID string) (mcpclient.ServerRequestHandler, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return SamplingHandler(bedrockruntime.NewFromConfig(cfg), modelID), nil
+}
+
+// samplingInput converts sampling/createMessage params into a Converse request
+func samplingInput(modelID string, params map[string]interface{}) (*bedrockruntime.ConverseInput, error) {
+	rawMessages, _ := params["messages"].([]interface{})
+	if len(rawMessages) == 0 {
+		return nil, fmt.Errorf("sampling request has no messages")
+	}
+
+	input := &bedrockruntime.ConverseInput{ModelId: aws.String(modelID)}
+	for _, raw := range rawMessages {
+		msg, _ := raw.(map[string]interface{})
+		role, _ := msg["role"].(string)
+		content, _ := msg["content"].(map[string]interface{})
+		if contentType, _ := content["type"].(string); contentType != "text" {
+			return nil, fmt.Errorf("unsupported sampling content type %q", contentType)
+		}
+		text, _ := content["text"].(string)
+
+		message := types.Message{
+			Role:    types.ConversationRoleUser,
+			Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: text}},
+		}
+		if role == "assistant" {
+			message.Role = types.ConversationRoleAssistant
+		}
+		input.Messages = append(input.Messages, message)
+	}
+
+	if system, _ := params["systemPrompt"].(string); system != "" {
+		input.System = []types.SystemContentBlock{&types.SystemContentBlockMemberText{Value: system}}
+	}
+	inference := &types.InferenceConfiguration{}
+	if maxTokens, ok := params["maxTokens"].(float64); ok && maxTokens > 0 {
+		inference.MaxTokens = aws.Int32(int32(maxTokens))
+	}
+	if temperature, ok := params["temperature"].(float64); ok {
+		inference.Temperature = aws.Float32(float32(temperature))
+	}
+	if stops, ok := params["stopSequences"].([]interface{}); ok {
+		for _, stop := range stops {
+			if s, ok := stop.(string); ok {
+				inference.StopSequences = append(inference.StopSequences, s)
+			}
+		}
+	}
+	input.InferenceConfig = inference
+	return input, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Priority is the scheduling class of an invocation
+type Priority string
+
+const (
+	// PriorityInteractive is for a person waiting on the answer, such as a chat
+	PriorityInteractive Priority = "interactive"
+	// PriorityBatch is for background work such as long analyses; it waits while interactive
+	// invocations are queued
+	PriorityBatch Priority = "batch"
+)
+
+// defaultMaxBatchWait is how long a batch model call may be passed over before it is served
+// ahead of interactive ones, so batch work can't starve
+const defaultMaxBatchWait = 2 * time.Minute
+
+// ParsePriority parses a priority name; empty is interactive
+func ParsePriority(s string) (Priority, error) {
+	switch Priority(s) {
+	case "", PriorityInteractive:
+		return PriorityInteractive, nil
+	case PriorityBatch:
+		return PriorityBatch, nil
+	}
+	return "", fmt.Errorf("invalid priority %q, expected %s or %s", s, PriorityInteractive, PriorityBatch)
+}
+
+// Scheduler limits how many model calls run at once. When all slots are busy, queued
+// interactive calls are served before batch calls. Slots are taken per model call rather
+// than per invocation, so a long batch invocation gives way to interactive ones between
+// its turns.
+type Scheduler struct {
+	// MaxBatchWait is how long a queued batch call may be passed over; 0 uses two minutes
+	MaxBatchWait time.Duration
+
+	mu     sync.Mutex
+	slots  int
+	inUse  int
+	queues map[Priority]*list.List
+}
+
+type schedulerWaiter struct {
+	ready  chan struct{}
+	queued time.Time
+}
+
+// NewScheduler returns a scheduler that runs at most slots model calls at once
+func NewScheduler(slots int) *Scheduler {
+	if slots < 1 {
+		slots = 1
+	}
+	return &Scheduler{
+		slots: slots,
+		queues: map[Priority]*list.List{
+			PriorityInteractive: list.New(),
+			PriorityBatch:       list.New(),
+		},
+	}
+}
+
+// Acquire waits for a slot and returns the function that gives it back. A nil scheduler
+// doesn't limit calls.
+func (s *Scheduler) Acquire(ctx context.Context, priority Priority) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	if priority != PriorityBatch {
+		priority = PriorityInteractive
+	}
+
+	s.mu.Lock()
+	if s.inUse < s.slots && s.queued() == 0 {
+		s.inUse++
+		s.mu.Unlock()
+		return s.releaser(), nil
+	}
+	w := &schedulerWaiter{ready: make(chan struct{}), queued: time.Now()}
+	elem := s.queues[priority].PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaser(), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// Granted while giving up; hand the slot on
+			s.mu.Unlock()
+			s.releaser()()
+		default:
+			s.queues[priority].Remove(elem)
+			s.mu.Unlock()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// releaser returns a release function that frees the slot once
+func (s *Scheduler) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.inUse--
+			s.grant()
+		})
+	}
+}
+
+// grant hands free slots to queued calls; it must be called with mu held
+func (s *Scheduler) grant() {
+	for s.inUse < s.slots {
+		queue := s.next()
+		if queue == nil {
+			return
+		}
+		w := queue.Remove(queue.Front()).(*schedulerWaiter)
+		s.inUse++
+		close(w.ready)
+	}
+}
+
+// next returns the queue to serve next, or nil when nothing is queued
+func (s *Scheduler) next() *list.List {
+	interactive, batch := s.queues[PriorityInteractive], s.queues[PriorityBatch]
+	maxBatchWait := s.MaxBatchWait
+	if maxBatchWait <= 0 {
+		maxBatchWait = defaultMaxBatchWait
+	}
+	if batch.Len() > 0 && time.Since(batch.Front().Value.(*schedulerWaiter).queued) >= maxBatchWait {
+		return batch
+	}
+	if interactive.Len() > 0 {
+		return interactive
+	}
+	if batch.Len() > 0 {
+		return batch
+	}
+	return nil
+}
+
+func (s *Scheduler) queued() int {
+	return s.queues[PriorityInteractive].Len() + s.queues[PriorityBatch].Len()
+}
+
+// Stats reports the slots in use and the calls queued per priority, e.g. for a health check
+func (s *Scheduler) Stats() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]interface{}{
+		"slots":       s.slots,
+		"inUse":       s.inUse,
+		"interactive": s.queues[PriorityInteractive].Len(),
+		"batch":       s.queues[PriorityBatch].Len(),
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/aws/smithy-go/document"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// Session holds the conversation state of one user session
+type Session struct {
+	ID        string
+	CreatedAt time.Time
+	// ForkedFrom is the ID of the session this one was forked from, if any
+	ForkedFrom string
+
+	mu        sync.Mutex
+	messages  []types.Message
+	toolCalls []ToolCallRecord
+	usage     Usage
+	// variables are set by tools and the application; see SessionVariables
+	variables map[string]interface{}
+	// lastUsed is when the session was last invoked; zero means CreatedAt
+	lastUsed time.Time
+}
+
+// Transcript is the portable JSON form of a session
+type Transcript struct {
+	SessionID  string                 `json:"sessionId"`
+	ForkedFrom string                 `json:"forkedFrom,omitempty"`
+	Model      string                 `json:"model"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	ExportedAt time.Time              `json:"exportedAt"`
+	Messages   []TranscriptMessage    `json:"messages"`
+	ToolCalls  []ToolCallRecord       `json:"toolCalls"`
+	Usage      Usage                  `json:"usage"`
+	Variables  map[string]interface{} `json:"variables,omitempty"`
+}
+
+type TranscriptMessage struct {
+	Role    string              `json:"role"`
+	Content []TranscriptContent `json:"content"`
+}
+
+// TranscriptContent is one content block; Type is "text", "toolUse", "toolResult",
+// "document", "image" or "json"
+type TranscriptContent struct {
+	Type      string                 `json:"type"`
+	Text      string                 `json:"text,omitempty"`
+	ToolUseID string                 `json:"toolUseId,omitempty"`
+	Name      string                 `json:"name,omitempty"`
+	Input     map[string]interface{} `json:"input,omitempty"`
+	Status    string                 `json:"status,omitempty"`
+	// Format and Bytes hold a document or image; Name is the document's name
+	Format string `json:"format,omitempty"`
+	Bytes  []byte `json:"bytes,omitempty"`
+	// JSON is a json block's value
+	JSON interface{} `json:"json,omitempty"`
+	// Content holds a tool result's documents, images and JSON, which follow its text
+	Content []TranscriptContent `json:"content,omitempty"`
+}
+
+// getOrCreateSession returns the stored session, creating it on first use.
+// An empty sessionID returns a throwaway session that is never stored.
+func (a *InlineAgent) getOrCreateSession(sessionID string) *Session {
+	if sessionID == "" {
+		return &Session{CreatedAt: time.Now()}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	session, ok := a.liveSession(sessionID)
+	if !ok {
+		session = &Session{ID: sessionID, CreatedAt: time.Now()}
+		a.store.Put(session)
+	}
+	session.touch(time.Now())
+	return session
+}
+
+// messagesSnapshot returns a copy of the session history to build a new request from
+func (s *Session) messagesSnapshot() []types.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]types.Message, len(s.messages))
+	copy(messages, s.messages)
+	return messages
+}
+
+// touch records that the session was used at now, for SessionTTL's idle expiry
+func (s *Session) touch(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUsed = now
+}
+
+// record stores the outcome of a completed invocation
+func (s *Session) record(messages []types.Message, toolCalls []ToolCallRecord, usage Usage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastUsed = time.Now()
+	s.messages = messages
+	s.toolCalls = append(s.toolCalls, toolCalls...)
+	s.usage.InputTokens += usage.InputTokens
+	s.usage.OutputTokens += usage.OutputTokens
+	s.usage.TotalTokens += usage.TotalTokens
+}
+
+// toolCallCount returns how many tools the session has run, excluding calls refused by a quota
+func (s *Session) toolCallCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, call := range s.toolCalls {
+		if call.Status != statusQuotaExceeded {
+			count++
+		}
+	}
+	return count
+}
+
+// ExportSession returns the session's conversation as a portable JSON transcript
+func (a *InlineAgent) ExportSession(sessionID string) ([]byte, error) {
+	a.mu.Lock()
+	session, ok := a.liveSession(sessionID)
+	a.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+
+	session.mu.Lock()
+	transcript := Transcript{
+		SessionID:  session.ID,
+		ForkedFrom: session.ForkedFrom,
+		Model:      a.FoundationModel,
+		CreatedAt:  session.CreatedAt,
+		ExportedAt: time.Now(),
+		Messages:   make([]TranscriptMessage, 0, len(session.messages)),
+		ToolCalls:  append([]ToolCallRecord{}, session.toolCalls...),
+		Usage:      session.usage,
+	}
+	if len(session.variables) > 0 {
+		transcript.Variables = make(map[string]interface{}, len(session.variables))
+		for k, v := range session.variables {
+			transcript.Variables[k] = v
+		}
+	}
+	for _, msg := range session.messages {
+		m, err := toTranscriptMessage(msg)
+		if err != nil {
+			session.mu.Unlock()
+			return nil, fmt.Errorf("failed to export session %s: %w", sessionID, err)
+		}
+		transcript.Messages = append(transcript.Messages, m)
+	}
+	session.mu.Unlock()
+
+	data, err := json.MarshalIndent(transcript, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal transcript: %w", err)
+	}
+
+	return data, nil
+}
+
+// ImportSession seeds a new session from a transcript produced by ExportSession.
+// The session is stored under sessionID, or the transcript's own ID when sessionID is empty.
+func (a *InlineAgent) ImportSession(sessionID string, data []byte) error {
+	// Numbers stay json.Number until fromTranscriptMessage encodes them into documents
+	var transcript Transcript
+	if err := mcpclient.UnmarshalJSONNumbers(data, &transcript); err != nil {
+		return fmt.Errorf("failed to unmarshal transcript: %w", err)
+	}
+
+	if sessionID == "" {
+		sessionID = transcript.SessionID
+	}
+	if sessionID == "" {
+		return fmt.Errorf("transcript has no session ID")
+	}
+
+	messages := make([]types.Message, 0, len(transcript.Messages))
+	for _, msg := range transcript.Messages {
+		m, err := fromTranscriptMessage(msg)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, m)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, exists := a.liveSession(sessionID); exists {
+		return fmt.Errorf("session %s already exists", sessionID)
+	}
+
+	a.store.Put(&Session{
+		ID:         sessionID,
+		CreatedAt:  time.Now(),
+		ForkedFrom: transcript.ForkedFrom,
+		messages:   messages,
+		toolCalls:  transcript.ToolCalls,
+		usage:      transcript.Usage,
+		variables:  transcript.Variables,
+	})
+
+	log.Printf("Imported session %s with %d messages", sessionID, len(messages))
+	return nil
+}
+
+// ForkSession copies a session's history into a new session and returns the new ID, so
+// follow-ups can be explored without touching the original thread
+func (a *InlineAgent) ForkSession(sessionID string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	source, ok := a.liveSession(sessionID)
+	if !ok {
+		return "", fmt.Errorf("session %s not found", sessionID)
+	}
+
+	forkID, err := newForkID(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	if _, exists := a.liveSession(forkID); exists {
+		return "", fmt.Errorf("session %s already exists", forkID)
+	}
+	a.store.Put(source.fork(forkID))
+
+	log.Printf("Forked session %s into %s", sessionID, forkID)
+	return forkID, nil
+}
+
+// fork returns a new session sharing this session's history. Stored message slices are
+// never modified in place, and the copies are capped at their length so the first append
+// on either side reallocates; that makes the sharing copy-on-write.
+func (s *Session) fork(id string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &Session{
+		ID:         id,
+		CreatedAt:  time.Now(),
+		ForkedFrom: s.ID,
+		messages:   s.messages[:len(s.messages):len(s.messages)],
+		toolCalls:  s.toolCalls[:len(s.toolCalls):len(s.toolCalls)],
+		usage:      s.usage,
+		variables:  copyVariables(s.variables),
+	}
+}
+
+// copyVariables copies a variables map; the values are decoded JSON that is never modified
+// in place, so a shallow copy is enough
+func copyVariables(vars map[string]interface{}) map[string]interface{} {
+	if vars == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		copied[k] = v
+	}
+	return copied
+}
+
+// newForkID derives a fresh session ID from the parent's
+func newForkID(parentID string) (string, error) {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return parentID + "-fork-" + hex.EncodeToString(buf), nil
+}
+
+// toTranscriptMessage converts a Converse message for a transcript. It fails on content
+// blocks a transcript can't hold, rather than dropping them.
+func toTranscriptMessage(msg types.Message) (TranscriptMessage, error) {
+	out := TranscriptMessage{Role: string(msg.Role)}
+
+	for _, content := range msg.Content {
+		switch c := content.(type) {
+		case *types.ContentBlockMemberText:
+			out.Content = append(out.Content, TranscriptContent{Type: "text", Text: c.Value})
+		case *types.ContentBlockMemberToolUse:
+			out.Content = append(out.Content, TranscriptContent{
+				Type:      "toolUse",
+				ToolUseID: aws.ToString(c.Value.ToolUseId),
+				Name:      aws.ToString(c.Value.Name),
+				Input:     decodeDocument(c.Value.Input),
+			})
+		case *types.ContentBlockMemberToolResult:
+			result := TranscriptContent{
+				Type:      "toolResult",
+				ToolUseID: aws.ToString(c.Value.ToolUseId),
+				Status:    string(c.Value.Status),
+			}
+			for _, block := range c.Value.Content {
+				var (
+					converted TranscriptContent
+					err       error
+				)
+				switch b := block.(type) {
+				case *types.ToolResultContentBlockMemberText:
+					result.Text += b.Value
+					continue
+				case *types.ToolResultContentBlockMemberDocument:
+					converted, err = transcriptDocument(b.Value)
+				case *types.ToolResultContentBlockMemberImage:
+					converted, err = transcriptImage(b.Value)
+				case *types.ToolResultContentBlockMemberJson:
+					converted, err = transcriptJSON(b.Value)
+				default:
+					err = fmt.Errorf("unsupported tool result content %T", block)
+				}
+				if err != nil {
+					return out, fmt.Errorf("tool result %s: %w", result.ToolUseID, err)
+				}
+				result.Content = append(result.Content, converted)
+			}
+			out.Content = append(out.Content, result)
+		case *types.ContentBlockMemberDocument:
+			converted, err := transcriptDocument(c.Value)
+			if err != nil {
+				return out, err
+			}
+			out.Content = append(out.Content, converted)
+		case *types.ContentBlockMemberImage:
+			converted, err := transcriptImage(c.Value)
+			if err != nil {
+				return out, err
+			}
+			out.Content = append(out.Content, converted)
+		default:
+			return out, fmt.Errorf("unsupported %s message content %T", msg.Role, content)
+		}
+	}
+
+	return out, nil
+}
+
+func transcriptDocument(doc types.DocumentBlock) (TranscriptContent, error) {
+	source, ok := doc.Source.(*types.DocumentSourceMemberBytes)
+	if !ok {
+		return TranscriptContent{}, fmt.Errorf("unsupported source %T for document %s", doc.Source, aws.ToString(doc.Name))
+	}
+	return TranscriptContent{Type: "document", Name: aws.ToString(doc.Name), Format: string(doc.Format), Bytes: source.Value}, nil
+}
+
+func transcriptImage(image types.ImageBlock) (TranscriptContent, error) {
+	source, ok := image.Source.(*types.ImageSourceMemberBytes)
+	if !ok {
+		return TranscriptContent{}, fmt.Errorf("unsupported image source %T", image.Source)
+	}
+	return TranscriptContent{Type: "image", Format: string(image.Format), Bytes: source.Value}, nil
+}
+
+func transcriptJSON(doc document.Interface) (TranscriptContent, error) {
+	var value interface{}
+	if doc != nil {
+		data, err := doc.MarshalSmithyDocument()
+		if err != nil {
+			return TranscriptContent{}, fmt.Errorf("failed to marshal JSON content: %w", err)
+		}
+		if err := mcpclient.UnmarshalJSONNumbers(data, &value); err != nil {
+			return TranscriptContent{}, fmt.Errorf("failed to unmarshal JSON content: %w", err)
+		}
+	}
+	return TranscriptContent{Type: "json", JSON: value}, nil
+}
+
+func fromTranscriptMessage(msg TranscriptMessage) (types.Message, error) {
+	out := types.Message{Role: types.ConversationRole(msg.Role)}
+
+	for _, content := range msg.Content {
+		switch content.Type {
+		case "text":
+			out.Content = append(out.Content, &types.ContentBlockMemberText{Value: content.Text})
+		case "toolUse":
+			input := content.Input
+			if input == nil {
+				input = map[string]interface{}{}
+			}
+			inputDoc, err := document.NewEncoder().Encode(documentNumbers(input))
+			if err != nil {
+				return out, fmt.Errorf("failed to encode input for tool use %s: %w", content.ToolUseID, err)
+			}
+			out.Content = append(out.Content, &types.ContentBlockMemberToolUse{
+				Value: types.ToolUseBlock{
+					ToolUseId: aws.String(content.ToolUseID),
+					Name:      aws.String(content.Name),
+					Input:     inputDoc,
+				},
+			})
+		case "toolResult":
+			var blocks []types.ToolResultContentBlock
+			// Converse rejects empty text blocks, so a result of only documents has none
+			if content.Text != "" || len(content.Content) == 0 {
+				blocks = append(blocks, &types.ToolResultContentBlockMemberText{Value: content.Text})
+			}
+			for _, c := range content.Content {
+				switch c.Type {
+				case "document":
+					blocks = append(blocks, &types.ToolResultContentBlockMemberDocument{Value: converseTranscriptDocument(c)})
+				case "image":
+					blocks = append(blocks, &types.ToolResultContentBlockMemberImage{Value: converseTranscriptImage(c)})
+				case "json":
+					doc, err := document.NewEncoder().Encode(documentNumbers(c.JSON))
+					if err != nil {
+						return out, fmt.Errorf("failed to encode JSON content for tool result %s: %w", content.ToolUseID, err)
+					}
+					blocks = append(blocks, &types.ToolResultContentBlockMemberJson{Value: doc})
+				default:
+					return out, fmt.Errorf("unknown content type %q in tool result %s", c.Type, content.ToolUseID)
+				}
+			}
+			out.Content = append(out.Content, &types.ContentBlockMemberToolResult{
+				Value: types.ToolResultBlock{
+					ToolUseId: aws.String(content.ToolUseID),
+					Content:   blocks,
+					Status:    types.ToolResultStatus(content.Status),
+				},
+			})
+		case "document":
+			out.Content = append(out.Content, &types.ContentBlockMemberDocument{Value: converseTranscriptDocument(content)})
+		case "image":
+			out.Content = append(out.Content, &types.ContentBlockMemberImage{Value: converseTranscriptImage(content)})
+		default:
+			return out, fmt.Errorf("unknown transcript content type %q", content.Type)
+		}
+	}
+
+	return out, nil
+}
+
+func converseTranscriptDocument(content TranscriptContent) types.DocumentBlock {
+	return types.DocumentBlock{
+		Format: types.DocumentFormat(content.Format),
+		Name:   aws.String(content.Name),
+		Source: &types.DocumentSourceMemberBytes{Value: content.Bytes},
+	}
+}
+
+func converseTranscriptImage(content TranscriptContent) types.ImageBlock {
+	return types.ImageBlock{
+		Format: types.ImageFormat(content.Format),
+		Source: &types.ImageSourceMemberBytes{Value: content.Bytes},
+	}
+}
+
+// decodeDocument converts a Bedrock document (such as tool use input) into a plain map
+func decodeDocument(doc document.Interface) map[string]interface{} {
+	result := make(map[string]interface{})
+	if doc == nil {
+		return result
+	}
+	// Going through JSON keeps numbers as json.Number, so large integers reach tools intact
+	if data, err := doc.MarshalSmithyDocument(); err == nil {
+		if err := mcpclient.UnmarshalJSONNumbers(data, &result); err == nil {
+			return result
+		}
+		result = make(map[string]interface{})
+	}
+	if err := doc.UnmarshalSmithyDocument(&result); err != nil {
+		log.Printf("Failed to decode document: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// defaultSessionReapInterval is how often expired sessions are deleted when no interval is set
+const defaultSessionReapInterval = time.Minute
+
+// SessionTTL expires stored sessions so the session store doesn't grow without bound in a
+// long-running process. An expired session is never resumed: its ID starts a new
+// conversation. Expired sessions are also deleted in the background when the store
+// supports it, as MemorySessionStore does.
+type SessionTTL struct {
+	// Idle expires a session this long after it was last used; 0 doesn't
+	Idle time.Duration
+	// Absolute expires a session this long after it was created, however busy; 0 doesn't
+	Absolute time.Duration
+	// ReapInterval is how often expired sessions are deleted; 0 uses a minute
+	ReapInterval time.Duration
+}
+
+// expired reports whether session has outlived the TTL at now; a nil TTL never expires
+func (t *SessionTTL) expired(session *Session, now time.Time) bool {
+	if t == nil {
+		return false
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if t.Absolute > 0 && now.Sub(session.CreatedAt) > t.Absolute {
+		return true
+	}
+	lastUsed := session.lastUsed
+	if lastUsed.IsZero() {
+		lastUsed = session.CreatedAt
+	}
+	return t.Idle > 0 && now.Sub(lastUsed) > t.Idle
+}
+
+// sessionReaper is implemented by session stores that can delete expired sessions themselves
+type sessionReaper interface {
+	// DeleteExpired deletes the sessions expired reports true for and returns how many
+	DeleteExpired(expired func(session *Session) bool) int
+}
+
+// DeleteExpired deletes the sessions expired reports true for
+func (s *MemorySessionStore) DeleteExpired(expired func(session *Session) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for id, session := range s.sessions {
+		if expired(session) {
+			delete(s.sessions, id)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// liveSession returns a stored session unless it has expired, deleting it if it has. It
+// must be called with a.mu held.
+func (a *InlineAgent) liveSession(sessionID string) (*Session, bool) {
+	session, ok := a.store.Get(sessionID)
+	if !ok {
+		return nil, false
+	}
+	if a.SessionTTL.expired(session, time.Now()) {
+		a.store.Delete(sessionID)
+		log.Printf("Session %s expired", sessionID)
+		return nil, false
+	}
+	return session, true
+}
+
+// reapSessions deletes the expired sessions from the store, when it supports that
+func (a *InlineAgent) reapSessions(now time.Time) int {
+	reaper, ok := a.store.(sessionReaper)
+	if !ok {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return reaper.DeleteExpired(func(session *Session) bool {
+		return a.SessionTTL.expired(session, now)
+	})
+}
+
+// startSessionReaper deletes expired sessions every ReapInterval until Close
+func (a *InlineAgent) startSessionReaper() {
+	interval := a.SessionTTL.ReapInterval
+	if interval <= 0 {
+		interval = defaultSessionReapInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopReaper = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if n := a.reapSessions(now); n > 0 {
+					log.Printf("Deleted %d expired sessions", n)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+const (
+	// sessionVariablesMeta is the tools/call _meta key carrying the session's variables
+	sessionVariablesMeta = "sessionVariables"
+	// setSessionVariablesMeta is the tool result _meta key with variables to set; a null
+	// value deletes the variable
+	setSessionVariablesMeta = "setSessionVariables"
+	// defaultMaxSessionVariables bounds how many variables one session may hold
+	defaultMaxSessionVariables = 64
+	// defaultMaxSessionValueBytes bounds the JSON size of one variable's value
+	defaultMaxSessionValueBytes = 4096
+)
+
+// SessionVariables keeps key-value state with each session, apart from the conversation,
+// for stateful workflows such as remembering the cluster the user picked earlier. Every
+// tools/call carries the session's variables in _meta.sessionVariables, and a tool sets
+// them by returning _meta.setSessionVariables. The instruction can use them as
+// {{session "name"}}, rendered before each invocation.
+type SessionVariables struct {
+	// MaxVariables bounds how many variables a session may hold; 0 allows 64
+	MaxVariables int
+	// MaxValueBytes bounds the JSON size of each value; 0 allows 4096
+	MaxValueBytes int
+}
+
+func (v *SessionVariables) maxVariables() int {
+	if v.MaxVariables > 0 {
+		return v.MaxVariables
+	}
+	return defaultMaxSessionVariables
+}
+
+func (v *SessionVariables) maxValueBytes() int {
+	if v.MaxValueBytes > 0 {
+		return v.MaxValueBytes
+	}
+	return defaultMaxSessionValueBytes
+}
+
+// set stores or, for a nil value, deletes a variable of session within the limits
+func (v *SessionVariables) set(session *Session, key string, value interface{}) error {
+	if key == "" {
+		return fmt.Errorf("session variable name is empty")
+	}
+	if value == nil {
+		session.deleteVariable(key)
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode session variable %s: %w", key, err)
+	}
+	if len(data) > v.maxValueBytes() {
+		return fmt.Errorf("session variable %s is %d bytes, over the limit of %d", key, len(data), v.maxValueBytes())
+	}
+	// Values are stored as decoded JSON so servers and templates see the same thing
+	var decoded interface{}
+	if err := mcpclient.UnmarshalJSONNumbers(data, &decoded); err != nil {
+		return fmt.Errorf("failed to decode session variable %s: %w", key, err)
+	}
+	return session.setVariable(key, decoded, v.maxVariables())
+}
+
+// apply sets the variables a tool result asks for, logging the ones refused
+func (v *SessionVariables) apply(session *Session, toolName string, meta map[string]interface{}) {
+	updates, _ := meta[setSessionVariablesMeta].(map[string]interface{})
+	for _, key := range sortedKeys(updates) {
+		if err := v.set(session, key, updates[key]); err != nil {
+			log.Printf("Tool %s could not set a session variable: %v", toolName, err)
+		}
+	}
+}
+
+// setVariable stores a variable unless the session already holds max others
+func (s *Session) setVariable(key string, value interface{}, max int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.variables[key]; !exists && len(s.variables) >= max {
+		return fmt.Errorf("session already holds %d variables", max)
+	}
+	if s.variables == nil {
+		s.variables = make(map[string]interface{})
+	}
+	s.variables[key] = value
+	return nil
+}
+
+func (s *Session) deleteVariable(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.variables, key)
+}
+
+// Variables returns a copy of the session's variables
+func (s *Session) Variables() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vars := make(map[string]interface{}, len(s.variables))
+	for k, v := range s.variables {
+		vars[k] = v
+	}
+	return vars
+}
+
+// GetSessionVariables returns a session's variables, or an error if there is no such session
+func (a *InlineAgent) GetSessionVariables(sessionID string) (map[string]interface{}, error) {
+	a.mu.Lock()
+	session, ok := a.liveSession(sessionID)
+	a.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+	return session.Variables(), nil
+}
+
+// SetSessionVariable sets, or for a nil value deletes, a session variable, e.g. from a
+// selection the user made in the UI. The session is created if it doesn't exist yet.
+func (a *InlineAgent) SetSessionVariable(sessionID, key string, value interface{}) error {
+	if a.Variables == nil {
+		return fmt.Errorf("session variables are not enabled")
+	}
+	if sessionID == "" {
+		return fmt.Errorf("session ID is required")
+	}
+	return a.Variables.set(a.getOrCreateSession(sessionID), key, value)
+}
+
+type sessionKey struct{}
+
+// withSession attaches the invocation's session for tool calls to read and write its variables
+func withSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// sessionFromContext returns the session attached by withSession, or nil
+func sessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionKey{}).(*Session)
+	return session
+}
+
+// renderSessionVariables replaces {{session "name"}} in an instruction with the variable's
+// value; unset variables render as empty
+func renderSessionVariables(instruction string, vars map[string]interface{}) (string, error) {
+	if !strings.Contains(instruction, "{{session") {
+		return instruction, nil
+	}
+	tmpl, err := template.New("instruction").Funcs(template.FuncMap{
+		"session": func(key string) string {
+			switch v := vars[key].(type) {
+			case nil:
+				return ""
+			case string:
+				return v
+			default:
+				data, _ := json.Marshal(v)
+				return string(data)
+			}
+		},
+	}).Parse(instruction)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse instruction: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return "", fmt.Errorf("failed to render instruction: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultShadowTimeout bounds a candidate call
+	defaultShadowTimeout = 30 * time.Second
+	// defaultMaxShadowCalls is how many candidate calls may run at once; more are skipped
+	defaultMaxShadowCalls = 16
+)
+
+// ShadowResult compares one tool call's result from the primary and the candidate server
+type ShadowResult struct {
+	Tool             string        `json:"tool"`
+	Match            bool          `json:"match"`
+	Differences      []string      `json:"differences,omitempty"`
+	PrimaryError     string        `json:"primaryError,omitempty"`
+	CandidateError   string        `json:"candidateError,omitempty"`
+	PrimaryLatency   time.Duration `json:"primaryLatency"`
+	CandidateLatency time.Duration `json:"candidateLatency"`
+}
+
+// ShadowCaller sends tool calls to Primary and, in the background, a copy to Candidate, a
+// new release of the same server. Only the primary's results are used; the candidate's are
+// compared with them and differences logged and traced, so a release can be checked against
+// live agent traffic before it takes over. It implements MCPCaller.
+//
+// The candidate really runs the calls it is sent, so only shadow tools that are safe to run
+// twice, such as read-only ones.
+type ShadowCaller struct {
+	Primary   MCPCaller
+	Candidate MCPCaller
+	// Tools limits shadowing to these tools; empty shadows every tool
+	Tools []string
+	// SampleRate is the fraction of calls shadowed; 0 shadows every call
+	SampleRate float64
+	// Timeout bounds each candidate call; 0 uses 30s
+	Timeout time.Duration
+	// TraceSink receives a shadow event per compared call; nil only logs differences
+	TraceSink TraceSink
+
+	initOnce sync.Once
+	slots    chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewShadowCaller shadows calls to primary on candidate
+func NewShadowCaller(primary, candidate MCPCaller, tools ...string) *ShadowCaller {
+	return &ShadowCaller{Primary: primary, Candidate: candidate, Tools: tools}
+}
+
+// Initialize initializes the primary, then the candidate. A candidate that fails to start
+// is logged and its calls fail later, without affecting the primary.
+func (s *ShadowCaller) Initialize(ctx context.Context) error {
+	if err := s.Primary.Initialize(ctx); err != nil {
+		return err
+	}
+	if err := s.Candidate.Initialize(ctx); err != nil {
+		log.Printf("Shadow candidate %s failed to initialize: %v", callerName(s.Candidate), err)
+	}
+	return nil
+}
+
+// ListTools lists the primary's tools, logging how the candidate's differ
+func (s *ShadowCaller) ListTools(ctx context.Context) ([]Tool, error) {
+	tools, err := s.Primary.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if candidateTools, err := s.Candidate.ListTools(ctx); err != nil {
+		log.Printf("Shadow candidate %s failed to list tools: %v", callerName(s.Candidate), err)
+	} else if diff := DiffTools(callerName(s.Candidate), tools, candidateTools); !diff.Empty() {
+		log.Printf("Shadow candidate tools differ from the primary's: %s", diff)
+	}
+	return tools, nil
+}
+
+// CallTool returns the primary's result and shadows the call on the candidate
+func (s *ShadowCaller) CallTool(ctx context.Context, toolCall ToolCall) (*ToolResult, error) {
+	start := time.Now()
+	result, err := s.Primary.CallTool(ctx, toolCall)
+	s.Shadow(ctx, toolCall, result, err, time.Since(start))
+	return result, err
+}
+
+// Shadow sends a call the primary has answered to the candidate in the background and
+// compares the results. It is for callers that reach the primary directly; a nil
+// ShadowCaller does nothing.
+func (s *ShadowCaller) Shadow(ctx context.Context, toolCall ToolCall, primary *ToolResult, primaryErr error, primaryLatency time.Duration) {
+	if s == nil || !s.shadows(toolCall.Name) {
+		return
+	}
+	s.initOnce.Do(func() {
+		s.slots = make(chan struct{}, defaultMaxShadowCalls)
+	})
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		log.Printf("Too many shadow calls in flight, skipping %s", toolCall.Name)
+		return
+	}
+
+	// The agent may post-process the primary's result after this returns
+	if primary != nil {
+		snapshot := *primary
+		snapshot.Content = append([]ContentBlock(nil), primary.Content...)
+		primary = &snapshot
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultShadowTimeout
+	}
+	// The candidate call outlives the request, but keeps its headers and other values
+	shadowCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.slots }()
+		defer cancel()
+
+		start := time.Now()
+		candidate, candidateErr := s.Candidate.CallTool(shadowCtx, toolCall)
+		comparison := compareShadowResults(primary, primaryErr, candidate, candidateErr)
+		comparison.Tool = toolCall.Name
+		comparison.PrimaryLatency = primaryLatency
+		comparison.CandidateLatency = time.Since(start)
+		s.report(comparison)
+	}()
+}
+
+// shadows reports whether calls to tool are shadowed, sampling by SampleRate
+func (s *ShadowCaller) shadows(tool string) bool {
+	if len(s.Tools) > 0 && !containsString(s.Tools, tool) {
+		return false
+	}
+	return s.SampleRate <= 0 || s.SampleRate >= 1 || rand.Float64() < s.SampleRate
+}
+
+func (s *ShadowCaller) report(result ShadowResult) {
+	if !result.Match {
+		log.Printf("Shadow mismatch for %s on %s: %v", result.Tool, callerName(s.Candidate), result.Differences)
+	}
+	if s.TraceSink == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"candidate":        callerName(s.Candidate),
+		"match":            result.Match,
+		"primaryLatency":   result.PrimaryLatency.Milliseconds(),
+		"candidateLatency": result.CandidateLatency.Milliseconds(),
+	}
+	if len(result.Differences) > 0 {
+		data["differences"] = result.Differences
+	}
+	s.TraceSink.Emit(TraceEvent{Time: time.Now(), Type: TraceShadow, Tool: result.Tool, Data: data})
+}
+
+// compareShadowResults lists how the candidate's outcome differs from the primary's.
+// Content is compared as canonical JSON, so key order and number formatting don't count.
+func compareShadowResults(primary *ToolResult, primaryErr error, candidate *ToolResult, candidateErr error) ShadowResult {
+	var result ShadowResult
+	if primaryErr != nil {
+		result.PrimaryError = primaryErr.Error()
+	}
+	if candidateErr != nil {
+		result.CandidateError = candidateErr.Error()
+	}
+
+	switch {
+	case primaryErr != nil && candidateErr != nil:
+		// Both failed; the errors are expected to mention different hosts
+	case primaryErr != nil:
+		result.Differences = append(result.Differences, "primary failed, candidate succeeded")
+	case candidateErr != nil:
+		result.Differences = append(result.Differences, "candidate failed, primary succeeded")
+	case primary == nil || candidate == nil:
+		if (primary == nil) != (candidate == nil) {
+			result.Differences = append(result.Differences, "only one server returned a result")
+		}
+	default:
+		if primary.IsError != candidate.IsError {
+			result.Differences = append(result.Differences, fmt.Sprintf("isError: primary %t, candidate %t", primary.IsError, candidate.IsError))
+		}
+		if len(primary.Content) != len(candidate.Content) {
+			result.Differences = append(result.Differences, fmt.Sprintf("content blocks: primary %d, candidate %d", len(primary.Content), len(candidate.Content)))
+		}
+		if diff, err := contentDifference(primary.Content, candidate.Content); err != nil {
+			result.Differences = append(result.Differences, err.Error())
+		} else if diff != "" {
+			result.Differences = append(result.Differences, diff)
+		}
+	}
+	result.Match = len(result.Differences) == 0
+	return result
+}
+
+// contentDifference describes the first difference between two results' content, or ""
+func contentDifference(primary, candidate []ContentBlock) (string, error) {
+	a, err := canonicalJSON(primary)
+	if err != nil {
+		return "", fmt.Errorf("failed to compare primary content: %w", err)
+	}
+	b, err := canonicalJSON(candidate)
+	if err != nil {
+		return "", fmt.Errorf("failed to compare candidate content: %w", err)
+	}
+	if bytes.Equal(a, b) {
+		return "", nil
+	}
+	at := 0
+	for at < len(a) && at < len(b) && a[at] == b[at] {
+		at++
+	}
+	return fmt.Sprintf("content differs from byte %d (primary %d bytes, candidate %d bytes)", at, len(a), len(b)), nil
+}
+
+// Close waits for in-flight shadow calls, then closes both servers
+func (s *ShadowCaller) Close(ctx context.Context) error {
+	s.wg.Wait()
+	return errors.Join(s.Primary.Close(ctx), s.Candidate.Close(ctx))
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+const (
+	// defaultStatsWindow is how many recent calls per server the stats are computed over
+	defaultStatsWindow = 200
+	// minSLOSamples is how many calls a server must have in the window before its SLO is checked
+	minSLOSamples = 20
+)
+
+// ServerSLO is the service level expected of an MCP server's tool calls; zero fields are not checked
+type ServerSLO struct {
+	// MaxP95Latency is the highest acceptable 95th percentile call latency
+	MaxP95Latency time.Duration
+	// MaxP95ResponseBytes is the highest acceptable 95th percentile result size
+	MaxP95ResponseBytes int64
+}
+
+// ServerStats summarizes a server's recent tool calls
+type ServerStats struct {
+	Server string `json:"server"`
+	Calls  int    `json:"calls"`
+	Errors int    `json:"errors"`
+	// AuthErrors are the errors where the server rejected the credentials, counted apart
+	// from outages
+	AuthErrors       int           `json:"authErrors"`
+	P50Latency       time.Duration `json:"p50Latency"`
+	P95Latency       time.Duration `json:"p95Latency"`
+	P95ResponseBytes int64         `json:"p95ResponseBytes"`
+	MaxResponseBytes int64         `json:"maxResponseBytes"`
+	// Violations lists how the server misses its SLO; empty when it meets it
+	Violations []string `json:"violations,omitempty"`
+}
+
+// serverSamples is a ring of a server's most recent calls
+type serverSamples struct {
+	latencies  []time.Duration
+	sizes      []int64
+	failed     []bool
+	authFailed []bool
+	next       int
+	violating  bool
+	// restoredUntil is set when violating came from the HealthStore rather than these
+	// samples; Admit refuses calls until then
+	restoredUntil time.Time
+	// tripped is the reason an operator marked the server violating, see Trip; it holds
+	// whatever the samples say until Reset
+	tripped string
+}
+
+// ServerStatsTracker keeps rolling latency and result size statistics per MCP server over
+// its last Window calls, and checks them against an SLO. Servers that miss it are logged and
+// traced when they start and stop doing so, and are tried last when another server offers
+// the same tool.
+type ServerStatsTracker struct {
+	SLO ServerSLO
+	// Window is how many recent calls per server are kept; 0 keeps 200
+	Window int
+	// TraceSink receives an slo event when a server starts or stops missing its SLO; nil only logs
+	TraceSink TraceSink
+	// Events receives an SLO violated or recovered event at the same points; nil sends none
+	Events *EventBus
+	// Store keeps each server's SLO state across restarts and replicas, see Restore; nil doesn't
+	Store HealthStore
+
+	mu      sync.Mutex
+	servers map[string]*serverSamples
+}
+
+// NewServerStatsTracker tracks server stats against slo
+func NewServerStatsTracker(slo ServerSLO) *ServerStatsTracker {
+	return &ServerStatsTracker{SLO: slo, servers: map[string]*serverSamples{}}
+}
+
+// Record adds a tool call to server's stats; a nil tracker does nothing
+func (t *ServerStatsTracker) Record(server string, latency time.Duration, responseBytes int64, err error) {
+	if t == nil {
+		return
+	}
+	window := t.Window
+	if window <= 0 {
+		window = defaultStatsWindow
+	}
+
+	t.mu.Lock()
+	samples, ok := t.servers[server]
+	if !ok {
+		samples = &serverSamples{}
+		t.servers[server] = samples
+	}
+	if len(samples.latencies) < window {
+		samples.latencies = append(samples.latencies, latency)
+		samples.sizes = append(samples.sizes, responseBytes)
+		samples.failed = append(samples.failed, err != nil)
+		samples.authFailed = append(samples.authFailed, errors.Is(err, mcpclient.ErrAuthFailed))
+	} else {
+		samples.latencies[samples.next] = latency
+		samples.sizes[samples.next] = responseBytes
+		samples.failed[samples.next] = err != nil
+		samples.authFailed[samples.next] = errors.Is(err, mcpclient.ErrAuthFailed)
+		samples.next = (samples.next + 1) % len(samples.latencies)
+	}
+
+	stats := t.summarize(server, samples)
+	violating := len(stats.Violations) > 0
+	if !samples.restoredUntil.IsZero() {
+		if stats.Calls < minSLOSamples && time.Now().Before(samples.restoredUntil) {
+			violating = samples.violating
+		} else {
+			samples.restoredUntil = time.Time{}
+		}
+	}
+	changed := violating != samples.violating
+	samples.violating = violating
+	t.mu.Unlock()
+
+	if changed {
+		t.report(stats)
+	}
+}
+
+// summarize computes a server's stats; it must be called with mu held
+func (t *ServerStatsTracker) summarize(server string, samples *serverSamples) ServerStats {
+	stats := ServerStats{Server: server, Calls: len(samples.latencies)}
+	latencies := append([]time.Duration(nil), samples.latencies...)
+	sizes := append([]int64(nil), samples.sizes...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	for i, failed := range samples.failed {
+		if failed {
+			stats.Errors++
+		}
+		if samples.authFailed[i] {
+			stats.AuthErrors++
+		}
+	}
+
+	stats.P50Latency = percentile(latencies, 0.50)
+	stats.P95Latency = percentile(latencies, 0.95)
+	if len(sizes) > 0 {
+		stats.P95ResponseBytes = sizes[percentileRank(len(sizes), 0.95)]
+		stats.MaxResponseBytes = sizes[len(sizes)-1]
+	}
+
+	if samples.tripped != "" {
+		stats.Violations = append(stats.Violations, "tripped by operator: "+samples.tripped)
+	}
+	if stats.Calls < minSLOSamples {
+		return stats
+	}
+	if t.SLO.MaxP95Latency > 0 && stats.P95Latency > t.SLO.MaxP95Latency {
+		stats.Violations = append(stats.Violations, fmt.Sprintf("p95 latency %s exceeds %s", stats.P95Latency.Round(time.Millisecond), t.SLO.MaxP95Latency))
+	}
+	if t.SLO.MaxP95ResponseBytes > 0 && stats.P95ResponseBytes > t.SLO.MaxP95ResponseBytes {
+		stats.Violations = append(stats.Violations, fmt.Sprintf("p95 response size %d bytes exceeds %d", stats.P95ResponseBytes, t.SLO.MaxP95ResponseBytes))
+	}
+	return stats
+}
+
+// resultSize returns the size of a tool result's content as JSON, or 0 for no result
+func resultSize(result *ToolResult) int64 {
+	if result == nil {
+		return 0
+	}
+	data, err := json.Marshal(result.Content)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
+
+// percentileRank returns the index of the nearest-rank percentile p in n sorted values
+func percentileRank(n int, p float64) int {
+	rank := int(p*float64(n)+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= n {
+		rank = n - 1
+	}
+	return rank
+}
+
+func (t *ServerStatsTracker) report(stats ServerStats) {
+	if len(stats.Violations) > 0 {
+		log.Printf("MCP server %s is missing its SLO: %v", stats.Server, stats.Violations)
+	} else {
+		log.Printf("MCP server %s is meeting its SLO again", stats.Server)
+	}
+	t.persist(stats)
+	if len(stats.Violations) > 0 {
+		t.Events.publish(Event{Type: EventSLOViolated, Server: stats.Server, Message: "MCP server is missing its SLO", Data: map[string]interface{}{"violations": stats.Violations}})
+	} else {
+		t.Events.publish(Event{Type: EventSLORecovered, Server: stats.Server, Message: "MCP server is meeting its SLO again"})
+	}
+	if t.TraceSink == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"server":           stats.Server,
+		"violating":        len(stats.Violations) > 0,
+		"p95LatencyMs":     stats.P95Latency.Milliseconds(),
+		"p95ResponseBytes": stats.P95ResponseBytes,
+	}
+	if len(stats.Violations) > 0 {
+		data["violations"] = stats.Violations
+	}
+	t.TraceSink.Emit(TraceEvent{Time: time.Now(), Type: TraceSLO, Data: data})
+}
+
+// Stats returns server's stats; ok is false when it has no calls recorded
+func (t *ServerStatsTracker) Stats(server string) (stats ServerStats, ok bool) {
+	if t == nil {
+		return ServerStats{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	samples, ok := t.servers[server]
+	if !ok {
+		return ServerStats{}, false
+	}
+	return t.summarize(server, samples), true
+}
+
+// All returns the stats of every server with calls recorded, ordered by server
+func (t *ServerStatsTracker) All() []ServerStats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	all := make([]ServerStats, 0, len(t.servers))
+	for server, samples := range t.servers {
+		all = append(all, t.summarize(server, samples))
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Server < all[j].Server })
+	return all
+}
+
+// Violating reports whether server is currently missing its SLO
+func (t *ServerStatsTracker) Violating(server string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	samples, ok := t.servers[server]
+	if !ok || !samples.violating {
+		return false
+	}
+	return samples.tripped != "" || samples.restoredUntil.IsZero() || time.Now().Before(samples.restoredUntil)
+}
+
+// ErrServerDown is returned by Admit for a server the HealthStore reports missing its SLO
+var ErrServerDown = errors.New("MCP server reported missing its SLO")
+
+// Admit fails fast with ErrServerDown while server's violating state was restored from the
+// HealthStore and hasn't expired, so a freshly started replica doesn't wait on calls to a
+// server the others already found failing. A nil tracker admits every call.
+func (t *ServerStatsTracker) Admit(server string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	samples, ok := t.servers[server]
+	if !ok || !samples.violating || samples.restoredUntil.IsZero() || !time.Now().Before(samples.restoredUntil) {
+		return nil
+	}
+	return fmt.Errorf("%w, not calling %s until %s", ErrServerDown, server, samples.restoredUntil.Format(time.RFC3339))
+}
+
+// Trip marks server as missing its SLO, whatever its calls show, until Reset; it is then
+// tried last like any violating server
+func (t *ServerStatsTracker) Trip(server, reason string) ServerStats {
+	if reason == "" {
+		reason = "no reason given"
+	}
+	return t.setTripped(server, reason)
+}
+
+// Reset clears a Trip and any restored verdict, so server is judged by its own calls again
+func (t *ServerStatsTracker) Reset(server string) ServerStats {
+	return t.setTripped(server, "")
+}
+
+func (t *ServerStatsTracker) setTripped(server, reason string) ServerStats {
+	t.mu.Lock()
+	samples, ok := t.servers[server]
+	if !ok {
+		samples = &serverSamples{}
+		t.servers[server] = samples
+	}
+	samples.tripped = reason
+	samples.restoredUntil = time.Time{}
+	stats := t.summarize(server, samples)
+	violating := len(stats.Violations) > 0
+	changed := violating != samples.violating
+	samples.violating = violating
+	t.mu.Unlock()
+
+	if changed {
+		t.report(stats)
+	}
+	return stats
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"mcp-client/pkg/mcpclient"
+)
+
+// ServerStartup is the handshake outcome of one MCP server
+type ServerStartup struct {
+	Server string `json:"server"`
+	OK     bool   `json:"ok"`
+	// Stage is the stage that failed, or the last stage when OK
+	Stage mcpclient.StartupStage `json:"stage"`
+	Tools int                    `json:"tools"`
+	Error string                 `json:"error,omitempty"`
+	// ErrorClass tells credential failures ("auth") apart from outages, see ErrorClass
+	ErrorClass string                            `json:"errorClass,omitempty"`
+	Stages     map[mcpclient.StartupStage]string `json:"stages"`
+	Duration   time.Duration                     `json:"duration"`
+}
+
+// StartupReport lists the handshake outcome of every MCP server, so operators can see which
+// server and stage failed. It is safe for concurrent use.
+type StartupReport struct {
+	mu      sync.Mutex
+	servers []ServerStartup
+
+	// events receives a server connected or failed event for each outcome; nil sends none
+	events *EventBus
+}
+
+// record adds or replaces the outcome for a server; a retried handshake overwrites the old one
+func (r *StartupReport) record(outcome ServerStartup) {
+	r.events.publish(startupEvent(outcome))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.servers {
+		if r.servers[i].Server == outcome.Server {
+			r.servers[i] = outcome
+			return
+		}
+	}
+	r.servers = append(r.servers, outcome)
+}
+
+// Servers returns a copy of the per-server outcomes
+func (r *StartupReport) Servers() []ServerStartup {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ServerStartup{}, r.servers...)
+}
+
+// Failed returns the servers whose handshake failed
+func (r *StartupReport) Failed() []ServerStartup {
+	var failed []ServerStartup
+	for _, s := range r.Servers() {
+		if !s.OK {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+// String formats the report as one line per server
+func (r *StartupReport) String() string {
+	var b strings.Builder
+	for _, s := range r.Servers() {
+		if s.OK {
+			fmt.Fprintf(&b, "%s: ok, %d tools in %s\n", s.Server, s.Tools, s.Duration)
+		} else {
+			fmt.Fprintf(&b, "%s: FAILED at %s after %s: %s\n", s.Server, s.Stage, s.Duration, s.Error)
+		}
+	}
+	return b.String()
+}
+
+// StartupReport returns the handshake outcomes of the agent's MCP servers so far
+func (a *InlineAgent) StartupReport() *StartupReport {
+	return &a.startup
+}
+
+// handshake initializes one MCP server and lists its tools with list (nil uses the caller's
+// ListTools), recording the outcome in report, which may be nil. Errors are StageErrors
+// naming the stage that failed.
+func handshake(ctx context.Context, caller MCPCaller, list func(ctx context.Context) ([]Tool, error), report *StartupReport) ([]Tool, error) {
+	start := time.Now()
+	outcome := ServerStartup{Server: callerName(caller), Stages: make(map[mcpclient.StartupStage]string)}
+	finish := func(tools []Tool, err error) ([]Tool, error) {
+		outcome.Duration = time.Since(start)
+		outcome.Tools = len(tools)
+		outcome.OK = err == nil
+		if err != nil {
+			var stageErr *mcpclient.StageError
+			if !errors.As(err, &stageErr) {
+				stageErr = &mcpclient.StageError{Server: outcome.Server, Stage: outcome.Stage, Err: err}
+				err = stageErr
+			}
+			outcome.Stage = stageErr.Stage
+			outcome.Error = stageErr.Err.Error()
+			outcome.ErrorClass = mcpclient.ErrorClass(stageErr.Err)
+			outcome.Stages[stageErr.Stage] = "failed"
+		}
+		if report != nil {
+			report.record(outcome)
+		}
+		return tools, err
+	}
+
+	outcome.Stage = mcpclient.StageInitialize
+	if err := caller.Initialize(ctx); err != nil {
+		return finish(nil, err)
+	}
+	outcome.Stages[mcpclient.StageConnect] = "ok"
+	outcome.Stages[mcpclient.StageInitialize] = "ok"
+	outcome.Stages[mcpclient.StageInitialized] = "ok"
+
+	timeout := mcpclient.DefaultHandshakeTimeouts().ListTools
+	if client, ok := caller.(*MCPClient); ok {
+		timeout = client.HandshakeTimeouts().ListTools
+		// Servers offering only resources or prompts are kept, just without tools
+		if !client.HasCapability("tools") {
+			log.Printf("MCP server %s has no tools capability, skipping tools/list", outcome.Server)
+			outcome.Stages[mcpclient.StageListTools] = "skipped"
+			return finish(nil, nil)
+		}
+	}
+	listCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if list == nil {
+		list = caller.ListTools
+	}
+	outcome.Stage = mcpclient.StageListTools
+	tools, err := list(listCtx)
+	if err != nil {
+		return finish(nil, err)
+	}
+	outcome.Stages[mcpclient.StageListTools] = "ok"
+	return finish(tools, nil)
+}
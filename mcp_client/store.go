@@ -0,0 +1,51 @@
+package main
+
+import "sync"
+
+// SessionStore holds the agent's sessions. Implementations must be safe for concurrent use.
+type SessionStore interface {
+	Get(id string) (*Session, bool)
+	Put(session *Session)
+	Delete(id string)
+}
+
+// MemorySessionStore keeps sessions in process memory; it is the default store
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewMemorySessionStore creates an empty in-memory store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*Session)}
+}
+
+func (s *MemorySessionStore) Get(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	return session, ok
+}
+
+func (s *MemorySessionStore) Put(session *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session
+}
+
+func (s *MemorySessionStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// List returns every session in the store
+func (s *MemorySessionStore) List() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// StreamOverflow is what a full event buffer does with more events
+type StreamOverflow string
+
+const (
+	// StreamCoalesce keeps the agent running: model text is merged into one consolidated
+	// chunk and other events are dropped until the consumer catches up
+	StreamCoalesce StreamOverflow = "coalesce"
+	// StreamBlock holds the agent loop until the consumer makes room
+	StreamBlock StreamOverflow = "block"
+)
+
+// ParseStreamOverflow maps "coalesce" or "block" to a StreamOverflow; empty is coalesce
+func ParseStreamOverflow(name string) (StreamOverflow, error) {
+	switch StreamOverflow(name) {
+	case "", StreamCoalesce:
+		return StreamCoalesce, nil
+	case StreamBlock:
+		return StreamBlock, nil
+	default:
+		return "", fmt.Errorf("unknown stream overflow %q, want coalesce or block", name)
+	}
+}
+
+// StreamBuffer puts a bounded queue between the agent loop and InvokeOptions.Events, so a
+// slow consumer such as a browser on a poor connection doesn't stall the loop
+type StreamBuffer struct {
+	// Size is how many events may wait for the consumer; 0 delivers events synchronously
+	Size int
+	// Overflow is what happens when Size events are waiting; empty coalesces
+	Overflow StreamOverflow
+}
+
+// eventQueue delivers events to deliver from its own goroutine
+type eventQueue struct {
+	deliver  func(TraceEvent)
+	size     int
+	overflow StreamOverflow
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// queue holds events in order; once it fills in coalesce mode, later events go to the
+	// overflow state until the queue has drained, so order is kept
+	queue       []TraceEvent
+	overflowing bool
+	text        strings.Builder
+	textEvent   *TraceEvent
+	dropped     int
+	closed      bool
+	done        chan struct{}
+}
+
+// buffered returns an Events callback that queues events for deliver, and a function that
+// waits until every queued event has been delivered and stops the queue
+func (b StreamBuffer) buffered(deliver func(TraceEvent)) (events func(TraceEvent), drain func()) {
+	if b.Size <= 0 || deliver == nil {
+		return deliver, func() {}
+	}
+	q := &eventQueue{deliver: deliver, size: b.Size, overflow: b.Overflow, done: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run()
+	return q.push, q.close
+}
+
+func (q *eventQueue) push(event TraceEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.overflow == StreamBlock {
+		for len(q.queue) >= q.size && !q.closed {
+			q.cond.Wait()
+		}
+	} else if q.overflowing || len(q.queue) >= q.size {
+		q.overflowing = true
+		q.coalesce(event)
+		return
+	}
+	if q.closed {
+		return
+	}
+	q.queue = append(q.queue, event)
+	q.cond.Broadcast()
+}
+
+// coalesce merges model text into one pending event and counts everything else as dropped
+func (q *eventQueue) coalesce(event TraceEvent) {
+	text, ok := event.Data["text"].(string)
+	if event.Type != TraceModelText || !ok {
+		q.dropped++
+		return
+	}
+	if q.textEvent == nil {
+		q.textEvent = &event
+	}
+	q.text.WriteString(text)
+}
+
+func (q *eventQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.queue) == 0 && !q.overflowing && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.queue) == 0 && !q.overflowing {
+			q.mu.Unlock()
+			return
+		}
+		var batch []TraceEvent
+		if len(q.queue) > 0 {
+			batch, q.queue = q.queue, nil
+		} else {
+			batch = q.flushOverflow()
+		}
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		for _, event := range batch {
+			q.deliver(event)
+		}
+	}
+}
+
+// flushOverflow returns the consolidated events for the overflow state and leaves it
+func (q *eventQueue) flushOverflow() []TraceEvent {
+	var batch []TraceEvent
+	if q.dropped > 0 {
+		batch = append(batch, TraceEvent{
+			Type: TraceStreamOverflow,
+			Data: map[string]interface{}{"dropped": q.dropped},
+		})
+	}
+	if q.textEvent != nil {
+		event := *q.textEvent
+		event.Data = map[string]interface{}{"text": q.text.String(), "coalesced": true}
+		batch = append(batch, event)
+	}
+	q.overflowing = false
+	q.text.Reset()
+	q.textEvent = nil
+	q.dropped = 0
+	return batch
+}
+
+// close delivers what is still queued and stops the queue; later events are discarded
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.done
+}
@@ -0,0 +1,595 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// gatewayActionGroup is the action group of the gateway's MCP server, for the gateway agent
+// and for direct tool calls to /invoke
+const gatewayActionGroup = "GatewayActionGroup"
+
+// defaultTenantHeader carries the tenant ID when the gateway sits behind a proxy that
+// authenticates callers
+const defaultTenantHeader = "X-Tenant-ID"
+
+// tenantIDPattern keeps tenant IDs usable as session prefixes and audit file names
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var (
+	// ErrTenantRateLimited is returned when a tenant sends requests faster than its rate limit
+	ErrTenantRateLimited = errors.New("tenant rate limit exceeded")
+	// ErrTenantBudgetExceeded is returned when a tenant has used its daily token budget
+	ErrTenantBudgetExceeded = errors.New("tenant daily token budget exhausted")
+	// ErrTenantForbidden is returned when a tenant uses an action group it isn't allowed
+	ErrTenantForbidden = errors.New("action group not allowed for tenant")
+)
+
+// Tenant is one team sharing the gateway
+type Tenant struct {
+	ID string `json:"id"`
+	// ActionGroups are the action groups the tenant may use; empty allows all
+	ActionGroups []string `json:"actionGroups,omitempty"`
+	// RequestsPerMinute limits /invoke calls and /ws prompts; 0 means no limit
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+	// Burst is how many requests may arrive at once; 0 uses RequestsPerMinute
+	Burst int `json:"burst,omitempty"`
+	// DailyTokenBudget caps the model tokens used per UTC day; 0 means no limit. Usage is
+	// counted per gateway replica.
+	DailyTokenBudget int `json:"dailyTokenBudget,omitempty"`
+	// RoleARN is assumed for the tenant's model calls, so they are authorized and billed
+	// under the tenant's own role; empty uses the gateway's credentials
+	RoleARN string `json:"roleArn,omitempty"`
+	// Models are the model IDs the tenant may use; empty allows any model
+	Models []string `json:"models,omitempty"`
+}
+
+// TenantsConfig is the gateway's tenants file. Tenants are identified by a header set by an
+// authenticating proxy or, when JWTClaim is set, by a claim of an HS256 bearer token.
+type TenantsConfig struct {
+	// Header carries the tenant ID; empty uses X-Tenant-ID
+	Header string `json:"header,omitempty"`
+	// JWTClaim takes the tenant ID from this claim of the Authorization bearer token instead
+	JWTClaim string `json:"jwtClaim,omitempty"`
+	// JWTSecretEnv names the environment variable holding the secret that signs the tokens
+	JWTSecretEnv string `json:"jwtSecretEnv,omitempty"`
+	// AuditDir receives one JSON lines audit log per tenant; empty writes audit records to the log
+	AuditDir string   `json:"auditDir,omitempty"`
+	Tenants  []Tenant `json:"tenants"`
+}
+
+// LoadTenantsConfig reads a JSON tenants file
+func LoadTenantsConfig(path string) (*TenantsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants config: %w", err)
+	}
+	var cfg TenantsConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// tenantGateway identifies the tenant of each gateway request
+type tenantGateway struct {
+	header    string
+	jwtClaim  string
+	jwtSecret []byte
+	tenants   map[string]*tenantState
+}
+
+// tenantState is a tenant's rate limit, budget and audit log
+type tenantState struct {
+	Tenant
+
+	// events receives the tenant's budget exceeded events; nil sends none
+	events TraceSink
+
+	// bedrock makes model calls with the tenant's role, or is nil to use the agent's client
+	bedrock ConverseAPI
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	day    string
+	used   int
+
+	auditMu sync.Mutex
+	audit   io.WriteCloser
+}
+
+func newTenantGateway(ctx context.Context, cfg *TenantsConfig, events TraceSink) (*tenantGateway, error) {
+	g := &tenantGateway{
+		header:   cfg.Header,
+		jwtClaim: cfg.JWTClaim,
+		tenants:  make(map[string]*tenantState, len(cfg.Tenants)),
+	}
+	if g.header == "" {
+		g.header = defaultTenantHeader
+	}
+	if g.jwtClaim != "" {
+		secret := os.Getenv(cfg.JWTSecretEnv)
+		if cfg.JWTSecretEnv == "" || secret == "" {
+			return nil, fmt.Errorf("jwtClaim requires jwtSecretEnv to name a non-empty environment variable")
+		}
+		g.jwtSecret = []byte(secret)
+	}
+	if len(cfg.Tenants) == 0 {
+		return nil, fmt.Errorf("no tenants configured")
+	}
+
+	for _, tenant := range cfg.Tenants {
+		if !tenantIDPattern.MatchString(tenant.ID) {
+			g.Close()
+			return nil, fmt.Errorf("invalid tenant ID %q, must match %s", tenant.ID, tenantIDPattern)
+		}
+		if _, ok := g.tenants[tenant.ID]; ok {
+			g.Close()
+			return nil, fmt.Errorf("duplicate tenant %s", tenant.ID)
+		}
+		state := &tenantState{Tenant: tenant, events: events}
+		if tenant.RoleARN != "" {
+			client, err := tenantBedrockClient(ctx, tenant)
+			if err != nil {
+				g.Close()
+				return nil, err
+			}
+			state.bedrock = client
+		}
+		if cfg.AuditDir != "" {
+			if err := os.MkdirAll(cfg.AuditDir, 0o700); err != nil {
+				g.Close()
+				return nil, fmt.Errorf("failed to create audit directory: %w", err)
+			}
+			f, err := os.OpenFile(filepath.Join(cfg.AuditDir, tenant.ID+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				g.Close()
+				return nil, fmt.Errorf("failed to open audit log for tenant %s: %w", tenant.ID, err)
+			}
+			state.audit = f
+		}
+		g.tenants[tenant.ID] = state
+	}
+	return g, nil
+}
+
+// tenantBedrockClient returns a Bedrock client that assumes the tenant's role. Credentials
+// are cached and refreshed before they expire.
+func tenantBedrockClient(ctx context.Context, tenant Tenant) (ConverseAPI, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), tenant.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = "gateway-" + tenant.ID
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	return bedrockruntime.NewFromConfig(cfg), nil
+}
+
+// Close closes the tenants' audit logs
+func (g *tenantGateway) Close() error {
+	if g == nil {
+		return nil
+	}
+	var errs []error
+	for _, t := range g.tenants {
+		if t.audit != nil {
+			errs = append(errs, t.audit.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// identify returns the tenant of a request, writing an error response when there is none.
+// A nil gateway serves a single tenant and returns a nil tenant.
+func (g *tenantGateway) identify(w http.ResponseWriter, r *http.Request) (*tenantState, bool) {
+	if g == nil {
+		return nil, true
+	}
+
+	tenant, status, err := g.resolve(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return nil, false
+	}
+	return tenant, true
+}
+
+// resolve returns the tenant of a request, or the error and HTTP status to reject it with
+func (g *tenantGateway) resolve(r *http.Request) (*tenantState, int, error) {
+	id, err := g.tenantID(r)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	tenant, ok := g.tenants[id]
+	if !ok {
+		log.Printf("Rejected request for unknown tenant %q", id)
+		return nil, http.StatusForbidden, fmt.Errorf("unknown tenant")
+	}
+	return tenant, http.StatusOK, nil
+}
+
+func (g *tenantGateway) tenantID(r *http.Request) (string, error) {
+	if g.jwtClaim == "" {
+		id := r.Header.Get(g.header)
+		if id == "" {
+			return "", fmt.Errorf("missing %s header", g.header)
+		}
+		return id, nil
+	}
+
+	// Browsers can't set headers on WebSocket requests, so /ws may pass the token as a query parameter
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("access_token")
+	}
+	if token == "" {
+		return "", fmt.Errorf("missing bearer token")
+	}
+	claims, err := verifyJWT(token, g.jwtSecret, time.Now())
+	if err != nil {
+		return "", err
+	}
+	id, _ := claims[g.jwtClaim].(string)
+	if id == "" {
+		return "", fmt.Errorf("token has no %s claim", g.jwtClaim)
+	}
+	return id, nil
+}
+
+// verifyJWT checks an HS256 token's signature and validity period and returns its claims
+func verifyJWT(token string, secret []byte, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.Unix() >= int64(exp) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Unix() < int64(nbf) {
+		return nil, fmt.Errorf("token not valid yet")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	return nil
+}
+
+// limit takes a request from the tenant's rate limit and, for prompts, checks its token budget
+func (t *tenantState) limit(prompt bool) error {
+	if t == nil {
+		return nil
+	}
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.RequestsPerMinute > 0 {
+		burst := float64(t.Burst)
+		if burst <= 0 {
+			burst = float64(t.RequestsPerMinute)
+		}
+		if t.last.IsZero() {
+			t.tokens = burst
+		} else {
+			t.tokens = math.Min(burst, t.tokens+now.Sub(t.last).Minutes()*float64(t.RequestsPerMinute))
+		}
+		t.last = now
+		if t.tokens < 1 {
+			return ErrTenantRateLimited
+		}
+		t.tokens--
+	}
+
+	if prompt && t.DailyTokenBudget > 0 {
+		t.rollDay(now)
+		if t.used >= t.DailyTokenBudget {
+			return ErrTenantBudgetExceeded
+		}
+	}
+	return nil
+}
+
+// charge counts an invocation's tokens against the tenant's budget
+func (t *tenantState) charge(result *Result) {
+	if t == nil || result == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollDay(time.Now())
+	t.used += result.Usage.TotalTokens
+}
+
+// rollDay resets the budget at the start of a UTC day; it must be called with mu held
+func (t *tenantState) rollDay(now time.Time) {
+	day := now.UTC().Format(time.DateOnly)
+	if t.day != day {
+		t.day = day
+		t.used = 0
+	}
+}
+
+// allowsGroup reports whether the tenant may use the named action group
+func (t *tenantState) allowsGroup(name string) bool {
+	if t == nil || len(t.ActionGroups) == 0 {
+		return true
+	}
+	for _, group := range t.ActionGroups {
+		if group == name {
+			return true
+		}
+	}
+	return false
+}
+
+// meta sets the tenant's ID in tool call metadata, overriding any the caller set, so MCP
+// servers can rely on it; a nil tenant returns meta unchanged
+func (t *tenantState) meta(meta map[string]interface{}) map[string]interface{} {
+	if t == nil {
+		return meta
+	}
+	scoped := map[string]interface{}{"tenant": t.ID}
+	for k, v := range meta {
+		if k != "tenant" {
+			scoped[k] = v
+		}
+	}
+	return scoped
+}
+
+// scopedKey prefixes a session ID or idempotency key with the tenant ID, so tenants can't
+// read or replay each other's; empty keys stay empty
+func (t *tenantState) scopedKey(key string) string {
+	if t == nil || key == "" {
+		return key
+	}
+	return t.ID + "." + key
+}
+
+// unscopedKey strips the tenant prefix scopedKey adds, for keys returned to the tenant
+func (t *tenantState) unscopedKey(key string) string {
+	if t == nil {
+		return key
+	}
+	return strings.TrimPrefix(key, t.ID+".")
+}
+
+// scope confines an invocation to the tenant's sessions, role and models and tags it with
+// the tenant. Only the tools of the tenant's action groups are offered and approved.
+func (t *tenantState) scope(ctx context.Context, agent *InlineAgent, opts InvokeOptions) (InvokeOptions, error) {
+	if t == nil {
+		return opts, nil
+	}
+
+	opts.SessionID = t.scopedKey(opts.SessionID)
+	if t.bedrock != nil {
+		opts.BedrockClient = t.bedrock
+	}
+	opts.AllowedModels = t.Models
+	tags := map[string]string{"tenant": t.ID}
+	for k, v := range opts.Tags {
+		tags[k] = v
+	}
+	opts.Tags = tags
+	opts.Meta = t.meta(opts.Meta)
+
+	if len(t.ActionGroups) == 0 {
+		return opts, nil
+	}
+
+	// Lazily registered groups have no tools until they are initialized
+	if err := agent.ensureActionGroups(ctx); err != nil {
+		return opts, err
+	}
+	allowed := make(map[string]bool)
+	for _, group := range agent.ActionGroups {
+		if !t.allowsGroup(group.Name) {
+			continue
+		}
+		for _, tool := range group.Tools {
+			if len(opts.Tools) == 0 || containsString(opts.Tools, tool.Name) {
+				allowed[tool.Name] = true
+			}
+		}
+	}
+	if len(allowed) == 0 {
+		return opts, ErrTenantForbidden
+	}
+	opts.Tools = opts.Tools[:0:0]
+	for name := range allowed {
+		opts.Tools = append(opts.Tools, name)
+	}
+	if agent.Workspace != nil {
+		for _, tool := range workspaceTools() {
+			allowed[tool.Name] = true
+		}
+	}
+
+	// The model is only offered allowed tools, but a call to any other tool is refused as well
+	approve := opts.ApproveTool
+	opts.ApproveTool = func(ctx context.Context, toolUse map[string]interface{}) (bool, error) {
+		name, _ := toolUse["name"].(string)
+		if !allowed[name] {
+			log.Printf("Refused tool %s for tenant %s", name, t.ID)
+			return false, nil
+		}
+		if approve != nil {
+			return approve(ctx, toolUse)
+		}
+		return true, nil
+	}
+	return opts, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// auditRecord is one line of a tenant's audit log
+type auditRecord struct {
+	Time          time.Time       `json:"time"`
+	Tenant        string          `json:"tenant"`
+	Endpoint      string          `json:"endpoint"`
+	SessionID     string          `json:"sessionId,omitempty"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	Tools         []auditToolCall `json:"tools,omitempty"`
+	Outcome       string          `json:"outcome"`
+	Error         string          `json:"error,omitempty"`
+	Tokens        int             `json:"tokens,omitempty"`
+	EstimatedCost float64         `json:"estimatedCost,omitempty"`
+}
+
+// auditToolCall is a tool call in an audit record. Arguments are recorded by the hash of
+// their canonical JSON, so identical calls can be correlated without logging their values.
+type auditToolCall struct {
+	Name          string `json:"name"`
+	ArgumentsHash string `json:"argumentsHash,omitempty"`
+}
+
+// newAuditToolCall records a call to name with args
+func newAuditToolCall(name string, args map[string]interface{}) auditToolCall {
+	call := auditToolCall{Name: name}
+	if args != nil {
+		call.ArgumentsHash, _ = canonicalHash(args)
+	}
+	return call
+}
+
+// record charges an invocation's result to the tenant and writes it to the tenant's audit log
+func (t *tenantState) record(rec auditRecord, result *Result, err error) {
+	if t == nil {
+		return
+	}
+	t.charge(result)
+
+	rec.Time = time.Now().UTC()
+	rec.Tenant = t.ID
+	rec.Outcome = auditOutcome(err)
+	if errors.Is(err, ErrTenantBudgetExceeded) && t.events != nil {
+		t.events.Emit(TraceEvent{
+			Time:      rec.Time,
+			Type:      TraceBudgetExceeded,
+			SessionID: rec.SessionID,
+			Error:     err.Error(),
+			Data:      map[string]interface{}{"budget": t.DailyTokenBudget, "endpoint": rec.Endpoint},
+			Tags:      map[string]string{"tenant": t.ID},
+		})
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if result != nil {
+		if rec.CorrelationID == "" {
+			rec.CorrelationID = result.CorrelationID
+		}
+		rec.Tokens = result.Usage.TotalTokens
+		rec.EstimatedCost = result.EstimatedCost
+		for _, call := range result.ToolCalls {
+			rec.Tools = append(rec.Tools, newAuditToolCall(call.Name, call.Input))
+		}
+	}
+
+	line, jsonErr := json.Marshal(rec)
+	if jsonErr != nil {
+		log.Printf("Failed to marshal audit record: %v", jsonErr)
+		return
+	}
+	if t.audit == nil {
+		log.Printf("audit: %s", line)
+		return
+	}
+	t.auditMu.Lock()
+	defer t.auditMu.Unlock()
+	if _, err := t.audit.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit log for tenant %s: %v", t.ID, err)
+	}
+}
+
+func auditOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrTenantRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrTenantBudgetExceeded):
+		return "budget_exceeded"
+	case errors.Is(err, ErrTenantForbidden), errors.Is(err, ErrModelNotAllowed), errors.Is(err, ErrToolCallDenied):
+		return "forbidden"
+	default:
+		return "error"
+	}
+}
+
+// tenantStatus is the HTTP status for a request refused or failed with err
+func tenantStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTenantRateLimited), errors.Is(err, ErrTenantBudgetExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrTenantForbidden), errors.Is(err, ErrModelNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, ErrAudioUnsupported):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// statusOutOfTime marks tool calls skipped because the time budget was used up
+const statusOutOfTime = "time_budget_exceeded"
+
+const (
+	// defaultModelReserve is kept back from tool calls for the model call that follows them
+	defaultModelReserve = 10 * time.Second
+	// defaultMinToolTime is the least time a tool call is started with
+	defaultMinToolTime = time.Second
+)
+
+// TimeBudget gives every invocation a deadline and splits it between model calls and tool
+// calls. Each tool call must finish early enough to leave ModelReserve for the model call
+// after it, and tool calls of the same turn share the time left evenly, so one slow tool
+// can't use up the request and fail the final answer.
+type TimeBudget struct {
+	// Timeout is the invocation's deadline; InvokeOptions.Timeout overrides it, and 0 sets none
+	Timeout time.Duration
+	// ModelReserve is kept back from tool calls for the next model call; 0 uses 10s
+	ModelReserve time.Duration
+	// MinToolTime is the least time a tool call is started with; a call that can't get it
+	// is skipped and the model told to answer with what it has. 0 uses 1s.
+	MinToolTime time.Duration
+}
+
+func (b *TimeBudget) modelReserve() time.Duration {
+	if b != nil && b.ModelReserve > 0 {
+		return b.ModelReserve
+	}
+	return defaultModelReserve
+}
+
+func (b *TimeBudget) minToolTime() time.Duration {
+	if b != nil && b.MinToolTime > 0 {
+		return b.MinToolTime
+	}
+	return defaultMinToolTime
+}
+
+// invocationBudget is the time budget of one running invocation
+type invocationBudget struct {
+	deadline     time.Time
+	modelReserve time.Duration
+	minToolTime  time.Duration
+}
+
+type invocationBudgetKey struct{}
+
+// RemainingBudget returns how much of the invocation's time budget is left, for tools that
+// can trade thoroughness for speed. ok is false when the invocation has no deadline. The
+// tool call's own, shorter deadline is ctx.Deadline.
+func RemainingBudget(ctx context.Context) (remaining time.Duration, ok bool) {
+	budget, ok := ctx.Value(invocationBudgetKey{}).(*invocationBudget)
+	if !ok {
+		return 0, false
+	}
+	return time.Until(budget.deadline), true
+}
+
+// startTimeBudget applies the invocation's deadline to ctx. The budget is nil when the
+// invocation has no timeout.
+func (a *InlineAgent) startTimeBudget(ctx context.Context, opts InvokeOptions, start time.Time) (context.Context, *invocationBudget, context.CancelFunc) {
+	var timeout time.Duration
+	if a.TimeBudget != nil {
+		timeout = a.TimeBudget.Timeout
+	}
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+	if timeout <= 0 {
+		return ctx, nil, func() {}
+	}
+
+	budget := &invocationBudget{
+		deadline:     start.Add(timeout),
+		modelReserve: a.TimeBudget.modelReserve(),
+		minToolTime:  a.TimeBudget.minToolTime(),
+	}
+	ctx, cancel := context.WithDeadline(ctx, budget.deadline)
+	return context.WithValue(ctx, invocationBudgetKey{}, budget), budget, cancel
+}
+
+// toolContext returns the context for the next of pending tool calls in a turn: it ends in
+// time to leave the model reserve, with the rest shared evenly by the pending calls. ok is
+// false when the share is under the minimum and the call should not be started.
+func (b *invocationBudget) toolContext(ctx context.Context, pending int) (context.Context, context.CancelFunc, bool) {
+	if b == nil {
+		return ctx, func() {}, true
+	}
+	if pending < 1 {
+		pending = 1
+	}
+	share := (time.Until(b.deadline) - b.modelReserve) / time.Duration(pending)
+	if share < b.minToolTime {
+		return ctx, func() {}, false
+	}
+	toolCtx, cancel := context.WithTimeout(ctx, share)
+	return toolCtx, cancel, true
+}
+
+// outOfTime stands in for a tool call there was no time left to run
+func (b *invocationBudget) outOfTime(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"toolUseId": toolUse["toolUseId"],
+		"content": []map[string]interface{}{
+			{"text": fmt.Sprintf("Not enough time left to run this tool (%s remaining in the request). Answer with the information you already have.", time.Until(b.deadline).Round(time.Second))},
+		},
+		"status": statusOutOfTime,
+	}, nil
+}
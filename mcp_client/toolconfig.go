@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// defaultToolConfigTokens is the tool configuration size past which answers tend to suffer
+const defaultToolConfigTokens = 8000
+
+// ErrToolConfigTooLarge is returned by Invoke when the tool configuration is over a failing limit
+var ErrToolConfigTooLarge = errors.New("tool configuration too large")
+
+// ToolConfigLimit bounds the estimated token size of the tool schemas sent with every model
+// call. Oversized tool configurations cost tokens on every turn and make the model worse at
+// picking tools, without any error from Bedrock.
+type ToolConfigLimit struct {
+	// MaxTokens is the estimated size allowed; 0 uses 8000
+	MaxTokens int
+	// Fail refuses invocations over the limit instead of logging a warning
+	Fail bool
+}
+
+func (l *ToolConfigLimit) maxTokens() int {
+	if l.MaxTokens > 0 {
+		return l.MaxTokens
+	}
+	return defaultToolConfigTokens
+}
+
+// toolConfigSize returns the JSON size of the tool specs and a token estimate of about four
+// bytes per token
+func toolConfigSize(tools []Tool) (int, int) {
+	specs := make([]map[string]interface{}, len(tools))
+	for i, tool := range tools {
+		specs[i] = map[string]interface{}{
+			"name":        tool.Name,
+			"description": tool.Description,
+			"inputSchema": map[string]interface{}{"json": tool.InputSchema},
+		}
+	}
+	data, err := json.Marshal(specs)
+	if err != nil {
+		return 0, 0
+	}
+	return len(data), (len(data) + 3) / 4
+}
+
+// checkToolConfigSize applies the agent's ToolConfigLimit to the tools of an invocation.
+// A warning is logged once per distinct size rather than on every call.
+func (a *InlineAgent) checkToolConfigSize(tools []Tool) error {
+	if a.ToolConfigLimit == nil {
+		return nil
+	}
+	bytes, tokens := toolConfigSize(tools)
+	limit := a.ToolConfigLimit.maxTokens()
+	if tokens <= limit {
+		return nil
+	}
+
+	if a.ToolConfigLimit.Fail {
+		return fmt.Errorf("%w: %d tools, about %d tokens (%d bytes), limit %d", ErrToolConfigTooLarge, len(tools), tokens, bytes, limit)
+	}
+	if a.toolConfigWarned.Swap(int64(tokens)) != int64(tokens) {
+		log.Printf("Warning: tool configuration is about %d tokens (%d tools, %d bytes), over the %d token limit; consider fewer tools or shorter descriptions",
+			tokens, len(tools), bytes, limit)
+	}
+	return nil
+}
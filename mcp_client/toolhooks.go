@@ -0,0 +1,118 @@
+package main
+
+import "strings"
+
+// ToolHook rewrites a tool definition at discovery time, before it is offered to the model.
+// Hooks must not rename parameters; use ToolOverride.RenameParams so calls can be mapped back.
+type ToolHook func(tool Tool) Tool
+
+// ToolOverride adjusts one discovered tool without changing the upstream MCP server
+type ToolOverride struct {
+	// Description replaces the upstream description when set
+	Description string
+	// AppendDescription is added after the (possibly replaced) description, e.g. org-specific usage guidance
+	AppendDescription string
+	// RenameParams maps upstream parameter names to the names shown to the model
+	RenameParams map[string]string
+	// ParamDescriptions replaces parameter descriptions, keyed by the name shown to the model
+	ParamDescriptions map[string]string
+}
+
+// augmentTools applies the group's overrides and then its hooks to freshly discovered tools
+func (g *ActionGroup) augmentTools(tools []Tool) []Tool {
+	if len(g.ToolOverrides) == 0 && len(g.ToolHooks) == 0 {
+		return tools
+	}
+
+	out := make([]Tool, len(tools))
+	for i, tool := range tools {
+		if override, ok := g.ToolOverrides[tool.Name]; ok {
+			tool = override.apply(tool)
+		}
+		for _, hook := range g.ToolHooks {
+			tool = hook(tool)
+		}
+		out[i] = tool
+	}
+	return out
+}
+
+func (o ToolOverride) apply(tool Tool) Tool {
+	if o.Description != "" {
+		tool.Description = o.Description
+	}
+	if o.AppendDescription != "" {
+		tool.Description = strings.TrimSpace(tool.Description + "\n\n" + o.AppendDescription)
+	}
+	if len(o.RenameParams) == 0 && len(o.ParamDescriptions) == 0 {
+		return tool
+	}
+
+	// Copy the schema so the upstream definition is left untouched
+	schema := make(map[string]interface{}, len(tool.InputSchema))
+	for k, v := range tool.InputSchema {
+		schema[k] = v
+	}
+
+	if props, ok := tool.InputSchema["properties"].(map[string]interface{}); ok {
+		renamed := make(map[string]interface{}, len(props))
+		for name, prop := range props {
+			if newName, ok := o.RenameParams[name]; ok {
+				name = newName
+			}
+			if desc, ok := o.ParamDescriptions[name]; ok {
+				if p, ok := prop.(map[string]interface{}); ok {
+					copied := make(map[string]interface{}, len(p))
+					for k, v := range p {
+						copied[k] = v
+					}
+					copied["description"] = desc
+					prop = copied
+				}
+			}
+			renamed[name] = prop
+		}
+		schema["properties"] = renamed
+	}
+
+	if required, ok := tool.InputSchema["required"].([]interface{}); ok {
+		renamed := make([]interface{}, len(required))
+		for i, r := range required {
+			if name, ok := r.(string); ok {
+				if newName, ok := o.RenameParams[name]; ok {
+					r = newName
+				}
+			}
+			renamed[i] = r
+		}
+		schema["required"] = renamed
+	}
+
+	tool.InputSchema = schema
+	return tool
+}
+
+// upstreamArguments maps renamed parameters in a tool call back to the upstream names
+func (a *InlineAgent) upstreamArguments(toolName string, input map[string]interface{}) map[string]interface{} {
+	for _, group := range a.ActionGroups {
+		override, ok := group.ToolOverrides[toolName]
+		if !ok || len(override.RenameParams) == 0 {
+			continue
+		}
+
+		upstream := make(map[string]string, len(override.RenameParams))
+		for from, to := range override.RenameParams {
+			upstream[to] = from
+		}
+
+		args := make(map[string]interface{}, len(input))
+		for name, value := range input {
+			if original, ok := upstream[name]; ok {
+				name = original
+			}
+			args[name] = value
+		}
+		return args
+	}
+	return input
+}
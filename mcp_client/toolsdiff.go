@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ToolChange is how one tool's definition changed
+type ToolChange struct {
+	Tool          string   `json:"tool"`
+	AddedParams   []string `json:"addedParams,omitempty"`
+	RemovedParams []string `json:"removedParams,omitempty"`
+	// RetypedParams changed their JSON schema type
+	RetypedParams    []string `json:"retypedParams,omitempty"`
+	NewlyRequired    []string `json:"newlyRequired,omitempty"`
+	NoLongerRequired []string `json:"noLongerRequired,omitempty"`
+	// SchemaChanged is set when the schema changed in ways not itemized above
+	SchemaChanged      bool `json:"schemaChanged,omitempty"`
+	DescriptionChanged bool `json:"descriptionChanged,omitempty"`
+}
+
+// Breaking reports whether calls that worked before the change may now fail
+func (c ToolChange) Breaking() bool {
+	return len(c.RemovedParams) > 0 || len(c.RetypedParams) > 0 || len(c.NewlyRequired) > 0
+}
+
+// ToolSchemaDiff is how a server's tools changed between two listings
+type ToolSchemaDiff struct {
+	Server  string       `json:"server"`
+	Added   []string     `json:"added,omitempty"`
+	Removed []string     `json:"removed,omitempty"`
+	Changed []ToolChange `json:"changed,omitempty"`
+}
+
+// Empty reports whether the listings were equivalent
+func (d *ToolSchemaDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Breaking reports whether a tool was removed or changed incompatibly
+func (d *ToolSchemaDiff) Breaking() bool {
+	if len(d.Removed) > 0 {
+		return true
+	}
+	for _, c := range d.Changed {
+		if c.Breaking() {
+			return true
+		}
+	}
+	return false
+}
+
+// String summarizes the diff on one line
+func (d *ToolSchemaDiff) String() string {
+	var parts []string
+	if len(d.Added) > 0 {
+		parts = append(parts, "added "+strings.Join(d.Added, ", "))
+	}
+	if len(d.Removed) > 0 {
+		parts = append(parts, "removed "+strings.Join(d.Removed, ", "))
+	}
+	for _, c := range d.Changed {
+		var details []string
+		for _, item := range []struct {
+			label  string
+			params []string
+		}{
+			{"+", c.AddedParams},
+			{"-", c.RemovedParams},
+			{"retyped ", c.RetypedParams},
+			{"now required ", c.NewlyRequired},
+			{"now optional ", c.NoLongerRequired},
+		} {
+			for _, p := range item.params {
+				details = append(details, item.label+p)
+			}
+		}
+		if c.SchemaChanged && len(details) == 0 {
+			details = append(details, "schema")
+		}
+		if c.DescriptionChanged {
+			details = append(details, "description")
+		}
+		parts = append(parts, fmt.Sprintf("changed %s (%s)", c.Tool, strings.Join(details, ", ")))
+	}
+	return fmt.Sprintf("%s: %s", d.Server, strings.Join(parts, "; "))
+}
+
+// TraceEvent converts the diff into a trace event for a TraceSink
+func (d *ToolSchemaDiff) TraceEvent() TraceEvent {
+	return TraceEvent{
+		Time: time.Now(),
+		Type: TraceToolSchemaChange,
+		Data: map[string]interface{}{
+			"server":   d.Server,
+			"added":    d.Added,
+			"removed":  d.Removed,
+			"changed":  d.Changed,
+			"breaking": d.Breaking(),
+		},
+	}
+}
+
+// DiffTools compares two listings of a server's tools
+func DiffTools(server string, before, after []Tool) *ToolSchemaDiff {
+	diff := &ToolSchemaDiff{Server: server}
+
+	old := make(map[string]Tool, len(before))
+	for _, tool := range before {
+		old[tool.Name] = tool
+	}
+	current := make(map[string]bool, len(after))
+	for _, tool := range after {
+		current[tool.Name] = true
+		prev, ok := old[tool.Name]
+		if !ok {
+			diff.Added = append(diff.Added, tool.Name)
+			continue
+		}
+		if change, changed := diffTool(prev, tool); changed {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for _, tool := range before {
+		if !current[tool.Name] {
+			diff.Removed = append(diff.Removed, tool.Name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Tool < diff.Changed[j].Tool })
+	return diff
+}
+
+func diffTool(before, after Tool) (ToolChange, bool) {
+	change := ToolChange{Tool: after.Name, DescriptionChanged: before.Description != after.Description}
+
+	oldProps := schemaProperties(before.InputSchema)
+	newProps := schemaProperties(after.InputSchema)
+	for name, prop := range newProps {
+		oldProp, ok := oldProps[name]
+		if !ok {
+			change.AddedParams = append(change.AddedParams, name)
+		} else if schemaType(oldProp) != schemaType(prop) {
+			change.RetypedParams = append(change.RetypedParams, name)
+		}
+	}
+	for name := range oldProps {
+		if _, ok := newProps[name]; !ok {
+			change.RemovedParams = append(change.RemovedParams, name)
+		}
+	}
+
+	oldRequired := schemaRequired(before.InputSchema)
+	newRequired := schemaRequired(after.InputSchema)
+	for name := range newRequired {
+		if !oldRequired[name] {
+			change.NewlyRequired = append(change.NewlyRequired, name)
+		}
+	}
+	for name := range oldRequired {
+		if !newRequired[name] {
+			change.NoLongerRequired = append(change.NoLongerRequired, name)
+		}
+	}
+
+	for _, list := range [][]string{change.AddedParams, change.RemovedParams, change.RetypedParams, change.NewlyRequired, change.NoLongerRequired} {
+		sort.Strings(list)
+	}
+
+	itemized := len(change.AddedParams)+len(change.RemovedParams)+len(change.RetypedParams)+len(change.NewlyRequired)+len(change.NoLongerRequired) > 0
+	change.SchemaChanged = itemized || !reflect.DeepEqual(before.InputSchema, after.InputSchema)
+	return change, change.SchemaChanged || change.DescriptionChanged
+}
+
+// schemaProperties returns the top-level properties of an object schema
+func schemaProperties(schema map[string]interface{}) map[string]interface{} {
+	props, _ := schema["properties"].(map[string]interface{})
+	return props
+}
+
+// schemaType returns a property's type, joining type lists such as ["string", "null"]
+func schemaType(prop interface{}) string {
+	m, _ := prop.(map[string]interface{})
+	switch t := m["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			types = append(types, fmt.Sprint(v))
+		}
+		sort.Strings(types)
+		return strings.Join(types, "|")
+	}
+	return ""
+}
+
+// schemaRequired returns the set of required top-level properties
+func schemaRequired(schema map[string]interface{}) map[string]bool {
+	required := make(map[string]bool)
+	switch list := schema["required"].(type) {
+	case []interface{}:
+		for _, v := range list {
+			if name, ok := v.(string); ok {
+				required[name] = true
+			}
+		}
+	case []string:
+		for _, name := range list {
+			required[name] = true
+		}
+	}
+	return required
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trace event types emitted by the agent loop
+const (
+	TraceInvocationStart = "invocation_start"
+	TraceInvocationEnd   = "invocation_end"
+	TraceModelCall       = "model_call"
+	TraceToolCall        = "tool_call"
+	TraceGuardrail       = "guardrail"
+	TraceRetrieval       = "retrieval"
+	// TraceModelText carries the model's text for a turn; it is only delivered to
+	// InvokeOptions.Events, never to the agent's TraceSink
+	TraceModelText = "model_text"
+	// TraceToolSchemaChange reports how a server's tools changed when they were re-listed
+	TraceToolSchemaChange = "tool_schema_change"
+	// TracePolicy reports a tool call the tool policy denied or rewrote
+	TracePolicy = "policy"
+	// TraceBudgetExceeded reports a request refused because a token budget was used up
+	TraceBudgetExceeded = "budget_exceeded"
+	// TraceCompaction reports a conversation compacted to fit the model's context window
+	TraceCompaction = "compaction"
+	// TraceShadow compares a tool call's result from a shadow candidate server with the primary's
+	TraceShadow = "shadow"
+	// TraceSLO reports an MCP server starting or ceasing to miss its latency or size SLO
+	TraceSLO = "slo"
+	// TraceInjection reports likely prompt injection found in a tool output, and what was done about it
+	TraceInjection = "injection"
+	// TraceResponsePolicy reports a final answer rewritten to meet the response policy's format or length
+	TraceResponsePolicy = "response_policy"
+	// TraceStreamOverflow reports events a slow consumer missed; only its event stream sees it
+	TraceStreamOverflow = "stream_overflow"
+)
+
+// TraceEvent is one structured event from the agent loop
+type TraceEvent struct {
+	Time      time.Time              `json:"time"`
+	Type      string                 `json:"type"`
+	SessionID string                 `json:"sessionId,omitempty"`
+	Tool      string                 `json:"tool,omitempty"`
+	Duration  time.Duration          `json:"duration,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Tags      map[string]string      `json:"tags,omitempty"`
+	// CorrelationID identifies the invocation across logs, traces, audit records and MCP requests
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+// TraceSink receives every agent-loop event. Implementations must be safe for concurrent use.
+type TraceSink interface {
+	Emit(event TraceEvent)
+}
+
+// JSONLTraceSink writes trace events to a file as JSON lines
+type JSONLTraceSink struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewJSONLTraceSink opens (or creates) path for appending trace events
+func NewJSONLTraceSink(path string) (*JSONLTraceSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return &JSONLTraceSink{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Emit writes the event as a single line
+func (s *JSONLTraceSink) Emit(event TraceEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return
+	}
+	if err := s.enc.Encode(event); err != nil {
+		log.Printf("Failed to write trace event: %v", err)
+	}
+}
+
+// Close flushes and closes the trace file
+func (s *JSONLTraceSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// multiTraceSink sends every event to several sinks
+type multiTraceSink []TraceSink
+
+// NewMultiTraceSink returns a sink that forwards events to each of sinks, skipping nil ones
+func NewMultiTraceSink(sinks ...TraceSink) TraceSink {
+	var multi multiTraceSink
+	for _, sink := range sinks {
+		if sink != nil {
+			multi = append(multi, sink)
+		}
+	}
+	if len(multi) == 1 {
+		return multi[0]
+	}
+	return multi
+}
+
+func (m multiTraceSink) Emit(event TraceEvent) {
+	for _, sink := range m {
+		sink.Emit(event)
+	}
+}
+
+// trace sends an event to the agent's trace sink, if one is configured
+func (a *InlineAgent) trace(event TraceEvent) {
+	if a.TraceSink == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	a.TraceSink.Emit(event)
+}
+
+// TraceFilter limits which events reach a sink. Empty EventTypes or Tools allow everything;
+// SampleRate between 0 and 1 keeps that fraction of the remaining events. Events carrying an
+// error are always kept so failures stay visible when sampling.
+type TraceFilter struct {
+	EventTypes []string
+	Tools      []string
+	SampleRate float64
+}
+
+// TraceFilterFromEnv reads a filter from TRACE_EVENT_TYPES and TRACE_TOOLS (comma-separated)
+// and TRACE_SAMPLE_RATE, so each environment can tune how much it traces
+func TraceFilterFromEnv() (TraceFilter, error) {
+	filter := TraceFilter{
+		EventTypes: splitList(os.Getenv("TRACE_EVENT_TYPES")),
+		Tools:      splitList(os.Getenv("TRACE_TOOLS")),
+		SampleRate: 1,
+	}
+
+	if v := os.Getenv("TRACE_SAMPLE_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return filter, fmt.Errorf("invalid TRACE_SAMPLE_RATE %q: must be between 0 and 1", v)
+		}
+		filter.SampleRate = rate
+	}
+
+	return filter, nil
+}
+
+// filteredTraceSink forwards events that pass a TraceFilter to another sink
+type filteredTraceSink struct {
+	next       TraceSink
+	eventTypes map[string]bool
+	tools      map[string]bool
+	sampleRate float64
+}
+
+// NewFilteredTraceSink wraps next so it only receives events matching filter
+func NewFilteredTraceSink(next TraceSink, filter TraceFilter) TraceSink {
+	sink := &filteredTraceSink{
+		next:       next,
+		eventTypes: make(map[string]bool),
+		tools:      make(map[string]bool),
+		sampleRate: filter.SampleRate,
+	}
+	for _, t := range filter.EventTypes {
+		sink.eventTypes[t] = true
+	}
+	for _, t := range filter.Tools {
+		sink.tools[t] = true
+	}
+	return sink
+}
+
+func (s *filteredTraceSink) Emit(event TraceEvent) {
+	if event.Error == "" {
+		if len(s.eventTypes) > 0 && !s.eventTypes[event.Type] {
+			return
+		}
+		if len(s.tools) > 0 && event.Tool != "" && !s.tools[event.Tool] {
+			return
+		}
+		if s.sampleRate < 1 && rand.Float64() >= s.sampleRate {
+			return
+		}
+	}
+	s.next.Emit(event)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
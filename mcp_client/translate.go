@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+const (
+	// defaultTranslationShare is the share of letters outside the Latin script above which a
+	// tool output is translated
+	defaultTranslationShare = 0.2
+	// defaultMaxTranslationChars bounds the outputs sent for translation
+	defaultMaxTranslationChars = 20000
+)
+
+// Translator translates text into language, e.g. with Amazon Translate
+type Translator func(ctx context.Context, text, language string) (string, error)
+
+// ToolTranslation translates tool outputs written in another script, such as Japanese, into
+// the conversation language before they enter the model's context. Detection counts letters
+// outside the Latin script, so Language should be one written in it.
+type ToolTranslation struct {
+	// Language is the conversation language, e.g. "English"
+	Language string
+	// Tools limits translation to these tools; empty translates the output of any tool
+	Tools []string
+	// Share is the share of non-Latin letters above which an output is translated; 0 uses 0.2
+	Share float64
+	// MaxChars skips outputs longer than this, keeping them as they are; 0 allows 20000
+	MaxChars int
+	// Translate does the translation; nil asks the agent's foundation model, through the
+	// invocation's Bedrock client and only when the invocation may use that model
+	Translate Translator
+}
+
+type translationModelKey struct{}
+
+// translationModel is the Converse client and model an invocation's tool outputs are
+// translated with
+type translationModel struct {
+	client  ConverseAPI
+	modelID string
+}
+
+// withTranslationModel attaches the model an invocation translates tool outputs with to ctx
+func withTranslationModel(ctx context.Context, client ConverseAPI, modelID string) context.Context {
+	return context.WithValue(ctx, translationModelKey{}, translationModel{client: client, modelID: modelID})
+}
+
+// foreignShare returns the share of letters in text that aren't in the Latin script
+func foreignShare(text string) float64 {
+	var letters, foreign int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if !unicode.Is(unicode.Latin, r) {
+			foreign++
+		}
+	}
+	if letters == 0 {
+		return 0
+	}
+	return float64(foreign) / float64(letters)
+}
+
+// wants reports whether toolName's output text should be translated
+func (t *ToolTranslation) wants(toolName, text string) bool {
+	if len(t.Tools) > 0 && !containsString(t.Tools, toolName) {
+		return false
+	}
+	share := t.Share
+	if share <= 0 {
+		share = defaultTranslationShare
+	}
+	return foreignShare(text) > share
+}
+
+// modelTranslator translates with a Converse model, keeping structure and identifiers
+func modelTranslator(client ConverseAPI, modelID string) Translator {
+	return func(ctx context.Context, text, language string) (string, error) {
+		output, err := client.Converse(ctx, &bedrockruntime.ConverseInput{
+			ModelId: aws.String(modelID),
+			System: []types.SystemContentBlock{
+				&types.SystemContentBlockMemberText{
+					Value: fmt.Sprintf("Translate the tool output the user sends into %s. Keep its structure, JSON keys, identifiers, numbers, code and URLs unchanged. Reply with the translation only.", language),
+				},
+			},
+			Messages: []types.Message{{
+				Role:    types.ConversationRoleUser,
+				Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: text}},
+			}},
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to translate: %w", err)
+		}
+		if output.Output == nil || output.Output.Message == nil {
+			return "", fmt.Errorf("failed to translate: no message in response")
+		}
+		var b strings.Builder
+		for _, block := range output.Output.Message.Content {
+			if textBlock, ok := block.(*types.ContentBlockMemberText); ok {
+				b.WriteString(textBlock.Value)
+			}
+		}
+		return b.String(), nil
+	}
+}
+
+// translateResult translates the text blocks of a tool result the translation wants. A
+// failed translation keeps the original text. Without a Translator, outputs are only
+// translated within an invocation that attached its model with withTranslationModel.
+func (a *InlineAgent) translateResult(ctx context.Context, toolName string, result *ToolResult) {
+	t := a.Translation
+	if t == nil {
+		return
+	}
+	translate := t.Translate
+	if translate == nil {
+		model, ok := ctx.Value(translationModelKey{}).(translationModel)
+		if !ok {
+			return
+		}
+		translate = modelTranslator(model.client, model.modelID)
+	}
+	maxChars := t.MaxChars
+	if maxChars <= 0 {
+		maxChars = defaultMaxTranslationChars
+	}
+
+	for i, block := range result.Content {
+		if (block.Type != "" && block.Type != "text") || !t.wants(toolName, block.Text) {
+			continue
+		}
+		if len([]rune(block.Text)) > maxChars {
+			logf(ctx, "Not translating %s output of %d bytes, over the %d character limit", toolName, len(block.Text), maxChars)
+			continue
+		}
+		translated, err := translate(ctx, block.Text, t.Language)
+		if err != nil {
+			logf(ctx, "Keeping untranslated %s output: %v", toolName, err)
+			continue
+		}
+		result.Content[i].Text = translated
+	}
+}
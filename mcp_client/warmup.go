@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// Warm-up states reported by WarmUpStatus
+const (
+	WarmUpPending = "pending"
+	WarmUpRunning = "running"
+	WarmUpReady   = "ready"
+	WarmUpFailed  = "failed"
+)
+
+// WarmUpStep is one step of a warm-up
+type WarmUpStep struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// WarmUpStatus reports how far a warm-up has got
+type WarmUpStatus struct {
+	State    string       `json:"state"`
+	Started  time.Time    `json:"started,omitempty"`
+	Finished time.Time    `json:"finished,omitempty"`
+	Steps    []WarmUpStep `json:"steps,omitempty"`
+}
+
+// warmUpTracker records the agent's warm-up for readiness checks
+type warmUpTracker struct {
+	mu     sync.Mutex
+	status WarmUpStatus
+}
+
+func (t *warmUpTracker) get() WarmUpStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := t.status
+	status.Steps = append([]WarmUpStep{}, t.status.Steps...)
+	if status.State == "" {
+		status.State = WarmUpPending
+	}
+	return status
+}
+
+func (t *warmUpTracker) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = WarmUpStatus{State: WarmUpRunning, Started: time.Now()}
+}
+
+// step runs fn as a named step and records its outcome
+func (t *warmUpTracker) step(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	step := WarmUpStep{Name: name, Duration: time.Since(start)}
+	if err != nil {
+		step.Error = err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Steps = append(t.status.Steps, step)
+	return err
+}
+
+func (t *warmUpTracker) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.State = WarmUpReady
+	if err != nil {
+		t.status.State = WarmUpFailed
+	}
+	t.status.Finished = time.Now()
+}
+
+// WarmUp pays the cold-path costs before the first user request: it initializes every MCP
+// server, builds and checks the tool configuration and, with converse, makes a one-token
+// model call so credentials are resolved and a connection to Bedrock is open. The outcome
+// is reported by WarmUpStatus.
+func (a *InlineAgent) WarmUp(ctx context.Context, converse bool) error {
+	a.warmUp.start()
+	err := a.warmUpSteps(ctx, converse)
+	a.warmUp.finish(err)
+	return err
+}
+
+func (a *InlineAgent) warmUpSteps(ctx context.Context, converse bool) error {
+	if err := a.warmUp.step("mcp_servers", func() error {
+		return a.ensureActionGroups(ctx)
+	}); err != nil {
+		return err
+	}
+
+	if err := a.warmUp.step("tool_config", func() error {
+		tools := a.selectedTools(nil)
+		if err := a.checkToolConfigSize(tools); err != nil {
+			return err
+		}
+		if built := a.buildToolConfig(tools); len(built) != len(tools) {
+			return fmt.Errorf("%d of %d tool schemas could not be encoded", len(tools)-len(built), len(tools))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if !converse {
+		return nil
+	}
+	return a.warmUp.step("converse", func() error {
+		_, err := a.bedrockClient.Converse(ctx, &bedrockruntime.ConverseInput{
+			ModelId: aws.String(a.FoundationModel),
+			Messages: []types.Message{{
+				Role:    types.ConversationRoleUser,
+				Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: "ping"}},
+			}},
+			InferenceConfig: &types.InferenceConfiguration{MaxTokens: aws.Int32(1)},
+		})
+		if err != nil {
+			return fmt.Errorf("warm-up model call failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// WarmUpStatus returns the state and steps of the agent's warm-up; pending when none has run
+func (a *InlineAgent) WarmUpStatus() WarmUpStatus {
+	return a.warmUp.get()
+}
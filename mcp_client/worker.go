@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// WorkerJob is an invocation request read from the queue
+type WorkerJob struct {
+	// ID names the job's result; empty uses the SQS message ID
+	ID          string            `json:"id,omitempty"`
+	InputText   string            `json:"inputText"`
+	SessionID   string            `json:"sessionId,omitempty"`
+	Preset      string            `json:"preset,omitempty"`
+	ModelID     string            `json:"modelId,omitempty"`
+	Instruction string            `json:"instruction,omitempty"`
+	Tools       []string          `json:"tools,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// WorkerOutcome is a job's result as stored and as sent in its completion event
+type WorkerOutcome struct {
+	JobID string `json:"jobId"`
+	// Status is "succeeded" or "failed"
+	Status     string    `json:"status"`
+	Result     *Result   `json:"result,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Location is where the outcome was stored, e.g. s3://bucket/prefix/job.json
+	Location string `json:"location,omitempty"`
+}
+
+// SQSAPI is the subset of the SQS client the worker uses
+type SQSAPI interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// ResultStore keeps job outcomes
+type ResultStore interface {
+	// Put stores the outcome and returns where it was stored
+	Put(ctx context.Context, outcome *WorkerOutcome) (string, error)
+}
+
+// OpenResultStore opens a result store at location, either "s3://bucket/prefix" or "dynamodb://<table>"
+func OpenResultStore(ctx context.Context, location string) (ResultStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("an S3 bucket name is required")
+		}
+		return &S3ResultStore{client: s3.NewFromConfig(cfg), bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+	}
+	if table, ok := strings.CutPrefix(location, "dynamodb://"); ok {
+		if table == "" {
+			return nil, fmt.Errorf("a DynamoDB table name is required")
+		}
+		return &DynamoDBResultStore{client: dynamodb.NewFromConfig(cfg), table: table}, nil
+	}
+	return nil, fmt.Errorf("unsupported result store %q, expected s3://bucket/prefix or dynamodb://table", location)
+}
+
+// S3ResultStore writes each outcome as JSON to <prefix>/<job ID>.json
+type S3ResultStore struct {
+	client S3API
+	bucket string
+	prefix string
+}
+
+func (s *S3ResultStore) Put(ctx context.Context, outcome *WorkerOutcome) (string, error) {
+	key := outcome.JobID + ".json"
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	body, err := json.Marshal(outcome)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal outcome: %w", err)
+	}
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
+
+// DynamoDBPutAPI is the subset of the DynamoDB client the result store uses
+type DynamoDBPutAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// DynamoDBResultStore writes each outcome as an item keyed by "jobId" (string), with
+// "status", "text", "error", "finishedAt" (RFC 3339) and the full outcome as JSON in "outcome"
+type DynamoDBResultStore struct {
+	client DynamoDBPutAPI
+	table  string
+}
+
+func (s *DynamoDBResultStore) Put(ctx context.Context, outcome *WorkerOutcome) (string, error) {
+	body, err := json.Marshal(outcome)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal outcome: %w", err)
+	}
+	item := map[string]dbtypes.AttributeValue{
+		"jobId":      &dbtypes.AttributeValueMemberS{Value: outcome.JobID},
+		"status":     &dbtypes.AttributeValueMemberS{Value: outcome.Status},
+		"finishedAt": &dbtypes.AttributeValueMemberS{Value: outcome.FinishedAt.Format(time.RFC3339)},
+		"outcome":    &dbtypes.AttributeValueMemberS{Value: string(body)},
+	}
+	if outcome.Result != nil && outcome.Result.Text != "" {
+		item["text"] = &dbtypes.AttributeValueMemberS{Value: outcome.Result.Text}
+	}
+	if outcome.Error != "" {
+		item["error"] = &dbtypes.AttributeValueMemberS{Value: outcome.Error}
+	}
+
+	if _, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(s.table), Item: item}); err != nil {
+		return "", fmt.Errorf("failed to write result %s to %s: %w", outcome.JobID, s.table, err)
+	}
+	return fmt.Sprintf("dynamodb://%s/%s", s.table, outcome.JobID), nil
+}
+
+// Worker runs the agent on invocation requests from an SQS queue
+type Worker struct {
+	Agent    *InlineAgent
+	Queue    SQSAPI
+	QueueURL string
+	Results  ResultStore
+	// EventsQueueURL receives a completion event per job; empty sends none
+	EventsQueueURL string
+	// Concurrency is how many jobs run at once; 0 runs one
+	Concurrency int
+}
+
+// Run receives and processes jobs until ctx is cancelled, then waits for running jobs to finish.
+// A job's message is deleted once its outcome is stored, so jobs whose outcome could not be
+// stored are received again after the queue's visibility timeout.
+func (w *Worker) Run(ctx context.Context) {
+	concurrency := w.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		// Only ask for as many messages as there are free slots, so the rest stay available to other workers
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		free := 1
+	fill:
+		for free < concurrency && free < 10 {
+			select {
+			case slots <- struct{}{}:
+				free++
+			default:
+				break fill
+			}
+		}
+
+		out, err := w.Queue.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(w.QueueURL),
+			MaxNumberOfMessages: int32(free),
+			WaitTimeSeconds:     20,
+		})
+		if err != nil {
+			for i := 0; i < free; i++ {
+				<-slots
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Failed to receive from %s: %v", w.QueueURL, err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for i := len(out.Messages); i < free; i++ {
+			<-slots
+		}
+		for _, msg := range out.Messages {
+			wg.Add(1)
+			go func(msg sqstypes.Message) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				w.process(msg)
+			}(msg)
+		}
+	}
+}
+
+// process runs one job. It uses its own context so a shutdown lets running jobs finish.
+func (w *Worker) process(msg sqstypes.Message) {
+	ctx := context.Background()
+	outcome := &WorkerOutcome{JobID: aws.ToString(msg.MessageId), StartedAt: time.Now()}
+
+	var job WorkerJob
+	err := json.Unmarshal([]byte(aws.ToString(msg.Body)), &job)
+	if err == nil && job.InputText == "" {
+		err = fmt.Errorf("inputText is required")
+	}
+	if job.ID != "" {
+		if workspaceNamePattern.MatchString(job.ID) {
+			outcome.JobID = job.ID
+		} else {
+			log.Printf("Ignoring invalid job ID %q, using message ID %s", job.ID, outcome.JobID)
+		}
+	}
+
+	if err != nil {
+		err = fmt.Errorf("invalid job: %w", err)
+	} else {
+		outcome.Result, err = w.Agent.InvokeWithOptions(job.InputText, InvokeOptions{
+			SessionID:   job.SessionID,
+			Preset:      job.Preset,
+			ModelID:     job.ModelID,
+			Instruction: job.Instruction,
+			Tools:       job.Tools,
+			Tags:        job.Tags,
+			Priority:    PriorityBatch,
+			// The job ID finds the job's log lines, traces and MCP requests
+			CorrelationID: outcome.JobID,
+		})
+	}
+	outcome.FinishedAt = time.Now()
+	outcome.Status = "succeeded"
+	if err != nil {
+		outcome.Status = "failed"
+		outcome.Error = err.Error()
+	}
+
+	location, err := w.Results.Put(ctx, outcome)
+	if err != nil {
+		log.Printf("Job %s: %v, leaving it on the queue", outcome.JobID, err)
+		return
+	}
+	outcome.Location = location
+	log.Printf("Job %s %s in %s, stored at %s", outcome.JobID, outcome.Status, outcome.FinishedAt.Sub(outcome.StartedAt).Round(time.Millisecond), location)
+
+	if w.EventsQueueURL != "" {
+		if err := w.sendEvent(ctx, outcome); err != nil {
+			log.Printf("Job %s: failed to send completion event: %v", outcome.JobID, err)
+		}
+	}
+
+	if _, err := w.Queue.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(w.QueueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	}); err != nil {
+		log.Printf("Job %s: failed to delete message: %v", outcome.JobID, err)
+	}
+}
+
+// sendEvent sends the completion event, which carries the outcome without the answer text
+func (w *Worker) sendEvent(ctx context.Context, outcome *WorkerOutcome) error {
+	event := map[string]interface{}{
+		"type":       "invocation.completed",
+		"jobId":      outcome.JobID,
+		"status":     outcome.Status,
+		"location":   outcome.Location,
+		"startedAt":  outcome.StartedAt,
+		"finishedAt": outcome.FinishedAt,
+	}
+	if outcome.Error != "" {
+		event["error"] = outcome.Error
+	}
+	if outcome.Result != nil {
+		event["usage"] = outcome.Result.Usage
+		event["estimatedCost"] = outcome.Result.EstimatedCost
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	_, err = w.Queue.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(w.EventsQueueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// runWorkerCommand implements "worker -queue URL -results LOCATION [-events URL] [-concurrency N]"
+// and runs until interrupted
+func runWorkerCommand(agent *InlineAgent, args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	queueURL := fs.String("queue", "", "URL of the SQS queue to read invocation requests from")
+	results := fs.String("results", "", "where to store results: s3://bucket/prefix or dynamodb://table")
+	events := fs.String("events", "", "URL of an SQS queue for completion events")
+	concurrency := fs.Int("concurrency", 4, "number of jobs run at once")
+	fs.Parse(args)
+
+	if *queueURL == "" || *results == "" {
+		log.Fatal("worker needs -queue and -results")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := OpenResultStore(ctx, *results)
+	if err != nil {
+		log.Fatalf("Failed to open result store: %v", err)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+
+	worker := &Worker{
+		Agent:          agent,
+		Queue:          sqs.NewFromConfig(cfg),
+		QueueURL:       *queueURL,
+		Results:        store,
+		EventsQueueURL: *events,
+		Concurrency:    *concurrency,
+	}
+	log.Printf("Worker reading %s with concurrency %d", *queueURL, *concurrency)
+	worker.Run(ctx)
+	log.Printf("Worker stopped")
+}
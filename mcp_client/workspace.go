@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	readFileTool      = "read_file"
+	listWorkspaceTool = "list_workspace"
+
+	// defaultInlineLimit is the tool output size, in bytes, above which output goes to the workspace
+	defaultInlineLimit = 16 * 1024
+	// defaultReadLength and maxReadLength bound what one read_file call returns
+	defaultReadLength = 8 * 1024
+	maxReadLength     = 32 * 1024
+)
+
+// ErrWorkspaceFileNotFound is returned when a workspace has no file with the requested name
+var ErrWorkspaceFileNotFound = errors.New("workspace file not found")
+
+// workspaceNamePattern allows names that are safe as file names and S3 keys
+var workspaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// invalidWorkspaceName matches runs of characters not allowed in workspace names
+var invalidWorkspaceName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// WorkspaceFile describes a file in a session's workspace
+type WorkspaceFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// WorkspaceStore keeps files per session. scope is the session ID.
+type WorkspaceStore interface {
+	Write(ctx context.Context, scope, name string, data []byte) error
+	// Read returns up to length bytes from offset and the file's total size
+	Read(ctx context.Context, scope, name string, offset, length int64) ([]byte, int64, error)
+	List(ctx context.Context, scope string) ([]WorkspaceFile, error)
+}
+
+// Workspace moves large tool outputs out of the conversation. An output over InlineLimit is
+// written to Store and replaced by a short reference; the model pulls in the parts it needs
+// with the read_file and list_workspace tools.
+type Workspace struct {
+	Store WorkspaceStore
+	// InlineLimit is the output size in bytes kept inline; 0 uses 16 KiB
+	InlineLimit int
+}
+
+// OpenWorkspaceStore opens a workspace store at location, either "s3://bucket/prefix" or a directory
+func OpenWorkspaceStore(ctx context.Context, location string) (WorkspaceStore, error) {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		return NewS3WorkspaceStore(ctx, bucket, prefix)
+	}
+	return NewLocalWorkspaceStore(strings.TrimPrefix(location, "file://"))
+}
+
+// LocalWorkspaceStore keeps workspace files on disk under <dir>/<session>/<name>
+type LocalWorkspaceStore struct {
+	dir string
+}
+
+// NewLocalWorkspaceStore creates a store under dir, creating it if needed
+func NewLocalWorkspaceStore(dir string) (*LocalWorkspaceStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("a workspace directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+	return &LocalWorkspaceStore{dir: dir}, nil
+}
+
+func (s *LocalWorkspaceStore) path(scope, name string) (string, error) {
+	if !workspaceNamePattern.MatchString(scope) || !workspaceNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid workspace file %s/%s", scope, name)
+	}
+	return filepath.Join(s.dir, scope, name), nil
+}
+
+func (s *LocalWorkspaceStore) Write(ctx context.Context, scope, name string, data []byte) error {
+	path, err := s.path(scope, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write workspace file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalWorkspaceStore) Read(ctx context.Context, scope, name string, offset, length int64) ([]byte, int64, error) {
+	path, err := s.path(scope, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, ErrWorkspaceFileNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open workspace file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat workspace file: %w", err)
+	}
+	if offset >= info.Size() {
+		return nil, info.Size(), nil
+	}
+
+	buf := make([]byte, min(length, info.Size()-offset))
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("failed to read workspace file: %w", err)
+	}
+	return buf[:n], info.Size(), nil
+}
+
+func (s *LocalWorkspaceStore) List(ctx context.Context, scope string) ([]WorkspaceFile, error) {
+	if !workspaceNamePattern.MatchString(scope) {
+		return nil, fmt.Errorf("invalid workspace %q", scope)
+	}
+	entries, err := os.ReadDir(filepath.Join(s.dir, scope))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace: %w", err)
+	}
+
+	var files []WorkspaceFile
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, WorkspaceFile{Name: entry.Name(), Size: info.Size(), Modified: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// workspaceScope returns the workspace of a session. One-off conversations get a workspace
+// of their own that lasts for the invocation.
+func workspaceScope(sessionID string) (string, error) {
+	if workspaceNamePattern.MatchString(sessionID) {
+		return sessionID, nil
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate workspace ID: %w", err)
+	}
+	return "invocation-" + hex.EncodeToString(buf), nil
+}
+
+func isWorkspaceTool(name string) bool {
+	return name == readFileTool || name == listWorkspaceTool
+}
+
+// workspaceTools are the built-in tools offered to the model when the agent has a workspace
+func workspaceTools() []Tool {
+	return []Tool{
+		{
+			Name:        readFileTool,
+			Description: "Read part of a file in the session workspace. Large tool outputs are saved there instead of being returned inline.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"type":        "string",
+						"description": "File name as shown by list_workspace or in the tool result",
+					},
+					"offset": map[string]interface{}{
+						"type":        "integer",
+						"description": "Byte offset to start reading at; defaults to 0",
+					},
+					"length": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Number of bytes to read; defaults to %d, at most %d", defaultReadLength, maxReadLength),
+					},
+				},
+				"required": []string{"name"},
+			},
+		},
+		{
+			Name:        listWorkspaceTool,
+			Description: "List the files in the session workspace with their sizes.",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+	}
+}
+
+// inlineLimit returns the output size kept inline
+func (w *Workspace) inlineLimit() int {
+	if w.InlineLimit > 0 {
+		return w.InlineLimit
+	}
+	return defaultInlineLimit
+}
+
+// offload writes a tool result's text to the workspace when it is over the inline limit and
+// replaces it with a reference the model can follow with read_file. Results of the workspace
+// tools themselves are never offloaded. It reports whether the result was offloaded.
+func (w *Workspace) offload(ctx context.Context, scope, toolName string, result map[string]interface{}) (bool, error) {
+	if isWorkspaceTool(toolName) {
+		return false, nil
+	}
+	content, _ := result["content"].([]map[string]interface{})
+
+	var text strings.Builder
+	var rest []map[string]interface{}
+	for _, c := range content {
+		if t, ok := c["text"].(string); ok {
+			text.WriteString(t)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	if text.Len() <= w.inlineLimit() {
+		return false, nil
+	}
+
+	toolUseID, _ := result["toolUseId"].(string)
+	name := workspaceFileName(toolName, toolUseID)
+	if err := w.Store.Write(ctx, scope, name, []byte(text.String())); err != nil {
+		return false, err
+	}
+
+	preview := truncateUTF8(text.String(), 1024)
+	summary := fmt.Sprintf("The output of %s was %d bytes, so it was saved to the workspace file %q. "+
+		"Use read_file with that name and an offset to read more than this preview.\n\nPreview:\n%s",
+		toolName, text.Len(), name, preview)
+	result["content"] = append([]map[string]interface{}{{"text": summary}}, rest...)
+	return true, nil
+}
+
+// workspaceFileName names an offloaded tool output after the tool and tool use
+func workspaceFileName(toolName, toolUseID string) string {
+	clean := func(s string) string {
+		return strings.Trim(invalidWorkspaceName.ReplaceAllString(s, "-"), "-.")
+	}
+	name := clean(toolName)
+	if id := clean(toolUseID); id != "" {
+		name += "-" + id
+	}
+	if name == "" {
+		name = "output"
+	}
+	return name + ".txt"
+}
+
+// handler executes the workspace tools against the workspace of scope
+func (w *Workspace) handler(scope string) func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+	return func(ctx context.Context, toolUse map[string]interface{}) (map[string]interface{}, error) {
+		input, _ := toolUse["input"].(map[string]interface{})
+
+		var text string
+		var err error
+		if toolUse["name"] == listWorkspaceTool {
+			text, err = w.listFiles(ctx, scope)
+		} else {
+			text, err = w.readFile(ctx, scope, input)
+		}
+
+		status := "success"
+		if err != nil {
+			text = fmt.Sprintf("Error executing tool: %v", err)
+			status = "error"
+		}
+		return map[string]interface{}{
+			"toolUseId": toolUse["toolUseId"],
+			"content":   []map[string]interface{}{{"text": text}},
+			"status":    status,
+		}, nil
+	}
+}
+
+func (w *Workspace) readFile(ctx context.Context, scope string, input map[string]interface{}) (string, error) {
+	name, _ := input["name"].(string)
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	offset := int64(intArgument(input["offset"], 0))
+	length := int64(intArgument(input["length"], defaultReadLength))
+	if offset < 0 {
+		offset = 0
+	}
+	if length <= 0 || length > maxReadLength {
+		length = maxReadLength
+	}
+
+	data, size, err := w.Store.Read(ctx, scope, name, offset, length)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	start, end := wholeRunes(data)
+	chunk := string(data[start:end])
+
+	from := offset + int64(start)
+	to := offset + int64(end)
+	header := fmt.Sprintf("[%s: bytes %d-%d of %d]", name, from, to, size)
+	if to < size {
+		header += fmt.Sprintf(" Continue with offset %d.", to)
+	}
+	return header + "\n" + chunk, nil
+}
+
+func (w *Workspace) listFiles(ctx context.Context, scope string) (string, error) {
+	files, err := w.Store.List(ctx, scope)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "The workspace is empty.", nil
+	}
+
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "%s\t%d bytes\t%s\n", f.Name, f.Size, f.Modified.UTC().Format(time.RFC3339))
+	}
+	return b.String(), nil
+}
+
+// wholeRunes returns the bounds of data without the partial UTF-8 sequences a byte range
+// can cut off at either end
+func wholeRunes(data []byte) (start, end int) {
+	for start < len(data) && start < utf8.UTFMax && !utf8.RuneStart(data[start]) {
+		start++
+	}
+	end = len(data)
+	for i := end - 1; i >= start && end-i <= utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:end]) {
+				end = i
+			}
+			break
+		}
+	}
+	return start, end
+}
+
+// intArgument reads a JSON number tool argument, falling back to def
+func intArgument(v interface{}, def int) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	case int64:
+		return int(n)
+	}
+	return def
+}
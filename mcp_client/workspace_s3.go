@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3API is the subset of the S3 client the workspace store uses
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// S3WorkspaceStore keeps workspace files in a bucket under <prefix>/<session>/<name>
+type S3WorkspaceStore struct {
+	client S3API
+	bucket string
+	prefix string
+}
+
+// NewS3WorkspaceStore creates a store over bucket using the default AWS config
+func NewS3WorkspaceStore(ctx context.Context, bucket, prefix string) (*S3WorkspaceStore, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("an S3 bucket name is required")
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return NewS3WorkspaceStoreWithClient(s3.NewFromConfig(cfg), bucket, prefix), nil
+}
+
+// NewS3WorkspaceStoreWithClient creates a store that uses client, e.g. a stub in tests
+func NewS3WorkspaceStoreWithClient(client S3API, bucket, prefix string) *S3WorkspaceStore {
+	return &S3WorkspaceStore{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}
+}
+
+func (s *S3WorkspaceStore) key(scope, name string) (string, error) {
+	if !workspaceNamePattern.MatchString(scope) || (name != "" && !workspaceNamePattern.MatchString(name)) {
+		return "", fmt.Errorf("invalid workspace file %s/%s", scope, name)
+	}
+	// path.Join would drop the trailing slash that keeps one session's listing from matching another's
+	key := scope + "/" + name
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	return key, nil
+}
+
+func (s *S3WorkspaceStore) Write(ctx context.Context, scope, name string, data []byte) error {
+	key, err := s.key(scope, name)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String("text/plain; charset=utf-8"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write workspace file: %w", err)
+	}
+	return nil
+}
+
+func (s *S3WorkspaceStore) Read(ctx context.Context, scope, name string, offset, length int64) ([]byte, int64, error) {
+	key, err := s.key(scope, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	var noSuchKey *s3types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, 0, ErrWorkspaceFileNotFound
+	}
+	if err != nil {
+		// A range starting past the end of the object is rejected rather than returning nothing
+		if strings.Contains(err.Error(), "InvalidRange") {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("failed to read workspace file: %w", err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read workspace file: %w", err)
+	}
+	return data, contentRangeSize(aws.ToString(out.ContentRange), int64(len(data))), nil
+}
+
+// contentRangeSize returns the total size from a Content-Range such as "bytes 0-99/1234"
+func contentRangeSize(contentRange string, fallback int64) int64 {
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return fallback
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return size
+}
+
+func (s *S3WorkspaceStore) List(ctx context.Context, scope string) ([]WorkspaceFile, error) {
+	prefix, err := s.key(scope, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []WorkspaceFile
+	var token *string
+	for {
+		out, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(s.bucket),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workspace: %w", err)
+		}
+		for _, obj := range out.Contents {
+			file := WorkspaceFile{Name: path.Base(aws.ToString(obj.Key)), Size: aws.ToInt64(obj.Size)}
+			if obj.LastModified != nil {
+				file.Modified = *obj.LastModified
+			}
+			files = append(files, file)
+		}
+		if !aws.ToBool(out.IsTruncated) {
+			break
+		}
+		token = out.NextContinuationToken
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultApprovalTimeout is how long a tool call waits for the browser's decision before it is rejected
+const defaultApprovalTimeout = 5 * time.Minute
+
+// wsClientMessage is sent by the browser
+type wsClientMessage struct {
+	// Type is "prompt" or "approval"
+	Type string `json:"type"`
+
+	// prompt fields
+	SessionID       string `json:"sessionId,omitempty"`
+	Text            string `json:"text,omitempty"`
+	RequireApproval bool   `json:"requireApproval,omitempty"`
+
+	// approval fields
+	ToolUseID string `json:"toolUseId,omitempty"`
+	Approved  bool   `json:"approved,omitempty"`
+}
+
+// wsServerMessage is sent to the browser
+type wsServerMessage struct {
+	// Type is "event", "approval_request", "result" or "error"
+	Type      string                 `json:"type"`
+	Event     *TraceEvent            `json:"event,omitempty"`
+	ToolUseID string                 `json:"toolUseId,omitempty"`
+	Tool      string                 `json:"tool,omitempty"`
+	Input     map[string]interface{} `json:"input,omitempty"`
+	Result    *Result                `json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	// Report lists what a failed prompt attempted, with an "error" message
+	Report *FailureReport `json:"report,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// wsConn serializes writes to a client stream, a WebSocket or a gRPC stream, and routes
+// approval replies to waiting tool calls
+type wsConn struct {
+	// write sends one message to the client
+	write           func(msg wsServerMessage) error
+	approvalTimeout time.Duration
+	// tenant is the connection's tenant, or nil when the gateway serves a single tenant
+	tenant *tenantState
+	// stream buffers events for the browser, so a slow one doesn't stall the agent
+	stream StreamBuffer
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan bool
+	busy    bool
+	closed  chan struct{}
+}
+
+func (c *wsConn) send(msg wsServerMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.write(msg); err != nil {
+		log.Printf("Stream write failed: %v", err)
+	}
+}
+
+// approve asks the browser whether a tool call may run and waits for the reply
+func (c *wsConn) approve(ctx context.Context, toolUse map[string]interface{}) (bool, error) {
+	toolUseID, _ := toolUse["toolUseId"].(string)
+	name, _ := toolUse["name"].(string)
+	input, _ := toolUse["input"].(map[string]interface{})
+
+	reply := make(chan bool, 1)
+	c.mu.Lock()
+	c.pending[toolUseID] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, toolUseID)
+		c.mu.Unlock()
+	}()
+
+	c.send(wsServerMessage{Type: "approval_request", ToolUseID: toolUseID, Tool: name, Input: input})
+
+	select {
+	case approved := <-reply:
+		return approved, nil
+	case <-time.After(c.approvalTimeout):
+		log.Printf("Approval for tool %s timed out, rejecting", name)
+		return false, nil
+	case <-c.closed:
+		return false, fmt.Errorf("connection closed while waiting for approval of %s", name)
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func (c *wsConn) resolve(toolUseID string, approved bool) {
+	c.mu.Lock()
+	reply, ok := c.pending[toolUseID]
+	c.mu.Unlock()
+
+	if !ok {
+		c.send(wsServerMessage{Type: "error", ToolUseID: toolUseID, Error: "no pending approval for this tool use"})
+		return
+	}
+	reply <- approved
+}
+
+// run executes one prompt and streams its events; only one prompt runs per connection at a time
+func (c *wsConn) run(agent *InlineAgent, msg wsClientMessage) {
+	defer func() {
+		c.mu.Lock()
+		c.busy = false
+		c.mu.Unlock()
+	}()
+
+	opts := InvokeOptions{
+		SessionID:     msg.SessionID,
+		CorrelationID: newCorrelationID(),
+		Events: func(event TraceEvent) {
+			c.send(wsServerMessage{Type: "event", Event: &event})
+		},
+		StreamBuffer: c.stream,
+	}
+	if msg.RequireApproval {
+		opts.ApproveTool = c.approve
+	}
+
+	err := c.tenant.limit(true)
+	if err == nil {
+		opts, err = c.tenant.scope(context.Background(), agent, opts)
+	}
+	var result *Result
+	if err == nil {
+		result, err = agent.InvokeWithOptions(msg.Text, opts)
+	}
+	c.tenant.record(auditRecord{Endpoint: "/ws", SessionID: msg.SessionID, CorrelationID: opts.CorrelationID}, result, err)
+	if err != nil {
+		msg := wsServerMessage{Type: "error", Error: err.Error()}
+		var invocationErr *InvocationError
+		if errors.As(err, &invocationErr) {
+			msg.Report = invocationErr.Report
+		}
+		c.send(msg)
+		return
+	}
+	c.send(wsServerMessage{Type: "result", Result: result})
+}
+
+// newWebSocketHandler serves /ws: the browser sends prompts and tool approvals, and receives
+// model text, tool events, approval requests and the final result. Events are queued in
+// stream for each connection.
+func newWebSocketHandler(agent *InlineAgent, tenants *tenantGateway, approvalTimeout time.Duration, stream StreamBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenant, ok := tenants.identify(w, r)
+		if !ok {
+			return
+		}
+
+		conn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("WebSocket upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		conn.SetReadLimit(1 << 20)
+
+		c := &wsConn{
+			write: func(msg wsServerMessage) error {
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				return conn.WriteJSON(msg)
+			},
+			approvalTimeout: approvalTimeout,
+			tenant:          tenant,
+			stream:          stream,
+			pending:         make(map[string]chan bool),
+			closed:          make(chan struct{}),
+		}
+		defer close(c.closed)
+
+		for {
+			var msg wsClientMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					log.Printf("WebSocket read failed: %v", err)
+				}
+				return
+			}
+
+			c.handle(agent, msg)
+		}
+	}
+}
+
+// handle starts a prompt or resolves an approval sent by the client
+func (c *wsConn) handle(agent *InlineAgent, msg wsClientMessage) {
+	switch msg.Type {
+	case "prompt":
+		if msg.Text == "" {
+			c.send(wsServerMessage{Type: "error", Error: "prompt text is required"})
+			return
+		}
+		c.mu.Lock()
+		busy := c.busy
+		c.busy = true
+		c.mu.Unlock()
+		if busy {
+			c.send(wsServerMessage{Type: "error", Error: "a prompt is already running on this connection"})
+			return
+		}
+		go c.run(agent, msg)
+	case "approval":
+		c.resolve(msg.ToolUseID, msg.Approved)
+	default:
+		c.send(wsServerMessage{Type: "error", Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+}
@@ -3,59 +3,57 @@ package main
 import (
 	"context"
 	"log"
-	"os/exec"
-
-	mcp_golang "github.com/metoro-io/mcp-golang"
-	"github.com/metoro-io/mcp-golang/transport/stdio"
+	"os"
 )
 
 func main() {
-	// Configure Docker command for MCP server
-	cmd := exec.Command("docker", "run", "-i", "--rm", "mcp/time")
+	ctx := context.Background()
 
-	// Create IO pipes to Docker container
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		log.Fatalf("Failed to create stdin pipe: %v", err)
+	// MCP_SERVERS_CONFIG names a servers config file, e.g. {"servers": ["time", "github"]};
+	// without one only the time server runs. Stdio servers are restarted if they crash.
+	cfg := &ServersConfig{Servers: []string{"time"}}
+	if path := os.Getenv("MCP_SERVERS_CONFIG"); path != "" {
+		loaded, err := LoadServersConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load servers config: %v", err)
+		}
+		cfg = loaded
 	}
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatalf("Failed to create stdout pipe: %v", err)
+	// MCP_CONTAINER_RUNTIME picks docker or podman; by default whichever is installed
+	if runtime := os.Getenv("MCP_CONTAINER_RUNTIME"); runtime != "" {
+		cfg.Runtime = runtime
 	}
 
-	// Start Docker container
-	if err := cmd.Start(); err != nil {
-		log.Fatalf("Failed to start Docker container: %v", err)
+	servers, err := cfg.Resolve()
+	if err != nil {
+		log.Fatalf("Failed to configure MCP servers: %v", err)
 	}
-	defer func() {
-		if cmd.Process != nil {
-			cmd.Process.Kill()
+	for _, name := range cfg.Servers {
+		server := servers[name]
+		if err := server.Start(ctx); err != nil {
+			log.Fatalf("Failed to start MCP server %s: %v", name, err)
 		}
-	}()
+		defer server.Close(ctx)
 
-	// Create MCP transport using Docker's stdio
-	transport := stdio.NewStdioServerTransportWithIO(stdout, stdin)
-	client := mcp_golang.NewClient(transport)
-
-	// Initialize MCP connection
-	if _, err := client.Initialize(context.Background()); err != nil {
-		log.Fatalf("MCP initialization failed: %v", err)
-	}
+		// Discover available tools
+		tools, err := server.Tools(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list tools: %v", err)
+		}
 
-	// Discover available tools
-	tools, err := client.ListTools(context.Background(), nil)
-	if err != nil {
-		log.Fatalf("Failed to list tools: %v", err)
+		log.Printf("Available Tools on %s:", name)
+		for _, tool := range tools.Tools {
+			desc := "No description"
+			if tool.Description != nil {
+				desc = *tool.Description
+			}
+			log.Printf("- %s: %s", tool.Name, desc)
+		}
 	}
 
-	log.Println("Available Tools:")
-	for _, tool := range tools.Tools {
-		desc := "No description"
-		if tool.Description != nil {
-			desc = *tool.Description
-		}
-		log.Printf("- %s: %s", tool.Name, desc)
+	server, ok := servers["time"]
+	if !ok {
+		return
 	}
 
 	// Call time tool with specific format
@@ -64,7 +62,7 @@ func main() {
 	}
 
 	log.Println("\nCalling time tool:")
-	timeResponse, err := client.CallTool(context.Background(), "time", timeArgs)
+	timeResponse, err := server.CallTool(ctx, "time", timeArgs)
 	if err != nil {
 		log.Fatalf("Time tool call failed: %v", err)
 	}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PullPolicy controls when the container image is pulled
+type PullPolicy string
+
+const (
+	// PullMissing pulls the image only when it isn't present locally
+	PullMissing PullPolicy = "missing"
+	PullAlways  PullPolicy = "always"
+	PullNever   PullPolicy = "never"
+)
+
+// containerRuntimes are tried in order when ContainerSpec.Runtime is empty
+var containerRuntimes = []string{"docker", "podman"}
+
+// envNamePattern matches valid environment variable names
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ContainerSpec describes how to run a containerized MCP server over stdio
+type ContainerSpec struct {
+	Image string `json:"image"`
+	// Command overrides the image's entrypoint arguments
+	Command []string `json:"command,omitempty"`
+	// Env is set in the container. Values are passed through the runtime's environment
+	// rather than its arguments, so they don't show up in process listings.
+	Env map[string]string `json:"env,omitempty"`
+	// Volumes are bind mounts as "host:container" or "host:container:ro"
+	Volumes []string `json:"volumes,omitempty"`
+	// Network is the network mode, e.g. "none" or "host"; empty uses the runtime default
+	Network string `json:"network,omitempty"`
+	// Memory and CPUs limit the container, e.g. "512m" and "1.5"; empty means no limit
+	Memory string `json:"memory,omitempty"`
+	CPUs   string `json:"cpus,omitempty"`
+	// Pull is the image pull policy; empty uses PullMissing
+	Pull PullPolicy `json:"pull,omitempty"`
+	// Runtime is "docker" or "podman"; empty uses docker, falling back to podman when docker
+	// isn't installed
+	Runtime string `json:"runtime,omitempty"`
+	// ExtraArgs are passed to "run" before the image, for options not covered above
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+}
+
+// runtime returns the container runtime binary to use
+func (c ContainerSpec) runtime() (string, error) {
+	if c.Runtime != "" {
+		if _, err := exec.LookPath(c.Runtime); err != nil {
+			return "", fmt.Errorf("container runtime %s not found: %w", c.Runtime, err)
+		}
+		return c.Runtime, nil
+	}
+	for _, runtime := range containerRuntimes {
+		if _, err := exec.LookPath(runtime); err == nil {
+			return runtime, nil
+		}
+	}
+	return "", fmt.Errorf("no container runtime found, install one of %s", strings.Join(containerRuntimes, ", "))
+}
+
+// runArgs returns the "run" arguments for the spec and the environment the runtime needs
+// to pass Env through
+func (c ContainerSpec) runArgs() ([]string, []string, error) {
+	if c.Image == "" {
+		return nil, nil, fmt.Errorf("a container image is required")
+	}
+
+	pull := c.Pull
+	if pull == "" {
+		pull = PullMissing
+	}
+	switch pull {
+	case PullMissing, PullAlways, PullNever:
+	default:
+		return nil, nil, fmt.Errorf("invalid pull policy %q", pull)
+	}
+
+	args := []string{"run", "-i", "--rm", "--pull=" + string(pull)}
+
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		if !envNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid environment variable name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var env []string
+	for _, name := range names {
+		args = append(args, "-e", name)
+		env = append(env, name+"="+c.Env[name])
+	}
+
+	for _, volume := range c.Volumes {
+		if !strings.Contains(volume, ":") {
+			return nil, nil, fmt.Errorf("invalid volume %q, expected host:container[:ro]", volume)
+		}
+		args = append(args, "-v", volume)
+	}
+	if c.Network != "" {
+		args = append(args, "--network", c.Network)
+	}
+	if c.Memory != "" {
+		args = append(args, "--memory", c.Memory)
+	}
+	if c.CPUs != "" {
+		args = append(args, "--cpus", c.CPUs)
+	}
+
+	args = append(args, c.ExtraArgs...)
+	args = append(args, c.Image)
+	args = append(args, c.Command...)
+	return args, env, nil
+}
+
+// newContainerServer creates a supervisor that runs the spec's container; call Start to launch it
+func newContainerServer(spec ContainerSpec) (*stdioServer, error) {
+	runtime, err := spec.runtime()
+	if err != nil {
+		return nil, err
+	}
+	args, env, err := spec.runArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	server := newStdioServer(runtime, args...)
+	server.ServerName = spec.Image
+	server.Env = env
+	return server, nil
+}
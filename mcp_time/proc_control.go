@@ -0,0 +1,19 @@
+package main
+
+import "os/exec"
+
+// processController kills a child together with everything it spawned. Platform
+// implementations live in proc_control_unix.go and proc_control_windows.go; tests can
+// swap in a fake to exercise stdioProcess shutdown without real processes.
+type processController interface {
+	// prepare configures cmd before it is started
+	prepare(cmd *exec.Cmd)
+	// attach is called once cmd has started
+	attach(cmd *exec.Cmd) error
+	// terminate asks the process tree to stop; it may return an error where that isn't supported
+	terminate(cmd *exec.Cmd) error
+	// kill forcibly stops the process tree
+	kill(cmd *exec.Cmd) error
+	// release frees any handles held for the process tree
+	release()
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// processGroupController runs the child in its own process group and signals the whole
+// group, so grandchildren (e.g. the container runtime's helpers) don't outlive it
+type processGroupController struct{}
+
+func newProcessController() processController {
+	return processGroupController{}
+}
+
+func (processGroupController) prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func (processGroupController) attach(cmd *exec.Cmd) error {
+	return nil
+}
+
+func (processGroupController) terminate(cmd *exec.Cmd) error {
+	// A negative pid signals every process in the group
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+func (processGroupController) kill(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func (processGroupController) release() {}
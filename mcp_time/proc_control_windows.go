@@ -0,0 +1,135 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+)
+
+const (
+	jobObjectExtendedLimitInformationClass = 9
+	jobObjectLimitKillOnJobClose           = 0x2000
+	processSetQuota                        = 0x0100
+	processTerminate                       = 0x0001
+)
+
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type ioCounters struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	OtherOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherTransferCount  uint64
+}
+
+type jobObjectExtendedLimitInformation struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                ioCounters
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// errNoGracefulStop is returned by terminate: Windows has no SIGTERM for arbitrary processes
+var errNoGracefulStop = errors.New("graceful termination is not supported on windows")
+
+// jobObjectController puts the child in a Job Object configured to kill every process in it
+// when the job is terminated or its handle is closed
+type jobObjectController struct {
+	mu  sync.Mutex
+	job syscall.Handle
+}
+
+func newProcessController() processController {
+	return &jobObjectController{}
+}
+
+func (c *jobObjectController) prepare(cmd *exec.Cmd) {}
+
+func (c *jobObjectController) attach(cmd *exec.Cmd) error {
+	job, _, err := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		return fmt.Errorf("CreateJobObject failed: %w", err)
+	}
+
+	info := jobObjectExtendedLimitInformation{}
+	info.BasicLimitInformation.LimitFlags = jobObjectLimitKillOnJobClose
+	if ok, _, err := procSetInformationJobObject.Call(job, jobObjectExtendedLimitInformationClass,
+		uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info)); ok == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		return fmt.Errorf("SetInformationJobObject failed: %w", err)
+	}
+
+	// Children spawned before this point escape the job; the window is the few
+	// microseconds between Start and here
+	process, err := syscall.OpenProcess(processSetQuota|processTerminate, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		syscall.CloseHandle(syscall.Handle(job))
+		return fmt.Errorf("OpenProcess failed: %w", err)
+	}
+	defer syscall.CloseHandle(process)
+
+	if ok, _, err := procAssignProcessToJobObject.Call(job, uintptr(process)); ok == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		return fmt.Errorf("AssignProcessToJobObject failed: %w", err)
+	}
+
+	c.mu.Lock()
+	c.job = syscall.Handle(job)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *jobObjectController) terminate(cmd *exec.Cmd) error {
+	return errNoGracefulStop
+}
+
+func (c *jobObjectController) kill(cmd *exec.Cmd) error {
+	c.mu.Lock()
+	job := c.job
+	c.mu.Unlock()
+
+	if job == 0 {
+		return cmd.Process.Kill()
+	}
+	if ok, _, err := procTerminateJobObject.Call(uintptr(job), 1); ok == 0 {
+		return fmt.Errorf("TerminateJobObject failed: %w", err)
+	}
+	return nil
+}
+
+func (c *jobObjectController) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.job != 0 {
+		syscall.CloseHandle(c.job)
+		c.job = 0
+	}
+}
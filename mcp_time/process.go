@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// defaultStdioGracePeriod is how long each shutdown step waits before escalating
+const defaultStdioGracePeriod = 5 * time.Second
+
+// stdioProcess is an MCP server child process that talks over stdin/stdout
+type stdioProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	ctl    processController
+	// stderr captures the server's error output; it is complete once done is closed
+	stderr *stderrCapture
+
+	// gracePeriod is how long each shutdown step waits before escalating
+	gracePeriod time.Duration
+
+	done    chan struct{}
+	waitErr error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// startStdioProcess starts name with args and connects to its stdio; stderr goes to stderr.
+// env ("KEY=VALUE") is added to the inherited environment.
+func startStdioProcess(stderr *stderrCapture, env []string, name string, args ...string) (*stdioProcess, error) {
+	return startStdioProcessWith(newProcessController(), stderr, env, name, args...)
+}
+
+// startStdioProcessWith is startStdioProcess with an explicit process controller
+func startStdioProcessWith(ctl processController, stderr *stderrCapture, env []string, name string, args ...string) (*stdioProcess, error) {
+	cmd := exec.Command(name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	// A writer rather than a pipe, so Wait finishes copying stderr before done is closed
+	cmd.Stderr = stderr
+	ctl.prepare(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	p := &stdioProcess{
+		cmd:         cmd,
+		stdin:       stdin,
+		stdout:      stdout,
+		ctl:         ctl,
+		stderr:      stderr,
+		gracePeriod: defaultStdioGracePeriod,
+		done:        make(chan struct{}),
+	}
+	if err := ctl.attach(cmd); err != nil {
+		// Without the process tree handle only the direct child can be stopped
+		log.Printf("Failed to track child processes of %s: %v", name, err)
+	}
+	go func() {
+		p.waitErr = cmd.Wait()
+		stderr.flush()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Close shuts the process tree down: it closes stdin so the server can exit on its own, then
+// terminates, then kills the tree, waiting gracePeriod (or until ctx ends) between steps.
+// It is safe to call more than once.
+func (p *stdioProcess) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		p.closeErr = p.shutdown(ctx)
+	})
+	return p.closeErr
+}
+
+// reap cleans up after a process that exited on its own: it kills whatever the server left
+// running in its process tree and frees the tree's handles. Close does nothing after it.
+func (p *stdioProcess) reap() {
+	p.closeOnce.Do(func() {
+		<-p.done
+		p.stdin.Close()
+		// The group is usually empty by now, so an error here is expected
+		p.ctl.kill(p.cmd)
+		p.ctl.release()
+	})
+}
+
+func (p *stdioProcess) shutdown(ctx context.Context) error {
+	defer p.ctl.release()
+
+	p.stdin.Close()
+	if p.wait(ctx) {
+		return nil
+	}
+
+	if err := p.ctl.terminate(p.cmd); err == nil && p.wait(ctx) {
+		return nil
+	}
+
+	if err := p.ctl.kill(p.cmd); err != nil {
+		return fmt.Errorf("failed to kill process %d: %w", p.cmd.Process.Pid, err)
+	}
+	<-p.done
+	return nil
+}
+
+// wait reports whether the process exited within the grace period
+func (p *stdioProcess) wait(ctx context.Context) bool {
+	timer := time.NewTimer(p.gracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-p.done:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+	mcphttp "github.com/metoro-io/mcp-golang/transport/http"
+)
+
+// mcpServer is a running MCP server, whatever its transport
+type mcpServer interface {
+	Start(ctx context.Context) error
+	Tools(ctx context.Context) (*mcp_golang.ToolsResponse, error)
+	CallTool(ctx context.Context, name string, args interface{}) (*mcp_golang.ToolResponse, error)
+	Close(ctx context.Context) error
+}
+
+// ServerRecipe says how to launch or connect to an MCP server. Exactly one of Container,
+// Package and URL is set.
+type ServerRecipe struct {
+	Description string `json:"description,omitempty"`
+	// Container runs the server image over stdio
+	Container *ContainerSpec `json:"container,omitempty"`
+	// Package is an npm package run with npx over stdio, with Args after it
+	Package string   `json:"package,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	// URL connects to a server that is already running, over HTTP
+	URL string `json:"url,omitempty"`
+	// RequiredEnv names environment variables the server needs, such as an access token.
+	// They are read from this process's environment and passed to the server.
+	RequiredEnv []string `json:"requiredEnv,omitempty"`
+	// IdempotentTools may be replayed if a stdio server dies mid-call
+	IdempotentTools []string `json:"idempotentTools,omitempty"`
+	// ConversionWarnings adds DST warnings to the server's convert_time results
+	ConversionWarnings bool `json:"conversionWarnings,omitempty"`
+}
+
+// WellKnownServers maps short names to recipes for commonly used MCP servers
+var WellKnownServers = map[string]ServerRecipe{
+	"time": {
+		Description:        "Current time and time zone conversion",
+		Container:          &ContainerSpec{Image: "mcp/time", Network: "none", Memory: "256m"},
+		IdempotentTools:    []string{"get_current_time", "convert_time", "time"},
+		ConversionWarnings: true,
+	},
+	"fetch": {
+		Description:     "Fetch web pages as markdown",
+		Container:       &ContainerSpec{Image: "mcp/fetch", Memory: "512m"},
+		IdempotentTools: []string{"fetch"},
+	},
+	"filesystem": {
+		Description: "Read and write files under the working directory",
+		Package:     "@modelcontextprotocol/server-filesystem",
+		Args:        []string{"."},
+	},
+	"github": {
+		Description: "GitHub repositories, issues and pull requests",
+		Container:   &ContainerSpec{Image: "ghcr.io/github/github-mcp-server"},
+		RequiredEnv: []string{"GITHUB_PERSONAL_ACCESS_TOKEN"},
+	},
+}
+
+// ServersConfig is a servers config file. Servers lists names from WellKnownServers or
+// Recipes, e.g. {"servers": ["time", "github"]}; Recipes adds or replaces recipes by name.
+type ServersConfig struct {
+	Servers []string                `json:"servers"`
+	Recipes map[string]ServerRecipe `json:"recipes,omitempty"`
+	// Runtime is the container runtime for container recipes that don't set one
+	Runtime string `json:"runtime,omitempty"`
+}
+
+// LoadServersConfig reads a JSON servers config file
+func LoadServersConfig(path string) (*ServersConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read servers config: %w", err)
+	}
+	var cfg ServersConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse servers config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// recipe looks a server up in the config's recipes, then in WellKnownServers
+func (c *ServersConfig) recipe(name string) (ServerRecipe, error) {
+	if recipe, ok := c.Recipes[name]; ok {
+		return recipe, nil
+	}
+	if recipe, ok := WellKnownServers[name]; ok {
+		return recipe, nil
+	}
+
+	known := make([]string, 0, len(WellKnownServers))
+	for n := range WellKnownServers {
+		known = append(known, n)
+	}
+	sort.Strings(known)
+	return ServerRecipe{}, fmt.Errorf("unknown MCP server %q, well-known servers are %s", name, strings.Join(known, ", "))
+}
+
+// Resolve creates a server for every name in Servers, in order. The servers are not started.
+func (c *ServersConfig) Resolve() (map[string]mcpServer, error) {
+	servers := make(map[string]mcpServer, len(c.Servers))
+	for _, name := range c.Servers {
+		recipe, err := c.recipe(name)
+		if err != nil {
+			return nil, err
+		}
+		if recipe.Container != nil && recipe.Container.Runtime == "" && c.Runtime != "" {
+			spec := *recipe.Container
+			spec.Runtime = c.Runtime
+			recipe.Container = &spec
+		}
+
+		server, err := recipe.server(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve MCP server %s: %w", name, err)
+		}
+		if recipe.ConversionWarnings {
+			server = &conversionWarningServer{server}
+		}
+		servers[name] = server
+	}
+	return servers, nil
+}
+
+// requiredEnv returns the recipe's required environment as KEY=VALUE
+func (r ServerRecipe) requiredEnv() ([]string, error) {
+	var env []string
+	for _, name := range r.RequiredEnv {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("environment variable %s is required", name)
+		}
+		env = append(env, name+"="+value)
+	}
+	return env, nil
+}
+
+// server creates the server the recipe describes
+func (r ServerRecipe) server(name string) (mcpServer, error) {
+	set := 0
+	for _, ok := range []bool{r.Container != nil, r.Package != "", r.URL != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("a recipe needs exactly one of container, package and url")
+	}
+
+	env, err := r.requiredEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var server *stdioServer
+	switch {
+	case r.URL != "":
+		return newRemoteServer(name, r.URL)
+	case r.Container != nil:
+		spec := *r.Container
+		spec.Env = make(map[string]string, len(r.Container.Env)+len(env))
+		for k, v := range r.Container.Env {
+			spec.Env[k] = v
+		}
+		for _, kv := range env {
+			k, v, _ := strings.Cut(kv, "=")
+			spec.Env[k] = v
+		}
+		if server, err = newContainerServer(spec); err != nil {
+			return nil, err
+		}
+	default:
+		if _, err := exec.LookPath("npx"); err != nil {
+			return nil, fmt.Errorf("npx not found: %w", err)
+		}
+		server = newStdioServer("npx", append([]string{"-y", r.Package}, r.Args...)...)
+		server.Env = env
+	}
+
+	server.ServerName = name
+	for _, tool := range r.IdempotentTools {
+		server.IdempotentTools[tool] = true
+	}
+	return server, nil
+}
+
+// remoteServer is an MCP server reached over HTTP; it is not supervised since its lifecycle
+// is someone else's
+type remoteServer struct {
+	name     string
+	endpoint *url.URL
+
+	mu     sync.Mutex
+	client *mcp_golang.Client
+	tools  *mcp_golang.ToolsResponse
+}
+
+func newRemoteServer(name, rawURL string) (*remoteServer, error) {
+	endpoint, err := url.Parse(rawURL)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q", rawURL)
+	}
+	return &remoteServer{name: name, endpoint: endpoint}, nil
+}
+
+// Start initializes the server and discovers its tools
+func (s *remoteServer) Start(ctx context.Context) error {
+	path := s.endpoint.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	transport := mcphttp.NewHTTPClientTransport(path)
+	transport.WithBaseURL(s.endpoint.Scheme + "://" + s.endpoint.Host)
+
+	client := mcp_golang.NewClient(transport)
+	if _, err := client.Initialize(ctx); err != nil {
+		return fmt.Errorf("MCP initialization failed for %s: %w", s.name, err)
+	}
+	tools, err := client.ListTools(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list tools of %s: %w", s.name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = client
+	s.tools = tools
+	return nil
+}
+
+func (s *remoteServer) started() (*mcp_golang.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return nil, fmt.Errorf("MCP server %s is not started", s.name)
+	}
+	return s.client, nil
+}
+
+// Tools returns the tools discovered by Start
+func (s *remoteServer) Tools(ctx context.Context) (*mcp_golang.ToolsResponse, error) {
+	if _, err := s.started(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tools, nil
+}
+
+func (s *remoteServer) CallTool(ctx context.Context, name string, args interface{}) (*mcp_golang.ToolResponse, error) {
+	client, err := s.started()
+	if err != nil {
+		return nil, err
+	}
+	return client.CallTool(ctx, name, args)
+}
+
+// Close forgets the connection; the server itself keeps running
+func (s *remoteServer) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = nil
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultStderrLines is how many trailing stderr lines are kept for error reports
+	defaultStderrLines = 50
+	// maxStderrLine caps a single line so a server writing without newlines can't grow the buffer
+	maxStderrLine = 4096
+)
+
+// stderrCapture is the stderr of a server process. Each line is forwarded to the logger
+// tagged with the server name, and the last lines are kept in a ring buffer so failures can
+// be reported with the server's own error output.
+type stderrCapture struct {
+	server string
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	partial []byte
+	lines   []string
+	next    int
+	full    bool
+}
+
+// newStderrCapture keeps the last size lines; a nil logger uses slog.Default
+func newStderrCapture(server string, logger *slog.Logger, size int) *stderrCapture {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if size <= 0 {
+		size = defaultStderrLines
+	}
+	return &stderrCapture{server: server, logger: logger, lines: make([]string, size)}
+}
+
+func (c *stderrCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := p
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			c.partial = append(c.partial, data...)
+			if len(c.partial) >= maxStderrLine {
+				c.addLine(string(c.partial[:maxStderrLine]))
+				c.partial = c.partial[:0]
+			}
+			break
+		}
+		c.partial = append(c.partial, data[:i]...)
+		c.addLine(string(c.partial))
+		c.partial = c.partial[:0]
+		data = data[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush records a final line that had no trailing newline; it is called once the process has exited
+func (c *stderrCapture) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.partial) > 0 {
+		c.addLine(string(c.partial))
+		c.partial = c.partial[:0]
+	}
+}
+
+// addLine must be called with mu held
+func (c *stderrCapture) addLine(line string) {
+	line = strings.TrimRight(line, "\r")
+	if line == "" {
+		return
+	}
+	c.logger.Info(line, "server", c.server, "stream", "stderr")
+
+	c.lines[c.next] = line
+	c.next = (c.next + 1) % len(c.lines)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// Tail returns the kept lines, oldest first
+func (c *stderrCapture) Tail() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.full {
+		return append([]string{}, c.lines[:c.next]...)
+	}
+	return append(append([]string{}, c.lines[c.next:]...), c.lines[:c.next]...)
+}
+
+// StderrError is a server failure together with the server's last stderr lines
+type StderrError struct {
+	Err    error
+	Stderr []string
+}
+
+func (e *StderrError) Error() string {
+	return fmt.Sprintf("%v\nserver stderr:\n  %s", e.Err, strings.Join(e.Stderr, "\n  "))
+}
+
+func (e *StderrError) Unwrap() error {
+	return e.Err
+}
+
+// withStderr attaches the captured stderr to err, if there is any
+func (c *stderrCapture) withStderr(err error) error {
+	tail := c.Tail()
+	if err == nil || len(tail) == 0 {
+		return err
+	}
+	return &StderrError{Err: err, Stderr: tail}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"sync"
+	"time"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+	"github.com/metoro-io/mcp-golang/transport/stdio"
+)
+
+// ServerEvent reports a lifecycle change of a supervised stdio server
+type ServerEvent struct {
+	Time     time.Time
+	Type     string // "started", "exited", "restart_failed" or "gave_up"
+	Restarts int
+	Err      error
+	// Stderr is the last lines the server wrote to stderr, set when it exited or failed to start
+	Stderr []string
+}
+
+// errServerUnavailable is returned while the server is down and being restarted
+var errServerUnavailable = errors.New("stdio MCP server is unavailable")
+
+// errServerClosed is returned by launch when Close was called while it was starting the process
+var errServerClosed = errors.New("stdio MCP server is closed")
+
+// stdioServer keeps a subprocess MCP server running, relaunching it with exponential
+// backoff when it exits unexpectedly
+type stdioServer struct {
+	name string
+	args []string
+
+	// MinBackoff and MaxBackoff bound the delay between restarts; MaxRestarts of 0 means no limit
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxRestarts int
+	// IdempotentTools may be retried once on the new process if the server dies mid-call
+	IdempotentTools map[string]bool
+	// OnEvent is called for every lifecycle event; nil logs them
+	OnEvent func(ServerEvent)
+	// ServerName tags the server's stderr lines in Logger; empty uses the command name
+	ServerName string
+	// Logger receives the server's stderr line by line; nil uses slog.Default
+	Logger *slog.Logger
+	// StderrLines is how many trailing stderr lines are kept for errors; 0 keeps 50
+	StderrLines int
+	// Env ("KEY=VALUE") is added to the environment the command inherits
+	Env []string
+
+	mu       sync.Mutex
+	proc     *stdioProcess
+	client   *mcp_golang.Client
+	tools    *mcp_golang.ToolsResponse
+	restarts int
+	ready    chan struct{}
+	closed   bool
+}
+
+// newStdioServer creates a supervisor for the command; call Start to launch it
+func newStdioServer(name string, args ...string) *stdioServer {
+	return &stdioServer{
+		name:            name,
+		args:            args,
+		MinBackoff:      500 * time.Millisecond,
+		MaxBackoff:      30 * time.Second,
+		IdempotentTools: make(map[string]bool),
+		ready:           make(chan struct{}),
+	}
+}
+
+func (s *stdioServer) emit(event ServerEvent) {
+	event.Time = time.Now()
+	if s.OnEvent != nil {
+		s.OnEvent(event)
+		return
+	}
+	if event.Err != nil {
+		log.Printf("MCP server %s %s (restarts: %d): %v", s.name, event.Type, event.Restarts, event.Err)
+	} else {
+		log.Printf("MCP server %s %s (restarts: %d)", s.name, event.Type, event.Restarts)
+	}
+}
+
+// Start launches the server, initializes it and discovers its tools
+func (s *stdioServer) Start(ctx context.Context) error {
+	return s.launch(ctx)
+}
+
+// launch starts a new process and runs initialize and tool discovery on it
+func (s *stdioServer) launch(ctx context.Context) error {
+	serverName := s.ServerName
+	if serverName == "" {
+		serverName = s.name
+	}
+	stderr := newStderrCapture(serverName, s.Logger, s.StderrLines)
+	proc, err := startStdioProcess(stderr, s.Env, s.name, s.args...)
+	if err != nil {
+		return err
+	}
+
+	// Close waits for the process to exit, so stderr is complete when it is attached to the error
+	client := mcp_golang.NewClient(stdio.NewStdioServerTransportWithIO(proc.stdout, proc.stdin))
+	if _, err := client.Initialize(ctx); err != nil {
+		proc.Close(ctx)
+		return stderr.withStderr(fmt.Errorf("MCP initialization failed: %w", err))
+	}
+	tools, err := client.ListTools(ctx, nil)
+	if err != nil {
+		proc.Close(ctx)
+		return stderr.withStderr(fmt.Errorf("failed to list tools: %w", err))
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		// Close ran while the process was starting and didn't see it, so stop it here
+		s.mu.Unlock()
+		proc.Close(ctx)
+		return errServerClosed
+	}
+	s.proc = proc
+	s.client = client
+	s.tools = tools
+	restarts := s.restarts
+	close(s.ready)
+	s.mu.Unlock()
+
+	s.emit(ServerEvent{Type: "started", Restarts: restarts})
+	go s.watch(proc)
+	return nil
+}
+
+// watch waits for the process to exit and restarts it unless Close was called
+func (s *stdioServer) watch(proc *stdioProcess) {
+	<-proc.done
+	// Kill anything the server left running and free its handles before relaunching
+	proc.reap()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.ready = make(chan struct{})
+	s.client = nil
+	restarts := s.restarts
+	s.mu.Unlock()
+
+	s.emit(ServerEvent{Type: "exited", Restarts: restarts, Err: proc.waitErr, Stderr: proc.stderr.Tail()})
+
+	backoff := s.MinBackoff
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		if s.MaxRestarts > 0 && s.restarts >= s.MaxRestarts {
+			s.mu.Unlock()
+			s.emit(ServerEvent{Type: "gave_up", Restarts: restarts})
+			return
+		}
+		s.restarts++
+		restarts = s.restarts
+		s.mu.Unlock()
+
+		time.Sleep(backoff)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := s.launch(ctx)
+		cancel()
+		if err == nil || errors.Is(err, errServerClosed) {
+			return
+		}
+
+		var stderrErr *StderrError
+		event := ServerEvent{Type: "restart_failed", Restarts: restarts, Err: err}
+		if errors.As(err, &stderrErr) {
+			event.Err, event.Stderr = stderrErr.Err, stderrErr.Stderr
+		}
+		s.emit(event)
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+// current waits until the server is running and returns its client
+func (s *stdioServer) current(ctx context.Context) (*mcp_golang.Client, *stdioProcess, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, nil, errServerUnavailable
+		}
+		client, proc, ready := s.client, s.proc, s.ready
+		s.mu.Unlock()
+
+		if client != nil {
+			select {
+			case <-proc.done:
+				// Exited but not yet noticed by watch; give it a moment to swap in a new ready channel
+				time.Sleep(10 * time.Millisecond)
+				continue
+			default:
+				return client, proc, nil
+			}
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("%w: %v", errServerUnavailable, ctx.Err())
+		}
+	}
+}
+
+// Tools returns the tools discovered on the current process
+func (s *stdioServer) Tools(ctx context.Context) (*mcp_golang.ToolsResponse, error) {
+	if _, _, err := s.current(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tools, nil
+}
+
+// CallTool calls a tool, waiting out a restart if the server is down. If the process dies
+// during the call and the tool is idempotent, the call is replayed once on the new process.
+func (s *stdioServer) CallTool(ctx context.Context, name string, args interface{}) (*mcp_golang.ToolResponse, error) {
+	client, proc, err := s.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := callTool(ctx, client, proc, name, args)
+	if err == nil {
+		return resp, nil
+	}
+
+	select {
+	case <-proc.done:
+	default:
+		// The server is still running, so this is an ordinary tool error
+		return nil, err
+	}
+
+	if !s.IdempotentTools[name] {
+		return nil, fmt.Errorf("MCP server exited during %s, not retrying a non-idempotent call: %w", name, err)
+	}
+
+	log.Printf("MCP server exited during %s, replaying on the restarted server", name)
+	client, proc, err = s.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return callTool(ctx, client, proc, name, args)
+}
+
+// callTool calls a tool on proc's client, giving up as soon as proc exits. mcp-golang's
+// stdio transport doesn't close when the server's stdout does, so without this the call
+// would wait out its full request timeout.
+func callTool(ctx context.Context, client *mcp_golang.Client, proc *stdioProcess, name string, args interface{}) (*mcp_golang.ToolResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-proc.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	resp, err := client.CallTool(ctx, name, args)
+	select {
+	case <-proc.done:
+		if err != nil {
+			return nil, fmt.Errorf("MCP server exited: %w", err)
+		}
+	default:
+	}
+	return resp, err
+}
+
+// Close stops supervising and shuts the current process down
+func (s *stdioServer) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	proc := s.proc
+	s.mu.Unlock()
+
+	if proc == nil {
+		return nil
+	}
+	return proc.Close(ctx)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+)
+
+// transitionWindow is how close to a DST transition a conversion gets a warning
+const transitionWindow = 7 * 24 * time.Hour
+
+// TimeWarning is a caveat about a time conversion, returned as an extra JSON content block
+// so the agent can qualify its answer
+type TimeWarning struct {
+	// Kind is nonexistent_local_time, ambiguous_local_time or dst_transition_nearby
+	Kind     string `json:"kind"`
+	Timezone string `json:"timezone"`
+	Message  string `json:"message"`
+	// Transition is when the nearby transition happens, in RFC 3339
+	Transition string `json:"transition,omitempty"`
+}
+
+// conversionWarningServer adds DST warnings to convert_time results. The time server runs
+// in its own image, so the warnings are worked out here from the call's arguments with Go's
+// time zone database.
+type conversionWarningServer struct {
+	mcpServer
+}
+
+// CallTool calls the server and, for convert_time, appends any warnings
+func (s *conversionWarningServer) CallTool(ctx context.Context, name string, args interface{}) (*mcp_golang.ToolResponse, error) {
+	resp, err := s.mcpServer.CallTool(ctx, name, args)
+	if err != nil || resp == nil || name != "convert_time" {
+		return resp, err
+	}
+	params, ok := args.(map[string]interface{})
+	if !ok {
+		return resp, nil
+	}
+	source, _ := params["source_timezone"].(string)
+	target, _ := params["target_timezone"].(string)
+	clock, _ := params["time"].(string)
+
+	warnings, err := conversionWarnings(source, target, clock, time.Now())
+	if err != nil || len(warnings) == 0 {
+		// The server reports bad arguments itself
+		return resp, nil
+	}
+	data, err := json.Marshal(map[string]interface{}{"warnings": warnings})
+	if err != nil {
+		return resp, nil
+	}
+	resp.Content = append(resp.Content, mcp_golang.NewTextContent(string(data)))
+	return resp, nil
+}
+
+// conversionWarnings checks converting clock (HH:MM) on now's date in source to target, as
+// convert_time does: the local time may be skipped or repeated by a DST change, and either
+// zone may be close to a transition that changes the offset between them.
+func conversionWarnings(source, target, clock string, now time.Time) ([]TimeWarning, error) {
+	sourceLoc, err := time.LoadLocation(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source timezone %q: %w", source, err)
+	}
+	targetLoc, err := time.LoadLocation(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target timezone %q: %w", target, err)
+	}
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q, expected HH:MM: %w", clock, err)
+	}
+
+	y, m, d := now.In(sourceLoc).Date()
+	local := time.Date(y, m, d, parsed.Hour(), parsed.Minute(), 0, 0, sourceLoc)
+
+	var warnings []TimeWarning
+	if local.Hour() != parsed.Hour() || local.Minute() != parsed.Minute() {
+		warnings = append(warnings, TimeWarning{
+			Kind:     "nonexistent_local_time",
+			Timezone: source,
+			Message:  fmt.Sprintf("%s does not exist in %s on %s because clocks go forward, so the converted time may be off by the size of the change", clock, source, local.Format("2006-01-02")),
+		})
+	} else if other, ok := otherReading(local); ok {
+		warnings = append(warnings, TimeWarning{
+			Kind:     "ambiguous_local_time",
+			Timezone: source,
+			Message:  fmt.Sprintf("%s happens twice in %s on %s because clocks go back, as %s and as %s; the conversion used one of them", clock, source, local.Format("2006-01-02"), local.Format("15:04 MST"), other.Format("15:04 MST")),
+		})
+	}
+
+	for _, zone := range []struct {
+		name string
+		loc  *time.Location
+	}{{source, sourceLoc}, {target, targetLoc}} {
+		if transition, ok := nearestTransition(local.In(zone.loc), transitionWindow); ok {
+			_, before := transition.Add(-time.Minute).Zone()
+			_, after := transition.Zone()
+			warnings = append(warnings, TimeWarning{
+				Kind:       "dst_transition_nearby",
+				Timezone:   zone.name,
+				Transition: transition.Format(time.RFC3339),
+				Message: fmt.Sprintf("%s changes its UTC offset by %s on %s, so the difference between the zones may not hold on other dates",
+					zone.name, time.Duration(after-before)*time.Second, transition.Format("2006-01-02 15:04 MST")),
+			})
+		}
+	}
+	return warnings, nil
+}
+
+// otherReading returns the second instant with t's wall clock when clocks went back over it
+func otherReading(t time.Time) (time.Time, bool) {
+	for _, shift := range []time.Duration{-time.Hour, time.Hour, -30 * time.Minute, 30 * time.Minute} {
+		other := t.Add(shift)
+		if other.Hour() == t.Hour() && other.Minute() == t.Minute() {
+			return other, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// nearestTransition returns the first UTC offset change within window of t, either side
+func nearestTransition(t time.Time, window time.Duration) (time.Time, bool) {
+	start := t.Add(-window)
+	_, offset := start.Zone()
+	for at := start.Add(time.Hour); !at.After(t.Add(window)); at = at.Add(time.Hour) {
+		if _, o := at.Zone(); o != offset {
+			// Narrow the change down to the minute
+			lo, hi := at.Add(-time.Hour), at
+			for hi.Sub(lo) > time.Minute {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, o := mid.Zone(); o == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			return hi.Truncate(time.Minute), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,109 @@
+package bedrock
+
+import (
+    "fmt"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+)
+
+// ToolDefinition is an MCP tool as returned by tools/list
+type ToolDefinition struct {
+    Name        string
+    Description string
+    InputSchema map[string]interface{}
+}
+
+// Executor decides how Bedrock runs an action group's functions. With an empty LambdaArn
+// control is returned to the caller (RETURN_CONTROL); otherwise Bedrock invokes the Lambda.
+type Executor struct {
+    LambdaArn string
+}
+
+// ReturnControl is the executor that hands tool calls back to the caller
+var ReturnControl = Executor{}
+
+// LambdaExecutor runs the action group's functions in the given Lambda function
+func LambdaExecutor(arn string) Executor {
+    return Executor{LambdaArn: arn}
+}
+
+// BuildActionGroup converts MCP tools into an inline agent action group
+func BuildActionGroup(name, description string, tools []ToolDefinition, executor Executor) (types.AgentActionGroup, error) {
+    functions := make([]types.FunctionDefinition, 0, len(tools))
+    for _, tool := range tools {
+        params, err := functionParameters(tool.InputSchema)
+        if err != nil {
+            return types.AgentActionGroup{}, fmt.Errorf("tool %s: %w", tool.Name, err)
+        }
+        functions = append(functions, types.FunctionDefinition{
+            Name:        aws.String(tool.Name),
+            Description: aws.String(tool.Description),
+            Parameters:  params,
+        })
+    }
+
+    group := types.AgentActionGroup{
+        ActionGroupName: aws.String(name),
+        Description:     aws.String(description),
+        FunctionSchema:  &types.FunctionSchemaMemberFunctions{Value: functions},
+    }
+
+    if executor.LambdaArn != "" {
+        group.ActionGroupExecutor = &types.ActionGroupExecutorMemberLambda{Value: executor.LambdaArn}
+    } else {
+        group.ActionGroupExecutor = &types.ActionGroupExecutorMemberCustomControl{Value: types.CustomControlMethodReturnControl}
+    }
+
+    return group, nil
+}
+
+// functionParameters maps a JSON schema's top-level properties onto Bedrock function parameters
+func functionParameters(schema map[string]interface{}) (map[string]types.ParameterDetail, error) {
+    params := make(map[string]types.ParameterDetail)
+
+    properties, _ := schema["properties"].(map[string]interface{})
+    required := make(map[string]bool)
+    if list, ok := schema["required"].([]interface{}); ok {
+        for _, r := range list {
+            if name, ok := r.(string); ok {
+                required[name] = true
+            }
+        }
+    }
+
+    for name, raw := range properties {
+        prop, ok := raw.(map[string]interface{})
+        if !ok {
+            return nil, fmt.Errorf("property %s has an invalid schema", name)
+        }
+
+        detail := types.ParameterDetail{
+            Type:     parameterType(prop["type"]),
+            Required: aws.Bool(required[name]),
+        }
+        if desc, ok := prop["description"].(string); ok {
+            detail.Description = aws.String(desc)
+        }
+        params[name] = detail
+    }
+
+    return params, nil
+}
+
+// parameterType maps a JSON schema type onto a Bedrock parameter type. Objects have no
+// equivalent, so they are passed as JSON strings.
+func parameterType(t interface{}) types.ParameterType {
+    switch t {
+    case "number":
+        return types.ParameterTypeNumber
+    case "integer":
+        return types.ParameterTypeInteger
+    case "boolean":
+        return types.ParameterTypeBoolean
+    case "array":
+        return types.ParameterTypeArray
+    default:
+        return types.ParameterTypeString
+    }
+}
@@ -0,0 +1,113 @@
+package bedrock
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+    "github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+)
+
+// Collaborator defines a specialist inline agent that a supervisor can delegate to
+type Collaborator struct {
+    Name            string
+    Instruction     string
+    FoundationModel string
+    // RoutingInstruction tells the supervisor when to hand work to this collaborator
+    RoutingInstruction string
+    // RelayConversationHistory shares the supervisor's conversation with the collaborator
+    RelayConversationHistory bool
+}
+
+// Supervisor is an inline agent that coordinates a set of collaborators
+type Supervisor struct {
+    Name            string
+    Instruction     string
+    FoundationModel string
+    // RouterMode sends each request straight to the best collaborator instead of orchestrating
+    RouterMode    bool
+    Collaborators []Collaborator
+    // PromptOverrides tunes the supervisor's orchestration prompts
+    PromptOverrides *PromptOverrides
+}
+
+// buildInput converts the supervisor definition into an InvokeInlineAgent request
+func (s *Supervisor) buildInput(sessionID, inputText string) (*bedrockagentruntime.InvokeInlineAgentInput, error) {
+    if len(s.Collaborators) == 0 {
+        return nil, fmt.Errorf("supervisor %s has no collaborators", s.Name)
+    }
+
+    collaboration := types.AgentCollaborationSupervisor
+    if s.RouterMode {
+        collaboration = types.AgentCollaborationSupervisorRouter
+    }
+
+    input := &bedrockagentruntime.InvokeInlineAgentInput{
+        FoundationModel:    aws.String(s.FoundationModel),
+        Instruction:        aws.String(s.Instruction),
+        AgentName:          aws.String(s.Name),
+        InputText:          aws.String(inputText),
+        SessionId:          aws.String(sessionID),
+        AgentCollaboration: collaboration,
+        EnableTrace:        aws.Bool(true),
+    }
+
+    if err := ApplyPromptOverrides(input, s.PromptOverrides); err != nil {
+        return nil, err
+    }
+
+    for _, c := range s.Collaborators {
+        if c.Name == "" || c.Instruction == "" || c.FoundationModel == "" {
+            return nil, fmt.Errorf("collaborator %q needs a name, instruction and foundation model", c.Name)
+        }
+
+        relay := types.RelayConversationHistoryDisabled
+        if c.RelayConversationHistory {
+            relay = types.RelayConversationHistoryToCollaborator
+        }
+
+        input.Collaborators = append(input.Collaborators, types.Collaborator{
+            AgentName:       aws.String(c.Name),
+            Instruction:     aws.String(c.Instruction),
+            FoundationModel: aws.String(c.FoundationModel),
+        })
+        input.CollaboratorConfigurations = append(input.CollaboratorConfigurations, types.CollaboratorConfiguration{
+            CollaboratorName:         aws.String(c.Name),
+            CollaboratorInstruction:  aws.String(c.RoutingInstruction),
+            RelayConversationHistory: relay,
+        })
+    }
+
+    return input, nil
+}
+
+// InvokeSupervisor runs the supervisor agent with its collaborators and returns the final answer
+func InvokeSupervisor(ctx context.Context, cfg aws.Config, supervisor *Supervisor, sessionID, inputText string) (string, error) {
+    input, err := supervisor.buildInput(sessionID, inputText)
+    if err != nil {
+        return "", err
+    }
+
+    client := bedrockagentruntime.NewFromConfig(cfg)
+    output, err := client.InvokeInlineAgent(ctx, input)
+    if err != nil {
+        return "", fmt.Errorf("InvokeInlineAgent failed: %w", err)
+    }
+
+    stream := output.GetStream()
+    defer stream.Close()
+
+    var answer strings.Builder
+    for event := range stream.Events() {
+        if chunk, ok := event.(*types.InlineAgentResponseStreamMemberChunk); ok {
+            answer.Write(chunk.Value.Bytes)
+        }
+    }
+    if err := stream.Err(); err != nil {
+        return "", fmt.Errorf("agent response stream failed: %w", err)
+    }
+
+    return answer.String(), nil
+}
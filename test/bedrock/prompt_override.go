@@ -0,0 +1,90 @@
+package bedrock
+
+import (
+    "fmt"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+    "github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+)
+
+// PromptTemplate overrides one step of the agent's prompt sequence
+type PromptTemplate struct {
+    // Type is the step being overridden, e.g. types.PromptTypeOrchestration
+    Type types.PromptType
+    // Template replaces the default base prompt template; empty keeps the default
+    Template string
+    // Disabled skips the step entirely (only valid for pre- and post-processing)
+    Disabled bool
+    // UseParserLambda parses this step's output with the override Lambda
+    UseParserLambda bool
+    // Inference overrides the model parameters for this step
+    Inference *types.InferenceConfiguration
+}
+
+// PromptOverrides tunes the inline agent's prompt templates and output parsing
+type PromptOverrides struct {
+    Templates []PromptTemplate
+    // ParserLambdaArn is the Lambda used by templates with UseParserLambda set
+    ParserLambdaArn string
+}
+
+// build converts the overrides into the API's PromptOverrideConfiguration
+func (p *PromptOverrides) build() (*types.PromptOverrideConfiguration, error) {
+    config := &types.PromptOverrideConfiguration{}
+    if p.ParserLambdaArn != "" {
+        config.OverrideLambda = aws.String(p.ParserLambdaArn)
+    }
+
+    seen := make(map[types.PromptType]bool)
+    for _, t := range p.Templates {
+        if seen[t.Type] {
+            return nil, fmt.Errorf("prompt type %s is overridden more than once", t.Type)
+        }
+        seen[t.Type] = true
+
+        if t.UseParserLambda && p.ParserLambdaArn == "" {
+            return nil, fmt.Errorf("prompt type %s uses the parser Lambda but no ParserLambdaArn is set", t.Type)
+        }
+        if t.Disabled && t.Type != types.PromptTypePreProcessing && t.Type != types.PromptTypePostProcessing {
+            return nil, fmt.Errorf("prompt type %s cannot be disabled", t.Type)
+        }
+
+        pc := types.PromptConfiguration{
+            PromptType:             t.Type,
+            PromptState:            types.PromptStateEnabled,
+            PromptCreationMode:     types.CreationModeDefault,
+            ParserMode:             types.CreationModeDefault,
+            InferenceConfiguration: t.Inference,
+        }
+        if t.Disabled {
+            pc.PromptState = types.PromptStateDisabled
+        }
+        if t.Template != "" {
+            pc.PromptCreationMode = types.CreationModeOverridden
+            pc.BasePromptTemplate = aws.String(t.Template)
+        }
+        if t.UseParserLambda {
+            pc.ParserMode = types.CreationModeOverridden
+        }
+
+        config.PromptConfigurations = append(config.PromptConfigurations, pc)
+    }
+
+    return config, nil
+}
+
+// ApplyPromptOverrides sets the prompt override configuration on an inline agent request
+func ApplyPromptOverrides(input *bedrockagentruntime.InvokeInlineAgentInput, overrides *PromptOverrides) error {
+    if overrides == nil {
+        return nil
+    }
+
+    config, err := overrides.build()
+    if err != nil {
+        return err
+    }
+
+    input.PromptOverrideConfiguration = config
+    return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+    "log"
+    "os"
+
+    "github.com/aws/aws-lambda-go/lambda"
+
+    mcplambda "github.com/your-org/mcp-client-go/lambda"
+)
+
+// Lambda entry point for Bedrock action groups backed by an MCP server.
+// MCP_URL must point at the server's streamable HTTP endpoint.
+func main() {
+    mcpURL := os.Getenv("MCP_URL")
+    if mcpURL == "" {
+        log.Fatal("MCP_URL is required")
+    }
+
+    handler := mcplambda.NewHandler(mcpURL)
+    lambda.Start(handler.Handle)
+}
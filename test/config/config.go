@@ -1,19 +1,234 @@
 package config
 
-import "os"
+import (
+    "context"
+    "flag"
+    "fmt"
+    "log"
+    "net/url"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// profileFlag selects a profile from the command line, taking precedence over APP_ENV
+var profileFlag = flag.String("profile", "", "configuration profile (dev, staging, prod)")
+
+const defaultProfile = "dev"
 
 type Config struct {
+    Profile  string
     MCPURL   string
+    MCPURLs  []string
+    MCPToken string
+    APIKey   string
     Region   string
     AgentId  string
     ModelArn string
+    LogLevel string
+
+    // secretRefs remembers which fields were loaded from secret references so they can be refreshed
+    secretRefs map[*string]string
+    secrets    *SecretResolver
+    // mu guards the fields in secretRefs while RefreshSecrets may be rewriting them
+    mu sync.RWMutex
+}
+
+// Profile holds the defaults for a named environment
+type Profile struct {
+    MCPURLs  []string
+    ModelArn string
+    Region   string
+    LogLevel string
+}
+
+// Profiles maps profile names to their defaults; environment variables override them
+var Profiles = map[string]Profile{
+    "dev": {
+        MCPURLs:  []string{"http://localhost:3001/mcp"},
+        ModelArn: "us.anthropic.claude-3-5-sonnet-20241022-v2:0",
+        Region:   "us-east-1",
+        LogLevel: "debug",
+    },
+    "staging": {
+        ModelArn: "us.anthropic.claude-3-5-sonnet-20241022-v2:0",
+        Region:   "us-east-1",
+        LogLevel: "info",
+    },
+    "prod": {
+        ModelArn: "us.anthropic.claude-3-5-sonnet-20241022-v2:0",
+        Region:   "us-east-1",
+        LogLevel: "warn",
+    },
 }
 
-func Load() *Config {
-    return &Config{
-        MCPURL:   os.Getenv("MCP_URL"),
-        Region:   os.Getenv("AWS_REGION"),
+// Load builds the configuration for the selected profile. The profile comes from
+// the -profile flag, then APP_ENV, then falls back to dev.
+func Load() (*Config, error) {
+    name := *profileFlag
+    if name == "" {
+        name = os.Getenv("APP_ENV")
+    }
+    if name == "" {
+        name = defaultProfile
+    }
+
+    profile, ok := Profiles[name]
+    if !ok {
+        return nil, fmt.Errorf("unknown config profile %q", name)
+    }
+
+    cfg := &Config{
+        Profile:  name,
+        MCPURLs:  profile.MCPURLs,
+        MCPToken: os.Getenv("MCP_TOKEN"),
+        APIKey:   os.Getenv("API_KEY"),
+        Region:   envOr("AWS_REGION", profile.Region),
         AgentId:  os.Getenv("AGENT_ID"),
-        ModelArn: os.Getenv("MODEL_ARN"),
+        ModelArn: envOr("MODEL_ARN", profile.ModelArn),
+        LogLevel: envOr("LOG_LEVEL", profile.LogLevel),
+    }
+
+    // MCP_URL accepts a comma-separated list of server URLs
+    if v := os.Getenv("MCP_URL"); v != "" {
+        cfg.MCPURLs = nil
+        for _, u := range strings.Split(v, ",") {
+            if u = strings.TrimSpace(u); u != "" {
+                cfg.MCPURLs = append(cfg.MCPURLs, u)
+            }
+        }
+    }
+    // Only dev has a default server; staging and prod must say where theirs are
+    if len(cfg.MCPURLs) == 0 {
+        return nil, fmt.Errorf("config profile %q has no MCP server URL; set MCP_URL", name)
+    }
+    cfg.MCPURL = cfg.MCPURLs[0]
+
+    if err := cfg.resolveSecrets(); err != nil {
+        return nil, err
+    }
+
+    return cfg, nil
+}
+
+// resolveSecrets replaces secretsmanager:// and ssm:// values with the secrets they point at
+func (c *Config) resolveSecrets() error {
+    c.secretRefs = make(map[*string]string)
+    for _, field := range []*string{&c.MCPToken, &c.APIKey} {
+        if IsSecretRef(*field) {
+            c.secretRefs[field] = *field
+        }
+    }
+    if len(c.secretRefs) == 0 {
+        return nil
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(c.Region))
+    if err != nil {
+        return fmt.Errorf("failed to load AWS config for secrets: %w", err)
+    }
+
+    ttl, _ := time.ParseDuration(os.Getenv("SECRETS_CACHE_TTL"))
+    c.secrets = NewSecretResolver(awsCfg, ttl)
+
+    return c.RefreshSecrets(ctx)
+}
+
+// RefreshSecrets re-resolves every field that was loaded from a secret reference.
+// Values are served from cache until the TTL expires, so it is cheap to call periodically
+// or after an authentication failure to pick up a rotated credential. Once it may run
+// concurrently, read the fields with GetMCPToken and GetAPIKey.
+func (c *Config) RefreshSecrets(ctx context.Context) error {
+    values := make(map[*string]string, len(c.secretRefs))
+    for field, ref := range c.secretRefs {
+        value, err := c.secrets.Resolve(ctx, ref)
+        if err != nil {
+            return fmt.Errorf("failed to resolve %s: %w", ref, err)
+        }
+        values[field] = value
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for field, value := range values {
+        *field = value
+    }
+    return nil
+}
+
+// WatchSecrets refreshes the secret fields every cache TTL until ctx is done, so rotated
+// credentials are picked up without a restart. It does nothing when no field is a secret
+// reference.
+func (c *Config) WatchSecrets(ctx context.Context) {
+    if c.secrets == nil {
+        return
+    }
+    go func() {
+        ticker := time.NewTicker(c.secrets.ttl)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                if err := c.RefreshSecrets(ctx); err != nil {
+                    log.Printf("Failed to refresh config secrets: %v", err)
+                }
+            }
+        }
+    }()
+}
+
+// GetMCPToken returns MCPToken; it is safe to call while secrets are being refreshed
+func (c *Config) GetMCPToken() string {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+    return c.MCPToken
+}
+
+// GetAPIKey returns APIKey; it is safe to call while secrets are being refreshed
+func (c *Config) GetAPIKey() string {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+    return c.APIKey
+}
+
+// String returns a printable form of the config with secrets redacted
+func (c *Config) String() string {
+    urls := make([]string, len(c.MCPURLs))
+    for i, u := range c.MCPURLs {
+        urls[i] = redactURL(u)
+    }
+
+    return fmt.Sprintf("Config{Profile: %s, MCPURLs: [%s], MCPToken: %s, APIKey: %s, Region: %s, AgentId: %s, ModelArn: %s, LogLevel: %s}",
+        c.Profile, strings.Join(urls, ", "), redact(c.GetMCPToken()), redact(c.GetAPIKey()), c.Region, c.AgentId, c.ModelArn, c.LogLevel)
+}
+
+func redact(secret string) string {
+    if secret == "" {
+        return ""
+    }
+    return "[REDACTED]"
+}
+
+func envOr(key, fallback string) string {
+    if v := os.Getenv(key); v != "" {
+        return v
+    }
+    return fallback
+}
+
+// redactURL hides any password embedded in the URL's userinfo
+func redactURL(raw string) string {
+    u, err := url.Parse(raw)
+    if err != nil {
+        return "[INVALID URL]"
     }
+    return u.Redacted()
 }
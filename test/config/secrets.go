@@ -0,0 +1,161 @@
+package config
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+    "github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+const (
+    secretsManagerScheme = "secretsmanager://"
+    ssmScheme            = "ssm://"
+
+    defaultSecretTTL = 5 * time.Minute
+)
+
+// IsSecretRef reports whether a config value points at a secret store instead of holding the value itself
+func IsSecretRef(value string) bool {
+    return strings.HasPrefix(value, secretsManagerScheme) || strings.HasPrefix(value, ssmScheme)
+}
+
+type cachedSecret struct {
+    value     string
+    fetchedAt time.Time
+}
+
+// SecretResolver resolves secretsmanager:// and ssm:// references, caching values for a TTL
+// so rotated secrets are picked up without hammering the APIs.
+//
+// Supported forms:
+//   secretsmanager://<secret-id>          the whole SecretString
+//   secretsmanager://<secret-id>#<key>    one key of a JSON SecretString
+//   ssm://<parameter-name>                a (decrypted) SSM parameter, name or ARN as given;
+//                                         hierarchical names are written ssm:///path/to/param
+type SecretResolver struct {
+    secretsManager *secretsmanager.Client
+    ssm            *ssm.Client
+    ttl            time.Duration
+
+    mu    sync.Mutex
+    cache map[string]cachedSecret
+}
+
+// NewSecretResolver creates a resolver using the given AWS config
+func NewSecretResolver(cfg aws.Config, ttl time.Duration) *SecretResolver {
+    if ttl <= 0 {
+        ttl = defaultSecretTTL
+    }
+    return &SecretResolver{
+        secretsManager: secretsmanager.NewFromConfig(cfg),
+        ssm:            ssm.NewFromConfig(cfg),
+        ttl:            ttl,
+        cache:          make(map[string]cachedSecret),
+    }
+}
+
+// Resolve returns the value behind ref. Values that are not secret references are returned as-is.
+// When a cached value has expired it is re-fetched; if that fetch fails the stale value is kept,
+// so a transient API error during rotation doesn't take the process down.
+func (r *SecretResolver) Resolve(ctx context.Context, ref string) (string, error) {
+    if !IsSecretRef(ref) {
+        return ref, nil
+    }
+
+    r.mu.Lock()
+    cached, ok := r.cache[ref]
+    r.mu.Unlock()
+
+    if ok && time.Since(cached.fetchedAt) < r.ttl {
+        return cached.value, nil
+    }
+
+    value, err := r.fetch(ctx, ref)
+    if err != nil {
+        if ok {
+            log.Printf("Failed to refresh secret %s, using cached value: %v", ref, err)
+            return cached.value, nil
+        }
+        return "", err
+    }
+
+    r.mu.Lock()
+    r.cache[ref] = cachedSecret{value: value, fetchedAt: time.Now()}
+    r.mu.Unlock()
+
+    return value, nil
+}
+
+// Invalidate drops the cached value for ref, forcing the next Resolve to fetch it again.
+// Call it when a credential is rejected, since that usually means it was rotated.
+func (r *SecretResolver) Invalidate(ref string) {
+    r.mu.Lock()
+    delete(r.cache, ref)
+    r.mu.Unlock()
+}
+
+func (r *SecretResolver) fetch(ctx context.Context, ref string) (string, error) {
+    switch {
+    case strings.HasPrefix(ref, secretsManagerScheme):
+        return r.fetchSecretsManager(ctx, strings.TrimPrefix(ref, secretsManagerScheme))
+    case strings.HasPrefix(ref, ssmScheme):
+        return r.fetchSSM(ctx, strings.TrimPrefix(ref, ssmScheme))
+    default:
+        return "", fmt.Errorf("unsupported secret reference %q", ref)
+    }
+}
+
+func (r *SecretResolver) fetchSecretsManager(ctx context.Context, path string) (string, error) {
+    secretID, key, _ := strings.Cut(path, "#")
+
+    out, err := r.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+        SecretId: aws.String(secretID),
+    })
+    if err != nil {
+        return "", fmt.Errorf("failed to get secret %s: %w", secretID, err)
+    }
+    if out.SecretString == nil {
+        return "", fmt.Errorf("secret %s has no string value", secretID)
+    }
+
+    if key == "" {
+        return *out.SecretString, nil
+    }
+
+    // Numbers are kept as written; as float64 a value like 1000000 would print as 1e+06
+    var fields map[string]interface{}
+    dec := json.NewDecoder(strings.NewReader(*out.SecretString))
+    dec.UseNumber()
+    if err := dec.Decode(&fields); err != nil {
+        return "", fmt.Errorf("failed to parse secret %s as JSON: %w", secretID, err)
+    }
+
+    value, ok := fields[key]
+    if !ok {
+        return "", fmt.Errorf("key %q not found in secret %s", key, secretID)
+    }
+
+    return fmt.Sprint(value), nil
+}
+
+func (r *SecretResolver) fetchSSM(ctx context.Context, name string) (string, error) {
+    out, err := r.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+        Name:           aws.String(name),
+        WithDecryption: aws.Bool(true),
+    })
+    if err != nil {
+        return "", fmt.Errorf("failed to get parameter %s: %w", name, err)
+    }
+    if out.Parameter == nil || out.Parameter.Value == nil {
+        return "", fmt.Errorf("parameter %s has no value", name)
+    }
+
+    return *out.Parameter.Value, nil
+}
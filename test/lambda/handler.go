@@ -0,0 +1,273 @@
+package lambda
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// ActionEvent is the payload Bedrock sends to an action group Lambda using a function schema
+type ActionEvent struct {
+    MessageVersion          string            `json:"messageVersion"`
+    InputText               string            `json:"inputText"`
+    SessionID               string            `json:"sessionId"`
+    ActionGroup             string            `json:"actionGroup"`
+    Function                string            `json:"function"`
+    Parameters              []ActionParameter `json:"parameters"`
+    SessionAttributes       map[string]string `json:"sessionAttributes"`
+    PromptSessionAttributes map[string]string `json:"promptSessionAttributes"`
+}
+
+type ActionParameter struct {
+    Name  string `json:"name"`
+    Type  string `json:"type"`
+    Value string `json:"value"`
+}
+
+// ActionResponse is what the Lambda returns to Bedrock
+type ActionResponse struct {
+    MessageVersion          string            `json:"messageVersion"`
+    Response                FunctionResult    `json:"response"`
+    SessionAttributes       map[string]string `json:"sessionAttributes,omitempty"`
+    PromptSessionAttributes map[string]string `json:"promptSessionAttributes,omitempty"`
+}
+
+type FunctionResult struct {
+    ActionGroup      string           `json:"actionGroup"`
+    Function         string           `json:"function"`
+    FunctionResponse FunctionResponse `json:"functionResponse"`
+}
+
+type FunctionResponse struct {
+    // ResponseState is empty on success, or FAILURE / REPROMPT
+    ResponseState string                       `json:"responseState,omitempty"`
+    ResponseBody  map[string]map[string]string `json:"responseBody"`
+}
+
+// Handler forwards Bedrock action group invocations to an MCP server as tools/call requests
+type Handler struct {
+    mcpURL     string
+    httpClient *http.Client
+
+    mu          sync.Mutex
+    requestID   int
+    initialized bool
+}
+
+// NewHandler creates a handler for the MCP server at mcpURL. The MCP session is set up
+// on the first invocation and reused while the Lambda container stays warm.
+func NewHandler(mcpURL string) *Handler {
+    return &Handler{
+        mcpURL:     mcpURL,
+        httpClient: &http.Client{Timeout: 30 * time.Second},
+    }
+}
+
+// Handle processes one action group invocation
+func (h *Handler) Handle(ctx context.Context, event ActionEvent) (ActionResponse, error) {
+    response := ActionResponse{
+        MessageVersion:          "1.0",
+        SessionAttributes:       event.SessionAttributes,
+        PromptSessionAttributes: event.PromptSessionAttributes,
+        Response: FunctionResult{
+            ActionGroup: event.ActionGroup,
+            Function:    event.Function,
+        },
+    }
+
+    text, err := h.callTool(ctx, event.Function, convertParameters(event.Parameters))
+    if err != nil {
+        log.Printf("Tool %s failed: %v", event.Function, err)
+        response.Response.FunctionResponse = FunctionResponse{
+            ResponseState: "FAILURE",
+            ResponseBody:  map[string]map[string]string{"TEXT": {"body": err.Error()}},
+        }
+        return response, nil
+    }
+
+    response.Response.FunctionResponse = FunctionResponse{
+        ResponseBody: map[string]map[string]string{"TEXT": {"body": text}},
+    }
+    return response, nil
+}
+
+// convertParameters turns Bedrock's string-typed parameters back into JSON values
+func convertParameters(params []ActionParameter) map[string]interface{} {
+    args := make(map[string]interface{}, len(params))
+    for _, p := range params {
+        switch p.Type {
+        case "integer":
+            if v, err := strconv.ParseInt(p.Value, 10, 64); err == nil {
+                args[p.Name] = v
+                continue
+            }
+        case "number":
+            if v, err := strconv.ParseFloat(p.Value, 64); err == nil {
+                args[p.Name] = v
+                continue
+            }
+        case "boolean":
+            if v, err := strconv.ParseBool(p.Value); err == nil {
+                args[p.Name] = v
+                continue
+            }
+        case "array":
+            var v []interface{}
+            if err := json.Unmarshal([]byte(p.Value), &v); err == nil {
+                args[p.Name] = v
+                continue
+            }
+        }
+        args[p.Name] = p.Value
+    }
+    return args
+}
+
+func (h *Handler) callTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+    if err := h.ensureInitialized(ctx); err != nil {
+        return "", err
+    }
+
+    result, err := h.rpc(ctx, "tools/call", map[string]interface{}{
+        "name":      name,
+        "arguments": args,
+    })
+    if err != nil {
+        return "", err
+    }
+
+    var toolResult struct {
+        Content []struct {
+            Type string `json:"type"`
+            Text string `json:"text"`
+        } `json:"content"`
+        IsError bool `json:"isError"`
+    }
+    if err := json.Unmarshal(result, &toolResult); err != nil {
+        return "", fmt.Errorf("failed to unmarshal tool result: %w", err)
+    }
+
+    var text strings.Builder
+    for _, block := range toolResult.Content {
+        text.WriteString(block.Text)
+    }
+    if toolResult.IsError {
+        return "", fmt.Errorf("tool returned an error: %s", text.String())
+    }
+    return text.String(), nil
+}
+
+func (h *Handler) ensureInitialized(ctx context.Context) error {
+    h.mu.Lock()
+    done := h.initialized
+    h.mu.Unlock()
+    if done {
+        return nil
+    }
+
+    _, err := h.rpc(ctx, "initialize", map[string]interface{}{
+        "protocolVersion": "2024-11-05",
+        "capabilities":    map[string]interface{}{},
+        "clientInfo": map[string]interface{}{
+            "name":    "bedrock-mcp-lambda",
+            "version": "1.0.0",
+        },
+    })
+    if err != nil {
+        return fmt.Errorf("failed to initialize MCP session: %w", err)
+    }
+
+    if err := h.post(ctx, map[string]interface{}{
+        "jsonrpc": "2.0",
+        "method":  "notifications/initialized",
+    }, nil); err != nil {
+        return fmt.Errorf("failed to send initialized notification: %w", err)
+    }
+
+    h.mu.Lock()
+    h.initialized = true
+    h.mu.Unlock()
+    return nil
+}
+
+// rpc sends a JSON-RPC request and returns the raw result
+func (h *Handler) rpc(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+    h.mu.Lock()
+    h.requestID++
+    id := h.requestID
+    h.mu.Unlock()
+
+    var resp struct {
+        Result json.RawMessage `json:"result"`
+        Error  *struct {
+            Code    int    `json:"code"`
+            Message string `json:"message"`
+        } `json:"error"`
+    }
+    if err := h.post(ctx, map[string]interface{}{
+        "jsonrpc": "2.0",
+        "id":      id,
+        "method":  method,
+        "params":  params,
+    }, &resp); err != nil {
+        return nil, err
+    }
+    if resp.Error != nil {
+        return nil, fmt.Errorf("MCP error %d: %s", resp.Error.Code, resp.Error.Message)
+    }
+    return resp.Result, nil
+}
+
+// post sends a message and decodes the JSON or single-event SSE reply into out, if given
+func (h *Handler) post(ctx context.Context, msg interface{}, out interface{}) error {
+    body, err := json.Marshal(msg)
+    if err != nil {
+        return fmt.Errorf("failed to marshal request: %w", err)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, "POST", h.mcpURL, bytes.NewReader(body))
+    if err != nil {
+        return fmt.Errorf("failed to create HTTP request: %w", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("Accept", "application/json, text/event-stream")
+
+    resp, err := h.httpClient.Do(req)
+    if err != nil {
+        return fmt.Errorf("HTTP request failed: %w", err)
+    }
+    defer resp.Body.Close()
+
+    data, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return fmt.Errorf("failed to read response: %w", err)
+    }
+    if resp.StatusCode >= 300 {
+        return fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(data))
+    }
+    if out == nil || len(data) == 0 {
+        return nil
+    }
+
+    if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+        for _, line := range strings.Split(string(data), "\n") {
+            if strings.HasPrefix(line, "data:") {
+                data = []byte(strings.TrimSpace(line[5:]))
+                break
+            }
+        }
+    }
+
+    if err := json.Unmarshal(data, out); err != nil {
+        return fmt.Errorf("failed to unmarshal response: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,66 @@
+package lambda
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestHandleKeepsObjectParameterAsString(t *testing.T) {
+    var arguments map[string]interface{}
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var req struct {
+            ID     int    `json:"id"`
+            Method string `json:"method"`
+            Params struct {
+                Arguments map[string]interface{} `json:"arguments"`
+            } `json:"params"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+
+        var result interface{}
+        switch req.Method {
+        case "notifications/initialized":
+            w.WriteHeader(http.StatusAccepted)
+            return
+        case "initialize":
+            result = map[string]interface{}{"protocolVersion": "2024-11-05"}
+        case "tools/call":
+            arguments = req.Params.Arguments
+            result = map[string]interface{}{
+                "content": []map[string]interface{}{{"type": "text", "text": "ok"}},
+            }
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+    }))
+    defer server.Close()
+
+    filter := `{"status":"open","limit":10}`
+    response, err := NewHandler(server.URL).Handle(context.Background(), ActionEvent{
+        ActionGroup: "tickets",
+        Function:    "search_tickets",
+        Parameters: []ActionParameter{
+            {Name: "filter", Type: "object", Value: filter},
+            {Name: "limit", Type: "integer", Value: "10"},
+        },
+    })
+    if err != nil {
+        t.Fatalf("Handle failed: %v", err)
+    }
+    if state := response.Response.FunctionResponse.ResponseState; state != "" {
+        t.Fatalf("response state = %q, want success", state)
+    }
+
+    if got, ok := arguments["filter"].(string); !ok || got != filter {
+        t.Errorf("filter = %#v, want the string %q", arguments["filter"], filter)
+    }
+    if got, ok := arguments["limit"].(float64); !ok || got != 10 {
+        t.Errorf("limit = %#v, want 10", arguments["limit"])
+    }
+}
@@ -2,6 +2,7 @@ package main
 
 import (
     "context"
+    "flag"
     "log"
     "mcp-client-go/config"
     "mcp-client-go/mcp"
@@ -9,8 +10,15 @@ import (
 )
 
 func main() {
+    flag.Parse()
+
     ctx := context.Background()
-    cfg := config.Load()
+    cfg, err := config.Load()
+    if err != nil {
+        log.Fatalf("Failed to load config: %v", err)
+    }
+    log.Printf("Loaded config: %s", cfg)
+    cfg.WatchSecrets(ctx)
 
     // Start MCP server (streamable HTTP)
     mcpClient := mcp.NewClient(cfg.MCPURL)